@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// Namespace caches values under a hash of the parameters they were loaded
+// with. Every key includes the version of the namespace, Invalidate bumps
+// it so that all the values cached before are ignored and left to expire.
+type Namespace struct {
+	redis  *RedisConnection
+	name   string
+	ttl    time.Duration
+	logger *logrus.Logger
+	// group loads a missing value once when many requests ask for it at
+	// the same time, instead of all of them hitting the database
+	group *singleflight.Group
+}
+
+func NewNamespace(redis *RedisConnection, name string, ttl time.Duration, logger *logrus.Logger) *Namespace {
+	return &Namespace{
+		redis:  redis,
+		name:   name,
+		ttl:    ttl,
+		logger: logger,
+		group:  &singleflight.Group{},
+	}
+}
+
+func (n *Namespace) versionKey() string {
+	return n.name + ":version"
+}
+
+func (n *Namespace) version(ctx context.Context) (string, error) {
+	version, err := n.redis.Get(ctx, n.versionKey())
+	if err == redis.Nil {
+		return "0", nil
+	}
+	return string(version), err
+}
+
+// key returns the cache key of params, their JSON encoding is canonical as
+// long as params is a struct.
+func (n *Namespace) key(ctx context.Context, params interface{}) (string, error) {
+	version, err := n.version(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+
+	return fmt.Sprintf("%s:v%s:%s", n.name, version, hex.EncodeToString(sum[:])), nil
+}
+
+// Fetch decodes into value the value cached for params, or the one returned
+// by load which is then cached. It reports whether the value came from the
+// cache. Values are loaded without caching them when Redis fails.
+func (n *Namespace) Fetch(ctx context.Context, params interface{}, value interface{}, load func(ctx context.Context) (interface{}, error)) (bool, error) {
+	key, err := n.key(ctx, params)
+	if err != nil {
+		n.logger.WithError(err).WithField("namespace", n.name).Error("failed to read cache version")
+		return false, n.load(ctx, value, load)
+	}
+
+	cached, err := n.redis.Get(ctx, key)
+	if err == nil {
+		if err := json.Unmarshal(cached, value); err == nil {
+			return true, nil
+		}
+	} else if err != redis.Nil {
+		n.logger.WithError(err).WithField("namespace", n.name).Error("failed to read cache")
+	}
+
+	data, err, _ := n.group.Do(key, func() (interface{}, error) {
+		loaded, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(loaded)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := n.redis.Set(ctx, key, data, n.ttl); err != nil {
+			n.logger.WithError(err).WithField("namespace", n.name).Error("failed to write cache")
+		}
+		return data, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// every caller decodes its own copy of the shared result
+	return false, json.Unmarshal(data.([]byte), value)
+}
+
+func (n *Namespace) load(ctx context.Context, value interface{}, load func(ctx context.Context) (interface{}, error)) error {
+	loaded, err := load(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(loaded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Invalidate discards every value cached in the namespace.
+func (n *Namespace) Invalidate(ctx context.Context) error {
+	return n.redis.Incr(ctx, n.versionKey())
+}
@@ -28,6 +28,11 @@ func NewRedisConnection() *RedisConnection {
 	}
 }
 
+// NewRedisConnectionWithClient wraps a client configured by the caller.
+func NewRedisConnectionWithClient(client *redis.Client) *RedisConnection {
+	return &RedisConnection{client: client}
+}
+
 func (r *RedisConnection) Get(ctx context.Context, key string) ([]byte, error) {
 
 	result, err := r.client.Get(ctx, key).Result()
@@ -38,6 +43,14 @@ func (r *RedisConnection) Get(ctx context.Context, key string) ([]byte, error) {
 	return []byte(result), nil
 }
 
+func (r *RedisConnection) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *RedisConnection) Incr(ctx context.Context, key string) error {
+	return r.client.Incr(ctx, key).Err()
+}
+
 func (r *RedisConnection) Set(ctx context.Context, key string, value []byte, duration time.Duration) ([]byte, error) {
 
 	result, err := r.client.Set(ctx, key, bytes.NewBuffer(value).Bytes(), duration).Result()
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/fredele20/microservice-practice/ms.users/libs/ratelimit"
 	"github.com/joho/godotenv"
 )
 
@@ -12,6 +15,27 @@ type Secrets struct {
 	DatabaseName string `json:"DATABASE_NAME"`
 	Port         string
 	JWTSecret    string `json:"JWT_SECRET"`
+	// UsersServiceURL is the base url of ms.users internal API
+	UsersServiceURL string `json:"USERS_SERVICE_URL"`
+	ServiceToken    string `json:"SERVICE_TOKEN"`
+	RedisAddress    string `json:"REDIS_URL"`
+	// RateLimits overrides the default limit of routes, see
+	// ratelimit.ParseLimits for the format
+	RateLimits ratelimit.Limits `json:"RATE_LIMITS"`
+	// DefaultCurrency is the currency of the prices stored without one
+	DefaultCurrency string `json:"DEFAULT_CURRENCY"`
+	// PublicURL is the URL the service is reached at, product images are
+	// served from it
+	PublicURL string `json:"PUBLIC_URL"`
+	// BlobDir is the directory of the local blob store
+	BlobDir string `json:"BLOB_DIR"`
+	// PaymentProvider names the provider orders are paid through, only
+	// "fake" is available for now. Both settings are required
+	PaymentProvider      string `json:"PAYMENT_PROVIDER"`
+	PaymentWebhookSecret string `json:"PAYMENT_WEBHOOK_SECRET"`
+	// TrustedProxies are the comma separated IPs or CIDRs of the proxies
+	// allowed to forward the client IP, none by default
+	TrustedProxies []string `json:"TRUSTED_PROXIES"`
 }
 
 var ss Secrets
@@ -28,11 +52,45 @@ func init() {
 	ss.DatabaseURL = os.Getenv("DATABASE_URL")
 	ss.DatabaseName = os.Getenv("DATABASE_NAME")
 	ss.JWTSecret = os.Getenv("JWT_SECRET")
+	ss.UsersServiceURL = os.Getenv("USERS_SERVICE_URL")
+	ss.ServiceToken = os.Getenv("SERVICE_TOKEN")
+	ss.RedisAddress = fmt.Sprintf("%s:6379", os.Getenv("REDIS_URL"))
+
+	if ss.RateLimits, err = ratelimit.ParseLimits(os.Getenv("RATE_LIMITS")); err != nil {
+		log.Fatal(err)
+	}
 
 	if ss.Port = os.Getenv("PORT"); ss.Port == "" {
 		ss.Port = "80"
 	}
 
+	if ss.PublicURL = os.Getenv("PUBLIC_URL"); ss.PublicURL == "" {
+		ss.PublicURL = "http://127.0.0.1:" + ss.Port
+	}
+
+	if ss.BlobDir = os.Getenv("BLOB_DIR"); ss.BlobDir == "" {
+		ss.BlobDir = "uploads"
+	}
+
+	// the fake provider approves every payment, it is never picked by
+	// default, and unsigned webhooks are never accepted
+	if ss.PaymentProvider = os.Getenv("PAYMENT_PROVIDER"); ss.PaymentProvider == "" {
+		log.Fatal("PAYMENT_PROVIDER is required, set it to fake for local runs")
+	}
+	if ss.PaymentWebhookSecret = os.Getenv("PAYMENT_WEBHOOK_SECRET"); ss.PaymentWebhookSecret == "" {
+		log.Fatal("PAYMENT_WEBHOOK_SECRET is required")
+	}
+
+	if ss.DefaultCurrency = strings.ToUpper(os.Getenv("DEFAULT_CURRENCY")); ss.DefaultCurrency == "" {
+		ss.DefaultCurrency = "USD"
+	}
+
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			ss.TrustedProxies = append(ss.TrustedProxies, proxy)
+		}
+	}
+
 }
 
 func GetSecrets() Secrets {
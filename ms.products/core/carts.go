@@ -0,0 +1,609 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidCartId    = errors.New("invalid cart id")
+	ErrCartItemNotFound = errors.New("cart item not found")
+	ErrCartFull         = errors.New("a cart can not hold more than 50 items")
+	ErrCartEmpty        = errors.New("the cart is empty")
+	ErrCartUnavailable  = errors.New("some items of the cart can not be bought, check their issue")
+	ErrCartChanged      = errors.New("the totals of the cart changed, review it and try again")
+	ErrCartConflict     = errors.New("the cart was changed by another request, try again")
+	ErrCheckoutRunning  = errors.New("the cart is being checked out, try again once it is done")
+	ErrGetCartFailed    = errors.New("failed to get cart")
+	ErrSaveCartFailed   = errors.New("failed to save cart")
+	ErrCheckoutFailed   = errors.New("failed to checkout cart")
+)
+
+const (
+	// maxCartItems must match ErrCartFull
+	maxCartItems = 50
+
+	// carts expire once they were not changed for their TTL
+	userCartTTL      = time.Hour * 24 * 30
+	anonymousCartTTL = time.Hour * 24 * 7
+
+	// maxCartAttempts bounds how often a change is applied again to a cart
+	// saved by another request meanwhile
+	maxCartAttempts = 3
+	// checkoutTimeout is how long a checkout holds its cart, longer than
+	// the requests placing the orders can last
+	checkoutTimeout = time.Minute
+)
+
+// errNothingToMerge stops the merge of an empty anonymous cart.
+var errNothingToMerge = errors.New("nothing to merge")
+
+// cartKey returns the key of the cart of actor, or of the anonymous cart
+// cartId when nobody is signed in. It is empty for an anonymous visitor
+// without a cart.
+func cartKey(actor models.Actor, cartId string) (string, error) {
+	if actor.UserId != "" {
+		return "user:" + actor.UserId, nil
+	}
+	if cartId == "" {
+		return "", nil
+	}
+	if decoded, err := hex.DecodeString(cartId); err != nil || len(decoded) != 16 {
+		return "", ErrInvalidCartId
+	}
+	return "anon:" + cartId, nil
+}
+
+// newCartId returns the token of a new anonymous cart, it can not be
+// guessed since it is all that protects the cart.
+func newCartId() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func redisCartKey(key string) string {
+	return "carts:" + key
+}
+
+// loadCart reads a cart from redis, and from mongo when redis misses it or
+// fails. It returns nil when there is no cart.
+func (p ProductService) loadCart(ctx context.Context, key string) (*models.Cart, error) {
+	data, err := p.redis.Get(ctx, redisCartKey(key))
+	if err == nil {
+		var cart models.Cart
+		if err := json.Unmarshal(data, &cart); err == nil {
+			cart.Key = key
+			return &cart, nil
+		}
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		p.logger.WithError(err).Error("failed to read cart from redis")
+	}
+
+	cart, err := p.db.GetCart(ctx, key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// mongo deletes expired carts about every minute
+	if cart.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+
+	p.cacheCart(ctx, cart)
+	return cart, nil
+}
+
+func (p ProductService) cacheCart(ctx context.Context, cart *models.Cart) error {
+	data, err := json.Marshal(cart)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.redis.Set(ctx, redisCartKey(cart.Key), data, time.Until(cart.ExpiresAt))
+	return err
+}
+
+// saveCart pushes back the expiry of cart and saves it as its next
+// version in mongo, then caches it in redis. It fails with ErrCartConflict
+// when the cart was saved meanwhile, the copy in redis is then dropped so
+// that the cart is read again from mongo.
+func (p ProductService) saveCart(ctx context.Context, cart *models.Cart) error {
+	ttl := anonymousCartTTL
+	if cart.UserId != "" {
+		ttl = userCartTTL
+	}
+	cart.UpdatedAt = time.Now()
+	cart.ExpiresAt = cart.UpdatedAt.Add(ttl)
+	cart.Version++
+
+	stored := cart.Stored()
+	if err := p.db.SaveCart(ctx, stored); err != nil {
+		cart.Version--
+		if err := p.redis.Delete(ctx, redisCartKey(cart.Key)); err != nil {
+			p.logger.WithError(err).Error("failed to delete cart from redis")
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrCartConflict
+		}
+		return err
+	}
+
+	if err := p.cacheCart(ctx, stored); err != nil {
+		p.logger.WithError(err).Error("failed to write cart to redis")
+		// an older copy must not be read back once redis recovers
+		p.redis.Delete(ctx, redisCartKey(cart.Key))
+	}
+
+	return nil
+}
+
+// changeCart applies change to the cart of actor, or to the anonymous cart
+// cartId, and saves it. When the cart was saved by another request
+// meanwhile, change is applied again to the current cart. Carts can not be
+// changed while they are checked out.
+func (p ProductService) changeCart(ctx context.Context, actor models.Actor, cartId string, change func(cart *models.Cart) error) (*models.Cart, error) {
+	for attempt := 1; ; attempt++ {
+		cart, err := p.openCart(ctx, actor, cartId)
+		if err != nil {
+			return nil, err
+		}
+		if checkingOut(cart) {
+			return nil, ErrCheckoutRunning
+		}
+		if err := change(cart); err != nil {
+			return nil, err
+		}
+
+		err = p.saveCart(ctx, cart)
+		switch {
+		case err == nil:
+			return cart, nil
+		case errors.Is(err, ErrCartConflict):
+			if attempt < maxCartAttempts {
+				continue
+			}
+			return nil, ErrCartConflict
+		}
+		p.logger.WithError(err).Error(ErrSaveCartFailed.Error())
+		return nil, ErrSaveCartFailed
+	}
+}
+
+// checkingOut reports whether cart is held by a checkout.
+func checkingOut(cart *models.Cart) bool {
+	return cart.CheckoutUntil != nil && cart.CheckoutUntil.After(time.Now())
+}
+
+func (p ProductService) deleteCart(ctx context.Context, key string) error {
+	if err := p.redis.Delete(ctx, redisCartKey(key)); err != nil {
+		p.logger.WithError(err).Error("failed to delete cart from redis")
+	}
+	return p.db.DeleteCart(ctx, key)
+}
+
+// openCart returns the cart of actor or the anonymous cart cartId, and a
+// new empty cart when there is none yet.
+func (p ProductService) openCart(ctx context.Context, actor models.Actor, cartId string) (*models.Cart, error) {
+	key, err := cartKey(actor, cartId)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		cart, err := p.loadCart(ctx, key)
+		if err != nil {
+			p.logger.WithError(err).Error(ErrGetCartFailed.Error())
+			return nil, ErrGetCartFailed
+		}
+		if cart != nil {
+			return cart, nil
+		}
+	}
+
+	cart := &models.Cart{Key: key, UserId: actor.UserId, Items: []*models.CartItem{}}
+	if actor.UserId == "" {
+		cart.CartId = cartId
+	}
+	return cart, nil
+}
+
+// revalidate reads the current price and stock of the items of cart, and
+// flags the items that can not be bought as they are.
+func (p ProductService) revalidate(ctx context.Context, cart *models.Cart, buyerId string) error {
+	productIds := make([]string, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		productIds = append(productIds, item.ProductId)
+	}
+
+	products := map[string]*models.Product{}
+	if len(productIds) > 0 {
+		found, err := p.db.GetProductsByIds(ctx, productIds)
+		if err != nil {
+			return err
+		}
+		for _, product := range found {
+			products[product.ProductID] = product
+		}
+	}
+
+	cart.Totals = []models.Money{}
+	cart.Checkout = len(cart.Items) > 0
+	for _, item := range cart.Items {
+		revalidateItem(item, products[item.ProductId], buyerId)
+
+		if item.Issue.Blocking() {
+			cart.Checkout = false
+			continue
+		}
+		if item.Total != nil {
+			cart.Totals = models.AddTotal(cart.Totals, *item.Total)
+		}
+	}
+
+	return nil
+}
+
+func revalidateItem(item *models.CartItem, product *models.Product, buyerId string) {
+	item.Issue, item.Available = "", 0
+	if product == nil {
+		item.Issue = models.CartItemUnavailable
+		return
+	}
+
+	item.Name, item.SellerId = stringValue(product.Name), product.OwnerID
+	variant, err := product.PickVariant(item.VariantId)
+	if err != nil {
+		item.Issue = models.CartItemUnavailable
+		return
+	}
+
+	if variant != nil {
+		item.SKU, item.Options = variant.SKU, variant.Options
+	}
+	if image := product.PrimaryImage(); image != nil {
+		item.Image = image.URLs["thumb"]
+	}
+	item.Available = product.Stock(variant)
+	item.UnitPrice = product.PriceOf(variant)
+	if item.UnitPrice != nil {
+		total := item.UnitPrice.Mul(int64(item.Quantity))
+		item.Total = &total
+	}
+
+	switch {
+	case item.UnitPrice == nil:
+		item.Issue = models.CartItemUnavailable
+	case buyerId != "" && product.OwnerID == buyerId:
+		item.Issue = models.CartItemOwnProduct
+	case item.Available < item.Quantity:
+		item.Issue = models.CartItemInsufficientStock
+	case item.AddedPrice != nil && item.UnitPrice != nil && *item.AddedPrice != *item.UnitPrice:
+		item.Issue = models.CartItemPriceChanged
+	}
+}
+
+// cartView revalidates cart before it is returned.
+func (p ProductService) cartView(ctx context.Context, cart *models.Cart, buyerId string) (*models.Cart, error) {
+	if err := p.revalidate(ctx, cart, buyerId); err != nil {
+		p.logger.WithError(err).Error(ErrGetCartFailed.Error())
+		return nil, ErrGetCartFailed
+	}
+	return cart, nil
+}
+
+// GetCart returns the cart of actor, or the anonymous cart cartId, with the
+// current price and stock of its items.
+func (p ProductService) GetCart(ctx context.Context, actor models.Actor, cartId string) (*models.Cart, error) {
+	cart, err := p.openCart(ctx, actor, cartId)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.cartView(ctx, cart, actor.UserId)
+}
+
+// AddCartItem adds a product to a cart, or adds to the quantity of the item
+// already holding it. A new anonymous cart is created for a visitor without
+// one, its CartId must be sent back with the next requests.
+func (p ProductService) AddCartItem(ctx context.Context, actor models.Actor, cartId string, payload models.AddCartItemRequest) (*models.Cart, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	product, err := p.GetProductById(ctx, payload.ProductId)
+	if err != nil {
+		return nil, err
+	}
+	if actor.UserId != "" && product.OwnerID == actor.UserId {
+		return nil, ErrOwnProductPurchase
+	}
+
+	variant, err := product.PickVariant(payload.VariantId)
+	if err != nil {
+		return nil, err
+	}
+	if product.PriceOf(variant) == nil {
+		return nil, ErrProductNotPriced
+	}
+
+	if actor.UserId == "" && cartId == "" {
+		if cartId, err = newCartId(); err != nil {
+			p.logger.WithError(err).Error(ErrSaveCartFailed.Error())
+			return nil, ErrSaveCartFailed
+		}
+	}
+
+	cart, err := p.changeCart(ctx, actor, cartId, func(cart *models.Cart) error {
+		item := cart.Line(product.ProductID, payload.VariantId)
+		if item == nil {
+			if len(cart.Items) >= maxCartItems {
+				return ErrCartFull
+			}
+			item = &models.CartItem{
+				ItemId:    primitive.NewObjectID().Hex(),
+				ProductId: product.ProductID,
+				VariantId: payload.VariantId,
+				AddedAt:   time.Now(),
+			}
+			cart.Items = append(cart.Items, item)
+		}
+
+		if item.Quantity+payload.Quantity > product.Stock(variant) {
+			return ErrInsufficientStock
+		}
+		item.Quantity += payload.Quantity
+		item.AddedPrice = product.PriceOf(variant)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.cartView(ctx, cart, actor.UserId)
+}
+
+// UpdateCartItem changes the quantity of an item, the item then takes the
+// current price of its product. A quantity of 0 removes the item.
+func (p ProductService) UpdateCartItem(ctx context.Context, actor models.Actor, cartId, itemId string, payload models.UpdateCartItemRequest) (*models.Cart, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	if payload.Quantity == 0 {
+		return p.RemoveCartItem(ctx, actor, cartId, itemId)
+	}
+
+	cart, err := p.changeCart(ctx, actor, cartId, func(cart *models.Cart) error {
+		item := cart.Item(itemId)
+		if item == nil {
+			return ErrCartItemNotFound
+		}
+
+		product, err := p.GetProductById(ctx, item.ProductId)
+		if err != nil {
+			return err
+		}
+		variant, err := product.PickVariant(item.VariantId)
+		if err != nil {
+			return err
+		}
+
+		if payload.Quantity > product.Stock(variant) {
+			return ErrInsufficientStock
+		}
+		item.Quantity = payload.Quantity
+		item.AddedPrice = product.PriceOf(variant)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.cartView(ctx, cart, actor.UserId)
+}
+
+func (p ProductService) RemoveCartItem(ctx context.Context, actor models.Actor, cartId, itemId string) (*models.Cart, error) {
+	cart, err := p.changeCart(ctx, actor, cartId, func(cart *models.Cart) error {
+		if cart.Item(itemId) == nil {
+			return ErrCartItemNotFound
+		}
+		items := make([]*models.CartItem, 0, len(cart.Items)-1)
+		for _, item := range cart.Items {
+			if item.ItemId != itemId {
+				items = append(items, item)
+			}
+		}
+		cart.Items = items
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.cartView(ctx, cart, actor.UserId)
+}
+
+// ClearCart removes every item of a cart.
+func (p ProductService) ClearCart(ctx context.Context, actor models.Actor, cartId string) error {
+	key, err := cartKey(actor, cartId)
+	if err != nil || key == "" {
+		return err
+	}
+
+	cart, err := p.openCart(ctx, actor, cartId)
+	if err != nil {
+		return err
+	}
+	if checkingOut(cart) {
+		return ErrCheckoutRunning
+	}
+
+	if err := p.deleteCart(ctx, key); err != nil {
+		p.logger.WithError(err).Error(ErrSaveCartFailed.Error())
+		return ErrSaveCartFailed
+	}
+
+	return nil
+}
+
+// MergeCart moves the items of the anonymous cart cartId into the cart of
+// user, it is called once a visitor signs in. The quantities of the items
+// held by both carts are added up, items beyond the size of a cart are
+// dropped. The items are taken out of the anonymous cart first, so that
+// they are merged once when the merge is sent again.
+func (p ProductService) MergeCart(ctx context.Context, user models.Actor, cartId string) (*models.Cart, error) {
+	var items []*models.CartItem
+	anonymous, err := p.changeCart(ctx, models.Actor{}, cartId, func(cart *models.Cart) error {
+		if len(cart.Items) == 0 {
+			return errNothingToMerge
+		}
+		items, cart.Items = cart.Items, []*models.CartItem{}
+		return nil
+	})
+	if errors.Is(err, errNothingToMerge) {
+		return p.GetCart(ctx, user, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := p.changeCart(ctx, user, "", func(cart *models.Cart) error {
+		for _, item := range items {
+			if line := cart.Line(item.ProductId, item.VariantId); line != nil {
+				line.Quantity += item.Quantity
+				continue
+			}
+			if len(cart.Items) < maxCartItems {
+				cart.Items = append(cart.Items, item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// the items go back to the anonymous cart to be merged again
+		if _, err := p.changeCart(ctx, models.Actor{}, cartId, func(cart *models.Cart) error {
+			cart.Items = append(cart.Items, items...)
+			return nil
+		}); err != nil {
+			p.logger.WithError(err).Error("failed to restore the items of a cart that was not merged")
+		}
+		return nil, err
+	}
+
+	if err := p.deleteCart(ctx, anonymous.Key); err != nil {
+		p.logger.WithError(err).Error("failed to delete merged cart")
+	}
+
+	return p.cartView(ctx, cart, user.UserId)
+}
+
+// Checkout buys every item of the cart of buyer in a single order, each
+// seller then handles their own items of it. The order is placed entirely
+// or not at all. The cart is held while it is checked out, a second
+// checkout of the same cart is refused with ErrCheckoutRunning.
+func (p ProductService) Checkout(ctx context.Context, buyer models.Actor, payload models.CheckoutRequest) (*models.Order, error) {
+	cart, err := p.holdCart(ctx, buyer)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := p.checkout(ctx, buyer, cart, payload)
+	if err != nil {
+		// the cart is left as it was
+		cart.CheckoutUntil = nil
+		if err := p.saveCart(ctx, cart); err != nil {
+			p.logger.WithError(err).Error("failed to release a cart that was not checked out")
+		}
+		return nil, err
+	}
+
+	if err := p.deleteCart(ctx, cart.Key); err != nil {
+		p.logger.WithError(err).Error("failed to delete checked out cart")
+	}
+
+	p.invalidateProducts(ctx)
+	return order, nil
+}
+
+// holdCart marks the cart of buyer as checked out until checkoutTimeout,
+// the cart can not be changed or checked out again until it is released.
+func (p ProductService) holdCart(ctx context.Context, buyer models.Actor) (*models.Cart, error) {
+	for attempt := 1; ; attempt++ {
+		cart, err := p.openCart(ctx, buyer, "")
+		if err != nil {
+			return nil, err
+		}
+		if checkingOut(cart) {
+			return nil, ErrCheckoutRunning
+		}
+		if len(cart.Items) == 0 {
+			return nil, ErrCartEmpty
+		}
+
+		until := time.Now().Add(checkoutTimeout)
+		cart.CheckoutUntil = &until
+		err = p.saveCart(ctx, cart)
+		switch {
+		case err == nil:
+			return cart, nil
+		case errors.Is(err, ErrCartConflict):
+			if attempt < maxCartAttempts {
+				continue
+			}
+			return nil, ErrCartConflict
+		}
+		p.logger.WithError(err).Error(ErrCheckoutFailed.Error())
+		return nil, ErrCheckoutFailed
+	}
+}
+
+// checkout places the order of cart, held by holdCart.
+func (p ProductService) checkout(ctx context.Context, buyer models.Actor, cart *models.Cart, payload models.CheckoutRequest) (*models.Order, error) {
+	if _, err := p.cartView(ctx, cart, buyer.UserId); err != nil {
+		return nil, err
+	}
+	if !cart.Checkout {
+		return nil, ErrCartUnavailable
+	}
+	if payload.ExpectedTotals != nil && !models.SameTotals(payload.ExpectedTotals, cart.Totals) {
+		return nil, ErrCartChanged
+	}
+
+	lines := make([]orderLine, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		lines = append(lines, orderLine{productId: item.ProductId, variantId: item.VariantId, quantity: item.Quantity})
+	}
+
+	// placeOrder undoes what it reserved when it fails, so the order is
+	// placed entirely or not at all even without transactions
+	var order *models.Order
+	err := p.db.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		order, _, err = p.placeOrder(ctx, buyer, lines)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrProductNotPriced) {
+			return nil, err
+		}
+		p.logger.WithError(err).Error(ErrCheckoutFailed.Error())
+		return nil, ErrCheckoutFailed
+	}
+
+	return order, nil
+}
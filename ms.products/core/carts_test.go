@@ -0,0 +1,222 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/cache"
+	"github.com/fredele20/microservice-practice/ms.products/database"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// cartStore keeps carts in memory with the version check of the mongo
+// store, the other store methods are not used by these tests.
+type cartStore struct {
+	database.DBInterface
+	carts map[string]*models.Cart
+	// beforeSave runs once before the next save, to change the cart
+	// concurrently
+	beforeSave func(s *cartStore)
+}
+
+func (s *cartStore) GetCart(ctx context.Context, key string) (*models.Cart, error) {
+	cart, ok := s.carts[key]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return cart.Stored(), nil
+}
+
+func (s *cartStore) SaveCart(ctx context.Context, cart *models.Cart) error {
+	if s.beforeSave != nil {
+		before := s.beforeSave
+		s.beforeSave = nil
+		before(s)
+	}
+	if current, ok := s.carts[cart.Key]; ok && current.Version != cart.Version-1 {
+		return mongo.ErrNoDocuments
+	}
+	s.carts[cart.Key] = cart.Stored()
+	return nil
+}
+
+func (s *cartStore) DeleteCart(ctx context.Context, key string) error {
+	delete(s.carts, key)
+	return nil
+}
+
+func (s *cartStore) GetProductsByIds(ctx context.Context, productIds []string) ([]*models.Product, error) {
+	products := []*models.Product{}
+	for _, id := range productIds {
+		name := id
+		products = append(products, &models.Product{ProductID: id, Name: &name, OwnerID: "seller", Quantity: 10})
+	}
+	return products, nil
+}
+
+// newTestService returns a service on store whose redis can not be
+// reached, like a service running through an outage of redis.
+func newTestService(t *testing.T, store database.DBInterface) *ProductService {
+	t.Helper()
+	connection := cache.NewRedisConnectionWithClient(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}))
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewProductService(store, logger, *connection, nil, nil, nil, nil)
+}
+
+func cartWith(key string, version int64, items ...*models.CartItem) *models.Cart {
+	cart := &models.Cart{Key: key, Items: items, Version: version, ExpiresAt: time.Now().Add(time.Hour)}
+	if strings.HasPrefix(key, "user:") {
+		cart.UserId = strings.TrimPrefix(key, "user:")
+	}
+	return cart
+}
+
+func quantities(cart *models.Cart) map[string]int {
+	result := map[string]int{}
+	for _, item := range cart.Items {
+		result[item.ProductId] += item.Quantity
+	}
+	return result
+}
+
+func TestMergeCartOnce(t *testing.T) {
+	const cartId = "0123456789abcdef0123456789abcdef"
+	store := &cartStore{carts: map[string]*models.Cart{
+		"anon:" + cartId: cartWith("anon:"+cartId, 1,
+			&models.CartItem{ItemId: "1", ProductId: "p1", Quantity: 2},
+			&models.CartItem{ItemId: "2", ProductId: "p2", Quantity: 1},
+		),
+		"user:buyer": cartWith("user:buyer", 4, &models.CartItem{ItemId: "3", ProductId: "p1", Quantity: 1}),
+	}}
+	service := newTestService(t, store)
+	buyer := models.Actor{UserId: "buyer"}
+
+	for i := 0; i < 2; i++ {
+		cart, err := service.MergeCart(context.Background(), buyer, cartId)
+		if err != nil {
+			t.Fatalf("merge %d: MergeCart() error = %v", i+1, err)
+		}
+		if got := quantities(cart); got["p1"] != 3 || got["p2"] != 1 || len(got) != 2 {
+			t.Errorf("merge %d: quantities = %v, want p1: 3, p2: 1", i+1, got)
+		}
+	}
+
+	if _, ok := store.carts["anon:"+cartId]; ok {
+		t.Error("the anonymous cart was not deleted")
+	}
+	if got := store.carts["user:buyer"].Version; got != 5 {
+		t.Errorf("version = %d, want 5", got)
+	}
+}
+
+func TestChangeCart(t *testing.T) {
+	addItem := func(cart *models.Cart) error {
+		cart.Items = append(cart.Items, &models.CartItem{ItemId: "new", ProductId: "p2", Quantity: 1})
+		return nil
+	}
+	// concurrentSave saves the cart from another request, times times
+	var concurrentSave func(times int) func(s *cartStore)
+	concurrentSave = func(times int) func(s *cartStore) {
+		return func(s *cartStore) {
+			cart := s.carts["user:buyer"]
+			cart.Items[0].Quantity++
+			cart.Version++
+			if times > 1 {
+				s.beforeSave = concurrentSave(times - 1)
+			}
+		}
+	}
+	until := time.Now().Add(time.Minute)
+	expired := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name          string
+		checkoutUntil *time.Time
+		beforeSave    func(s *cartStore)
+		want          map[string]int
+		wantErr       error
+	}{
+		{name: "saved", want: map[string]int{"p1": 1, "p2": 1}},
+		{name: "saved meanwhile", beforeSave: concurrentSave(1), want: map[string]int{"p1": 2, "p2": 1}},
+		{name: "saved meanwhile every time", beforeSave: concurrentSave(maxCartAttempts), wantErr: ErrCartConflict},
+		{name: "checked out", checkoutUntil: &until, wantErr: ErrCheckoutRunning},
+		{name: "checkout timed out", checkoutUntil: &expired, want: map[string]int{"p1": 1, "p2": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart := cartWith("user:buyer", 1, &models.CartItem{ItemId: "1", ProductId: "p1", Quantity: 1})
+			cart.CheckoutUntil = tt.checkoutUntil
+			store := &cartStore{carts: map[string]*models.Cart{cart.Key: cart}, beforeSave: tt.beforeSave}
+			service := newTestService(t, store)
+
+			_, err := service.changeCart(context.Background(), models.Actor{UserId: "buyer"}, "", addItem)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("changeCart() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got := quantities(store.carts[cart.Key]); len(got) != len(tt.want) || got["p1"] != tt.want["p1"] || got["p2"] != tt.want["p2"] {
+				t.Errorf("stored quantities = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckoutHoldsCart(t *testing.T) {
+	cart := cartWith("user:buyer", 1, &models.CartItem{ItemId: "1", ProductId: "p1", Quantity: 1})
+	store := &cartStore{carts: map[string]*models.Cart{cart.Key: cart}}
+	service := newTestService(t, store)
+	buyer := models.Actor{UserId: "buyer"}
+
+	held, err := service.holdCart(context.Background(), buyer)
+	if err != nil {
+		t.Fatalf("holdCart() error = %v", err)
+	}
+	if held.CheckoutUntil == nil || store.carts[cart.Key].CheckoutUntil == nil {
+		t.Fatal("the cart was not held")
+	}
+
+	if _, err := service.Checkout(context.Background(), buyer, models.CheckoutRequest{}); !errors.Is(err, ErrCheckoutRunning) {
+		t.Errorf("Checkout() error = %v, want %v", err, ErrCheckoutRunning)
+	}
+	if err := service.ClearCart(context.Background(), buyer, ""); !errors.Is(err, ErrCheckoutRunning) {
+		t.Errorf("ClearCart() error = %v, want %v", err, ErrCheckoutRunning)
+	}
+}
+
+func TestRevalidateItem(t *testing.T) {
+	name, price := "Lamp", models.NewMoney(1500, "USD")
+
+	tests := []struct {
+		name    string
+		price   *models.Money
+		buyerId string
+		want    models.CartIssue
+	}{
+		{name: "available", price: &price, buyerId: "buyer"},
+		// legacy prices that could not be read decode to nil
+		{name: "without a price", buyerId: "buyer", want: models.CartItemUnavailable},
+		{name: "own product", price: &price, buyerId: "seller", want: models.CartItemOwnProduct},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := &models.Product{ProductID: "lamp", Name: &name, Price: tt.price, Quantity: 5, OwnerID: "seller"}
+			item := &models.CartItem{ProductId: "lamp", Quantity: 2}
+
+			revalidateItem(item, product, tt.buyerId)
+			if item.Issue != tt.want {
+				t.Errorf("issue = %q, want %q", item.Issue, tt.want)
+			}
+		})
+	}
+}
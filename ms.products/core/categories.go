@@ -0,0 +1,334 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrAdminOnly            = errors.New("only an admin can do this")
+	ErrCategoryNotFound     = errors.New("category not found")
+	ErrCategorySlugTaken    = errors.New("a category with this slug already exists")
+	ErrCategoryCycle        = errors.New("a category can not be moved under itself or one of its descendants")
+	ErrCategoryHasChildren  = errors.New("a category with sub categories can not be deleted, move or delete them first")
+	ErrUnknownCategory      = errors.New("one of the categories does not exist")
+	ErrCreateCategoryFailed = errors.New("failed to create category")
+	ErrUpdateCategoryFailed = errors.New("failed to update category")
+	ErrDeleteCategoryFailed = errors.New("failed to delete category")
+	ErrListCategoriesFailed = errors.New("failed to list categories")
+)
+
+func (p ProductService) listCategories(ctx context.Context) (map[string]*models.Category, error) {
+	categories, err := p.db.ListCategories(ctx)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrListCategoriesFailed.Error())
+		return nil, ErrListCategoriesFailed
+	}
+
+	byId := make(map[string]*models.Category, len(categories))
+	for _, category := range categories {
+		byId[category.CategoryId] = category
+	}
+	return byId, nil
+}
+
+// findCategory returns the category of id or slug.
+func (p ProductService) findCategory(ctx context.Context, idOrSlug string) (*models.Category, error) {
+	category, err := p.db.GetCategory(ctx, idOrSlug)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		category, err = p.db.GetCategoryBySlug(ctx, idOrSlug)
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCategoryNotFound
+		}
+		p.logger.WithError(err).Error(ErrListCategoriesFailed.Error())
+		return nil, ErrListCategoriesFailed
+	}
+
+	return category, nil
+}
+
+// descendants returns the ids of categoryId and of every category under it.
+func descendants(categories map[string]*models.Category, categoryId string) []string {
+	ids := []string{categoryId}
+	for id, category := range categories {
+		for _, ancestor := range category.Path {
+			if ancestor == categoryId {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func breadcrumbs(categories map[string]*models.Category, category *models.Category) []models.Breadcrumb {
+	crumbs := make([]models.Breadcrumb, 0, len(category.Path)+1)
+	for _, id := range append(append([]string{}, category.Path...), category.CategoryId) {
+		if ancestor, ok := categories[id]; ok {
+			crumbs = append(crumbs, models.Breadcrumb{CategoryId: ancestor.CategoryId, Name: ancestor.Name, Slug: ancestor.Slug})
+		}
+	}
+	return crumbs
+}
+
+// checkCategories returns categoryIds without duplicates, they must all
+// exist.
+func (p ProductService) checkCategories(ctx context.Context, categoryIds []string) ([]string, error) {
+	if len(categoryIds) == 0 {
+		return []string{}, nil
+	}
+
+	categories, err := p.listCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, id := range categoryIds {
+		if _, ok := categories[id]; !ok {
+			return nil, ErrUnknownCategory
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// attachBreadcrumbs sets the breadcrumbs of the categories of products.
+func (p ProductService) attachBreadcrumbs(ctx context.Context, products []*models.Product) {
+	listed := false
+	for _, product := range products {
+		if len(product.Categories) > 0 {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return
+	}
+
+	categories, err := p.listCategories(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, product := range products {
+		product.Breadcrumbs = nil
+		for _, id := range product.Categories {
+			if category, ok := categories[id]; ok {
+				product.Breadcrumbs = append(product.Breadcrumbs, breadcrumbs(categories, category))
+			}
+		}
+	}
+}
+
+func (p ProductService) CreateCategory(ctx context.Context, actor models.Actor, payload models.CreateCategoryRequest) (*models.Category, error) {
+	if !actor.IsAdmin() {
+		return nil, ErrAdminOnly
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Slug == "" {
+		payload.Slug = models.Slugify(payload.Name)
+	}
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	id := primitive.NewObjectID()
+	category := &models.Category{
+		ID:         id,
+		CategoryId: id.Hex(),
+		Name:       payload.Name,
+		Slug:       payload.Slug,
+		Path:       []string{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if payload.ParentId != nil && *payload.ParentId != "" {
+		parent, err := p.findCategory(ctx, *payload.ParentId)
+		if err != nil {
+			return nil, err
+		}
+		category.ParentId = &parent.CategoryId
+		category.Path = append(append([]string{}, parent.Path...), parent.CategoryId)
+	}
+
+	created, err := p.db.CreateCategory(ctx, category)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrCategorySlugTaken
+		}
+		p.logger.WithError(err).Error(ErrCreateCategoryFailed.Error())
+		return nil, ErrCreateCategoryFailed
+	}
+
+	return created, nil
+}
+
+// UpdateCategory renames a category or moves it under another parent, the
+// paths of its descendants follow it.
+func (p ProductService) UpdateCategory(ctx context.Context, actor models.Actor, categoryId string, payload models.UpdateCategoryRequest) (*models.Category, error) {
+	if !actor.IsAdmin() {
+		return nil, ErrAdminOnly
+	}
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	categories, err := p.listCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	category, ok := categories[categoryId]
+	if !ok {
+		return nil, ErrCategoryNotFound
+	}
+
+	if payload.Name != nil {
+		category.Name = strings.TrimSpace(*payload.Name)
+	}
+	if payload.Slug != nil {
+		category.Slug = *payload.Slug
+	}
+
+	moved := map[string][]string{}
+	if payload.ParentId != nil {
+		oldLength := len(category.Path)
+		if *payload.ParentId == "" {
+			category.ParentId, category.Path = nil, []string{}
+		} else {
+			parent, ok := categories[*payload.ParentId]
+			if !ok {
+				return nil, ErrCategoryNotFound
+			}
+			for _, id := range descendants(categories, categoryId) {
+				if id == parent.CategoryId {
+					return nil, ErrCategoryCycle
+				}
+			}
+			category.ParentId = &parent.CategoryId
+			category.Path = append(append([]string{}, parent.Path...), parent.CategoryId)
+		}
+
+		// descendants keep the part of their path below category
+		for _, id := range descendants(categories, categoryId)[1:] {
+			below := categories[id].Path[oldLength:]
+			moved[id] = append(append([]string{}, category.Path...), below...)
+		}
+	}
+
+	var updated *models.Category
+	err = p.db.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if updated, err = p.db.UpdateCategory(ctx, category); err != nil {
+			return err
+		}
+		for id, path := range moved {
+			if err := p.db.SetCategoryPath(ctx, id, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrCategorySlugTaken
+		}
+		p.logger.WithError(err).Error(ErrUpdateCategoryFailed.Error())
+		return nil, ErrUpdateCategoryFailed
+	}
+
+	p.invalidateProducts(ctx)
+	return updated, nil
+}
+
+// DeleteCategory deletes a category without sub categories, its products
+// are no longer listed in it.
+func (p ProductService) DeleteCategory(ctx context.Context, actor models.Actor, categoryId string) error {
+	if !actor.IsAdmin() {
+		return ErrAdminOnly
+	}
+
+	categories, err := p.listCategories(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := categories[categoryId]; !ok {
+		return ErrCategoryNotFound
+	}
+	if len(descendants(categories, categoryId)) > 1 {
+		return ErrCategoryHasChildren
+	}
+
+	if err := p.db.WithTransaction(ctx, func(ctx context.Context) error {
+		return p.db.DeleteCategory(ctx, categoryId)
+	}); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrCategoryNotFound
+		}
+		p.logger.WithError(err).Error(ErrDeleteCategoryFailed.Error())
+		return ErrDeleteCategoryFailed
+	}
+
+	p.invalidateProducts(ctx)
+	return nil
+}
+
+// GetCategory returns the category of id or slug with its breadcrumbs.
+func (p ProductService) GetCategory(ctx context.Context, idOrSlug string) (*models.Category, error) {
+	category, err := p.findCategory(ctx, idOrSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := p.listCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	category.Breadcrumbs = breadcrumbs(categories, category)
+
+	return category, nil
+}
+
+// CategoryTree returns the root categories with their descendants.
+func (p ProductService) CategoryTree(ctx context.Context) ([]*models.CategoryNode, error) {
+	categories, err := p.db.ListCategories(ctx)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrListCategoriesFailed.Error())
+		return nil, ErrListCategoriesFailed
+	}
+
+	nodes := make(map[string]*models.CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.CategoryId] = &models.CategoryNode{Category: category, Children: []*models.CategoryNode{}}
+	}
+
+	// categories are sorted by name, so are the children of every node
+	roots := []*models.CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.CategoryId]
+		if category.ParentId == nil {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := nodes[*category.ParentId]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	return roots, nil
+}
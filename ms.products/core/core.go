@@ -2,34 +2,53 @@ package core
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/fredele20/microservice-practice/ms.products/cache"
 	"github.com/fredele20/microservice-practice/ms.products/database"
+	"github.com/fredele20/microservice-practice/ms.products/images"
 	"github.com/fredele20/microservice-practice/ms.products/models"
-	"github.com/go-redis/redis/v8"
+	"github.com/fredele20/microservice-practice/ms.products/payments"
+	"github.com/fredele20/microservice-practice/ms.products/search"
+	"github.com/fredele20/microservice-practice/ms.users/libs/userclient"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ProductService struct {
-	db database.DBInterface
+	db     database.DBInterface
 	logger *logrus.Logger
-	redis cache.RedisConnection
+	redis  cache.RedisConnection
+	users  *userclient.Client
+	search search.Engine
+	images *images.Images
+	// payments moves the money of orders
+	payments payments.Provider
+	// products caches product lists per filter
+	products *cache.Namespace
 }
 
-func NewProductService(db database.DBInterface, logger *logrus.Logger, redis cache.RedisConnection) *ProductService {
+func NewProductService(db database.DBInterface, logger *logrus.Logger, redis cache.RedisConnection, users *userclient.Client, search search.Engine, images *images.Images, payments payments.Provider) *ProductService {
 	return &ProductService{
-		db: db,
+		db:     db,
 		logger: logger,
-		redis: redis,
+		redis:  redis,
+		users:  users,
+		search: search,
+		images: images,
+
+		payments: payments,
+		products: cache.NewNamespace(&redis, "products", productCacheTTL, logger),
 	}
 }
 
 func (p ProductService) CreateProduct(ctx context.Context, payload models.Product) (*models.Product, error) {
 
+	if len(payload.Variants) > 0 {
+		payload.Quantity, _ = models.PrepareVariants(payload.Variants, nil)
+	}
+
 	if err := payload.Validate(); err != nil {
 		p.logger.WithError(err).Error("failed to validate product request body before persisting")
 		return nil, err
@@ -39,50 +58,111 @@ func (p ProductService) CreateProduct(ctx context.Context, payload models.Produc
 	payload.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	payload.ID = primitive.NewObjectID()
 	payload.ProductID = payload.ID.Hex()
+	payload.SearchGrams = search.Grams(*payload.Name, *payload.Description)
+	// images are uploaded once the product exists
+	payload.Images, payload.PrimaryImageId = nil, ""
+	// stock is reserved by orders only
+	payload.Reserved = 0
+
+	categories, err := p.checkCategories(ctx, payload.Categories)
+	if err != nil {
+		return nil, err
+	}
+	payload.Categories = categories
 
 	product, err := p.db.CreateProduct(ctx, &payload)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
 	}
+
+	p.invalidateProducts(ctx)
+	p.attachBreadcrumbs(ctx, []*models.Product{product})
 	return product, nil
 }
 
+const (
+	// productCacheTTL can be long, lists are invalidated on every write
+	productCacheTTL = time.Minute * 5
+
+	defaultProductsLimit = 20
+	maxProductsLimit     = 100
+)
+
 func (p ProductService) GetProducts(ctx context.Context, filter models.ProductFilter) (*models.ProductList, error) {
 
-	var result models.ProductList
-	cacheValue, err := p.redis.Get(ctx, "product_cache")
-	if err == redis.Nil {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
 
-		result, err := p.db.GetProducts(ctx, filter)
+	if filter.Sort == "" {
+		filter.Sort = models.SortByName
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultProductsLimit
+	}
+	if filter.Limit > maxProductsLimit {
+		filter.Limit = maxProductsLimit
+	}
+	if filter.Cursor != nil {
+		after, err := models.DecodeProductCursor(*filter.Cursor, filter.Sort)
 		if err != nil {
-			p.logger.WithError(err).Error(err.Error())
 			return nil, err
 		}
-		
-		cacheByte, err := json.Marshal(result)
+		filter.After = after
+	}
+	if filter.Category != nil {
+		category, err := p.findCategory(ctx, *filter.Category)
 		if err != nil {
 			return nil, err
 		}
-		
-		_, err = p.redis.Set(ctx, "product_cache", cacheByte, time.Second * 30)
+		categories, err := p.listCategories(ctx)
 		if err != nil {
 			return nil, err
 		}
-		
-		result.Source = models.DBData
-		return result, nil
+		filter.CategoryIds = descendants(categories, category.CategoryId)
+	}
 
-	} else if err != nil {
+	var result models.ProductList
+	cached, err := p.products.Fetch(ctx, filter, &result, func(ctx context.Context) (interface{}, error) {
+		return p.db.GetProducts(ctx, filter)
+	})
+	if err != nil {
+		p.logger.WithError(err).Error(err.Error())
 		return nil, err
-		
-	} else {
-		err = json.Unmarshal(cacheValue, &result)
-		if err != nil {
-			return nil, err
-		}
-		
+	}
+
+	result.Source = models.DBData
+	if cached {
 		result.Source = models.CacheData
-		return &result, nil
+	}
+	p.resolveOwners(ctx, result.Data)
+	p.attachBreadcrumbs(ctx, result.Data)
+	return &result, nil
+}
+
+// resolveOwners refreshes the owner names copied at creation time with the
+// current names from ms.users. Products keep their stored names when the
+// users service can not be reached.
+func (p ProductService) resolveOwners(ctx context.Context, products []*models.Product) {
+	if p.users == nil || len(products) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.OwnerID)
+	}
+
+	owners, err := p.users.LookupUsers(ctx, ids)
+	if err != nil {
+		p.logger.WithError(err).Error("failed to resolve product owners")
+		return
+	}
+
+	for _, product := range products {
+		if owner, ok := owners[product.OwnerID]; ok {
+			product.OwnerName = owner.FullName()
+		}
 	}
 }
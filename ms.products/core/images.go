@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/fredele20/microservice-practice/ms.products/images"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.users/libs/blob"
+	"github.com/fredele20/microservice-practice/ms.users/libs/imaging"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrImageNotFound      = errors.New("image not found")
+	ErrTooManyImages      = errors.New("a product can not have more than 10 images")
+	ErrImagesChanged      = errors.New("the images of the product changed meanwhile, reload them and try again")
+	ErrInvalidImageOrder  = errors.New("the new order must list every image of the product exactly once")
+	ErrUploadImageFailed  = errors.New("failed to upload image")
+	ErrUpdateImagesFailed = errors.New("failed to update images")
+)
+
+// maxProductImages must match ErrTooManyImages
+const maxProductImages = 10
+
+// UploadImage adds an image at the end of the images of a product, the
+// files are deleted again when the product can not take it.
+func (p ProductService) UploadImage(ctx context.Context, actor models.Actor, productId string, r io.Reader) (*models.Product, error) {
+	product, err := p.canChange(ctx, actor, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(product.Images) >= maxProductImages {
+		return nil, ErrTooManyImages
+	}
+
+	image, err := p.images.Process(ctx, product.ProductID, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrTooLarge), errors.Is(err, imaging.ErrUnsupportedType),
+			errors.Is(err, imaging.ErrTooManyPixels), errors.Is(err, imaging.ErrInvalidImage):
+			return nil, err
+		}
+		p.logger.WithError(err).Error(ErrUploadImageFailed.Error())
+		return nil, ErrUploadImageFailed
+	}
+
+	updated, err := p.db.AddProductImage(ctx, product.ProductID, image, maxProductImages)
+	if err != nil {
+		p.removeImage(ctx, image)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrTooManyImages
+		}
+		p.logger.WithError(err).Error(ErrUploadImageFailed.Error())
+		return nil, ErrUploadImageFailed
+	}
+
+	return p.imagesChanged(ctx, updated), nil
+}
+
+// ReorderImages changes the display order of the images of a product.
+func (p ProductService) ReorderImages(ctx context.Context, actor models.Actor, productId string, payload models.ReorderImagesRequest) (*models.Product, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	product, err := p.canChange(ctx, actor, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload.ImageIds) != len(product.Images) {
+		return nil, ErrInvalidImageOrder
+	}
+	ordered := make([]*models.ProductImage, 0, len(payload.ImageIds))
+	seen := map[string]bool{}
+	for _, imageId := range payload.ImageIds {
+		image := product.Image(imageId)
+		if image == nil || seen[imageId] {
+			return nil, ErrInvalidImageOrder
+		}
+		seen[imageId] = true
+		ordered = append(ordered, image)
+	}
+
+	updated, err := p.db.SetProductImages(ctx, product.ProductID, ordered)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrImagesChanged
+		}
+		p.logger.WithError(err).Error(ErrUpdateImagesFailed.Error())
+		return nil, ErrUpdateImagesFailed
+	}
+
+	return p.imagesChanged(ctx, updated), nil
+}
+
+// SetPrimaryImage picks the image shown in product lists.
+func (p ProductService) SetPrimaryImage(ctx context.Context, actor models.Actor, productId, imageId string) (*models.Product, error) {
+	product, err := p.canChange(ctx, actor, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.Image(imageId) == nil {
+		return nil, ErrImageNotFound
+	}
+
+	updated, err := p.db.SetPrimaryImage(ctx, product.ProductID, imageId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrImageNotFound
+		}
+		p.logger.WithError(err).Error(ErrUpdateImagesFailed.Error())
+		return nil, ErrUpdateImagesFailed
+	}
+
+	return p.imagesChanged(ctx, updated), nil
+}
+
+// DeleteImage removes an image from a product and deletes its files.
+func (p ProductService) DeleteImage(ctx context.Context, actor models.Actor, productId, imageId string) (*models.Product, error) {
+	product, err := p.canChange(ctx, actor, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	image := product.Image(imageId)
+	if image == nil {
+		return nil, ErrImageNotFound
+	}
+
+	updated, err := p.db.RemoveProductImage(ctx, product.ProductID, imageId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrImageNotFound
+		}
+		p.logger.WithError(err).Error(ErrUpdateImagesFailed.Error())
+		return nil, ErrUpdateImagesFailed
+	}
+
+	p.removeImage(ctx, image)
+	return p.imagesChanged(ctx, updated), nil
+}
+
+// OpenImageFile returns a stored image file, only keys under the products
+// prefix can be read.
+func (p ProductService) OpenImageFile(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	key, err := blob.CleanKey(key)
+	if err != nil || !strings.HasPrefix(key, images.KeyPrefix) {
+		return nil, "", ErrImageNotFound
+	}
+
+	file, contentType, err := p.images.Open(ctx, key)
+	if err != nil {
+		if !errors.Is(err, blob.ErrNotFound) {
+			p.logger.WithError(err).Error("failed to open image file")
+		}
+		return nil, "", ErrImageNotFound
+	}
+
+	return file, contentType, nil
+}
+
+// imagesChanged prepares a product returned by an image change.
+func (p ProductService) imagesChanged(ctx context.Context, product *models.Product) *models.Product {
+	p.invalidateProducts(ctx)
+	p.resolveOwners(ctx, []*models.Product{product})
+	p.attachBreadcrumbs(ctx, []*models.Product{product})
+	return product
+}
+
+func (p ProductService) removeImage(ctx context.Context, image *models.ProductImage) {
+	if err := p.images.Remove(ctx, image); err != nil {
+		p.logger.WithError(err).Error("failed to delete image files")
+	}
+}
@@ -0,0 +1,478 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrOrderNotFound      = errors.New("order not found")
+	ErrOrderChanged       = errors.New("the order changed meanwhile, reload it and try again")
+	ErrGetOrderFailed     = errors.New("failed to get order")
+	ErrListOrdersFailed   = errors.New("failed to list orders")
+	ErrUpdateOrderFailed  = errors.New("failed to update order")
+	ErrInvalidOrderStatus = errors.New("invalid order status")
+	ErrReservationExpired = errors.New("the stock reserved for the order was released, place the order again")
+
+	ErrReleaseReservationsFailed = errors.New("failed to release expired reservations")
+)
+
+// reservationsActor cancels the orders whose reservation expired.
+var reservationsActor = models.Actor{UserId: "reservations", Name: "reservations"}
+
+const (
+	defaultOrdersLimit = 20
+	maxOrdersLimit     = 100
+
+	// reservationTTL is how long a pending order holds its stock, it is
+	// cancelled when it is not paid by then
+	reservationTTL = time.Minute * 15
+	// expiredOrdersBatch is the number of expired orders cancelled per
+	// query by ReleaseReservations
+	expiredOrdersBatch = 100
+)
+
+// orderLine is an item to be bought in an order.
+type orderLine struct {
+	productId string
+	variantId string
+	quantity  int
+	// sellerName replaces the name of the owner stored on the product
+	// when it is set
+	sellerName string
+}
+
+// placeOrder reserves the stock of every line and records their purchases
+// in a new pending order, it fails with ErrInsufficientStock when a line
+// can not be reserved. It runs in a transaction when the store has them,
+// otherwise what it wrote before failing is undone.
+func (p ProductService) placeOrder(ctx context.Context, buyer models.Actor, lines []orderLine) (_ *models.Order, _ []*models.PurchaseProduct, err error) {
+	now := time.Now()
+	reservedUntil := now.Add(reservationTTL)
+	order := &models.Order{
+		ID:        primitive.NewObjectID(),
+		BuyerId:   buyer.UserId,
+		BuyerName: buyer.Name,
+		SellerIds: []string{},
+		Items:     make([]*models.OrderItem, 0, len(lines)),
+		Totals:    []models.Money{},
+		Status:    models.OrderPending,
+		Events: []*models.OrderEvent{{
+			Action:  models.OrderPlace,
+			To:      models.OrderPending,
+			ActorId: buyer.UserId,
+			Role:    models.OrderBuyer,
+			At:      now,
+		}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	order.OrderId = order.ID.Hex()
+	order.ReservedUntil = &reservedUntil
+
+	var reserved []orderLine
+	defer func() {
+		if err != nil {
+			p.undoOrder(ctx, order.OrderId, reserved)
+		}
+	}()
+
+	purchases := make([]*models.PurchaseProduct, 0, len(lines))
+	for _, line := range lines {
+		updated, err := p.db.ReserveProductQuantity(ctx, line.productId, line.variantId, line.quantity)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, nil, ErrInsufficientStock
+			}
+			return nil, nil, err
+		}
+		reserved = append(reserved, line)
+
+		record, err := purchaseRecord(buyer, updated, line.variantId, line.quantity)
+		if err != nil {
+			return nil, nil, err
+		}
+		if line.sellerName != "" {
+			record.SellerName = line.sellerName
+		}
+		record.OrderId = order.OrderId
+		record.TransactionDate = now
+		record.Pending = true
+
+		purchase, err := p.db.CreatePurchase(ctx, record)
+		if err != nil {
+			return nil, nil, err
+		}
+		purchases = append(purchases, purchase)
+
+		order.Items = append(order.Items, &models.OrderItem{
+			PurchaseId:  purchase.PurchaseId,
+			ProductId:   purchase.ProductId,
+			ProductName: purchase.ProductName,
+			VariantId:   purchase.VariantId,
+			SKU:         purchase.SKU,
+			Options:     purchase.Options,
+			Quantity:    purchase.Quantity,
+			UnitPrice:   purchase.UnitPrice,
+			Total:       purchase.Total,
+			SellerId:    purchase.SellerId,
+			SellerName:  purchase.SellerName,
+		})
+		if !containsString(order.SellerIds, purchase.SellerId) {
+			order.SellerIds = append(order.SellerIds, purchase.SellerId)
+		}
+		if purchase.Total != nil {
+			order.Totals = models.AddTotal(order.Totals, *purchase.Total)
+		}
+	}
+
+	created, err := p.db.CreateOrder(ctx, order)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return created, purchases, nil
+}
+
+// GetOrder returns an order to its buyer, its sellers and admins. Other
+// users are told it does not exist.
+func (p ProductService) GetOrder(ctx context.Context, actor models.Actor, orderId string) (*models.Order, error) {
+	order, err := p.db.GetOrder(ctx, orderId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderNotFound
+		}
+		p.logger.WithError(err).Error(ErrGetOrderFailed.Error())
+		return nil, ErrGetOrderFailed
+	}
+
+	if order.Role(actor) == "" {
+		return nil, ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+// ListOrders returns the orders placed by buyerId.
+func (p ProductService) ListOrders(ctx context.Context, buyerId string, filter models.OrderFilter) (*models.OrderList, error) {
+	filter.BuyerId, filter.SellerId = buyerId, ""
+	return p.listOrders(ctx, filter)
+}
+
+// ListSellerOrders returns the orders holding products of sellerId.
+func (p ProductService) ListSellerOrders(ctx context.Context, sellerId string, filter models.OrderFilter) (*models.OrderList, error) {
+	filter.BuyerId, filter.SellerId = "", sellerId
+	return p.listOrders(ctx, filter)
+}
+
+func (p ProductService) listOrders(ctx context.Context, filter models.OrderFilter) (*models.OrderList, error) {
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, ErrInvalidOrderStatus
+	}
+	if filter.NextCursorId != nil && !primitive.IsValidObjectID(*filter.NextCursorId) {
+		return nil, models.ErrInvalidCursor
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultOrdersLimit
+	}
+	if filter.Limit > maxOrdersLimit {
+		filter.Limit = maxOrdersLimit
+	}
+
+	orders, err := p.db.ListOrders(ctx, filter)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrListOrdersFailed.Error())
+		return nil, ErrListOrdersFailed
+	}
+
+	return orders, nil
+}
+
+// TransitionOrder takes action on an order, see models.Order.Transition for
+// the actions allowed in each status. On an order with several sellers the
+// items of each seller are fulfilled, shipped and delivered separately, see
+// models.Order.TransitionItems. Cancelling an order puts its items back in
+// stock, and refunding it refunds its payment. Orders are paid with
+// PayOrder.
+func (p ProductService) TransitionOrder(ctx context.Context, actor models.Actor, orderId string, action models.OrderAction, payload models.OrderTransitionRequest) (*models.Order, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+	if action == models.OrderPay {
+		return nil, ErrPaymentRequired
+	}
+
+	order, err := p.GetOrder(ctx, actor, orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	role := order.Role(actor)
+	if order.SharedBySellers() && models.IsItemAction(action) {
+		return p.transitionItems(ctx, order, actor, role, action, payload)
+	}
+	if _, err := order.Transition(action, role); err != nil {
+		return nil, err
+	}
+	if action == models.OrderRefund {
+		return p.refund(ctx, order, actor, role, payload)
+	}
+
+	return p.transition(ctx, order, actor, role, action, payload)
+}
+
+// transitionItems moves the items of a seller of order to the status action
+// leads to, sellers always move their own items. Order must hold the items
+// it was read with.
+func (p ProductService) transitionItems(ctx context.Context, order *models.Order, actor models.Actor, role models.OrderRole, action models.OrderAction, payload models.OrderTransitionRequest) (*models.Order, error) {
+	sellerId := payload.SellerId
+	if role == models.OrderSeller {
+		sellerId = actor.UserId
+	}
+	from, _ := order.SellerStatus(sellerId)
+	to, err := order.TransitionItems(action, role, sellerId)
+	if err != nil {
+		return nil, err
+	}
+
+	status := order.Status
+	event := &models.OrderEvent{
+		Action:   action,
+		From:     from,
+		To:       to,
+		ActorId:  actor.UserId,
+		Role:     role,
+		SellerId: sellerId,
+		Note:     payload.Note,
+		At:       time.Now(),
+	}
+	trackingNumber := ""
+	if action == models.OrderShip {
+		trackingNumber = payload.TrackingNumber
+	}
+	order.MoveItems(sellerId, to, trackingNumber)
+
+	updated, err := p.db.TransitionOrder(ctx, order, status, event)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderChanged
+		}
+		p.logger.WithError(err).Error(ErrUpdateOrderFailed.Error())
+		return nil, ErrUpdateOrderFailed
+	}
+
+	return updated, nil
+}
+
+// transition moves order to the status action leads to, order must hold
+// the status it was read with.
+func (p ProductService) transition(ctx context.Context, order *models.Order, actor models.Actor, role models.OrderRole, action models.OrderAction, payload models.OrderTransitionRequest) (*models.Order, error) {
+	to, err := order.Transition(action, role)
+	if err != nil {
+		return nil, err
+	}
+
+	from := order.Status
+	event := &models.OrderEvent{
+		Action:  action,
+		From:    from,
+		To:      to,
+		ActorId: actor.UserId,
+		Role:    role,
+		Note:    payload.Note,
+		At:      time.Now(),
+	}
+	order.Status = to
+	switch action {
+	case models.OrderPay:
+		order.PaidAt = &event.At
+	case models.OrderCancel:
+		// without transactions the order is cancelled before its stock is
+		// put back, the reservations job finishes when restock fails
+		order.RestockFrom = from
+	case models.OrderShip:
+		if payload.TrackingNumber != "" {
+			order.TrackingNumber = payload.TrackingNumber
+		}
+	}
+
+	// the stock of the order changes with its status
+	stock := action == models.OrderCancel || (action == models.OrderPay && order.ReservedUntil != nil)
+
+	var updated *models.Order
+	if stock {
+		err = p.db.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			if updated, err = p.db.TransitionOrder(ctx, order, from, event); err != nil {
+				return err
+			}
+			if action == models.OrderPay {
+				return p.commitReservations(ctx, updated)
+			}
+			return p.restock(ctx, updated)
+		})
+	} else {
+		updated, err = p.db.TransitionOrder(ctx, order, from, event)
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrderChanged
+		}
+		p.logger.WithError(err).Error(ErrUpdateOrderFailed.Error())
+		return nil, ErrUpdateOrderFailed
+	}
+
+	if stock {
+		p.invalidateProducts(ctx)
+	}
+	return updated, nil
+}
+
+// undoOrder releases the stock reserved by an order that failed to be
+// placed and cancels the purchases recorded for it. Inside a transaction
+// the writes are rolled back anyway.
+func (p ProductService) undoOrder(ctx context.Context, orderId string, reserved []orderLine) {
+	for _, line := range reserved {
+		if err := p.db.ReleaseProductReservation(ctx, line.productId, line.variantId, line.quantity); err != nil {
+			p.logger.WithError(err).WithField("orderId", orderId).Error("failed to release the stock of an order that was not placed")
+		}
+	}
+	if err := p.db.CancelPurchases(ctx, orderId); err != nil {
+		p.logger.WithError(err).WithField("orderId", orderId).Error("failed to cancel the purchases of an order that was not placed")
+	}
+}
+
+// restock puts the items of a cancelled order back in stock, and stops
+// counting its purchases as sales. A pending order only held its stock,
+// unless it was placed before stock was reserved. Each item is marked
+// before its stock is put back so that it is put back once, when restock
+// is run again for an order that failed to be restocked.
+func (p ProductService) restock(ctx context.Context, order *models.Order) error {
+	for i, item := range order.Items {
+		if item.Restocked {
+			continue
+		}
+		if err := p.db.MarkItemRestocked(ctx, order.OrderId, i, true); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				// put back by another run
+				continue
+			}
+			return err
+		}
+
+		var err error
+		if order.RestockFrom == models.OrderPending && order.ReservedUntil != nil {
+			err = p.db.ReleaseProductReservation(ctx, item.ProductId, item.VariantId, item.Quantity)
+		} else {
+			err = p.db.ReturnProductQuantity(ctx, item.ProductId, item.VariantId, item.Quantity)
+		}
+		if err != nil {
+			if err := p.db.MarkItemRestocked(ctx, order.OrderId, i, false); err != nil {
+				p.logger.WithError(err).WithField("orderId", order.OrderId).Error("failed to unmark an item that was not restocked")
+			}
+			return err
+		}
+	}
+	if err := p.db.CancelPurchases(ctx, order.OrderId); err != nil {
+		return err
+	}
+	return p.db.FinishRestock(ctx, order.OrderId)
+}
+
+// commitReservations takes the stock reserved by a paid order off the
+// quantity of its products, its purchases then count as sales.
+func (p ProductService) commitReservations(ctx context.Context, order *models.Order) error {
+	for _, item := range order.Items {
+		if err := p.db.CommitProductReservation(ctx, item.ProductId, item.VariantId, item.Quantity); err != nil {
+			return err
+		}
+	}
+	return p.db.PayPurchases(ctx, order.OrderId)
+}
+
+// ReleaseReservations cancels the pending orders whose reservation expired
+// every interval until ctx is done, putting their stock back on sale. A run
+// is stopped once it lasted interval. Every instance of the service runs
+// it, an order is cancelled by a single one since the change of its status
+// is conditional.
+func (p ProductService) ReleaseReservations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, interval)
+		released, err := p.ReleaseExpiredReservations(runCtx)
+		cancel()
+		if err != nil {
+			p.logger.WithError(err).Error(ErrReleaseReservationsFailed.Error())
+			continue
+		}
+		if released > 0 {
+			p.logger.WithField("orders", released).Info("released expired reservations")
+		}
+	}
+}
+
+// ReleaseExpiredReservations cancels the pending orders whose reservation
+// expired, and returns how many were cancelled. It also puts back the
+// stock of the cancelled orders that failed to be restocked. The orders
+// that fail are logged and skipped, the next run tries them again.
+func (p ProductService) ReleaseExpiredReservations(ctx context.Context) (int, error) {
+	released := 0
+	var failed []string
+	for {
+		orders, err := p.db.ListExpiredOrders(ctx, time.Now(), failed, expiredOrdersBatch)
+		if err != nil {
+			return released, err
+		}
+
+		for _, order := range orders {
+			var err error
+			if order.RestockFrom != "" {
+				if err = p.restock(ctx, order); err == nil {
+					p.invalidateProducts(ctx)
+				}
+			} else {
+				_, err = p.transition(ctx, order, reservationsActor, models.OrderAdmin, models.OrderCancel, models.OrderTransitionRequest{
+					Note: "the reservation expired",
+				})
+			}
+			switch {
+			case err == nil:
+				released++
+			case errors.Is(err, ErrOrderChanged):
+				// paid, cancelled or released by another instance meanwhile
+			default:
+				p.logger.WithError(err).WithField("orderId", order.OrderId).Error("failed to release the reservation of an order")
+				failed = append(failed, order.OrderId)
+			}
+		}
+		if ctx.Err() != nil {
+			return released, ctx.Err()
+		}
+
+		if len(orders) < expiredOrdersBatch {
+			return released, nil
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
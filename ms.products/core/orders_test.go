@@ -0,0 +1,265 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/database"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// expiredOrderStore holds pending orders whose reservation expired, the
+// orders whose id starts with "fail" can not be cancelled. The first
+// releaseFails releases of the stock of failProduct fail. The other store
+// methods are not used by these tests.
+type expiredOrderStore struct {
+	database.DBInterface
+	orders       []*models.Order
+	failProduct  string
+	releaseFails int
+	released     map[string]int
+}
+
+func (s *expiredOrderStore) ListExpiredOrders(ctx context.Context, now time.Time, skip []string, limit int64) ([]*models.Order, error) {
+	orders := []*models.Order{}
+	for _, order := range s.orders {
+		if (order.Status == models.OrderPending || order.RestockFrom != "") && !containsString(skip, order.OrderId) && int64(len(orders)) < limit {
+			orders = append(orders, copyOrder(order))
+		}
+	}
+	return orders, nil
+}
+
+func (s *expiredOrderStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (s *expiredOrderStore) TransitionOrder(ctx context.Context, order *models.Order, from models.OrderStatus, event *models.OrderEvent) (*models.Order, error) {
+	if strings.HasPrefix(order.OrderId, "fail") {
+		return nil, errors.New("write failed")
+	}
+	for _, stored := range s.orders {
+		if stored.OrderId == order.OrderId {
+			if stored.Status != from {
+				return nil, mongo.ErrNoDocuments
+			}
+			stored.Status, stored.RestockFrom = order.Status, order.RestockFrom
+		}
+	}
+	return order, nil
+}
+
+func (s *expiredOrderStore) ReleaseProductReservation(ctx context.Context, productId, variantId string, quantity int) error {
+	if productId == s.failProduct && s.releaseFails > 0 {
+		s.releaseFails--
+		return errors.New("write failed")
+	}
+	if s.released == nil {
+		s.released = map[string]int{}
+	}
+	s.released[productId] += quantity
+	return nil
+}
+
+func (s *expiredOrderStore) MarkItemRestocked(ctx context.Context, orderId string, index int, restocked bool) error {
+	for _, stored := range s.orders {
+		if stored.OrderId == orderId {
+			if restocked && stored.Items[index].Restocked {
+				return mongo.ErrNoDocuments
+			}
+			stored.Items[index].Restocked = restocked
+		}
+	}
+	return nil
+}
+
+func (s *expiredOrderStore) FinishRestock(ctx context.Context, orderId string) error {
+	for _, stored := range s.orders {
+		if stored.OrderId == orderId {
+			stored.RestockFrom = ""
+		}
+	}
+	return nil
+}
+
+func (s *expiredOrderStore) CancelPurchases(ctx context.Context, orderId string) error {
+	return nil
+}
+
+func TestReleaseExpiredReservations(t *testing.T) {
+	tests := []struct {
+		name   string
+		failed int
+		ok     int
+	}{
+		{name: "released", ok: 3},
+		{name: "some fail", failed: 2, ok: 3},
+		// a whole batch of failures does not hide the orders after it
+		{name: "batch fails", failed: expiredOrdersBatch + 1, ok: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expired := time.Now().Add(-time.Minute)
+			store := &expiredOrderStore{}
+			for i := 0; i < tt.failed; i++ {
+				store.orders = append(store.orders, &models.Order{OrderId: fmt.Sprintf("fail-%d", i), Status: models.OrderPending, ReservedUntil: &expired})
+			}
+			for i := 0; i < tt.ok; i++ {
+				store.orders = append(store.orders, &models.Order{OrderId: fmt.Sprintf("ok-%d", i), Status: models.OrderPending, ReservedUntil: &expired})
+			}
+
+			released, err := newTestService(t, store).ReleaseExpiredReservations(context.Background())
+			if err != nil {
+				t.Fatalf("ReleaseExpiredReservations() error = %v", err)
+			}
+			if released != tt.ok {
+				t.Errorf("released = %d, want %d", released, tt.ok)
+			}
+			for _, order := range store.orders {
+				want := models.OrderCancelled
+				if strings.HasPrefix(order.OrderId, "fail") {
+					want = models.OrderPending
+				}
+				if order.Status != want {
+					t.Errorf("order %s status = %s, want %s", order.OrderId, order.Status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseExpiredReservationsRestocksOnce(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	store := &expiredOrderStore{
+		orders: []*models.Order{{OrderId: "order", Status: models.OrderPending, ReservedUntil: &expired, Items: []*models.OrderItem{
+			{ProductId: "a", Quantity: 1},
+			{ProductId: "b", Quantity: 2},
+		}}},
+		failProduct:  "b",
+		releaseFails: 1,
+	}
+	service := newTestService(t, store)
+	order := store.orders[0]
+
+	// the order is cancelled, but the stock of b is not put back
+	if released, err := service.ReleaseExpiredReservations(context.Background()); err != nil || released != 0 {
+		t.Fatalf("first run = %d, %v, want 0 released", released, err)
+	}
+	if order.Status != models.OrderCancelled || order.RestockFrom != models.OrderPending {
+		t.Fatalf("after first run status = %q, restock from = %q", order.Status, order.RestockFrom)
+	}
+
+	if released, err := service.ReleaseExpiredReservations(context.Background()); err != nil || released != 1 {
+		t.Fatalf("second run = %d, %v, want 1 released", released, err)
+	}
+	if order.RestockFrom != "" {
+		t.Errorf("restock from = %q, want it cleared", order.RestockFrom)
+	}
+	if store.released["a"] != 1 || store.released["b"] != 2 {
+		t.Errorf("released = %v, want a: 1 and b: 2", store.released)
+	}
+}
+
+func TestReleaseExpiredReservationsStopsWithContext(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	store := &expiredOrderStore{orders: []*models.Order{{OrderId: "ok-1", Status: models.OrderPending, ReservedUntil: &expired}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newTestService(t, store).ReleaseExpiredReservations(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReleaseExpiredReservations() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// sharedOrderStore holds a single order, it is changed only when it still
+// has the events it was read with. The other store methods are not used by
+// these tests.
+type sharedOrderStore struct {
+	database.DBInterface
+	order *models.Order
+}
+
+func (s *sharedOrderStore) GetOrder(ctx context.Context, orderId string) (*models.Order, error) {
+	return copyOrder(s.order), nil
+}
+
+func (s *sharedOrderStore) TransitionOrder(ctx context.Context, order *models.Order, from models.OrderStatus, event *models.OrderEvent) (*models.Order, error) {
+	if s.order.Status != from || len(s.order.Events) != len(order.Events) {
+		return nil, mongo.ErrNoDocuments
+	}
+	s.order = copyOrder(order)
+	s.order.Events = append(s.order.Events, event)
+	return copyOrder(s.order), nil
+}
+
+func copyOrder(order *models.Order) *models.Order {
+	copied := *order
+	copied.Items = make([]*models.OrderItem, len(order.Items))
+	for i, item := range order.Items {
+		copiedItem := *item
+		copied.Items[i] = &copiedItem
+	}
+	copied.Events = append([]*models.OrderEvent{}, order.Events...)
+	return &copied
+}
+
+func TestTransitionSharedOrder(t *testing.T) {
+	store := &sharedOrderStore{order: &models.Order{
+		OrderId:   "order",
+		BuyerId:   "buyer",
+		SellerIds: []string{"seller", "other seller"},
+		Status:    models.OrderPaid,
+		Items: []*models.OrderItem{
+			{ProductId: "a", SellerId: "seller"},
+			{ProductId: "b", SellerId: "other seller"},
+		},
+		Events: []*models.OrderEvent{{Action: models.OrderPlace}, {Action: models.OrderPay}},
+	}}
+	service := newTestService(t, store)
+	ctx := context.Background()
+	seller := models.Actor{UserId: "seller"}
+	buyer := models.Actor{UserId: "buyer"}
+
+	// a seller only moves their own items, whatever seller they ask for
+	order, err := service.TransitionOrder(ctx, seller, "order", models.OrderFulfill, models.OrderTransitionRequest{SellerId: "other seller"})
+	if err != nil {
+		t.Fatalf("seller fulfils: %v", err)
+	}
+	if order.Items[0].Status != models.OrderFulfilled || order.Items[1].Status != "" || order.Status != models.OrderPaid {
+		t.Errorf("after fulfil items = %q %q, order = %q", order.Items[0].Status, order.Items[1].Status, order.Status)
+	}
+	if event := order.Events[len(order.Events)-1]; event.SellerId != "seller" || event.From != models.OrderPaid {
+		t.Errorf("event = %+v", event)
+	}
+
+	if _, err := service.TransitionOrder(ctx, buyer, "order", models.OrderDeliver, models.OrderTransitionRequest{}); !errors.Is(err, models.ErrOrderSellerRequired) {
+		t.Errorf("buyer without seller error = %v, want %v", err, models.ErrOrderSellerRequired)
+	}
+	if _, err := service.TransitionOrder(ctx, seller, "order", models.OrderCancel, models.OrderTransitionRequest{}); !errors.Is(err, models.ErrOrderActionForbidden) {
+		t.Errorf("seller cancel error = %v, want %v", err, models.ErrOrderActionForbidden)
+	}
+
+	// the other seller acts on the order read before it changed
+	stale := copyOrder(store.order)
+	stale.Events = stale.Events[:len(stale.Events)-1]
+	if _, err := service.transitionItems(ctx, stale, models.Actor{UserId: "other seller"}, models.OrderSeller, models.OrderFulfill, models.OrderTransitionRequest{}); !errors.Is(err, ErrOrderChanged) {
+		t.Errorf("stale fulfil error = %v, want %v", err, ErrOrderChanged)
+	}
+	if store.order.Items[0].Status != models.OrderFulfilled {
+		t.Errorf("stale fulfil overwrote the items of seller: %q", store.order.Items[0].Status)
+	}
+
+	order, err = service.TransitionOrder(ctx, models.Actor{UserId: "other seller"}, "order", models.OrderFulfill, models.OrderTransitionRequest{})
+	if err != nil {
+		t.Fatalf("other seller fulfils: %v", err)
+	}
+	if order.Status != models.OrderFulfilled {
+		t.Errorf("order = %q, want %q once every seller fulfilled", order.Status, models.OrderFulfilled)
+	}
+}
@@ -0,0 +1,406 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.products/payments"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrPaymentRequired        = errors.New("an order is paid with a payment method")
+	ErrMixedCurrencyPayment   = errors.New("an order with totals in several currencies can not be paid at once")
+	ErrPaymentDeclined        = errors.New("the payment was declined")
+	ErrPaymentInProgress      = errors.New("a payment of the order is being processed, try again later")
+	ErrUnknownPaymentProvider = errors.New("unknown payment provider")
+	ErrPaymentFailed          = errors.New("failed to process payment")
+	ErrRefundFailed           = errors.New("failed to refund payment")
+	ErrGetPaymentFailed       = errors.New("failed to get payment")
+	ErrUpdatePaymentFailed    = errors.New("failed to update payment")
+	ErrListPaymentsFailed     = errors.New("failed to list payments")
+	ErrPaymentWebhookFailed   = errors.New("failed to handle payment webhook")
+)
+
+// paymentsActor takes the order actions made on behalf of the provider.
+var paymentsActor = models.Actor{UserId: "payments", Name: "payments"}
+
+// PayOrder charges the total of a pending order to the payment method of
+// its buyer and marks the order paid. Retrying with the same
+// idempotencyKey resumes the payment instead of charging the buyer again,
+// a new payment is started when it is empty.
+func (p ProductService) PayOrder(ctx context.Context, buyer models.Actor, orderId, idempotencyKey string, payload models.PayOrderRequest) (*models.Order, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	order, err := p.GetOrder(ctx, buyer, orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	// the retry of a payment that went through returns the paid order
+	if idempotencyKey != "" && order.PaymentId != "" {
+		intent, err := p.db.GetPaymentIntentByKey(ctx, paymentKey(order.OrderId, idempotencyKey))
+		if err == nil && intent.IntentId == order.PaymentId {
+			return order, nil
+		}
+	}
+
+	role := order.Role(buyer)
+	if _, err := order.Transition(models.OrderPay, role); err != nil {
+		return nil, err
+	}
+	if len(order.Totals) != 1 {
+		return nil, ErrMixedCurrencyPayment
+	}
+
+	if idempotencyKey == "" {
+		idempotencyKey = primitive.NewObjectID().Hex()
+	}
+	intent, err := p.openPaymentIntent(ctx, order, paymentKey(order.OrderId, idempotencyKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.Status == models.PaymentPending {
+		// the buyer is not charged for stock that is about to be released,
+		// an intent charged already is completed or refunded below
+		if order.ReservedUntil != nil && time.Now().After(*order.ReservedUntil) {
+			return nil, ErrReservationExpired
+		}
+
+		authorization, err := p.payments.Authorize(ctx, payments.AuthorizeRequest{
+			IdempotencyKey: intent.IntentId,
+			Amount:         intent.Amount,
+			PaymentMethod:  payload.PaymentMethod,
+			Description:    "order " + order.OrderId,
+		})
+		if err != nil {
+			p.logger.WithError(err).Error(ErrPaymentFailed.Error())
+			return nil, ErrPaymentFailed
+		}
+
+		intent.Reference = authorization.Reference
+		intent.Status = models.PaymentAuthorized
+		if !authorization.Approved {
+			intent.Status = models.PaymentFailed
+			intent.FailureReason = authorization.DeclineReason
+		}
+		if intent, err = p.updatePaymentIntent(ctx, intent, models.PaymentPending); err != nil {
+			return nil, err
+		}
+	}
+
+	if intent.Status == models.PaymentAuthorized {
+		if err := p.payments.Capture(ctx, intent.Reference, intent.Amount); err != nil {
+			p.logger.WithError(err).Error(ErrPaymentFailed.Error())
+			return nil, ErrPaymentFailed
+		}
+
+		intent.Status = models.PaymentCaptured
+		if intent, err = p.updatePaymentIntent(ctx, intent, models.PaymentAuthorized); err != nil {
+			return nil, err
+		}
+	}
+
+	switch intent.Status {
+	case models.PaymentCaptured:
+		return p.completePayment(ctx, intent, buyer, role)
+	case models.PaymentFailed:
+		return nil, ErrPaymentDeclined
+	}
+	// the payment was given back meanwhile
+	return nil, ErrOrderChanged
+}
+
+// ListOrderPayments returns the payments made for an order, oldest first.
+func (p ProductService) ListOrderPayments(ctx context.Context, actor models.Actor, orderId string) ([]*models.PaymentIntent, error) {
+	order, err := p.GetOrder(ctx, actor, orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	intents, err := p.db.ListOrderPayments(ctx, order.OrderId)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrListPaymentsFailed.Error())
+		return nil, ErrListPaymentsFailed
+	}
+
+	return intents, nil
+}
+
+// HandlePaymentWebhook applies a webhook sent by provider. Every event is
+// applied once, the copies sent again by the provider are acknowledged
+// without being applied.
+func (p ProductService) HandlePaymentWebhook(ctx context.Context, provider string, header http.Header, body []byte) error {
+	if provider != p.payments.Name() {
+		return ErrUnknownPaymentProvider
+	}
+
+	event, err := p.payments.VerifyWebhook(header, body)
+	if err != nil {
+		return err
+	}
+
+	if err := p.db.RecordPaymentEvent(ctx, &models.PaymentEvent{
+		Provider:   provider,
+		EventId:    event.EventId,
+		Type:       string(event.Type),
+		Reference:  event.Reference,
+		ReceivedAt: time.Now(),
+	}); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		p.logger.WithError(err).Error(ErrPaymentWebhookFailed.Error())
+		return ErrPaymentWebhookFailed
+	}
+
+	if err := p.applyPaymentEvent(ctx, event); err != nil {
+		// the provider sends the event again when it is not acknowledged
+		if err := p.db.ForgetPaymentEvent(ctx, provider, event.EventId); err != nil {
+			p.logger.WithError(err).Error(ErrPaymentWebhookFailed.Error())
+		}
+		return ErrPaymentWebhookFailed
+	}
+
+	return nil
+}
+
+func (p ProductService) applyPaymentEvent(ctx context.Context, event *payments.WebhookEvent) error {
+	intent, err := p.db.GetPaymentIntentByReference(ctx, p.payments.Name(), event.Reference)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			p.logger.WithField("reference", event.Reference).Warn("webhook for an unknown payment")
+			return nil
+		}
+		p.logger.WithError(err).Error(ErrGetPaymentFailed.Error())
+		return ErrGetPaymentFailed
+	}
+
+	switch event.Type {
+	case payments.PaymentCaptured:
+		if intent.Status == models.PaymentAuthorized {
+			intent.Status = models.PaymentCaptured
+			if intent, err = p.updatePaymentIntent(ctx, intent, models.PaymentAuthorized); err != nil {
+				return err
+			}
+		}
+		if intent.Status != models.PaymentCaptured {
+			return nil
+		}
+		if _, err := p.completePayment(ctx, intent, paymentsActor, models.OrderAdmin); err != nil && !errors.Is(err, ErrOrderChanged) {
+			return err
+		}
+
+	case payments.PaymentFailed:
+		if intent.Status == models.PaymentAuthorized {
+			intent.Status = models.PaymentFailed
+			intent.FailureReason = event.Reason
+			if _, err := p.updatePaymentIntent(ctx, intent, models.PaymentAuthorized); err != nil {
+				return err
+			}
+		}
+
+	case payments.PaymentRefunded:
+		if intent.Status == models.PaymentCaptured || intent.Status == models.PaymentRefunding {
+			from := intent.Status
+			intent.Status = models.PaymentRefunded
+			if _, err := p.updatePaymentIntent(ctx, intent, from); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// completePayment marks the order of a captured intent paid. When the
+// order was cancelled or paid with another intent meanwhile, the intent is
+// refunded and ErrOrderChanged is returned.
+func (p ProductService) completePayment(ctx context.Context, intent *models.PaymentIntent, actor models.Actor, role models.OrderRole) (*models.Order, error) {
+	for {
+		order, err := p.db.GetOrder(ctx, intent.OrderId)
+		if err != nil {
+			p.logger.WithError(err).Error(ErrGetOrderFailed.Error())
+			return nil, ErrGetOrderFailed
+		}
+
+		if order.PaymentId == intent.IntentId {
+			return order, nil
+		}
+		if order.Status != models.OrderPending {
+			if err := p.refundPayment(ctx, intent); err != nil && !errors.Is(err, ErrPaymentInProgress) {
+				return nil, err
+			}
+			return nil, ErrOrderChanged
+		}
+
+		order.PaymentId = intent.IntentId
+		updated, err := p.transition(ctx, order, actor, role, models.OrderPay, models.OrderTransitionRequest{
+			Note: "paid with " + intent.Provider,
+		})
+		// an order leaves pending once, the next read settles it
+		if errors.Is(err, ErrOrderChanged) {
+			continue
+		}
+		return updated, err
+	}
+}
+
+// refund gives the payment of order back to the buyer and marks the order
+// refunded. The money moves first, so an order that changed meanwhile is
+// reloaded until it is marked refunded. When the order can not be stored,
+// the refund is taken again: the payment is then refunded already and only
+// the order changes.
+func (p ProductService) refund(ctx context.Context, order *models.Order, actor models.Actor, role models.OrderRole, payload models.OrderTransitionRequest) (*models.Order, error) {
+	if err := p.refundOrder(ctx, order); err != nil {
+		return nil, err
+	}
+
+	for {
+		updated, err := p.transition(ctx, order, actor, role, models.OrderRefund, payload)
+		if !errors.Is(err, ErrOrderChanged) {
+			if err != nil {
+				p.logger.WithError(err).WithField("orderId", order.OrderId).Error("the payment of the order was refunded but the order was not marked refunded")
+			}
+			return updated, err
+		}
+
+		if order, err = p.db.GetOrder(ctx, order.OrderId); err != nil {
+			p.logger.WithError(err).Error(ErrGetOrderFailed.Error())
+			return nil, ErrGetOrderFailed
+		}
+		// refunded by a concurrent request
+		if order.Status == models.OrderRefunded {
+			return order, nil
+		}
+	}
+}
+
+// refundOrder refunds the payment order was paid with, orders paid before
+// payments went through a provider have none.
+func (p ProductService) refundOrder(ctx context.Context, order *models.Order) error {
+	if order.PaymentId == "" {
+		return nil
+	}
+
+	intents, err := p.db.ListOrderPayments(ctx, order.OrderId)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrGetPaymentFailed.Error())
+		return ErrGetPaymentFailed
+	}
+
+	for _, intent := range intents {
+		if intent.IntentId != order.PaymentId {
+			continue
+		}
+		switch intent.Status {
+		case models.PaymentCaptured:
+			return p.refundPayment(ctx, intent)
+		case models.PaymentRefunded:
+			// refunded on the provider side
+			return nil
+		}
+		return ErrPaymentInProgress
+	}
+
+	return nil
+}
+
+// refundPayment gives a captured intent back to the buyer. The intent is
+// held in PaymentRefunding while the provider refunds it, so that it is
+// refunded once.
+func (p ProductService) refundPayment(ctx context.Context, intent *models.PaymentIntent) error {
+	from := intent.Status
+	intent.Status = models.PaymentRefunding
+	claimed, err := p.db.UpdatePaymentIntent(ctx, intent, from)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrPaymentInProgress
+		}
+		p.logger.WithError(err).Error(ErrUpdatePaymentFailed.Error())
+		return ErrUpdatePaymentFailed
+	}
+
+	if err := p.payments.Refund(ctx, claimed.Reference, claimed.Amount); err != nil {
+		p.logger.WithError(err).Error(ErrRefundFailed.Error())
+		claimed.Status = from
+		if _, err := p.db.UpdatePaymentIntent(ctx, claimed, models.PaymentRefunding); err != nil {
+			p.logger.WithError(err).Error(ErrUpdatePaymentFailed.Error())
+		}
+		return ErrRefundFailed
+	}
+
+	claimed.Status = models.PaymentRefunded
+	// the refund webhook may have been applied already
+	if _, err := p.db.UpdatePaymentIntent(ctx, claimed, models.PaymentRefunding); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		p.logger.WithError(err).Error(ErrUpdatePaymentFailed.Error())
+		return ErrUpdatePaymentFailed
+	}
+
+	return nil
+}
+
+// openPaymentIntent returns the intent stored under key, or starts a new
+// one for the total of order.
+func (p ProductService) openPaymentIntent(ctx context.Context, order *models.Order, key string) (*models.PaymentIntent, error) {
+	intent, err := p.db.GetPaymentIntentByKey(ctx, key)
+	if err == nil {
+		return intent, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		p.logger.WithError(err).Error(ErrGetPaymentFailed.Error())
+		return nil, ErrGetPaymentFailed
+	}
+
+	now := time.Now()
+	id := primitive.NewObjectID()
+	intent, err = p.db.CreatePaymentIntent(ctx, &models.PaymentIntent{
+		ID:        id,
+		IntentId:  id.Hex(),
+		Key:       key,
+		OrderId:   order.OrderId,
+		BuyerId:   order.BuyerId,
+		Amount:    order.Totals[0],
+		Provider:  p.payments.Name(),
+		Status:    models.PaymentPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		// a concurrent retry created it first
+		if mongo.IsDuplicateKeyError(err) {
+			return p.openPaymentIntent(ctx, order, key)
+		}
+		p.logger.WithError(err).Error(ErrPaymentFailed.Error())
+		return nil, ErrPaymentFailed
+	}
+
+	return intent, nil
+}
+
+// updatePaymentIntent stores the status of intent, moved from the from
+// status. When the intent changed meanwhile it returns the stored intent,
+// so that the caller goes on from its current status.
+func (p ProductService) updatePaymentIntent(ctx context.Context, intent *models.PaymentIntent, from models.PaymentStatus) (*models.PaymentIntent, error) {
+	updated, err := p.db.UpdatePaymentIntent(ctx, intent, from)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		updated, err = p.db.GetPaymentIntentByKey(ctx, intent.Key)
+	}
+	if err != nil {
+		p.logger.WithError(err).Error(ErrUpdatePaymentFailed.Error())
+		return nil, ErrUpdatePaymentFailed
+	}
+
+	return updated, nil
+}
+
+func paymentKey(orderId, idempotencyKey string) string {
+	return orderId + ":" + idempotencyKey
+}
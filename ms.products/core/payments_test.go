@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/cache"
+	"github.com/fredele20/microservice-practice/ms.products/database"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.products/payments"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// paymentStore keeps orders, payments and webhook events in memory with
+// the conditional updates of the mongo store, the other store methods are
+// not used by these tests.
+type paymentStore struct {
+	database.DBInterface
+	orders  map[string]*models.Order
+	intents map[string]*models.PaymentIntent
+	events  map[string]bool
+
+	transitions int
+	// beforeTransition runs before an order is updated, to change it
+	// concurrently
+	beforeTransition func(order *models.Order)
+}
+
+func newPaymentStore(order *models.Order, intent *models.PaymentIntent) *paymentStore {
+	return &paymentStore{
+		orders:  map[string]*models.Order{order.OrderId: order},
+		intents: map[string]*models.PaymentIntent{intent.IntentId: intent},
+		events:  map[string]bool{},
+	}
+}
+
+func (s *paymentStore) GetOrder(ctx context.Context, orderId string) (*models.Order, error) {
+	order, ok := s.orders[orderId]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (s *paymentStore) TransitionOrder(ctx context.Context, order *models.Order, from models.OrderStatus, event *models.OrderEvent) (*models.Order, error) {
+	if s.beforeTransition != nil {
+		s.beforeTransition(s.orders[order.OrderId])
+		s.beforeTransition = nil
+	}
+	if s.orders[order.OrderId].Status != from {
+		return nil, mongo.ErrNoDocuments
+	}
+	s.transitions++
+	copied := *order
+	s.orders[order.OrderId] = &copied
+	return order, nil
+}
+
+func (s *paymentStore) GetPaymentIntentByReference(ctx context.Context, provider, reference string) (*models.PaymentIntent, error) {
+	for _, intent := range s.intents {
+		if intent.Provider == provider && intent.Reference == reference {
+			copied := *intent
+			return &copied, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *paymentStore) ListOrderPayments(ctx context.Context, orderId string) ([]*models.PaymentIntent, error) {
+	var intents []*models.PaymentIntent
+	for _, intent := range s.intents {
+		if intent.OrderId == orderId {
+			copied := *intent
+			intents = append(intents, &copied)
+		}
+	}
+	return intents, nil
+}
+
+func (s *paymentStore) UpdatePaymentIntent(ctx context.Context, intent *models.PaymentIntent, from models.PaymentStatus) (*models.PaymentIntent, error) {
+	if s.intents[intent.IntentId].Status != from {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *intent
+	s.intents[intent.IntentId] = &copied
+	return intent, nil
+}
+
+func (s *paymentStore) RecordPaymentEvent(ctx context.Context, event *models.PaymentEvent) error {
+	key := event.Provider + ":" + event.EventId
+	if s.events[key] {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}}}
+	}
+	s.events[key] = true
+	return nil
+}
+
+func (s *paymentStore) ForgetPaymentEvent(ctx context.Context, provider, eventId string) error {
+	delete(s.events, provider+":"+eventId)
+	return nil
+}
+
+// authorizedPayment authorizes the payment of a pending order with fake.
+func authorizedPayment(t *testing.T, fake *payments.Fake) (*models.Order, *models.PaymentIntent) {
+	t.Helper()
+	amount := models.NewMoney(1000, "USD")
+	auth, err := fake.Authorize(context.Background(), payments.AuthorizeRequest{IdempotencyKey: "order-1:key", Amount: amount})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	order := &models.Order{OrderId: "order-1", BuyerId: "buyer", SellerIds: []string{"seller"}, Status: models.OrderPending}
+	intent := &models.PaymentIntent{
+		IntentId:  "intent-1",
+		Key:       paymentKey(order.OrderId, "key"),
+		OrderId:   order.OrderId,
+		BuyerId:   order.BuyerId,
+		Amount:    amount,
+		Provider:  fake.Name(),
+		Reference: auth.Reference,
+		Status:    models.PaymentAuthorized,
+	}
+	return order, intent
+}
+
+func TestHandlePaymentWebhookDuplicateDelivery(t *testing.T) {
+	fake := payments.NewFake("secret")
+	order, intent := authorizedPayment(t, fake)
+	store := newPaymentStore(order, intent)
+	service := NewProductService(store, logrus.New(), cache.RedisConnection{}, nil, nil, nil, fake)
+
+	body := []byte(`{"id":"evt_1","type":"payment.captured","reference":"` + intent.Reference + `"}`)
+	header := http.Header{}
+	header.Set(payments.FakeSignatureHeader, fake.SignWebhook(body))
+
+	for i := 0; i < 3; i++ {
+		if err := service.HandlePaymentWebhook(context.Background(), fake.Name(), header, body); err != nil {
+			t.Fatalf("delivery %d: HandlePaymentWebhook() error = %v", i+1, err)
+		}
+	}
+
+	if store.transitions != 1 {
+		t.Errorf("order transitions = %d, want 1", store.transitions)
+	}
+	if got := store.orders[order.OrderId]; got.Status != models.OrderPaid || got.PaymentId != intent.IntentId {
+		t.Errorf("order = %s paid with %q, want %s paid with %q", got.Status, got.PaymentId, models.OrderPaid, intent.IntentId)
+	}
+	if got := store.intents[intent.IntentId].Status; got != models.PaymentCaptured {
+		t.Errorf("payment status = %s, want %s", got, models.PaymentCaptured)
+	}
+}
+
+func TestHandlePaymentWebhookRetriesFailedEvents(t *testing.T) {
+	fake := payments.NewFake("secret")
+	order, intent := authorizedPayment(t, fake)
+	store := newPaymentStore(order, intent)
+	service := NewProductService(store, logrus.New(), cache.RedisConnection{}, nil, nil, nil, fake)
+
+	body := []byte(`{"id":"evt_1","type":"payment.captured","reference":"` + intent.Reference + `"}`)
+	header := http.Header{}
+	header.Set(payments.FakeSignatureHeader, fake.SignWebhook(body))
+
+	// the order is missing, so the first delivery fails
+	delete(store.orders, order.OrderId)
+	if err := service.HandlePaymentWebhook(context.Background(), fake.Name(), header, body); !errors.Is(err, ErrPaymentWebhookFailed) {
+		t.Fatalf("HandlePaymentWebhook() error = %v, want %v", err, ErrPaymentWebhookFailed)
+	}
+
+	store.orders[order.OrderId] = order
+	if err := service.HandlePaymentWebhook(context.Background(), fake.Name(), header, body); err != nil {
+		t.Fatalf("HandlePaymentWebhook() again error = %v", err)
+	}
+	if got := store.orders[order.OrderId].Status; got != models.OrderPaid {
+		t.Errorf("order status = %s, want %s", got, models.OrderPaid)
+	}
+}
+
+func TestRefundOrder(t *testing.T) {
+	admin := models.Actor{UserId: "admin", UserType: "ADMIN"}
+
+	tests := []struct {
+		name string
+		// concurrent changes the order while it is being refunded
+		concurrent func(order *models.Order)
+	}{
+		{name: "refunded"},
+		{
+			name:       "refunded concurrently",
+			concurrent: func(order *models.Order) { order.Status = models.OrderRefunded },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := payments.NewFake("secret")
+			order, intent := authorizedPayment(t, fake)
+			if err := fake.Capture(context.Background(), intent.Reference, intent.Amount); err != nil {
+				t.Fatalf("Capture() error = %v", err)
+			}
+			paidAt := time.Now()
+			order.Status, order.PaymentId, order.PaidAt = models.OrderCancelled, intent.IntentId, &paidAt
+			intent.Status = models.PaymentCaptured
+
+			store := newPaymentStore(order, intent)
+			store.beforeTransition = tt.concurrent
+			service := NewProductService(store, logrus.New(), cache.RedisConnection{}, nil, nil, nil, fake)
+
+			refunded, err := service.TransitionOrder(context.Background(), admin, order.OrderId, models.OrderRefund, models.OrderTransitionRequest{})
+			if err != nil {
+				t.Fatalf("TransitionOrder() error = %v", err)
+			}
+			if refunded.Status != models.OrderRefunded {
+				t.Errorf("returned order status = %s, want %s", refunded.Status, models.OrderRefunded)
+			}
+			if got := store.orders[order.OrderId].Status; got != models.OrderRefunded {
+				t.Errorf("stored order status = %s, want %s", got, models.OrderRefunded)
+			}
+			if got := store.intents[intent.IntentId].Status; got != models.PaymentRefunded {
+				t.Errorf("payment status = %s, want %s", got, models.PaymentRefunded)
+			}
+		})
+	}
+}
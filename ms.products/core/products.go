@@ -0,0 +1,210 @@
+package core
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.products/search"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrProductNotFound     = errors.New("product not found")
+	ErrNotProductOwner     = errors.New("only the owner of this product or an admin can change it")
+	ErrUpdateProductFailed = errors.New("failed to update product")
+	ErrDeleteProductFailed = errors.New("failed to delete product")
+	ErrGetProductFailed    = errors.New("failed to get product")
+	ErrProductChanged      = errors.New("the stock of the product changed meanwhile, try again")
+)
+
+// maxProductAttempts bounds how often an update is applied again to a
+// product whose reservations changed
+const maxProductAttempts = 3
+
+func (p ProductService) GetProductById(ctx context.Context, productId string) (*models.Product, error) {
+	product, err := p.db.GetProductById(ctx, productId)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrProductNotFound
+		}
+		p.logger.WithError(err).Error(ErrGetProductFailed.Error())
+		return nil, ErrGetProductFailed
+	}
+
+	p.resolveOwners(ctx, []*models.Product{product})
+	p.attachBreadcrumbs(ctx, []*models.Product{product})
+	return product, nil
+}
+
+// canChange returns the product when actor owns it or is an admin.
+func (p ProductService) canChange(ctx context.Context, actor models.Actor, productId string) (*models.Product, error) {
+	product, err := p.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.OwnerID != actor.UserId && !actor.IsAdmin() {
+		return nil, ErrNotProductOwner
+	}
+
+	return product, nil
+}
+
+func (p ProductService) UpdateProduct(ctx context.Context, actor models.Actor, productId string, payload models.UpdateProductRequest) (*models.Product, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	current, err := p.canChange(ctx, actor, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.Name != nil || payload.Description != nil {
+		name, description := current.Name, current.Description
+		if payload.Name != nil {
+			name = payload.Name
+		}
+		if payload.Description != nil {
+			description = payload.Description
+		}
+		payload.SearchGrams = search.Grams(stringValue(name), stringValue(description))
+	}
+
+	if payload.Categories != nil {
+		categories, err := p.checkCategories(ctx, *payload.Categories)
+		if err != nil {
+			return nil, err
+		}
+		payload.Categories = &categories
+	}
+
+	// the stock is prepared from the product as read, the update is applied
+	// again when reservations change before it is written
+	request := payload
+	var product *models.Product
+	for attempt := 1; ; attempt++ {
+		payload := request
+		if err := prepareStock(current, &payload); err != nil {
+			return nil, err
+		}
+
+		product, err = p.db.UpdateProduct(ctx, productId, payload)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			p.logger.WithError(err).Error(ErrUpdateProductFailed.Error())
+			return nil, ErrUpdateProductFailed
+		}
+
+		current, err = p.db.GetProductById(ctx, productId)
+		if err != nil {
+			return nil, ErrProductNotFound
+		}
+		// the quantity is only lowered while it covers the reservations
+		if request.Quantity != nil && *request.Quantity < current.Reserved {
+			return nil, models.ErrQuantityReserved
+		}
+		if attempt == maxProductAttempts {
+			return nil, ErrProductChanged
+		}
+	}
+
+	p.invalidateProducts(ctx)
+	p.resolveOwners(ctx, []*models.Product{product})
+	p.attachBreadcrumbs(ctx, []*models.Product{product})
+	return product, nil
+}
+
+// prepareStock checks the quantity, options and variants of payload against
+// current and sets the stock they leave the product with. Variants are
+// written along with the reservations of current they were prepared from.
+func prepareStock(current *models.Product, payload *models.UpdateProductRequest) error {
+	// the quantity of a product with variants follows its variants, it can
+	// only be set when the variants are removed, and must be then since the
+	// stored one is the sum of the removed variants
+	hasVariants := len(current.Variants) > 0
+	if payload.Variants != nil {
+		hasVariants = len(*payload.Variants) > 0
+	}
+	if payload.Quantity != nil && hasVariants {
+		return models.ErrVariantQuantity
+	}
+	if payload.Quantity == nil && !hasVariants && len(current.Variants) > 0 {
+		return models.ErrQuantityRequired
+	}
+
+	if payload.Options != nil || payload.Variants != nil || payload.Price != nil {
+		options, variants, price := current.Options, current.Variants, current.Price
+		if payload.Options != nil {
+			options = *payload.Options
+		}
+		if payload.Variants != nil {
+			variants = *payload.Variants
+		}
+		if payload.Price != nil {
+			price = payload.Price
+		}
+		if err := models.ValidateVariants(options, variants, price); err != nil {
+			return err
+		}
+
+		if payload.Variants != nil {
+			total, reserved := models.PrepareVariants(*payload.Variants, current.Variants)
+			if err := models.CheckReservations(*payload.Variants, current.Variants); err != nil {
+				return err
+			}
+			// the reservations of a product without variants are not
+			// carried over to its new variants
+			if hasVariants && len(current.Variants) == 0 && current.Reserved > 0 {
+				return models.ErrQuantityReserved
+			}
+			if hasVariants {
+				payload.Quantity, payload.Reserved = &total, &reserved
+			}
+		}
+	}
+
+	if payload.Variants != nil {
+		payload.Reservations = current.StockReservations()
+	}
+	return nil
+}
+
+func (p ProductService) DeleteProduct(ctx context.Context, actor models.Actor, productId string) error {
+	if _, err := p.canChange(ctx, actor, productId); err != nil {
+		return err
+	}
+
+	if err := p.db.DeleteProduct(ctx, productId); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrProductNotFound
+		}
+		p.logger.WithError(err).Error(ErrDeleteProductFailed.Error())
+		return ErrDeleteProductFailed
+	}
+
+	if err := p.images.RemoveProduct(ctx, productId); err != nil {
+		p.logger.WithError(err).Error("failed to delete product images")
+	}
+
+	p.invalidateProducts(ctx)
+	return nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// invalidateProducts discards the cached product lists, it is called after
+// every product write.
+func (p ProductService) invalidateProducts(ctx context.Context) {
+	if err := p.products.Invalidate(ctx); err != nil {
+		p.logger.WithError(err).Error("failed to clear product cache")
+	}
+}
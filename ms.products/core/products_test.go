@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fredele20/microservice-practice/ms.products/database"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// productStore keeps one product in memory, the other store methods are
+// not used by these tests.
+type productStore struct {
+	database.DBInterface
+	product *models.Product
+	// updated is the payload of the last update
+	updated *models.UpdateProductRequest
+	// beforeUpdate runs before an update is written, to reserve stock
+	// concurrently
+	beforeUpdate func(product *models.Product)
+}
+
+func (s *productStore) GetProductById(ctx context.Context, productId string) (*models.Product, error) {
+	if s.product.ProductID != productId {
+		return nil, mongo.ErrNoDocuments
+	}
+	copied := *s.product
+	return &copied, nil
+}
+
+// UpdateProduct applies payload under the conditions of the mongo store.
+func (s *productStore) UpdateProduct(ctx context.Context, productId string, payload models.UpdateProductRequest) (*models.Product, error) {
+	if s.beforeUpdate != nil {
+		s.beforeUpdate(s.product)
+	}
+	if payload.Quantity != nil && *payload.Quantity < s.product.Reserved {
+		return nil, mongo.ErrNoDocuments
+	}
+	if payload.Reservations != nil && !reflect.DeepEqual(payload.Reservations, s.product.StockReservations()) {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	s.updated = &payload
+	if payload.Quantity != nil {
+		s.product.Quantity = *payload.Quantity
+	}
+	if payload.Reserved != nil {
+		s.product.Reserved = *payload.Reserved
+	}
+	if payload.Variants != nil {
+		variants := []*models.Variant{}
+		for _, variant := range *payload.Variants {
+			copied := *variant
+			variants = append(variants, &copied)
+		}
+		s.product.Variants = variants
+	}
+	copied := *s.product
+	return &copied, nil
+}
+
+// reserve reserves quantity of the variant variantId of product, like
+// ReserveProductQuantity.
+func reserve(variantId string, quantity int) func(product *models.Product) {
+	return func(product *models.Product) {
+		variant, _ := product.Variant(variantId)
+		variant.Reserved += quantity
+		product.Reserved += quantity
+	}
+}
+
+func TestUpdateProductVariants(t *testing.T) {
+	owner := models.Actor{UserId: "owner"}
+	options := []models.ProductOption{{Name: "size", Values: []string{"S", "M"}}}
+	noOptions := []models.ProductOption{}
+	quantity := 5
+
+	// withVariants returns a product with a small variant holding reserved
+	// units and a medium one
+	withVariants := func(reserved int) *models.Product {
+		return &models.Product{
+			ProductID: "product-1",
+			OwnerID:   owner.UserId,
+			Options:   options,
+			Variants: []*models.Variant{
+				{VariantId: "small", SKU: "TEE-S", Options: map[string]string{"size": "S"}, Quantity: 3, Reserved: reserved},
+				{VariantId: "medium", SKU: "TEE-M", Options: map[string]string{"size": "M"}, Quantity: 4},
+			},
+			Quantity: 7,
+			Reserved: reserved,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		product      *models.Product
+		payload      models.UpdateProductRequest
+		wantErr      error
+		wantQuantity int
+	}{
+		{
+			name:    "variants removed without qty",
+			product: withVariants(0),
+			payload: models.UpdateProductRequest{Options: &noOptions, Variants: &[]*models.Variant{}},
+			wantErr: models.ErrQuantityRequired,
+		},
+		{
+			name:         "variants removed with qty",
+			product:      withVariants(0),
+			payload:      models.UpdateProductRequest{Options: &noOptions, Variants: &[]*models.Variant{}, Quantity: &quantity},
+			wantQuantity: quantity,
+		},
+		{
+			name:    "reserved variants removed",
+			product: withVariants(1),
+			payload: models.UpdateProductRequest{Options: &noOptions, Variants: &[]*models.Variant{}, Quantity: &quantity},
+			wantErr: models.ErrQuantityReserved,
+		},
+		{
+			name:    "qty of a product with variants",
+			product: withVariants(0),
+			payload: models.UpdateProductRequest{Quantity: &quantity},
+			wantErr: models.ErrVariantQuantity,
+		},
+		{
+			name:    "variants replaced",
+			product: withVariants(1),
+			payload: models.UpdateProductRequest{Variants: &[]*models.Variant{
+				{SKU: "tee-s", Options: map[string]string{"size": "S"}, Quantity: 2},
+				{SKU: "TEE-M", Options: map[string]string{"size": "M"}, Quantity: 6},
+			}},
+			wantQuantity: 8,
+		},
+		{
+			name:         "qty of a product without variants",
+			product:      &models.Product{ProductID: "product-1", OwnerID: owner.UserId, Quantity: 1},
+			payload:      models.UpdateProductRequest{Quantity: &quantity},
+			wantQuantity: quantity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &productStore{product: tt.product}
+			product, err := newTestService(t, store).UpdateProduct(context.Background(), owner, "product-1", tt.payload)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateProduct() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if store.updated != nil {
+					t.Error("UpdateProduct() stored a rejected update")
+				}
+				return
+			}
+			if product.Quantity != tt.wantQuantity {
+				t.Errorf("qty = %d, want %d", product.Quantity, tt.wantQuantity)
+			}
+		})
+	}
+}
+
+func TestUpdateProductVariantsConcurrentReservation(t *testing.T) {
+	owner := models.Actor{UserId: "owner"}
+
+	tests := []struct {
+		name string
+		// reservations are made before each write of the update
+		reservations int
+		wantErr      error
+	}{
+		{name: "reserved once", reservations: 1},
+		{name: "reserved on every attempt", reservations: maxProductAttempts, wantErr: ErrProductChanged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &productStore{product: &models.Product{
+				ProductID: "product-1",
+				OwnerID:   owner.UserId,
+				Options:   []models.ProductOption{{Name: "size", Values: []string{"S", "M"}}},
+				Variants: []*models.Variant{
+					{VariantId: "small", SKU: "TEE-S", Options: map[string]string{"size": "S"}, Quantity: 3, Reserved: 1},
+					{VariantId: "medium", SKU: "TEE-M", Options: map[string]string{"size": "M"}, Quantity: 4},
+				},
+				Quantity: 7,
+				Reserved: 1,
+			}}
+			reservations := 0
+			store.beforeUpdate = func(product *models.Product) {
+				if reservations < tt.reservations {
+					reservations++
+					reserve("small", 1)(product)
+				}
+			}
+
+			_, err := newTestService(t, store).UpdateProduct(context.Background(), owner, "product-1", models.UpdateProductRequest{
+				Variants: &[]*models.Variant{
+					{SKU: "TEE-S", Options: map[string]string{"size": "S"}, Quantity: 5},
+					{SKU: "TEE-M", Options: map[string]string{"size": "M"}, Quantity: 4},
+				},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateProduct() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// no reservation is lost, whether the update applied or not
+			small, _ := store.product.Variant("small")
+			if want := 1 + tt.reservations; small.Reserved != want || store.product.Reserved != want {
+				t.Errorf("reserved = %d on the variant and %d on the product, want %d", small.Reserved, store.product.Reserved, want)
+			}
+			if err == nil && (small.Quantity != 5 || store.product.Quantity != 9) {
+				t.Errorf("qty = %d on the variant and %d on the product, want 5 and 9", small.Quantity, store.product.Quantity)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrOwnProductPurchase = errors.New("you can not purchase your own product")
+	ErrInsufficientStock  = errors.New("there is not enough of this product left")
+	ErrProductNotPriced   = errors.New("this product has no price and can not be bought")
+	ErrPurchaseFailed     = errors.New("failed to purchase product")
+)
+
+// PurchaseProduct takes the quantity bought from the stock of the product
+// and records the purchase, in an order of its own, in one transaction. The
+// stock is checked and decremented by a single conditional update, so
+// concurrent buyers can never take more than what is left.
+func (p ProductService) PurchaseProduct(ctx context.Context, buyer models.Actor, productId string, payload models.PurchaseRequest) (*models.PurchaseProduct, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	product, err := p.GetProductById(ctx, productId)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.OwnerID == buyer.UserId {
+		return nil, ErrOwnProductPurchase
+	}
+
+	variant, err := product.PickVariant(payload.VariantId)
+	if err != nil {
+		return nil, err
+	}
+	if product.PriceOf(variant) == nil {
+		return nil, ErrProductNotPriced
+	}
+
+	if product.Stock(variant) < payload.Quantity {
+		return nil, ErrInsufficientStock
+	}
+
+	var purchase *models.PurchaseProduct
+	err = p.db.WithTransaction(ctx, func(ctx context.Context) error {
+		_, purchases, err := p.placeOrder(ctx, buyer, []orderLine{{
+			productId:  productId,
+			variantId:  payload.VariantId,
+			quantity:   payload.Quantity,
+			sellerName: product.OwnerName,
+		}})
+		if err != nil {
+			return err
+		}
+		purchase = purchases[0]
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrProductNotPriced) {
+			return nil, err
+		}
+		p.logger.WithError(err).Error(ErrPurchaseFailed.Error())
+		return nil, ErrPurchaseFailed
+	}
+
+	p.invalidateProducts(ctx)
+	return purchase, nil
+}
+
+// purchaseRecord returns the purchase of quantity of variantId of product
+// by buyer, product is the product once its stock was taken. Products
+// without a price, such as those whose legacy price could not be read, can
+// not be bought.
+func purchaseRecord(buyer models.Actor, product *models.Product, variantId string, quantity int) (*models.PurchaseProduct, error) {
+	variant, err := product.PickVariant(variantId)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.PurchaseProduct{UnitPrice: product.PriceOf(variant)}
+	if record.UnitPrice == nil {
+		return nil, ErrProductNotPriced
+	}
+	if variant != nil {
+		record.VariantId, record.SKU, record.Options = variant.VariantId, variant.SKU, variant.Options
+	}
+
+	total := record.UnitPrice.Mul(int64(quantity))
+	record.Total = &total
+
+	record.ID = primitive.NewObjectID()
+	record.PurchaseId = record.ID.Hex()
+	record.ProductId = product.ProductID
+	record.ProductName = *product.Name
+	record.Quantity = quantity
+	record.SellerId = product.OwnerID
+	record.SellerName = product.OwnerName
+	record.BuyerId = buyer.UserId
+	record.BuyerName = buyer.Name
+	record.TransactionDate = time.Now()
+
+	return record, nil
+}
+
+var (
+	ErrInvalidDateRange    = errors.New("from must be before to")
+	ErrListPurchasesFailed = errors.New("failed to list purchases")
+	ErrSalesSummaryFailed  = errors.New("failed to summarize sales")
+)
+
+const (
+	defaultPurchasesLimit = 20
+	maxPurchasesLimit     = 100
+	defaultTopProducts    = 5
+	maxTopProducts        = 50
+)
+
+// ListPurchases returns the purchases made by buyerId.
+func (p ProductService) ListPurchases(ctx context.Context, buyerId string, filter models.PurchaseFilter) (*models.PurchaseList, error) {
+	filter.BuyerId, filter.SellerId, filter.Paid = buyerId, "", false
+	return p.listPurchases(ctx, filter)
+}
+
+// ListSales returns the paid purchases of the products of sellerId.
+func (p ProductService) ListSales(ctx context.Context, sellerId string, filter models.PurchaseFilter) (*models.PurchaseList, error) {
+	filter.BuyerId, filter.SellerId, filter.Paid = "", sellerId, true
+	return p.listPurchases(ctx, filter)
+}
+
+func (p ProductService) listPurchases(ctx context.Context, filter models.PurchaseFilter) (*models.PurchaseList, error) {
+	if filter.From != nil && filter.To != nil && filter.From.After(*filter.To) {
+		return nil, ErrInvalidDateRange
+	}
+	if filter.NextCursorId != nil && !primitive.IsValidObjectID(*filter.NextCursorId) {
+		return nil, models.ErrInvalidCursor
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPurchasesLimit
+	}
+	if filter.Limit > maxPurchasesLimit {
+		filter.Limit = maxPurchasesLimit
+	}
+
+	purchases, err := p.db.ListPurchases(ctx, filter)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrListPurchasesFailed.Error())
+		return nil, ErrListPurchasesFailed
+	}
+
+	return purchases, nil
+}
+
+// SalesSummary totals the units sold and revenue of the paid orders of
+// sellerId over a period, with their best selling products.
+func (p ProductService) SalesSummary(ctx context.Context, sellerId string, filter models.SalesSummaryFilter) (*models.SalesSummary, error) {
+	if filter.From != nil && filter.To != nil && filter.From.After(*filter.To) {
+		return nil, ErrInvalidDateRange
+	}
+	if filter.TopProducts <= 0 {
+		filter.TopProducts = defaultTopProducts
+	}
+	if filter.TopProducts > maxTopProducts {
+		filter.TopProducts = maxTopProducts
+	}
+	filter.SellerId = sellerId
+
+	summary, err := p.db.SalesSummary(ctx, filter)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrSalesSummaryFailed.Error())
+		return nil, ErrSalesSummaryFailed
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,16 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+)
+
+func TestPurchaseRecordWithoutPrice(t *testing.T) {
+	name := "Lamp"
+	product := &models.Product{ProductID: "lamp", Name: &name, Quantity: 5, OwnerID: "seller"}
+
+	if _, err := purchaseRecord(models.Actor{UserId: "buyer"}, product, "", 1); err != ErrProductNotPriced {
+		t.Errorf("purchaseRecord() error = %v, want %v", err, ErrProductNotPriced)
+	}
+}
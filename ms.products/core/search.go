@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+)
+
+var ErrSearchFailed = errors.New("failed to search products")
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+// SearchProducts returns the products matching the free text query, the
+// most relevant first.
+func (p ProductService) SearchProducts(ctx context.Context, query models.SearchQuery) (*models.SearchResult, error) {
+	query.Q = strings.TrimSpace(query.Q)
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	if query.Currency == "" {
+		query.Currency = models.DefaultCurrency
+	}
+	query.Currency = strings.ToUpper(query.Currency)
+	if err := models.NewMoney(0, query.Currency).Validate(); err != nil {
+		return nil, err
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultSearchLimit
+	}
+	if query.Limit > maxSearchLimit {
+		query.Limit = maxSearchLimit
+	}
+
+	result, err := p.search.Search(ctx, query)
+	if err != nil {
+		p.logger.WithError(err).Error(ErrSearchFailed.Error())
+		return nil, ErrSearchFailed
+	}
+
+	products := make([]*models.Product, 0, len(result.Data))
+	for _, hit := range result.Data {
+		products = append(products, hit.Product)
+	}
+	p.resolveOwners(ctx, products)
+	p.attachBreadcrumbs(ctx, products)
+
+	if len(result.Facets.Categories) > 0 {
+		if categories, err := p.listCategories(ctx); err == nil {
+			for _, facet := range result.Facets.Categories {
+				if category, ok := categories[facet.CategoryId]; ok {
+					facet.Name, facet.Slug = category.Name, category.Slug
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -2,11 +2,115 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.products/search"
 )
 
 type DBInterface interface {
+	// the store searches products on a text index
+	search.Engine
+
 	CreateProduct(ctx context.Context, payload *models.Product) (*models.Product, error)
 	GetProducts(ctx context.Context, filter models.ProductFilter) (*models.ProductList, error)
+	GetProductById(ctx context.Context, productId string) (*models.Product, error)
+	GetProductsByIds(ctx context.Context, productIds []string) ([]*models.Product, error)
+	// UpdateProduct fails with mongo.ErrNoDocuments when payload sets a
+	// quantity below the stock reserved for the product, or when the
+	// reservations of the product differ from payload.Reservations
+	UpdateProduct(ctx context.Context, productId string, payload models.UpdateProductRequest) (*models.Product, error)
+	DeleteProduct(ctx context.Context, productId string) error
+	// AddProductImage appends image to the images of a product, it returns
+	// mongo.ErrNoDocuments when the product already has maxImages images.
+	// The image becomes the primary image of a product without one.
+	AddProductImage(ctx context.Context, productId string, image *models.ProductImage, maxImages int) (*models.Product, error)
+	// SetProductImages replaces the images of a product with the same
+	// images in another order, it returns mongo.ErrNoDocuments when an
+	// image was added or removed meanwhile.
+	SetProductImages(ctx context.Context, productId string, images []*models.ProductImage) (*models.Product, error)
+	SetPrimaryImage(ctx context.Context, productId, imageId string) (*models.Product, error)
+	// RemoveProductImage removes an image from a product, the next image
+	// becomes primary when it was the primary one.
+	RemoveProductImage(ctx context.Context, productId, imageId string) (*models.Product, error)
+	CreateCategory(ctx context.Context, payload *models.Category) (*models.Category, error)
+	GetCategory(ctx context.Context, categoryId string) (*models.Category, error)
+	GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error)
+	ListCategories(ctx context.Context) ([]*models.Category, error)
+	UpdateCategory(ctx context.Context, payload *models.Category) (*models.Category, error)
+	SetCategoryPath(ctx context.Context, categoryId string, path []string) error
+	DeleteCategory(ctx context.Context, categoryId string) error
+
+	// MigratePrices converts the prices stored as strings to models.Money.
+	MigratePrices(ctx context.Context) (int64, error)
+	// MigrateSearchGrams stores the search grams of older products.
+	MigrateSearchGrams(ctx context.Context) (int64, error)
+
+	// WithTransaction runs fn in a transaction, every store call made with
+	// the context passed to fn is part of it. On a standalone server, which
+	// has no transactions, fn runs without one.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	// ReserveProductQuantity holds quantity of the available stock of a
+	// product, and of its variant variantId when it is not empty, in a
+	// single update. It returns mongo.ErrNoDocuments when the product or
+	// variant does not exist or has less than quantity available.
+	ReserveProductQuantity(ctx context.Context, productId, variantId string, quantity int) (*models.Product, error)
+	// CommitProductReservation takes a reserved quantity off the stock once
+	// the order holding it is paid.
+	CommitProductReservation(ctx context.Context, productId, variantId string, quantity int) error
+	// ReleaseProductReservation makes a reserved quantity available again.
+	ReleaseProductReservation(ctx context.Context, productId, variantId string, quantity int) error
+	// ReturnProductQuantity puts quantity back in the stock of a product,
+	// and of its variant variantId when it is not empty. Products and
+	// variants deleted meanwhile are left alone.
+	ReturnProductQuantity(ctx context.Context, productId, variantId string, quantity int) error
+	CreatePurchase(ctx context.Context, payload *models.PurchaseProduct) (*models.PurchaseProduct, error)
+	// CancelPurchases flags the purchases of an order as cancelled.
+	CancelPurchases(ctx context.Context, orderId string) error
+	// PayPurchases clears the pending flag of the purchases of a paid order.
+	PayPurchases(ctx context.Context, orderId string) error
+	ListPurchases(ctx context.Context, filter models.PurchaseFilter) (*models.PurchaseList, error)
+	SalesSummary(ctx context.Context, filter models.SalesSummaryFilter) (*models.SalesSummary, error)
+
+	// GetCart, SaveCart and DeleteCart keep the durable copy of the carts
+	// cached in redis, carts are deleted once past their ExpiresAt.
+	GetCart(ctx context.Context, key string) (*models.Cart, error)
+	// SaveCart stores cart over the version before cart.Version, and fails
+	// with mongo.ErrNoDocuments when the cart was saved meanwhile
+	SaveCart(ctx context.Context, cart *models.Cart) error
+	DeleteCart(ctx context.Context, key string) error
+
+	CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error)
+	GetOrder(ctx context.Context, orderId string) (*models.Order, error)
+	ListOrders(ctx context.Context, filter models.OrderFilter) (*models.OrderList, error)
+	// ListExpiredOrders returns the pending orders whose reservation ended
+	// before now, oldest first, and the cancelled orders whose stock is not
+	// all put back, leaving out the orders in skip.
+	ListExpiredOrders(ctx context.Context, now time.Time, skip []string, limit int64) ([]*models.Order, error)
+	// TransitionOrder stores the new status of order and of its items and
+	// appends event to its history. It returns mongo.ErrNoDocuments when the
+	// order is no longer in the from status or changed since it was read.
+	TransitionOrder(ctx context.Context, order *models.Order, from models.OrderStatus, event *models.OrderEvent) (*models.Order, error)
+	// MarkItemRestocked sets whether the stock of the item at index of an
+	// order is put back. It returns mongo.ErrNoDocuments when the item is
+	// marked restocked already.
+	MarkItemRestocked(ctx context.Context, orderId string, index int, restocked bool) error
+	// FinishRestock clears the RestockFrom of an order once all its stock
+	// is put back.
+	FinishRestock(ctx context.Context, orderId string) error
+
+	CreatePaymentIntent(ctx context.Context, intent *models.PaymentIntent) (*models.PaymentIntent, error)
+	GetPaymentIntentByKey(ctx context.Context, key string) (*models.PaymentIntent, error)
+	GetPaymentIntentByReference(ctx context.Context, provider, reference string) (*models.PaymentIntent, error)
+	ListOrderPayments(ctx context.Context, orderId string) ([]*models.PaymentIntent, error)
+	// UpdatePaymentIntent stores the status, reference and failure reason
+	// of intent. It returns mongo.ErrNoDocuments when the intent is no
+	// longer in the from status.
+	UpdatePaymentIntent(ctx context.Context, intent *models.PaymentIntent, from models.PaymentStatus) (*models.PaymentIntent, error)
+	// RecordPaymentEvent fails with a duplicate key error for an event
+	// already recorded.
+	RecordPaymentEvent(ctx context.Context, event *models.PaymentEvent) error
+	// ForgetPaymentEvent removes an event that failed to be handled, so
+	// that the provider can send it again.
+	ForgetPaymentEvent(ctx context.Context, provider, eventId string) error
 }
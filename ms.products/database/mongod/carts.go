@@ -0,0 +1,78 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (d DBStore) cartColl() *mongo.Collection {
+	return d.client.Database(d.dbName).Collection("carts")
+}
+
+func (d DBStore) ensureCartIndexes(ctx context.Context) error {
+	_, err := d.cartColl().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetName("cart_key").SetUnique(true),
+		},
+		{
+			// abandoned carts are deleted by mongo once they expire
+			Keys:    bson.D{{Key: "expiresat", Value: 1}},
+			Options: options.Index().SetName("cart_expiry").SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+func (d DBStore) GetProductsByIds(ctx context.Context, productIds []string) ([]*models.Product, error) {
+	cursor, err := d.productColl().Find(ctx, bson.M{"productid": bson.M{"$in": productIds}})
+	if err != nil {
+		return nil, err
+	}
+
+	products := []*models.Product{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (d DBStore) GetCart(ctx context.Context, key string) (*models.Cart, error) {
+	var cart models.Cart
+	if err := d.cartColl().FindOne(ctx, bson.M{"key": key}).Decode(&cart); err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
+
+func (d DBStore) SaveCart(ctx context.Context, cart *models.Cart) error {
+	filter := bson.M{"key": cart.Key, "version": cart.Version - 1}
+	if cart.Version == 1 {
+		// a new cart replaces an expired one mongo did not delete yet, and
+		// the carts saved before carts had a version have none
+		filter = bson.M{"key": cart.Key, "$or": bson.A{
+			bson.M{"version": bson.M{"$in": bson.A{0, nil}}},
+			bson.M{"expiresat": bson.M{"$lt": time.Now()}},
+		}}
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	_, err := d.cartColl().ReplaceOne(ctx, filter, cart, opts)
+	// the upsert collides with the cart saved meanwhile
+	if mongo.IsDuplicateKeyError(err) {
+		return mongo.ErrNoDocuments
+	}
+	return err
+}
+
+func (d DBStore) DeleteCart(ctx context.Context, key string) error {
+	_, err := d.cartColl().DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
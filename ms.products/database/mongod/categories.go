@@ -0,0 +1,98 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (d DBStore) categoryColl() *mongo.Collection {
+	return d.client.Database(d.dbName).Collection("categories")
+}
+
+func (d DBStore) CreateCategory(ctx context.Context, payload *models.Category) (*models.Category, error) {
+	if _, err := d.categoryColl().InsertOne(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (d DBStore) GetCategory(ctx context.Context, categoryId string) (*models.Category, error) {
+	var category models.Category
+	if err := d.categoryColl().FindOne(ctx, bson.M{"categoryid": categoryId}).Decode(&category); err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (d DBStore) GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	var category models.Category
+	if err := d.categoryColl().FindOne(ctx, bson.M{"slug": slug}).Decode(&category); err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+// ListCategories returns every category, the taxonomy is small enough to be
+// handled in memory.
+func (d DBStore) ListCategories(ctx context.Context) ([]*models.Category, error) {
+	cursor, err := d.categoryColl().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []*models.Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// UpdateCategory saves the name, slug, parent and path of payload.
+func (d DBStore) UpdateCategory(ctx context.Context, payload *models.Category) (*models.Category, error) {
+	var category models.Category
+	if err := d.categoryColl().FindOneAndUpdate(ctx, bson.M{"categoryid": payload.CategoryId}, bson.M{
+		"$set": bson.M{
+			"name":      payload.Name,
+			"slug":      payload.Slug,
+			"parentid":  payload.ParentId,
+			"path":      payload.Path,
+			"updatedat": time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&category); err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (d DBStore) SetCategoryPath(ctx context.Context, categoryId string, path []string) error {
+	_, err := d.categoryColl().UpdateOne(ctx, bson.M{"categoryid": categoryId}, bson.M{
+		"$set": bson.M{"path": path, "updatedat": time.Now()},
+	})
+	return err
+}
+
+// DeleteCategory deletes a category and removes it from its products.
+func (d DBStore) DeleteCategory(ctx context.Context, categoryId string) error {
+	result, err := d.categoryColl().DeleteOne(ctx, bson.M{"categoryid": categoryId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	_, err = d.productColl().UpdateMany(ctx, bson.M{"categories": categoryId}, bson.M{
+		"$pull": bson.M{"categories": categoryId},
+	})
+	return err
+}
@@ -0,0 +1,100 @@
+package mongod
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (d DBStore) updateProduct(ctx context.Context, filter, update bson.M) (*models.Product, error) {
+	var product models.Product
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := d.productColl().FindOneAndUpdate(ctx, filter, update, opts).Decode(&product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (d DBStore) AddProductImage(ctx context.Context, productId string, image *models.ProductImage, maxImages int) (*models.Product, error) {
+	product, err := d.updateProduct(ctx, bson.M{
+		"productid":                           productId,
+		fmt.Sprintf("images.%d", maxImages-1): bson.M{"$exists": false},
+	}, bson.M{
+		"$push": bson.M{"images": image},
+		"$set":  bson.M{"updatedat": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if product.PrimaryImageId != "" {
+		return product, nil
+	}
+
+	// only the first of concurrent uploads becomes the primary image
+	primary, err := d.updateProduct(ctx, bson.M{
+		"productid":      productId,
+		"primaryimageid": bson.M{"$in": bson.A{"", nil}},
+	}, bson.M{"$set": bson.M{"primaryimageid": image.ImageId}})
+	if err != nil {
+		return d.GetProductById(ctx, productId)
+	}
+
+	return primary, nil
+}
+
+func (d DBStore) SetProductImages(ctx context.Context, productId string, images []*models.ProductImage) (*models.Product, error) {
+	imageIds := make(bson.A, 0, len(images))
+	for _, image := range images {
+		imageIds = append(imageIds, image.ImageId)
+	}
+
+	return d.updateProduct(ctx, bson.M{
+		"productid":      productId,
+		"images":         bson.M{"$size": len(images)},
+		"images.imageid": bson.M{"$all": imageIds},
+	}, bson.M{"$set": bson.M{"images": images, "updatedat": time.Now()}})
+}
+
+func (d DBStore) SetPrimaryImage(ctx context.Context, productId, imageId string) (*models.Product, error) {
+	return d.updateProduct(ctx, bson.M{
+		"productid":      productId,
+		"images.imageid": imageId,
+	}, bson.M{"$set": bson.M{"primaryimageid": imageId, "updatedat": time.Now()}})
+}
+
+func (d DBStore) RemoveProductImage(ctx context.Context, productId, imageId string) (*models.Product, error) {
+	product, err := d.updateProduct(ctx, bson.M{
+		"productid":      productId,
+		"images.imageid": imageId,
+	}, bson.M{
+		"$pull": bson.M{"images": bson.M{"imageid": imageId}},
+		"$set":  bson.M{"updatedat": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if product.PrimaryImageId != imageId {
+		return product, nil
+	}
+
+	next := ""
+	if len(product.Images) > 0 {
+		next = product.Images[0].ImageId
+	}
+	primary, err := d.updateProduct(ctx, bson.M{
+		"productid":      productId,
+		"primaryimageid": imageId,
+	}, bson.M{"$set": bson.M{"primaryimageid": next}})
+	if err != nil {
+		return d.GetProductById(ctx, productId)
+	}
+
+	return primary, nil
+}
@@ -0,0 +1,121 @@
+package mongod
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+var tMoneyPointer = reflect.TypeOf(&models.Money{})
+
+// registry is the default registry with prices decoded by decodePrice.
+func registry() *bsoncodec.Registry {
+	return bson.NewRegistryBuilder().
+		RegisterTypeDecoder(tMoneyPointer, bsoncodec.ValueDecoderFunc(decodePrice)).
+		Build()
+}
+
+// decodePrice decodes the *models.Money fields. A legacy price that can not
+// be read, such as "$10" or "10 USD", is decoded as no price with a warning
+// instead of failing the whole document, it is left for an admin to fix.
+func decodePrice(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tMoneyPointer {
+		return bsoncodec.ValueDecoderError{Name: "decodePrice", Types: []reflect.Type{tMoneyPointer}, Received: val}
+	}
+
+	t, data, err := bsonrw.Copier{}.CopyValueToBytes(vr)
+	if err != nil {
+		return err
+	}
+	if t == bsontype.Null || t == bsontype.Undefined {
+		val.Set(reflect.Zero(tMoneyPointer))
+		return nil
+	}
+
+	var price models.Money
+	if err := price.UnmarshalBSONValue(t, data); err != nil {
+		if t == bsontype.String && errors.Is(err, models.ErrInvalidAmount) {
+			log.Printf("ignoring the legacy price %s, it is not a decimal amount", bson.RawValue{Type: t, Value: data})
+			val.Set(reflect.Zero(tMoneyPointer))
+			return nil
+		}
+		return err
+	}
+	val.Set(reflect.ValueOf(&price))
+	return nil
+}
+
+// MigratePrices rewrites the prices stored as decimal strings before
+// prices had a currency, in models.DefaultCurrency, and fills the total of
+// the purchases recorded with them. The prices that can not be read are
+// logged and left as they are. It returns the number of records updated
+// and can run again safely.
+func (d DBStore) MigratePrices(ctx context.Context) (int64, error) {
+	var updated int64
+
+	cursor, err := d.productColl().Find(ctx, bson.M{"price": bson.M{"$type": "string"}})
+	if err != nil {
+		return updated, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			log.Printf("skipping the price of product %v: %v", cursor.Current.Lookup("productid"), err)
+			continue
+		}
+		if product.Price == nil {
+			log.Printf("skipping the price of product %s, it can not be read", product.ProductID)
+			continue
+		}
+
+		if _, err := d.productColl().UpdateOne(ctx, bson.M{"productid": product.ProductID}, bson.M{
+			"$set": bson.M{"price": product.Price},
+		}); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+
+	purchases, err := d.PurchasedCollection().Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"unitprice": bson.M{"$type": "string"}},
+		bson.M{"unitprice": bson.M{"$ne": nil}, "total": nil},
+	}})
+	if err != nil {
+		return updated, err
+	}
+	defer purchases.Close(ctx)
+
+	for purchases.Next(ctx) {
+		var purchase models.PurchaseProduct
+		if err := purchases.Decode(&purchase); err != nil {
+			log.Printf("skipping the price of purchase %v: %v", purchases.Current.Lookup("purchaseid"), err)
+			continue
+		}
+		if purchase.UnitPrice == nil {
+			log.Printf("skipping the price of purchase %s, it can not be read", purchase.PurchaseId)
+			continue
+		}
+
+		total := purchase.UnitPrice.Mul(int64(purchase.Quantity))
+		if _, err := d.PurchasedCollection().UpdateOne(ctx, bson.M{"purchaseid": purchase.PurchaseId}, bson.M{
+			"$set": bson.M{"unitprice": purchase.UnitPrice, "total": total},
+		}); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, purchases.Err()
+}
@@ -0,0 +1,42 @@
+package mongod
+
+import (
+	"testing"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDecodePrice(t *testing.T) {
+	tests := []struct {
+		name  string
+		price interface{}
+		want  *models.Money
+	}{
+		{name: "money", price: bson.M{"amount": 1250, "currency": "EUR"}, want: &models.Money{Amount: 1250, Currency: "EUR"}},
+		{name: "legacy decimal", price: "12.50", want: &models.Money{Amount: 1250, Currency: models.DefaultCurrency}},
+		{name: "legacy with symbol", price: "$10"},
+		{name: "legacy with currency", price: "10 USD"},
+		{name: "null", price: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.M{"productid": "p1", "price": tt.price})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var product models.Product
+			if err := bson.UnmarshalWithRegistry(registry(), data, &product); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if (product.Price == nil) != (tt.want == nil) || (tt.want != nil && *product.Price != *tt.want) {
+				t.Errorf("Price = %v, want %v", product.Price, tt.want)
+			}
+			if product.ProductID != "p1" {
+				t.Errorf("ProductID = %q, want p1", product.ProductID)
+			}
+		})
+	}
+}
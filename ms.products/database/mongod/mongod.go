@@ -17,6 +17,8 @@ import (
 type DBStore struct {
 	client *mongo.Client
 	dbName string
+	// transactions is false on a standalone server, which rejects them
+	transactions bool
 	// collectionName string
 }
 
@@ -48,44 +50,250 @@ func (d DBStore) CreateProduct(ctx context.Context, payload *models.Product) (*m
 	return payload, nil
 }
 
-func (d DBStore) GetProducts(ctx context.Context, filters models.ProductFilter) (*models.ProductList, error) {
+type sortKey struct {
+	field string
+	order int
+	value interface{}
+}
 
-	opts := options.Find()
+// productSortKeys returns the fields a product list is sorted on, ending
+// with the product id so that the order is total, and their values in
+// after when it is set.
+func productSortKeys(sort models.ProductSort, after *models.ProductCursor) []sortKey {
+	var keys []sortKey
+	order := 1
+	switch sort {
+	case models.SortByNameDesc:
+		order = -1
+		fallthrough
+	case models.SortByName, "":
+		keys = []sortKey{{field: "name", order: order}}
+	case models.SortByPriceDesc:
+		order = -1
+		fallthrough
+	case models.SortByPrice:
+		keys = []sortKey{{field: "price.currency", order: 1}, {field: "price.amount", order: order}}
+	case models.SortByNewest:
+		order = -1
+		keys = []sortKey{{field: "createdat", order: order}}
+	}
+	keys = append(keys, sortKey{field: "productid", order: order})
 
-	if filters.Limit != 0 {
-		opts.SetLimit(filters.Limit)
+	if after != nil {
+		for i := range keys {
+			switch keys[i].field {
+			case "name":
+				keys[i].value = after.Name
+			case "price.currency":
+				if after.Price != nil {
+					keys[i].value = after.Price.Currency
+				}
+			case "price.amount":
+				if after.Price != nil {
+					keys[i].value = after.Price.Amount
+				}
+			case "createdat":
+				keys[i].value = after.CreatedAt
+			case "productid":
+				keys[i].value = after.ProductId
+			}
+		}
 	}
 
-	opts.SetSort(bson.M{"name": 1})
+	return keys
+}
 
+// afterFilter matches the products sorted after the values of keys: those
+// greater on the first key, or equal on it and greater on the next one...
+func afterFilter(keys []sortKey) bson.M {
+	var or bson.A
+	for i, key := range keys {
+		clause := bson.M{}
+		for _, previous := range keys[:i] {
+			clause[previous.field] = previous.value
+		}
+		operator := "$gt"
+		if key.order < 0 {
+			operator = "$lt"
+		}
+		clause[key.field] = bson.M{operator: key.value}
+		or = append(or, clause)
+	}
+	return bson.M{"$or": or}
+}
+
+func productFilter(filters models.ProductFilter) bson.M {
 	filter := bson.M{}
+	if filters.OwnerId != nil {
+		filter["ownerid"] = *filters.OwnerId
+	}
+	if filters.Category != nil {
+		filter["categories"] = bson.M{"$in": filters.CategoryIds}
+	}
+	if currency := filters.Currency(); currency != "" {
+		amount := bson.M{}
+		if filters.MinPrice != nil {
+			amount["$gte"] = filters.MinPrice.Amount
+		}
+		if filters.MaxPrice != nil {
+			amount["$lte"] = filters.MaxPrice.Amount
+		}
+		filter["price.currency"] = currency
+		filter["price.amount"] = amount
+	}
+	if filters.InStock {
+		filter["$expr"] = bson.M{"$gt": bson.A{availableStock("$"), 0}}
+	}
+	if created := dateRange(filters.CreatedFrom, filters.CreatedTo); created != nil {
+		filter["createdat"] = created
+	}
+	return filter
+}
 
-	var products []*models.Product
+func (d DBStore) GetProducts(ctx context.Context, filters models.ProductFilter) (*models.ProductList, error) {
+	filter := productFilter(filters)
 
-	cursor, err := d.productColl().Find(ctx, bson.M{}, opts)
+	count, err := d.productColl().CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
+	keys := productSortKeys(filters.Sort, filters.After)
+	sort := bson.D{}
+	for _, key := range keys {
+		sort = append(sort, bson.E{Key: key.field, Value: key.order})
+	}
+
+	if filters.After != nil {
+		filter = bson.M{"$and": bson.A{filter, afterFilter(keys)}}
+	}
+
+	// one more record than the limit tells whether there is a next page
+	opts := options.Find().SetSort(sort).SetLimit(filters.Limit + 1)
+
+	cursor, err := d.productColl().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []*models.Product{}
 	if err := cursor.All(ctx, &products); err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
-	count, err := d.productColl().CountDocuments(ctx, filter)
-	if err != nil {
+	list := &models.ProductList{Count: count}
+	if int64(len(products)) > filters.Limit {
+		products = products[:filters.Limit]
+		next := models.NewProductCursor(filters.Sort, products[len(products)-1]).Encode()
+		list.NextCursor = &next
+	}
+	list.Data = products
+
+	return list, nil
+}
+
+func (d DBStore) GetProductById(ctx context.Context, productId string) (*models.Product, error) {
+	var product models.Product
+	if err := d.productColl().FindOne(ctx, bson.M{"productid": productId}).Decode(&product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// UpdateProduct sets the fields of payload that are not nil. It returns
+// mongo.ErrNoDocuments when the product is missing, when the quantity is
+// lower than the reservations or when the reservations differ from
+// payload.Reservations.
+func (d DBStore) UpdateProduct(ctx context.Context, productId string, payload models.UpdateProductRequest) (*models.Product, error) {
+	set := bson.M{"updatedat": time.Now()}
+	if payload.Name != nil {
+		set["name"] = payload.Name
+	}
+	if payload.Description != nil {
+		set["description"] = payload.Description
+	}
+	if payload.Price != nil {
+		set["price"] = payload.Price
+	}
+	if payload.Quantity != nil {
+		set["quantity"] = *payload.Quantity
+	}
+	if payload.Reserved != nil {
+		set["reserved"] = *payload.Reserved
+	}
+	if payload.Categories != nil {
+		set["categories"] = *payload.Categories
+	}
+	if payload.Options != nil {
+		set["options"] = *payload.Options
+	}
+	if payload.Variants != nil {
+		set["variants"] = *payload.Variants
+	}
+	if payload.SearchGrams != nil {
+		set["searchgrams"] = payload.SearchGrams
+	}
+
+	var conditions bson.A
+	if payload.Quantity != nil {
+		// checked against the reservations made until the update
+		conditions = append(conditions, bson.M{"$gte": bson.A{*payload.Quantity, bson.M{"$ifNull": bson.A{"$reserved", 0}}}})
+	}
+	if reservations := payload.Reservations; reservations != nil {
+		conditions = append(conditions,
+			bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$reserved", 0}}, reservations.Reserved}},
+			bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$variants.variantid", bson.A{}}}, reservations.VariantIds}},
+			bson.M{"$eq": bson.A{bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$variants", bson.A{}}},
+				"as":    "variant",
+				"in":    bson.M{"$ifNull": bson.A{"$$variant.reserved", 0}},
+			}}, reservations.Variants}},
+		)
+	}
+
+	filter := bson.M{"productid": productId}
+	if len(conditions) > 0 {
+		filter["$expr"] = bson.M{"$and": conditions}
+	}
+
+	var product models.Product
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := d.productColl().FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, opts).Decode(&product); err != nil {
 		return nil, err
 	}
 
-	return &models.ProductList{
-		Data:  products,
-		Count: count,
-	}, nil
+	return &product, nil
+}
+
+func (d DBStore) DeleteProduct(ctx context.Context, productId string) error {
+	result, err := d.productColl().DeleteOne(ctx, bson.M{"productid": productId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
 
+	return nil
 }
 
 var ErrDuplicate = errors.New("duplicate record")
 
+// supportsTransactions reports whether the server is a replica set member
+// or a mongos, standalone servers reject transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err != nil {
+		// the transactions report the error themselves
+		return true
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
+}
+
 func DBInstance(connectionUri, databaseName string) (database.DBInterface, error) {
 	// err := godotenv.Load(".env")
 	// if err != nil {
@@ -96,7 +304,7 @@ func DBInstance(connectionUri, databaseName string) (database.DBInterface, error
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(connectionUri))
+	client, err := mongo.NewClient(options.Client().ApplyURI(connectionUri).SetRegistry(registry()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -109,5 +317,22 @@ func DBInstance(connectionUri, databaseName string) (database.DBInterface, error
 
 	fmt.Println("connected to MongoDB...")
 
-	return &DBStore{client: client, dbName: databaseName}, nil
+	store := &DBStore{client: client, dbName: databaseName, transactions: supportsTransactions(ctx, client)}
+	if !store.transactions {
+		log.Println("mongodb is a standalone server, orders and payments are written without transactions. Run a replica set in production, see DATABASE_URL in .env")
+	}
+	if err := store.ensureIndexes(ctx); err != nil {
+		log.Println("failed to create indexes: ", err)
+	}
+	if err := store.ensureCartIndexes(ctx); err != nil {
+		log.Println("failed to create cart indexes: ", err)
+	}
+	if err := store.ensureOrderIndexes(ctx); err != nil {
+		log.Println("failed to create order indexes: ", err)
+	}
+	if err := store.ensurePaymentIndexes(ctx); err != nil {
+		log.Println("failed to create payment indexes: ", err)
+	}
+
+	return store, nil
 }
@@ -0,0 +1,197 @@
+package mongod
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (d DBStore) orderColl() *mongo.Collection {
+	return d.client.Database(d.dbName).Collection("orders")
+}
+
+func (d DBStore) ensureOrderIndexes(ctx context.Context) error {
+	_, err := d.orderColl().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "orderid", Value: 1}},
+			Options: options.Index().SetName("order_id").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "buyerid", Value: 1}, {Key: "id", Value: -1}},
+			Options: options.Index().SetName("order_buyer"),
+		},
+		{
+			Keys:    bson.D{{Key: "sellerids", Value: 1}, {Key: "id", Value: -1}},
+			Options: options.Index().SetName("order_sellers"),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "reserveduntil", Value: 1}},
+			Options: options.Index().SetName("order_reservations"),
+		},
+		{
+			Keys:    bson.D{{Key: "restockfrom", Value: 1}},
+			Options: options.Index().SetName("order_restock"),
+		},
+	})
+	return err
+}
+
+func (d DBStore) CreateOrder(ctx context.Context, order *models.Order) (*models.Order, error) {
+	if _, err := d.orderColl().InsertOne(ctx, order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (d DBStore) GetOrder(ctx context.Context, orderId string) (*models.Order, error) {
+	var order models.Order
+	if err := d.orderColl().FindOne(ctx, bson.M{"orderid": orderId}).Decode(&order); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// ListOrders returns orders newest first, pages are cut on the order id like
+// the pages of ListPurchases.
+func (d DBStore) ListOrders(ctx context.Context, filters models.OrderFilter) (*models.OrderList, error) {
+	filter := bson.M{}
+	if filters.BuyerId != "" {
+		filter["buyerid"] = filters.BuyerId
+	}
+	if filters.SellerId != "" {
+		filter["sellerids"] = filters.SellerId
+	}
+	if filters.Status != "" {
+		filter["status"] = filters.Status
+	}
+
+	count, err := d.orderColl().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filters.NextCursorId != nil {
+		cursorId, err := primitive.ObjectIDFromHex(*filters.NextCursorId)
+		if err != nil {
+			return nil, err
+		}
+		filter["id"] = bson.M{"$lt": cursorId}
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"id": -1}).
+		SetLimit(filters.Limit + 1)
+
+	cursor, err := d.orderColl().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []*models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	list := &models.OrderList{Count: count}
+	if int64(len(orders)) > filters.Limit {
+		orders = orders[:filters.Limit]
+		next := orders[len(orders)-1].OrderId
+		list.NextCursorId = &next
+	}
+	list.Data = orders
+
+	return list, nil
+}
+
+func (d DBStore) ListExpiredOrders(ctx context.Context, now time.Time, skip []string, limit int64) ([]*models.Order, error) {
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"status": models.OrderPending, "reserveduntil": bson.M{"$lte": now}},
+			bson.M{"restockfrom": bson.M{"$nin": bson.A{nil, ""}}},
+		},
+	}
+	if len(skip) > 0 {
+		filter["orderid"] = bson.M{"$nin": skip}
+	}
+	opts := options.Find().
+		SetSort(bson.M{"reserveduntil": 1}).
+		SetLimit(limit)
+
+	cursor, err := d.orderColl().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []*models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (d DBStore) TransitionOrder(ctx context.Context, order *models.Order, from models.OrderStatus, event *models.OrderEvent) (*models.Order, error) {
+	// the events count as the version of the order, so that the sellers of
+	// an order do not overwrite the items moved by each other
+	filter := bson.M{
+		"orderid": order.OrderId,
+		"status":  from,
+		"events":  bson.M{"$size": len(order.Events)},
+	}
+	set := bson.M{
+		"status":         order.Status,
+		"paidat":         order.PaidAt,
+		"paymentid":      order.PaymentId,
+		"trackingnumber": order.TrackingNumber,
+		"restockfrom":    order.RestockFrom,
+		"updatedat":      event.At,
+	}
+	// only the fields sellers move, the restocked items are marked apart
+	for i, item := range order.Items {
+		set[fmt.Sprintf("items.%d.status", i)] = item.Status
+		set[fmt.Sprintf("items.%d.trackingnumber", i)] = item.TrackingNumber
+	}
+	update := bson.M{
+		"$set":  set,
+		"$push": bson.M{"events": event},
+	}
+
+	var updated models.Order
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := d.orderColl().FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (d DBStore) MarkItemRestocked(ctx context.Context, orderId string, index int, restocked bool) error {
+	field := fmt.Sprintf("items.%d.restocked", index)
+	filter := bson.M{"orderid": orderId}
+	if restocked {
+		filter[field] = bson.M{"$ne": true}
+	}
+
+	result, err := d.orderColl().UpdateOne(ctx, filter, bson.M{"$set": bson.M{field: restocked}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (d DBStore) FinishRestock(ctx context.Context, orderId string) error {
+	_, err := d.orderColl().UpdateOne(ctx, bson.M{"orderid": orderId}, bson.M{"$set": bson.M{"restockfrom": ""}})
+	return err
+}
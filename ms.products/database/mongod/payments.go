@@ -0,0 +1,119 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (d DBStore) paymentColl() *mongo.Collection {
+	return d.client.Database(d.dbName).Collection("payments")
+}
+
+func (d DBStore) paymentEventColl() *mongo.Collection {
+	return d.client.Database(d.dbName).Collection("paymentEvents")
+}
+
+func (d DBStore) ensurePaymentIndexes(ctx context.Context) error {
+	if _, err := d.paymentColl().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "intentid", Value: 1}},
+			Options: options.Index().SetName("payment_id").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetName("payment_key").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "reference", Value: 1}},
+			Options: options.Index().SetName("payment_reference"),
+		},
+		{
+			Keys:    bson.D{{Key: "orderid", Value: 1}},
+			Options: options.Index().SetName("payment_order"),
+		},
+	}); err != nil {
+		return err
+	}
+
+	_, err := d.paymentEventColl().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "eventid", Value: 1}},
+		Options: options.Index().SetName("payment_event").SetUnique(true),
+	})
+	return err
+}
+
+func (d DBStore) CreatePaymentIntent(ctx context.Context, intent *models.PaymentIntent) (*models.PaymentIntent, error) {
+	if _, err := d.paymentColl().InsertOne(ctx, intent); err != nil {
+		return nil, err
+	}
+
+	return intent, nil
+}
+
+func (d DBStore) findPaymentIntent(ctx context.Context, filter bson.M) (*models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	if err := d.paymentColl().FindOne(ctx, filter).Decode(&intent); err != nil {
+		return nil, err
+	}
+
+	return &intent, nil
+}
+
+func (d DBStore) GetPaymentIntentByKey(ctx context.Context, key string) (*models.PaymentIntent, error) {
+	return d.findPaymentIntent(ctx, bson.M{"key": key})
+}
+
+func (d DBStore) GetPaymentIntentByReference(ctx context.Context, provider, reference string) (*models.PaymentIntent, error) {
+	return d.findPaymentIntent(ctx, bson.M{"provider": provider, "reference": reference})
+}
+
+func (d DBStore) ListOrderPayments(ctx context.Context, orderId string) ([]*models.PaymentIntent, error) {
+	opts := options.Find().SetSort(bson.M{"id": 1})
+	cursor, err := d.paymentColl().Find(ctx, bson.M{"orderid": orderId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	intents := []*models.PaymentIntent{}
+	if err := cursor.All(ctx, &intents); err != nil {
+		return nil, err
+	}
+
+	return intents, nil
+}
+
+func (d DBStore) UpdatePaymentIntent(ctx context.Context, intent *models.PaymentIntent, from models.PaymentStatus) (*models.PaymentIntent, error) {
+	filter := bson.M{
+		"intentid": intent.IntentId,
+		"status":   from,
+	}
+	update := bson.M{"$set": bson.M{
+		"status":        intent.Status,
+		"reference":     intent.Reference,
+		"failurereason": intent.FailureReason,
+		"updatedat":     time.Now(),
+	}}
+
+	var updated models.PaymentIntent
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := d.paymentColl().FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (d DBStore) RecordPaymentEvent(ctx context.Context, event *models.PaymentEvent) error {
+	_, err := d.paymentEventColl().InsertOne(ctx, event)
+	return err
+}
+
+func (d DBStore) ForgetPaymentEvent(ctx context.Context, provider, eventId string) error {
+	_, err := d.paymentEventColl().DeleteOne(ctx, bson.M{"provider": provider, "eventid": eventId})
+	return err
+}
@@ -0,0 +1,322 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (d DBStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !d.transactions {
+		return fn(ctx)
+	}
+
+	session, err := d.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
+// availableStock computes the quantity less the reservations of the
+// product or variant document at prefix, "$" or "$$variant.".
+func availableStock(prefix string) bson.M {
+	return bson.M{"$subtract": bson.A{prefix + "quantity", bson.M{"$ifNull": bson.A{prefix + "reserved", 0}}}}
+}
+
+func (d DBStore) ReserveProductQuantity(ctx context.Context, productId, variantId string, quantity int) (*models.Product, error) {
+	available := bson.M{"$gte": bson.A{availableStock("$"), quantity}}
+	filter := bson.M{
+		"productid": productId,
+		"$expr":     available,
+	}
+	inc := bson.M{"reserved": quantity}
+	if variantId != "" {
+		// the variant is matched for the positional update, and its stock
+		// checked in $expr
+		filter["variants.variantid"] = variantId
+		filter["$expr"] = bson.M{"$and": bson.A{available, bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$variants", bson.A{}}},
+			"as":    "variant",
+			"in": bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$$variant.variantid", variantId}},
+				bson.M{"$gte": bson.A{availableStock("$$variant."), quantity}},
+			}},
+		}}}}}}
+		inc["variants.$.reserved"] = quantity
+	}
+	update := bson.M{
+		"$inc": inc,
+		"$set": bson.M{"updatedat": time.Now()},
+	}
+
+	var product models.Product
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if err := d.productColl().FindOneAndUpdate(ctx, filter, update, opts).Decode(&product); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (d DBStore) CommitProductReservation(ctx context.Context, productId, variantId string, quantity int) error {
+	return d.changeStock(ctx, productId, variantId, -quantity, -quantity)
+}
+
+func (d DBStore) ReleaseProductReservation(ctx context.Context, productId, variantId string, quantity int) error {
+	return d.changeStock(ctx, productId, variantId, 0, -quantity)
+}
+
+func (d DBStore) ReturnProductQuantity(ctx context.Context, productId, variantId string, quantity int) error {
+	return d.changeStock(ctx, productId, variantId, quantity, 0)
+}
+
+// changeStock adds quantity and reserved to the stock of a product and of
+// its variant variantId.
+func (d DBStore) changeStock(ctx context.Context, productId, variantId string, quantity, reserved int) error {
+	filter := bson.M{"productid": productId}
+	inc := bson.M{}
+	prefixes := []string{""}
+	if variantId != "" {
+		filter["variants.variantid"] = variantId
+		prefixes = append(prefixes, "variants.$.")
+	}
+	for _, prefix := range prefixes {
+		if quantity != 0 {
+			inc[prefix+"quantity"] = quantity
+		}
+		if reserved != 0 {
+			inc[prefix+"reserved"] = reserved
+		}
+	}
+	update := bson.M{
+		"$inc": inc,
+		"$set": bson.M{"updatedat": time.Now()},
+	}
+
+	_, err := d.productColl().UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (d DBStore) CancelPurchases(ctx context.Context, orderId string) error {
+	_, err := d.PurchasedCollection().UpdateMany(ctx, bson.M{"orderid": orderId}, bson.M{"$set": bson.M{"cancelled": true}})
+	return err
+}
+
+func (d DBStore) PayPurchases(ctx context.Context, orderId string) error {
+	_, err := d.PurchasedCollection().UpdateMany(ctx, bson.M{"orderid": orderId}, bson.M{"$set": bson.M{"pending": false}})
+	return err
+}
+
+func (d DBStore) CreatePurchase(ctx context.Context, payload *models.PurchaseProduct) (*models.PurchaseProduct, error) {
+	if _, err := d.PurchasedCollection().InsertOne(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// purchaseFilter matches the purchases of filter, without its cursor.
+func purchaseFilter(filters models.PurchaseFilter) bson.M {
+	filter := bson.M{}
+	if filters.BuyerId != "" {
+		filter["buyerid"] = filters.BuyerId
+	}
+	if filters.SellerId != "" {
+		filter["sellerid"] = filters.SellerId
+	}
+	if filters.ProductId != nil {
+		filter["productid"] = *filters.ProductId
+	}
+	if filters.Paid {
+		filter["pending"] = bson.M{"$ne": true}
+	}
+	if date := dateRange(filters.From, filters.To); date != nil {
+		filter["transactiondate"] = date
+	}
+	return filter
+}
+
+func dateRange(from, to *time.Time) bson.M {
+	if from == nil && to == nil {
+		return nil
+	}
+
+	date := bson.M{}
+	if from != nil {
+		date["$gte"] = *from
+	}
+	if to != nil {
+		date["$lte"] = *to
+	}
+	return date
+}
+
+// ListPurchases returns purchases newest first. Pages are cut on the
+// purchase id, which grows with time, so that purchases made while paging
+// do not shift the next pages.
+func (d DBStore) ListPurchases(ctx context.Context, filters models.PurchaseFilter) (*models.PurchaseList, error) {
+	filter := purchaseFilter(filters)
+
+	count, err := d.PurchasedCollection().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filters.NextCursorId != nil {
+		cursorId, err := primitive.ObjectIDFromHex(*filters.NextCursorId)
+		if err != nil {
+			return nil, err
+		}
+		filter["id"] = bson.M{"$lt": cursorId}
+	}
+
+	// one more record than the limit tells whether there is a next page
+	opts := options.Find().
+		SetSort(bson.M{"id": -1}).
+		SetLimit(filters.Limit + 1)
+
+	cursor, err := d.PurchasedCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	purchases := []*models.PurchaseProduct{}
+	if err := cursor.All(ctx, &purchases); err != nil {
+		return nil, err
+	}
+
+	list := &models.PurchaseList{Count: count}
+	if int64(len(purchases)) > filters.Limit {
+		purchases = purchases[:filters.Limit]
+		next := purchases[len(purchases)-1].PurchaseId
+		list.NextCursorId = &next
+	}
+	list.Data = purchases
+
+	return list, nil
+}
+
+// SalesSummary adds up the totals of the purchases, per currency since
+// amounts in different currencies can not be added.
+func (d DBStore) SalesSummary(ctx context.Context, filters models.SalesSummaryFilter) (*models.SalesSummary, error) {
+	match := purchaseFilter(models.PurchaseFilter{
+		SellerId: filters.SellerId,
+		Paid:     true,
+		From:     filters.From,
+		To:       filters.To,
+	})
+	// the purchases of cancelled orders were restocked
+	match["cancelled"] = bson.M{"$ne": true}
+
+	revenue := bson.M{"$push": bson.M{"amount": "$amount", "currency": "$_id.currency"}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":   nil,
+					"sales": bson.M{"$sum": 1},
+					"units": bson.M{"$sum": "$quantity"},
+				}},
+			},
+			"revenue": bson.A{
+				bson.M{"$match": bson.M{"total": bson.M{"$ne": nil}}},
+				bson.M{"$group": bson.M{
+					"_id":    bson.M{"currency": "$total.currency"},
+					"amount": bson.M{"$sum": "$total.amount"},
+				}},
+				bson.M{"$group": bson.M{"_id": nil, "revenue": revenue}},
+			},
+			"products": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":         bson.M{"productid": "$productid", "currency": "$total.currency"},
+					"productname": bson.M{"$last": "$productname"},
+					"units":       bson.M{"$sum": "$quantity"},
+					"amount":      bson.M{"$sum": "$total.amount"},
+				}},
+				bson.M{"$group": bson.M{
+					"_id":         "$_id.productid",
+					"productname": bson.M{"$last": "$productname"},
+					"units":       bson.M{"$sum": "$units"},
+					"revenue":     revenue,
+				}},
+				bson.M{"$sort": bson.D{{Key: "units", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": filters.TopProducts},
+			},
+		}}},
+	}
+
+	cursor, err := d.PurchasedCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Totals []struct {
+			Sales int64 `bson:"sales"`
+			Units int64 `bson:"units"`
+		} `bson:"totals"`
+		Revenue []struct {
+			Revenue []models.Money `bson:"revenue"`
+		} `bson:"revenue"`
+		Products []struct {
+			ProductId   string         `bson:"_id"`
+			ProductName string         `bson:"productname"`
+			Units       int64          `bson:"units"`
+			Revenue     []models.Money `bson:"revenue"`
+		} `bson:"products"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	summary := &models.SalesSummary{
+		From:        filters.From,
+		To:          filters.To,
+		Revenue:     []models.Money{},
+		TopProducts: []*models.ProductSales{},
+	}
+	if len(results) == 0 {
+		return summary, nil
+	}
+
+	if len(results[0].Totals) > 0 {
+		summary.Sales, summary.Units = results[0].Totals[0].Sales, results[0].Totals[0].Units
+	}
+	if len(results[0].Revenue) > 0 {
+		summary.Revenue = withCurrency(results[0].Revenue[0].Revenue)
+	}
+	for _, product := range results[0].Products {
+		summary.TopProducts = append(summary.TopProducts, &models.ProductSales{
+			ProductId:   product.ProductId,
+			ProductName: product.ProductName,
+			Units:       product.Units,
+			Revenue:     withCurrency(product.Revenue),
+		})
+	}
+
+	return summary, nil
+}
+
+// withCurrency drops the amounts of purchases recorded without a price.
+func withCurrency(amounts []models.Money) []models.Money {
+	result := []models.Money{}
+	for _, amount := range amounts {
+		if amount.Currency != "" {
+			result = append(result, amount)
+		}
+	}
+	return result
+}
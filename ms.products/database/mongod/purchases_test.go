@@ -0,0 +1,27 @@
+package mongod
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPurchaseFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter models.PurchaseFilter
+		want   bson.M
+	}{
+		{name: "purchases of a buyer", filter: models.PurchaseFilter{BuyerId: "buyer"}, want: bson.M{"buyerid": "buyer"}},
+		{name: "paid sales of a seller", filter: models.PurchaseFilter{SellerId: "seller", Paid: true}, want: bson.M{"sellerid": "seller", "pending": bson.M{"$ne": true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := purchaseFilter(tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("purchaseFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
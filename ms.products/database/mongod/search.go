@@ -0,0 +1,254 @@
+package mongod
+
+import (
+	"context"
+	"math"
+	"unicode/utf8"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.products/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// minFuzzyScore is the share of the trigrams of the query a product must
+// have to match a fuzzy search.
+const minFuzzyScore = 0.3
+
+func (d DBStore) ensureIndexes(ctx context.Context) error {
+	if _, err := d.categoryColl().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetName("category_slug").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "categoryid", Value: 1}},
+			Options: options.Index().SetName("category_id").SetUnique(true),
+		},
+	}); err != nil {
+		return err
+	}
+
+	_, err := d.productColl().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().
+				SetName("product_search").
+				SetWeights(bson.M{"name": 10, "description": 2}),
+		},
+		{
+			Keys:    bson.D{{Key: "searchgrams", Value: 1}},
+			Options: options.Index().SetName("product_search_grams"),
+		},
+		{
+			Keys:    bson.D{{Key: "categories", Value: 1}},
+			Options: options.Index().SetName("product_categories"),
+		},
+	})
+	return err
+}
+
+// Search ranks products on the text index, and falls back to the trigrams
+// of their name and description when no word of the query matches.
+func (d DBStore) Search(ctx context.Context, query models.SearchQuery) (*models.SearchResult, error) {
+	result, err := d.search(ctx, query,
+		bson.M{"$text": bson.M{"$search": query.Q}},
+		bson.M{"$meta": "textScore"},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	result.Mode = models.SearchText
+
+	terms := search.Terms(query.Q)
+	if result.Count == 0 {
+		grams := search.Grams(query.Q)
+		if len(grams) == 0 {
+			return result, nil
+		}
+
+		shared := bson.M{"$size": bson.M{"$setIntersection": bson.A{bson.M{"$ifNull": bson.A{"$searchgrams", bson.A{}}}, grams}}}
+		result, err = d.search(ctx, query,
+			bson.M{"searchgrams": bson.M{"$in": grams}},
+			bson.M{"$divide": bson.A{shared, len(grams)}},
+			bson.M{"score": bson.M{"$gte": minFuzzyScore}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.Mode = models.SearchFuzzy
+
+		// typos are usually not in the first letters of a word
+		for i, term := range terms {
+			if utf8.RuneCountInString(term) > 3 {
+				terms[i] = string([]rune(term)[:3])
+			}
+		}
+	}
+
+	for _, hit := range result.Data {
+		hit.Highlights = map[string]string{}
+		if hit.Name != nil {
+			hit.Highlights["name"] = search.Highlight(*hit.Name, terms)
+		}
+		if hit.Description != nil {
+			hit.Highlights["description"] = search.Highlight(*hit.Description, terms)
+		}
+	}
+
+	return result, nil
+}
+
+// search returns a page of the products matching match, sorted on score,
+// with the price facets of all of them.
+func (d DBStore) search(ctx context.Context, query models.SearchQuery, match, score, minScore bson.M) (*models.SearchResult, error) {
+	bounds := search.PriceBuckets(query.Currency)
+	boundaries := bson.A{}
+	for _, bound := range bounds {
+		boundaries = append(boundaries, bound)
+	}
+	boundaries = append(boundaries, int64(math.MaxInt64))
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.M{"score": score}}},
+	}
+	if minScore != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: minScore}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.M{
+		"hits": bson.A{
+			bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "name", Value: 1}, {Key: "productid", Value: 1}}},
+			bson.M{"$skip": query.Page * query.Limit},
+			bson.M{"$limit": query.Limit},
+		},
+		"count": bson.A{
+			bson.M{"$count": "count"},
+		},
+		"categories": bson.A{
+			bson.M{"$unwind": "$categories"},
+			bson.M{"$group": bson.M{"_id": "$categories", "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		},
+		"price": bson.A{
+			bson.M{"$match": bson.M{"price.currency": query.Currency}},
+			bson.M{"$bucket": bson.M{
+				"groupBy":    "$price.amount",
+				"boundaries": boundaries,
+				"default":    "other",
+				"output":     bson.M{"count": bson.M{"$sum": 1}},
+			}},
+		},
+	}}})
+
+	cursor, err := d.productColl().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Hits []struct {
+			models.Product `bson:",inline"`
+			Score          float64 `bson:"score"`
+		} `bson:"hits"`
+		Count []struct {
+			Count int64 `bson:"count"`
+		} `bson:"count"`
+		Categories []struct {
+			CategoryId string `bson:"_id"`
+			Count      int64  `bson:"count"`
+		} `bson:"categories"`
+		Price []struct {
+			Min   interface{} `bson:"_id"`
+			Count int64       `bson:"count"`
+		} `bson:"price"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	result := &models.SearchResult{
+		Data: []*models.SearchHit{},
+		Facets: &models.SearchFacets{
+			Price:      []*models.PriceBucket{},
+			Categories: []*models.CategoryFacet{},
+		},
+	}
+	if len(results) == 0 {
+		return result, nil
+	}
+
+	for i := range results[0].Hits {
+		hit := results[0].Hits[i]
+		product := hit.Product
+		result.Data = append(result.Data, &models.SearchHit{Product: &product, Score: hit.Score})
+	}
+	if len(results[0].Count) > 0 {
+		result.Count = results[0].Count[0].Count
+	}
+
+	for _, category := range results[0].Categories {
+		result.Facets.Categories = append(result.Facets.Categories, &models.CategoryFacet{
+			CategoryId: category.CategoryId,
+			Count:      category.Count,
+		})
+	}
+
+	counts := map[int64]int64{}
+	for _, bucket := range results[0].Price {
+		if min, ok := bucket.Min.(int64); ok {
+			counts[min] = bucket.Count
+		}
+	}
+	for i, bound := range bounds {
+		bucket := &models.PriceBucket{
+			Min:   models.NewMoney(bound, query.Currency),
+			Count: counts[bound],
+		}
+		if i+1 < len(bounds) {
+			max := models.NewMoney(bounds[i+1], query.Currency)
+			bucket.Max = &max
+		}
+		result.Facets.Price = append(result.Facets.Price, bucket)
+	}
+
+	return result, nil
+}
+
+// MigrateSearchGrams stores the search grams of the products created before
+// they were kept. It returns the number of products updated.
+func (d DBStore) MigrateSearchGrams(ctx context.Context) (int64, error) {
+	var updated int64
+
+	cursor, err := d.productColl().Find(ctx, bson.M{"searchgrams": nil})
+	if err != nil {
+		return updated, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			return updated, err
+		}
+
+		var name, description string
+		if product.Name != nil {
+			name = *product.Name
+		}
+		if product.Description != nil {
+			description = *product.Description
+		}
+
+		if _, err := d.productColl().UpdateOne(ctx, bson.M{"productid": product.ProductID}, bson.M{
+			"$set": bson.M{"searchgrams": search.Grams(name, description)},
+		}); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, cursor.Err()
+}
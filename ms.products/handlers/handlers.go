@@ -2,22 +2,63 @@ package handlers
 
 import (
 	"github.com/fredele20/microservice-practice/ms.products/middlewares"
+	"github.com/fredele20/microservice-practice/ms.products/models"
 	"github.com/fredele20/microservice-practice/ms.products/routes"
+	"github.com/fredele20/microservice-practice/ms.users/libs/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
 type Handlers struct {
 	handler *routes.RouteService
+	limiter *ratelimit.Limiter
 }
 
-func NewHandlers(handler *routes.RouteService) *Handlers {
+func NewHandlers(handler *routes.RouteService, limiter *ratelimit.Limiter) *Handlers {
 	return &Handlers{
 		handler: handler,
+		limiter: limiter,
 	}
 }
 
 func RouteHandlers(incomingRoutes *gin.Engine, h Handlers) {
 	incomingRoutes.GET("/products", h.handler.GetProducts())
+	incomingRoutes.GET("/products/search", h.handler.SearchProducts())
+	incomingRoutes.GET("/products/:id", h.handler.GetProduct())
+	incomingRoutes.GET("/categories", h.handler.CategoryTree())
+	incomingRoutes.GET("/categories/:id", h.handler.GetCategory())
+	incomingRoutes.GET("/files/*key", h.handler.ImageFile())
+	incomingRoutes.POST("/payments/webhooks/:provider", h.handler.PaymentWebhook())
+	// carts can be filled before signing in, see RouteService.MergeCart
+	incomingRoutes.GET("/cart", middlewares.OptionalAuthentication(), h.handler.GetCart())
+	incomingRoutes.POST("/cart/items", h.limiter.Route("cart.write", ratelimit.ByIP), middlewares.OptionalAuthentication(), h.handler.AddCartItem())
+	incomingRoutes.PATCH("/cart/items/:item_id", middlewares.OptionalAuthentication(), h.handler.UpdateCartItem())
+	incomingRoutes.DELETE("/cart/items/:item_id", middlewares.OptionalAuthentication(), h.handler.RemoveCartItem())
+	incomingRoutes.DELETE("/cart", middlewares.OptionalAuthentication(), h.handler.ClearCart())
 	incomingRoutes.Use(middlewares.Authentication())
-	incomingRoutes.POST("/products", h.handler.CreateProduct())
+	incomingRoutes.POST("/products", h.limiter.Route("products.create", ratelimit.ByContextValue("userId")), h.handler.CreateProduct())
+	incomingRoutes.PATCH("/products/:id", h.handler.UpdateProduct())
+	incomingRoutes.DELETE("/products/:id", h.handler.DeleteProduct())
+	incomingRoutes.POST("/products/:id/purchase", h.handler.PurchaseProduct())
+	incomingRoutes.POST("/products/:id/images", h.handler.UploadImage())
+	incomingRoutes.PUT("/products/:id/images/order", h.handler.ReorderImages())
+	incomingRoutes.PUT("/products/:id/images/:image_id/primary", h.handler.SetPrimaryImage())
+	incomingRoutes.DELETE("/products/:id/images/:image_id", h.handler.DeleteImage())
+	incomingRoutes.POST("/categories", h.handler.CreateCategory())
+	incomingRoutes.PATCH("/categories/:id", h.handler.UpdateCategory())
+	incomingRoutes.DELETE("/categories/:id", h.handler.DeleteCategory())
+	incomingRoutes.POST("/cart/merge", h.handler.MergeCart())
+	incomingRoutes.POST("/cart/checkout", h.handler.Checkout())
+	incomingRoutes.GET("/orders", h.handler.ListOrders())
+	incomingRoutes.GET("/orders/sales", h.handler.ListSellerOrders())
+	incomingRoutes.GET("/orders/:id", h.handler.GetOrder())
+	incomingRoutes.GET("/orders/:id/payments", h.handler.ListOrderPayments())
+	incomingRoutes.POST("/orders/:id/pay", h.handler.PayOrder())
+	incomingRoutes.POST("/orders/:id/fulfill", h.handler.TransitionOrder(models.OrderFulfill))
+	incomingRoutes.POST("/orders/:id/ship", h.handler.TransitionOrder(models.OrderShip))
+	incomingRoutes.POST("/orders/:id/deliver", h.handler.TransitionOrder(models.OrderDeliver))
+	incomingRoutes.POST("/orders/:id/cancel", h.handler.TransitionOrder(models.OrderCancel))
+	incomingRoutes.POST("/orders/:id/refund", h.handler.TransitionOrder(models.OrderRefund))
+	incomingRoutes.GET("/purchases", h.handler.ListPurchases())
+	incomingRoutes.GET("/sales", h.handler.ListSales())
+	incomingRoutes.GET("/sales/summary", h.handler.SalesSummary())
 }
@@ -0,0 +1,124 @@
+// Package images processes the uploaded pictures of products into resized
+// renditions kept in a blob store.
+package images
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.users/libs/blob"
+	"github.com/fredele20/microservice-practice/ms.users/libs/imaging"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rendition is a resized copy of every upload. Square renditions are
+// cropped to their center, the others keep the aspect ratio of the upload
+// and fit in a Pixels x Pixels box.
+type Rendition struct {
+	Name   string
+	Pixels int
+	Square bool
+}
+
+// Renditions are produced from every upload, the first one is the largest.
+var Renditions = []Rendition{
+	{Name: "large", Pixels: 1600},
+	{Name: "medium", Pixels: 800},
+	{Name: "small", Pixels: 400},
+	{Name: "thumb", Pixels: 200, Square: true},
+}
+
+// KeyPrefix is the prefix of every key written by Images.
+const KeyPrefix = "products/"
+
+type Images struct {
+	store  blob.Store
+	limits imaging.Limits
+}
+
+func NewImages(store blob.Store) *Images {
+	return &Images{
+		store:  store,
+		limits: imaging.DefaultLimits,
+	}
+}
+
+// Limits returns the limits uploads are checked against.
+func (i *Images) Limits() imaging.Limits {
+	return i.limits
+}
+
+// Process validates the uploaded image, resizes it into every rendition and
+// stores them under a new prefix. Nothing is left in the store when it
+// fails.
+func (i *Images) Process(ctx context.Context, productId string, r io.Reader) (*models.ProductImage, error) {
+	img, contentType, err := imaging.Decode(r, i.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	imageId := primitive.NewObjectID().Hex()
+	outputType := imaging.OutputType(contentType)
+	bounds := img.Bounds()
+	productImage := &models.ProductImage{
+		ImageId:     imageId,
+		Prefix:      productPrefix(productId) + imageId,
+		URLs:        map[string]string{},
+		ContentType: outputType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		UploadedAt:  time.Now(),
+	}
+
+	for _, rendition := range Renditions {
+		var resized image.Image
+		if rendition.Square {
+			resized = imaging.Square(img, rendition.Pixels)
+		} else {
+			resized = imaging.Fit(img, rendition.Pixels, rendition.Pixels)
+		}
+
+		var buf bytes.Buffer
+		if _, err := imaging.Encode(&buf, resized, outputType); err != nil {
+			i.store.DeletePrefix(ctx, productImage.Prefix)
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s/%s%s", productImage.Prefix, rendition.Name, imaging.Extension(outputType))
+		if err := i.store.Put(ctx, key, outputType, &buf); err != nil {
+			i.store.DeletePrefix(ctx, productImage.Prefix)
+			return nil, err
+		}
+		productImage.URLs[rendition.Name] = i.store.URL(key)
+	}
+
+	return productImage, nil
+}
+
+// Remove deletes every rendition of image.
+func (i *Images) Remove(ctx context.Context, image *models.ProductImage) error {
+	if image == nil || image.Prefix == "" {
+		return nil
+	}
+	return i.store.DeletePrefix(ctx, image.Prefix)
+}
+
+// RemoveProduct deletes every image of a product, including uploads that
+// were never attached to it.
+func (i *Images) RemoveProduct(ctx context.Context, productId string) error {
+	return i.store.DeletePrefix(ctx, productPrefix(productId))
+}
+
+// Open returns a stored image file and its content type.
+func (i *Images) Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	return i.store.Open(ctx, key)
+}
+
+func productPrefix(productId string) string {
+	return KeyPrefix + productId + "/"
+}
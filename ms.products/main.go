@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/fredele20/microservice-practice/ms.products/cache"
 	"github.com/fredele20/microservice-practice/ms.products/config"
 	"github.com/fredele20/microservice-practice/ms.products/core"
 	"github.com/fredele20/microservice-practice/ms.products/database/mongod"
 	"github.com/fredele20/microservice-practice/ms.products/handlers"
+	"github.com/fredele20/microservice-practice/ms.products/images"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.products/payments"
 	"github.com/fredele20/microservice-practice/ms.products/routes"
+	"github.com/fredele20/microservice-practice/ms.users/libs/blob"
+	"github.com/fredele20/microservice-practice/ms.users/libs/ratelimit"
+	"github.com/fredele20/microservice-practice/ms.users/libs/userclient"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -38,15 +46,65 @@ func main() {
 
 	router := gin.New()
 	router.Use(gin.Logger())
+	if err := ratelimit.TrustProxies(router, secrets.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
 
 	// var client *mongo.Client
 	db, _ := mongod.DBInstance(secrets.DatabaseURL, secrets.DatabaseName)
 
-	core := core.NewProductService(db, logger, redis)
+	if err := models.NewMoney(0, secrets.DefaultCurrency).Validate(); err != nil {
+		log.Fatalf("invalid DEFAULT_CURRENCY %q: %v", secrets.DefaultCurrency, err)
+	}
+	models.DefaultCurrency = secrets.DefaultCurrency
+
+	migrateCtx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	if migrated, err := db.MigratePrices(migrateCtx); err != nil {
+		logger.WithError(err).Error("failed to migrate product prices")
+	} else if migrated > 0 {
+		logger.WithField("records", migrated).Info("migrated product prices")
+	}
+	if migrated, err := db.MigrateSearchGrams(migrateCtx); err != nil {
+		logger.WithError(err).Error("failed to migrate product search grams")
+	} else if migrated > 0 {
+		logger.WithField("records", migrated).Info("migrated product search grams")
+	}
+	cancel()
+
+	var users *userclient.Client
+	if secrets.UsersServiceURL != "" {
+		users = userclient.New(secrets.UsersServiceURL, secrets.ServiceToken)
+	}
+
+	blobs, err := blob.NewLocalStore(secrets.BlobDir, secrets.PublicURL+"/files")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var provider payments.Provider
+	switch secrets.PaymentProvider {
+	case "fake":
+		provider = payments.NewFake(secrets.PaymentWebhookSecret)
+	default:
+		log.Fatalf("unknown payment provider %q", secrets.PaymentProvider)
+	}
+
+	// products are searched on the text index of the store, until another
+	// search.Engine is configured
+	core := core.NewProductService(db, logger, redis, users, db, images.NewImages(blobs), provider)
+
+	// pending orders that are not paid in time give their stock back
+	go core.ReleaseReservations(context.Background(), time.Minute)
 
 	routes := routes.NewRouteService(core)
 
-	handler := handlers.NewHandlers(routes)
+	limits := ratelimit.Limits{
+		"products.create": {Requests: 30, Period: time.Minute, Algorithm: ratelimit.TokenBucket},
+		"cart.write":      {Requests: 120, Period: time.Minute, Algorithm: ratelimit.SlidingWindow},
+	}.Merge(secrets.RateLimits)
+	limiter := ratelimit.NewLimiter(secrets.RedisAddress, "ms.products", limits, logger)
+
+	handler := handlers.NewHandlers(routes, limiter)
 
 	handlers.RouteHandlers(router, *handler)
 
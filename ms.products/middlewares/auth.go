@@ -28,7 +28,23 @@ func Authentication() gin.HandlerFunc {
 		ctx.Set("firstName", claims.FirstName)
 		ctx.Set("lastName", claims.LastName)
 		ctx.Set("userId", claims.UserId)
+		ctx.Set("userType", claims.UserType)
+		ctx.Set("organizationId", claims.OrganizationId)
+		ctx.Set("organizationRole", claims.OrganizationRole)
 		// ctx.Set("expiresAt", claims.ExpiresAt)
 		ctx.Next()
 	}
 }
+
+// OptionalAuthentication reads the token of signed in users like
+// Authentication, but lets anonymous requests through.
+func OptionalAuthentication() gin.HandlerFunc {
+	authenticate := Authentication()
+	return func(ctx *gin.Context) {
+		if ctx.Request.Header.Get("token") == "" {
+			ctx.Next()
+			return
+		}
+		authenticate(ctx)
+	}
+}
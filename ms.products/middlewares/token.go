@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -12,9 +13,26 @@ type SignedDetails struct {
 	FirstName string
 	LastName  string
 	UserId    string
+	// UserType is signed by ms.users as the client claim, see
+	// session.TokenPayload
+	UserType         string `json:"client"`
+	OrganizationId   string
+	OrganizationRole string
+	// Actor is set on the impersonation tokens of ms.users and Purpose on
+	// its tokens that do not sign in, such as password reset tokens. Both
+	// are refused here: ms.products can not tell whether an impersonation
+	// was ended nor mark the actions taken during one.
+	Actor   string `json:"actor"`
+	Purpose string `json:"purpose"`
 	jwt.StandardClaims
 }
 
+var (
+	errImpersonationToken = errors.New("impersonation sessions can not be used on this service")
+	errTokenPurpose       = errors.New("this token can not be used to sign in")
+	errTokenNoExpiry      = errors.New("the token has no expiry")
+)
+
 var SECRET_KEY string = os.Getenv("JWT_SECRET")
 
 func ValidateToken(signedToken string) (claim *SignedDetails, msg string) {
@@ -38,6 +56,17 @@ func ValidateToken(signedToken string) (claim *SignedDetails, msg string) {
 		return
 	}
 
+	// the expiry is checked by ParseWithClaims when it is set, ms.users
+	// sets one on every token
+	switch {
+	case claims.ExpiresAt == 0:
+		return nil, errTokenNoExpiry.Error()
+	case claims.Actor != "":
+		return nil, errImpersonationToken.Error()
+	case claims.Purpose != "":
+		return nil, errTokenPurpose.Error()
+	}
+
 	// if claims.ExpiresAt < time.Now().Local().Unix() {
 	// 	msg = fmt.Sprintf("token has expired")
 	// 	// msg = err.Error()
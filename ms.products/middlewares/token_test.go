@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/gin-gonic/gin"
+)
+
+// usersToken signs payload the way ms.users does.
+func usersToken(t *testing.T, payload session.TokenPayload) string {
+	t.Helper()
+	payload.Payload = jwt.Payload{
+		Issuer:         "Golang",
+		IssuedAt:       jwt.NumericDate(time.Now()),
+		ExpirationTime: jwt.NumericDate(time.Now().Add(time.Hour)),
+	}
+	token, err := jwt.Sign(payload, jwt.NewHS256([]byte(SECRET_KEY)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(token)
+}
+
+func TestValidateUsersToken(t *testing.T) {
+	SECRET_KEY = "test-secret"
+
+	token := usersToken(t, session.TokenPayload{
+		UserId:           "u1",
+		Email:            "ada@example.com",
+		FirstName:        "Ada",
+		LastName:         "Lovelace",
+		Role:             "ADMIN",
+		OrganizationId:   "o1",
+		OrganizationRole: "OWNER",
+	})
+
+	claims, msg := ValidateToken(token)
+	if msg != "" {
+		t.Fatalf("ValidateToken: %s", msg)
+	}
+	want := SignedDetails{
+		Email:            "ada@example.com",
+		FirstName:        "Ada",
+		LastName:         "Lovelace",
+		UserId:           "u1",
+		UserType:         "ADMIN",
+		OrganizationId:   "o1",
+		OrganizationRole: "OWNER",
+	}
+	claims.StandardClaims = want.StandardClaims
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+}
+
+func TestValidateTokenRejects(t *testing.T) {
+	SECRET_KEY = "test-secret"
+
+	unexpiring, err := jwt.Sign(session.TokenPayload{UserId: "u1"}, jwt.NewHS256([]byte(SECRET_KEY)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "impersonation", token: usersToken(t, session.TokenPayload{UserId: "u1", Actor: "admin"})},
+		{name: "password reset", token: usersToken(t, session.TokenPayload{UserId: "u1", Purpose: session.PurposeResetPassword})},
+		{name: "no expiry", token: string(unexpiring)},
+		{name: "other secret", token: func() string {
+			SECRET_KEY = "other-secret"
+			defer func() { SECRET_KEY = "test-secret" }()
+			return usersToken(t, session.TokenPayload{UserId: "u1"})
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if claims, msg := ValidateToken(tt.token); msg == "" {
+				t.Errorf("ValidateToken() = %+v, want an error", claims)
+			}
+		})
+	}
+}
+
+func TestAuthenticationSetsUserType(t *testing.T) {
+	SECRET_KEY = "test-secret"
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		role string
+	}{
+		{role: "ADMIN"},
+		{role: "USER"},
+	}
+	for _, tt := range tests {
+		var userType string
+		router := gin.New()
+		router.GET("/", Authentication(), func(c *gin.Context) {
+			userType = c.GetString("userType")
+		})
+
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("token", usersToken(t, session.TokenPayload{UserId: "u1", Role: tt.role}))
+		router.ServeHTTP(httptest.NewRecorder(), request)
+
+		if userType != tt.role {
+			t.Errorf("userType = %q, want %q", userType, tt.role)
+		}
+	}
+}
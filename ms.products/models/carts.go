@@ -0,0 +1,160 @@
+package models
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Cart is the cart of a signed in user, or of an anonymous visitor who
+// holds its CartId. It is merged into the cart of the visitor once they
+// sign in.
+type Cart struct {
+	// Key identifies the cart in the stores, "user:<userId>" or
+	// "anon:<cartId>"
+	Key string `json:"-"`
+	// CartId is the token of an anonymous cart, it is empty for the cart of
+	// a user
+	CartId    string      `json:"cartId,omitempty"`
+	UserId    string      `json:"userId,omitempty"`
+	Items     []*CartItem `json:"items"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	// ExpiresAt is pushed back on every change, abandoned carts are then
+	// deleted by the stores
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Version is incremented on every save, a cart is only saved over the
+	// version it was read at
+	Version int64 `json:"version"`
+	// CheckoutUntil is set while the cart is checked out, another checkout
+	// of the cart is refused until then
+	CheckoutUntil *time.Time `json:"checkoutUntil,omitempty"`
+	// Totals has the total of the available items in each currency
+	Totals []Money `json:"totals" bson:"-"`
+	// Checkout is false when an item has an issue that prevents the cart
+	// from being checked out
+	Checkout bool `json:"checkout" bson:"-"`
+}
+
+// CartIssue explains why an item of a cart can not be bought as is.
+type CartIssue string
+
+const (
+	// CartItemUnavailable is set on items whose product or variant was
+	// deleted, or has no price
+	CartItemUnavailable CartIssue = "unavailable"
+	// CartItemInsufficientStock is set on items asking for more than the
+	// stock left, Available has what can still be bought
+	CartItemInsufficientStock CartIssue = "insufficient_stock"
+	// CartItemOwnProduct is set on the products of the buyer, which can be
+	// added by an anonymous visitor before they sign in
+	CartItemOwnProduct CartIssue = "own_product"
+	// CartItemPriceChanged is informative, the item is bought at its
+	// current price
+	CartItemPriceChanged CartIssue = "price_changed"
+)
+
+// Blocking reports whether issue prevents a checkout.
+func (c CartIssue) Blocking() bool {
+	return c != "" && c != CartItemPriceChanged
+}
+
+type CartItem struct {
+	ItemId    string `json:"itemId"`
+	ProductId string `json:"productId"`
+	VariantId string `json:"variantId,omitempty"`
+	Quantity  int    `json:"qty"`
+	// AddedPrice is the unit price when the item was added or last
+	// changed
+	AddedPrice *Money    `json:"addedPrice"`
+	AddedAt    time.Time `json:"addedAt"`
+
+	// the fields below are read from the product every time the cart is
+	// loaded
+
+	Name      string            `json:"name,omitempty" bson:"-"`
+	SellerId  string            `json:"sellerId,omitempty" bson:"-"`
+	SKU       string            `json:"sku,omitempty" bson:"-"`
+	Options   map[string]string `json:"options,omitempty" bson:"-"`
+	UnitPrice *Money            `json:"unitPrice,omitempty" bson:"-"`
+	Total     *Money            `json:"total,omitempty" bson:"-"`
+	Available int               `json:"available" bson:"-"`
+	Image     string            `json:"image,omitempty" bson:"-"`
+	Issue     CartIssue         `json:"issue,omitempty" bson:"-"`
+}
+
+// Stored returns a copy of the cart without the fields read from the
+// products, which are never stored.
+func (c *Cart) Stored() *Cart {
+	stored := &Cart{
+		Key:           c.Key,
+		CartId:        c.CartId,
+		UserId:        c.UserId,
+		Items:         make([]*CartItem, 0, len(c.Items)),
+		UpdatedAt:     c.UpdatedAt,
+		ExpiresAt:     c.ExpiresAt,
+		Version:       c.Version,
+		CheckoutUntil: c.CheckoutUntil,
+	}
+	for _, item := range c.Items {
+		stored.Items = append(stored.Items, &CartItem{
+			ItemId:     item.ItemId,
+			ProductId:  item.ProductId,
+			VariantId:  item.VariantId,
+			Quantity:   item.Quantity,
+			AddedPrice: item.AddedPrice,
+			AddedAt:    item.AddedAt,
+		})
+	}
+	return stored
+}
+
+// Item returns the item itemId of the cart, or nil.
+func (c *Cart) Item(itemId string) *CartItem {
+	for _, item := range c.Items {
+		if item.ItemId == itemId {
+			return item
+		}
+	}
+	return nil
+}
+
+// Line returns the item of the cart holding variantId of productId, or nil.
+func (c *Cart) Line(productId, variantId string) *CartItem {
+	for _, item := range c.Items {
+		if item.ProductId == productId && item.VariantId == variantId {
+			return item
+		}
+	}
+	return nil
+}
+
+type AddCartItemRequest struct {
+	ProductId string `json:"productId"`
+	// VariantId is required for a product with variants
+	VariantId string `json:"variantId"`
+	Quantity  int    `json:"qty"`
+}
+
+func (a AddCartItemRequest) Validate() error {
+	return validation.ValidateStruct(&a,
+		validation.Field(&a.ProductId, validation.Required),
+		validation.Field(&a.Quantity, validation.Required, validation.Min(1)),
+	)
+}
+
+type UpdateCartItemRequest struct {
+	// Quantity 0 removes the item
+	Quantity int `json:"qty"`
+}
+
+func (u UpdateCartItemRequest) Validate() error {
+	return validation.ValidateStruct(&u,
+		validation.Field(&u.Quantity, validation.Min(0)),
+	)
+}
+
+type CheckoutRequest struct {
+	// ExpectedTotals are the totals the buyer agreed to, the checkout is
+	// refused when the cart no longer adds up to them. They are optional.
+	ExpectedTotals []Money `json:"expectedTotals"`
+}
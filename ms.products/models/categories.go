@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var ErrInvalidSlug = errors.New("slug must contain only lower case letters, digits and dashes")
+
+// Category is a node of the category tree. Path lists the ids of its
+// ancestors from the root, so that the descendants of a category are the
+// categories whose path contains its id.
+type Category struct {
+	ID         primitive.ObjectID `bson:"id"`
+	CategoryId string             `json:"categoryId"`
+	Name       string             `json:"name"`
+	Slug       string             `json:"slug"`
+	ParentId   *string            `json:"parentId"`
+	Path       []string           `json:"path"`
+	// Breadcrumbs has the path from the root to the category, itself
+	// included
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs,omitempty" bson:"-"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+// Slugify turns a name into a slug, "Men's Shoes" becomes "men-s-shoes".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+type CreateCategoryRequest struct {
+	Name string `json:"name"`
+	// Slug defaults to the slug of the name
+	Slug     string  `json:"slug"`
+	ParentId *string `json:"parentId"`
+}
+
+func (c CreateCategoryRequest) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Name, validation.Required, validation.Length(2, 100)),
+		validation.Field(&c.Slug, validation.Match(slugPattern).Error(ErrInvalidSlug.Error())),
+	)
+}
+
+// UpdateCategoryRequest renames or moves a category, fields left nil are
+// not updated. An empty ParentId moves the category to the root.
+type UpdateCategoryRequest struct {
+	Name     *string `json:"name"`
+	Slug     *string `json:"slug"`
+	ParentId *string `json:"parentId"`
+}
+
+func (c UpdateCategoryRequest) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Name, validation.NilOrNotEmpty, validation.Length(2, 100)),
+		validation.Field(&c.Slug, validation.NilOrNotEmpty, validation.Match(slugPattern).Error(ErrInvalidSlug.Error())),
+	)
+}
+
+// CategoryNode is a category with its children, in a category tree.
+type CategoryNode struct {
+	*Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// Breadcrumb is a category of the path from the root to a category.
+type Breadcrumb struct {
+	CategoryId string `json:"categoryId"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidProductSort  = errors.New("sort must be one of name, -name, price, -price or newest")
+	ErrInvalidPriceRange   = errors.New("minPrice must be less than maxPrice")
+	ErrInvalidCreatedRange = errors.New("createdFrom must be before createdTo")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+)
+
+// ProductSort orders a product list, a leading - sorts in descending order.
+type ProductSort string
+
+const (
+	SortByName      ProductSort = "name"
+	SortByNameDesc  ProductSort = "-name"
+	SortByPrice     ProductSort = "price"
+	SortByPriceDesc ProductSort = "-price"
+	SortByNewest    ProductSort = "newest"
+)
+
+func (s ProductSort) IsValid() bool {
+	switch s {
+	case SortByName, SortByNameDesc, SortByPrice, SortByPriceDesc, SortByNewest:
+		return true
+	}
+	return false
+}
+
+type ProductFilter struct {
+	// Filter by owner
+	OwnerId *string `json:"ownerId"`
+	// Category is the id or slug of a category, products of its
+	// descendants are included
+	Category *string `json:"category"`
+	// CategoryIds are the ids of Category and its descendants
+	CategoryIds []string `json:"-"`
+	// MinPrice and MaxPrice are inclusive and must be in the same currency,
+	// only products in that currency are returned
+	MinPrice *Money `json:"minPrice"`
+	MaxPrice *Money `json:"maxPrice"`
+	// InStock returns only products with some quantity left
+	InStock bool `json:"inStock"`
+	// CreatedFrom and CreatedTo are inclusive
+	CreatedFrom *time.Time `json:"createdFrom"`
+	CreatedTo   *time.Time `json:"createdTo"`
+	// Sort defaults to name
+	Sort ProductSort `json:"sort"`
+	// Cursor is the nextCursor of the previous page
+	Cursor *string `json:"cursor"`
+	// After is the decoded Cursor
+	After *ProductCursor `json:"-"`
+	// Limit the number of records to be returned at once
+	Limit int64 `json:"limit"`
+}
+
+// Currency returns the currency of the price range, or an empty string
+// without one.
+func (f ProductFilter) Currency() string {
+	if f.MinPrice != nil {
+		return f.MinPrice.Currency
+	}
+	if f.MaxPrice != nil {
+		return f.MaxPrice.Currency
+	}
+	return ""
+}
+
+func (f ProductFilter) Validate() error {
+	if f.Sort != "" && !f.Sort.IsValid() {
+		return ErrInvalidProductSort
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil {
+		cmp, err := f.MinPrice.Cmp(*f.MaxPrice)
+		if err != nil {
+			return err
+		}
+		if cmp > 0 {
+			return ErrInvalidPriceRange
+		}
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && f.CreatedFrom.After(*f.CreatedTo) {
+		return ErrInvalidCreatedRange
+	}
+	return nil
+}
+
+// ProductCursor holds the sort values of the last product of a page, the
+// next page starts after them.
+type ProductCursor struct {
+	Sort      ProductSort `json:"s"`
+	Name      string      `json:"n,omitempty"`
+	Price     *Money      `json:"p,omitempty"`
+	CreatedAt time.Time   `json:"c,omitempty"`
+	ProductId string      `json:"i"`
+}
+
+func NewProductCursor(sort ProductSort, last *Product) ProductCursor {
+	cursor := ProductCursor{Sort: sort, ProductId: last.ProductID, CreatedAt: last.CreatedAt, Price: last.Price}
+	if last.Name != nil {
+		cursor.Name = *last.Name
+	}
+	return cursor
+}
+
+func (c ProductCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeProductCursor reads a cursor, it must have been created for the
+// same sort.
+func DecodeProductCursor(value string, sort ProductSort) (*ProductCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor ProductCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort || cursor.ProductId == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
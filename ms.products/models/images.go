@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// ProductImage is an uploaded picture of a product stored in every rendition
+// of images.Renditions. The images of a product are kept in display order.
+type ProductImage struct {
+	ImageId string `json:"imageId"`
+	// Prefix is the blob key under which every rendition is stored
+	Prefix string `json:"-"`
+	// URLs maps each rendition name to its public URL
+	URLs        map[string]string `json:"urls"`
+	ContentType string            `json:"contentType"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	UploadedAt  time.Time         `json:"uploadedAt"`
+}
+
+// ReorderImagesRequest lists every image id of a product in its new order.
+type ReorderImagesRequest struct {
+	ImageIds []string `json:"imageIds"`
+}
+
+func (r ReorderImagesRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.ImageIds, validation.Required),
+	)
+}
+
+// Image returns the image imageId of the product, or nil.
+func (p *Product) Image(imageId string) *ProductImage {
+	for _, image := range p.Images {
+		if image.ImageId == imageId {
+			return image
+		}
+	}
+	return nil
+}
+
+// PrimaryImage returns the image shown in product lists, or nil when the
+// product has no image.
+func (p *Product) PrimaryImage() *ProductImage {
+	if image := p.Image(p.PrimaryImageId); image != nil {
+		return image
+	}
+	if len(p.Images) > 0 {
+		return p.Images[0]
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("amounts in different currencies can not be combined")
+	ErrInvalidCurrency  = errors.New("currency must be an ISO 4217 code such as USD")
+	ErrInvalidAmount    = errors.New("amount must be a decimal number such as 12.50")
+	ErrNegativeAmount   = errors.New("amount can not be negative")
+)
+
+// DefaultCurrency is the currency of prices stored before prices had one,
+// it is set from the configuration at startup.
+var DefaultCurrency = "USD"
+
+// Money is an amount in the minor units of its currency, 1250 USD is
+// $12.50 and 1250 JPY is ¥1250.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+func NewMoney(amount int64, code string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(code)}
+}
+
+// scale returns the number of decimals of the currency.
+func scale(code string) int {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return 2
+	}
+	digits, _ := currency.Standard.Rounding(unit)
+	return digits
+}
+
+// ParseMoney reads a decimal amount such as "1,234.50" in code.
+func ParseMoney(value, code string) (Money, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	digits := scale(code)
+	if whole == "" || len(fraction) > digits || strings.HasPrefix(whole, "+") {
+		return Money{}, ErrInvalidAmount
+	}
+
+	fraction += strings.Repeat("0", digits-len(fraction))
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+
+	return NewMoney(amount, code), nil
+}
+
+// Scale returns the number of minor units in one major unit of the
+// currency, 100 for USD and 1 for JPY.
+func (m Money) Scale() int64 {
+	return int64(math.Pow10(scale(m.Currency)))
+}
+
+func (m Money) Validate() error {
+	unit, err := currency.ParseISO(m.Currency)
+	if err != nil || unit.String() != m.Currency {
+		return ErrInvalidCurrency
+	}
+	if m.Amount < 0 {
+		return ErrNegativeAmount
+	}
+	return nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// Cmp returns -1, 0 or 1 when m is less than, equal to or more than other.
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// AddTotal adds amount to the total of its currency in totals.
+func AddTotal(totals []Money, amount Money) []Money {
+	for i, total := range totals {
+		if total.Currency == amount.Currency {
+			totals[i].Amount += amount.Amount
+			return totals
+		}
+	}
+	return append(totals, amount)
+}
+
+// SameTotals reports whether a and b hold the same amount in every
+// currency, in any order.
+func SameTotals(a, b []Money) bool {
+	return len(a) == len(b) && containsTotals(a, b) && containsTotals(b, a)
+}
+
+func containsTotals(totals, amounts []Money) bool {
+	for _, amount := range amounts {
+		found := false
+		for _, total := range totals {
+			if total.Currency == amount.Currency && total.Amount == amount.Amount {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal returns the amount in major units, such as "12.50".
+func (m Money) Decimal() string {
+	digits := scale(m.Currency)
+	if digits == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	divisor := int64(math.Pow10(digits))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/divisor, digits, amount%divisor)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Format writes the amount with the symbol of its currency and the number
+// format of locale, such as "$ 1,234.50" in en or "€ 1.234,50" in de.
+func (m Money) Format(locale language.Tag) string {
+	unit, err := currency.ParseISO(m.Currency)
+	if err != nil {
+		return m.String()
+	}
+
+	amount := float64(m.Amount) / math.Pow10(scale(m.Currency))
+	return message.NewPrinter(locale).Sprint(currency.Symbol(unit.Amount(amount)))
+}
+
+// UnmarshalJSON also accepts the prices sent as a decimal string before
+// prices had a currency, they are read in DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		parsed, err := ParseMoney(legacy, DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	type money Money
+	var value money
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	value.Currency = strings.ToUpper(value.Currency)
+	*m = Money(value)
+	return nil
+}
+
+// UnmarshalBSONValue also reads the string prices stored before prices had
+// a currency, in DefaultCurrency. The ones that are not a decimal amount
+// fail with ErrInvalidAmount, the store reads them as no price.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	if t == bsontype.String {
+		var legacy string
+		if err := raw.Unmarshal(&legacy); err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(legacy, DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	type money Money
+	var value money
+	if err := raw.Unmarshal(&value); err != nil {
+		return err
+	}
+	*m = Money(value)
+	return nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		code    string
+		want    Money
+		wantErr error
+	}{
+		{name: "whole amount", value: "10", code: "USD", want: NewMoney(1000, "USD")},
+		{name: "cents", value: "12.5", code: "USD", want: NewMoney(1250, "USD")},
+		{name: "thousands separator", value: " 1,234.50 ", code: "usd", want: NewMoney(123450, "USD")},
+		{name: "no minor unit", value: "1250", code: "JPY", want: NewMoney(1250, "JPY")},
+		{name: "leading dot", value: ".5", code: "USD", wantErr: ErrInvalidAmount},
+		{name: "too many decimals", value: "1.005", code: "USD", wantErr: ErrInvalidAmount},
+		{name: "decimals without minor unit", value: "10.5", code: "JPY", wantErr: ErrInvalidAmount},
+		{name: "plus sign", value: "+10", code: "USD", wantErr: ErrInvalidAmount},
+		{name: "currency symbol", value: "$10", code: "USD", wantErr: ErrInvalidAmount},
+		{name: "currency code", value: "10 USD", code: "USD", wantErr: ErrInvalidAmount},
+		{name: "empty", value: "", code: "USD", wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.value, tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseMoney(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: NewMoney(1250, "USD"), want: "12.50"},
+		{money: NewMoney(5, "USD"), want: "0.05"},
+		{money: NewMoney(-1250, "USD"), want: "-12.50"},
+		{money: NewMoney(1250, "JPY"), want: "1250"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.money.Currency+" "+tt.want, func(t *testing.T) {
+			if got := tt.money.Decimal(); got != tt.want {
+				t.Errorf("Decimal() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUnknownOrderAction     = errors.New("unknown order action")
+	ErrInvalidOrderTransition = errors.New("this change is not allowed in the current state of the order")
+	ErrOrderActionForbidden   = errors.New("you are not allowed to make this change to the order")
+	ErrOrderNotPaid           = errors.New("only a paid order can be refunded")
+	ErrOrderSellerRequired    = errors.New("this order has several sellers, choose the seller whose items change with sellerId")
+)
+
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderPaid      OrderStatus = "paid"
+	OrderFulfilled OrderStatus = "fulfilled"
+	OrderShipped   OrderStatus = "shipped"
+	OrderDelivered OrderStatus = "delivered"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderRefunded  OrderStatus = "refunded"
+)
+
+// Valid reports whether s is one of the statuses of an order.
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderPending, OrderPaid, OrderFulfilled, OrderShipped, OrderDelivered, OrderCancelled, OrderRefunded:
+		return true
+	}
+	return false
+}
+
+// OrderAction is a change of the status of an order.
+type OrderAction string
+
+const (
+	OrderPlace   OrderAction = "place"
+	OrderPay     OrderAction = "pay"
+	OrderFulfill OrderAction = "fulfill"
+	OrderShip    OrderAction = "ship"
+	OrderDeliver OrderAction = "deliver"
+	OrderCancel  OrderAction = "cancel"
+	OrderRefund  OrderAction = "refund"
+)
+
+// OrderRole is the part an actor plays in an order.
+type OrderRole string
+
+const (
+	OrderBuyer  OrderRole = "buyer"
+	OrderSeller OrderRole = "seller"
+	OrderAdmin  OrderRole = "admin"
+)
+
+type orderTransition struct {
+	from  []OrderStatus
+	to    OrderStatus
+	roles []OrderRole
+}
+
+// orderTransitions lists the statuses each action can be taken from, and
+// who can take it. Admins can take every action.
+var orderTransitions = map[OrderAction]orderTransition{
+	OrderPay: {
+		from:  []OrderStatus{OrderPending},
+		to:    OrderPaid,
+		roles: []OrderRole{OrderBuyer},
+	},
+	OrderFulfill: {
+		from:  []OrderStatus{OrderPaid},
+		to:    OrderFulfilled,
+		roles: []OrderRole{OrderSeller},
+	},
+	OrderShip: {
+		from:  []OrderStatus{OrderFulfilled},
+		to:    OrderShipped,
+		roles: []OrderRole{OrderSeller},
+	},
+	OrderDeliver: {
+		from:  []OrderStatus{OrderShipped},
+		to:    OrderDelivered,
+		roles: []OrderRole{OrderBuyer, OrderSeller},
+	},
+	// once shipped the goods are with the carrier, the order can only be
+	// refunded after they are delivered back
+	OrderCancel: {
+		from:  []OrderStatus{OrderPending, OrderPaid, OrderFulfilled},
+		to:    OrderCancelled,
+		roles: []OrderRole{OrderBuyer, OrderSeller},
+	},
+	OrderRefund: {
+		from:  []OrderStatus{OrderCancelled, OrderDelivered},
+		to:    OrderRefunded,
+		roles: []OrderRole{OrderSeller},
+	},
+}
+
+// itemActions are taken separately on the items of each seller of an
+// order with several sellers.
+var itemActions = map[OrderAction]bool{
+	OrderFulfill: true,
+	OrderShip:    true,
+	OrderDeliver: true,
+}
+
+// itemProgress lists the statuses the items of a seller go through, in
+// order.
+var itemProgress = []OrderStatus{OrderPaid, OrderFulfilled, OrderShipped, OrderDelivered}
+
+// IsItemAction reports whether action is taken per seller on an order with
+// several sellers.
+func IsItemAction(action OrderAction) bool {
+	return itemActions[action]
+}
+
+// Order groups the items bought together, each item is also recorded as a
+// purchase of its product.
+type Order struct {
+	ID        primitive.ObjectID `bson:"id"`
+	OrderId   string             `json:"orderId"`
+	BuyerId   string             `json:"buyerId"`
+	BuyerName string             `json:"buyerName"`
+	// SellerIds are the owners of the products of the order. When there
+	// are several, each of them fulfils, ships and delivers their own items
+	// and the status of the order follows its least advanced items
+	SellerIds []string     `json:"sellerIds"`
+	Items     []*OrderItem `json:"items"`
+	// Totals has the total of the order in each currency
+	Totals []Money     `json:"totals"`
+	Status OrderStatus `json:"status"`
+	PaidAt *time.Time  `json:"paidAt"`
+	// ReservedUntil is when the stock held by a pending order is released
+	// and the order cancelled, it is nil for the orders placed before stock
+	// was reserved, which took their stock right away
+	ReservedUntil *time.Time `json:"reservedUntil,omitempty"`
+	// PaymentId is the payment intent the order was paid with
+	PaymentId      string `json:"paymentId,omitempty"`
+	TrackingNumber string `json:"trackingNumber,omitempty"`
+	// RestockFrom is the status a cancelled order was cancelled from until
+	// all its stock is put back, the reservations job finishes putting back
+	// the stock of the orders that still have it
+	RestockFrom OrderStatus `json:"-"`
+	// Events has every change of the status of the order, oldest first
+	Events    []*OrderEvent `json:"events"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+type OrderItem struct {
+	// PurchaseId is the purchase recorded for the item
+	PurchaseId  string            `json:"purchaseId"`
+	ProductId   string            `json:"productId"`
+	ProductName string            `json:"productName"`
+	VariantId   string            `json:"variantId,omitempty"`
+	SKU         string            `json:"sku,omitempty"`
+	Options     map[string]string `json:"options,omitempty"`
+	Quantity    int               `json:"qty"`
+	UnitPrice   *Money            `json:"unitPrice"`
+	Total       *Money            `json:"total"`
+	SellerId    string            `json:"sellerId"`
+	SellerName  string            `json:"sellerName"`
+	// Status and TrackingNumber are set on the items of an order with
+	// several sellers once their seller handles them, an item without a
+	// status has the status of the order
+	Status         OrderStatus `json:"status,omitempty"`
+	TrackingNumber string      `json:"trackingNumber,omitempty"`
+	// Restocked is set once the stock of the item of a cancelled order is
+	// put back
+	Restocked bool `json:"-"`
+}
+
+type OrderEvent struct {
+	Action  OrderAction `json:"action"`
+	From    OrderStatus `json:"from,omitempty"`
+	To      OrderStatus `json:"to"`
+	ActorId string      `json:"actorId"`
+	Role    OrderRole   `json:"role"`
+	Note    string      `json:"note,omitempty"`
+	At      time.Time   `json:"at"`
+	// SellerId is set when the event only moved the items of a seller
+	SellerId string `json:"sellerId,omitempty"`
+}
+
+// Role returns the part actor plays in the order, it is empty for users
+// who have nothing to do with it.
+func (o *Order) Role(actor Actor) OrderRole {
+	switch {
+	case actor.UserId != "" && actor.UserId == o.BuyerId:
+		return OrderBuyer
+	case actor.UserId != "" && contains(o.SellerIds, actor.UserId):
+		return OrderSeller
+	case actor.IsAdmin():
+		return OrderAdmin
+	}
+	return ""
+}
+
+// Transition returns the status the order moves to when role takes action.
+func (o *Order) Transition(action OrderAction, role OrderRole) (OrderStatus, error) {
+	transition, ok := orderTransitions[action]
+	if !ok {
+		return "", ErrUnknownOrderAction
+	}
+	if role == "" || (role != OrderAdmin && !containsRole(transition.roles, role)) {
+		return "", ErrOrderActionForbidden
+	}
+	if o.SharedBySellers() {
+		// a seller only acts on their own items, see TransitionItems
+		if role == OrderSeller && !itemActions[action] {
+			return "", ErrOrderActionForbidden
+		}
+		if itemActions[action] {
+			return "", ErrOrderSellerRequired
+		}
+		// nothing is cancelled once a seller shipped their items
+		for _, item := range o.Items {
+			if !containsStatus(transition.from, o.ItemStatus(item)) {
+				return "", ErrInvalidOrderTransition
+			}
+		}
+	}
+	if !containsStatus(transition.from, o.Status) {
+		return "", ErrInvalidOrderTransition
+	}
+	if action == OrderRefund && o.PaidAt == nil {
+		return "", ErrOrderNotPaid
+	}
+	return transition.to, nil
+}
+
+// SharedBySellers reports whether the order holds the items of several
+// sellers.
+func (o *Order) SharedBySellers() bool {
+	return len(o.SellerIds) > 1
+}
+
+// ItemStatus returns the status of item, which is the status of the order
+// until its seller handles it.
+func (o *Order) ItemStatus(item *OrderItem) OrderStatus {
+	if item.Status == "" {
+		return o.Status
+	}
+	return item.Status
+}
+
+// SellerStatus returns the status of the items of sellerId, they always
+// move together. It reports false when the order holds none of their items.
+func (o *Order) SellerStatus(sellerId string) (OrderStatus, bool) {
+	for _, item := range o.Items {
+		if item.SellerId == sellerId {
+			return o.ItemStatus(item), true
+		}
+	}
+	return "", false
+}
+
+// TransitionItems returns the status the items of sellerId move to when
+// role takes action on them, action must be an item action. It is used on
+// orders with several sellers, while the order is between paid and
+// delivered.
+func (o *Order) TransitionItems(action OrderAction, role OrderRole, sellerId string) (OrderStatus, error) {
+	transition, ok := orderTransitions[action]
+	if !ok || !itemActions[action] {
+		return "", ErrUnknownOrderAction
+	}
+	if role == "" || (role != OrderAdmin && !containsRole(transition.roles, role)) {
+		return "", ErrOrderActionForbidden
+	}
+	status, ok := o.SellerStatus(sellerId)
+	if !ok {
+		return "", ErrOrderSellerRequired
+	}
+	if !containsStatus(itemProgress, o.Status) || !containsStatus(transition.from, status) {
+		return "", ErrInvalidOrderTransition
+	}
+	return transition.to, nil
+}
+
+// MoveItems sets the status of the items of sellerId and moves the order to
+// the status of its least advanced items.
+func (o *Order) MoveItems(sellerId string, status OrderStatus, trackingNumber string) {
+	least := len(itemProgress) - 1
+	for _, item := range o.Items {
+		if item.SellerId == sellerId {
+			item.Status = status
+			if trackingNumber != "" {
+				item.TrackingNumber = trackingNumber
+			}
+		}
+		for i, progress := range itemProgress {
+			if progress == o.ItemStatus(item) && i < least {
+				least = i
+			}
+		}
+	}
+	o.Status = itemProgress[least]
+}
+
+type OrderTransitionRequest struct {
+	// SellerId picks the seller whose items are fulfilled, shipped or
+	// delivered on an order with several sellers. Sellers always act on
+	// their own items, buyers and admins must set it
+	SellerId string `json:"sellerId"`
+	Note     string `json:"note"`
+	// TrackingNumber is kept when the order is shipped
+	TrackingNumber string `json:"trackingNumber"`
+}
+
+func (o OrderTransitionRequest) Validate() error {
+	return validation.ValidateStruct(&o,
+		validation.Field(&o.Note, validation.Length(0, 500)),
+		validation.Field(&o.TrackingNumber, validation.Length(0, 100)),
+	)
+}
+
+type OrderFilter struct {
+	// BuyerId and SellerId are set from the token, a buyer only sees their
+	// orders and a seller only the orders of their products
+	BuyerId  string      `json:"-"`
+	SellerId string      `json:"-"`
+	Status   OrderStatus `json:"status"`
+	// NextCursorId is the nextCursorId of the previous page
+	NextCursorId *string `json:"nextCursorId"`
+	Limit        int64   `json:"limit"`
+}
+
+type OrderList struct {
+	Data  []*Order `json:"data"`
+	Count int64    `json:"count"`
+	// NextCursorId is empty on the last page
+	NextCursorId *string `json:"nextCursorId"`
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRole(roles []OrderRole, role OrderRole) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(statuses []OrderStatus, status OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrderRole(t *testing.T) {
+	order := &Order{BuyerId: "buyer", SellerIds: []string{"seller"}}
+
+	tests := []struct {
+		name  string
+		actor Actor
+		want  OrderRole
+	}{
+		{name: "buyer", actor: Actor{UserId: "buyer"}, want: OrderBuyer},
+		{name: "seller", actor: Actor{UserId: "seller"}, want: OrderSeller},
+		{name: "admin", actor: Actor{UserId: "someone", UserType: "ADMIN"}, want: OrderAdmin},
+		{name: "admin buying", actor: Actor{UserId: "buyer", UserType: "ADMIN"}, want: OrderBuyer},
+		{name: "stranger", actor: Actor{UserId: "someone"}, want: ""},
+		{name: "anonymous", actor: Actor{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := order.Role(tt.actor); got != tt.want {
+				t.Errorf("Role = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderTransition(t *testing.T) {
+	paidAt := time.Now()
+
+	tests := []struct {
+		name    string
+		status  OrderStatus
+		paid    bool
+		sellers int
+		action  OrderAction
+		role    OrderRole
+		want    OrderStatus
+		wantErr error
+	}{
+		{name: "buyer pays", status: OrderPending, action: OrderPay, role: OrderBuyer, want: OrderPaid},
+		{name: "seller can not pay", status: OrderPending, action: OrderPay, role: OrderSeller, wantErr: ErrOrderActionForbidden},
+		{name: "paid twice", status: OrderPaid, action: OrderPay, role: OrderBuyer, wantErr: ErrInvalidOrderTransition},
+		{name: "seller fulfills", status: OrderPaid, action: OrderFulfill, role: OrderSeller, want: OrderFulfilled},
+		{name: "fulfilled before paid", status: OrderPending, action: OrderFulfill, role: OrderSeller, wantErr: ErrInvalidOrderTransition},
+		{name: "buyer can not fulfill", status: OrderPaid, action: OrderFulfill, role: OrderBuyer, wantErr: ErrOrderActionForbidden},
+		{name: "seller ships", status: OrderFulfilled, action: OrderShip, role: OrderSeller, want: OrderShipped},
+		{name: "buyer confirms delivery", status: OrderShipped, action: OrderDeliver, role: OrderBuyer, want: OrderDelivered},
+		{name: "seller confirms delivery", status: OrderShipped, action: OrderDeliver, role: OrderSeller, want: OrderDelivered},
+		{name: "buyer cancels pending", status: OrderPending, action: OrderCancel, role: OrderBuyer, want: OrderCancelled},
+		{name: "seller cancels fulfilled", status: OrderFulfilled, action: OrderCancel, role: OrderSeller, want: OrderCancelled},
+		{name: "cancelled once shipped", status: OrderShipped, action: OrderCancel, role: OrderBuyer, wantErr: ErrInvalidOrderTransition},
+		{name: "seller refunds cancelled", status: OrderCancelled, paid: true, action: OrderRefund, role: OrderSeller, want: OrderRefunded},
+		{name: "seller refunds delivered", status: OrderDelivered, paid: true, action: OrderRefund, role: OrderSeller, want: OrderRefunded},
+		{name: "refund of an unpaid order", status: OrderCancelled, action: OrderRefund, role: OrderSeller, wantErr: ErrOrderNotPaid},
+		{name: "buyer can not refund", status: OrderDelivered, paid: true, action: OrderRefund, role: OrderBuyer, wantErr: ErrOrderActionForbidden},
+		{name: "refunded twice", status: OrderRefunded, paid: true, action: OrderRefund, role: OrderSeller, wantErr: ErrInvalidOrderTransition},
+		{name: "admin takes seller actions", status: OrderPaid, action: OrderFulfill, role: OrderAdmin, want: OrderFulfilled},
+		{name: "admin still follows the states", status: OrderDelivered, action: OrderShip, role: OrderAdmin, wantErr: ErrInvalidOrderTransition},
+		{name: "seller of a shared order", status: OrderPaid, sellers: 2, action: OrderCancel, role: OrderSeller, wantErr: ErrOrderActionForbidden},
+		{name: "buyer of a shared order", status: OrderPaid, sellers: 2, action: OrderCancel, role: OrderBuyer, want: OrderCancelled},
+		{name: "shared order fulfilled per seller", status: OrderPaid, sellers: 2, action: OrderFulfill, role: OrderAdmin, wantErr: ErrOrderSellerRequired},
+		{name: "no role", status: OrderPending, action: OrderCancel, role: "", wantErr: ErrOrderActionForbidden},
+		{name: "unknown action", status: OrderPending, action: "archive", role: OrderAdmin, wantErr: ErrUnknownOrderAction},
+		{name: "place is not a transition", status: OrderPending, action: OrderPlace, role: OrderBuyer, wantErr: ErrUnknownOrderAction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &Order{Status: tt.status, SellerIds: []string{"seller"}}
+			if tt.paid {
+				order.PaidAt = &paidAt
+			}
+			if tt.sellers > 1 {
+				order.SellerIds = append(order.SellerIds, "other seller")
+			}
+
+			got, err := order.Transition(tt.action, tt.role)
+			if err != tt.wantErr {
+				t.Fatalf("Transition error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Transition = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderTransitionItems(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   OrderStatus
+		items    []OrderStatus // of "seller" then "other seller"
+		action   OrderAction
+		role     OrderRole
+		sellerId string
+		want     OrderStatus
+		wantErr  error
+	}{
+		{name: "seller fulfills their items", status: OrderPaid, items: []OrderStatus{"", ""}, action: OrderFulfill, role: OrderSeller, sellerId: "seller", want: OrderFulfilled},
+		{name: "seller ships their items", status: OrderPaid, items: []OrderStatus{OrderFulfilled, ""}, action: OrderShip, role: OrderSeller, sellerId: "seller", want: OrderShipped},
+		{name: "buyer confirms delivery of a seller", status: OrderPaid, items: []OrderStatus{OrderShipped, ""}, action: OrderDeliver, role: OrderBuyer, sellerId: "seller", want: OrderDelivered},
+		{name: "items shipped before fulfilled", status: OrderPaid, items: []OrderStatus{"", ""}, action: OrderShip, role: OrderSeller, sellerId: "seller", wantErr: ErrInvalidOrderTransition},
+		{name: "buyer can not fulfill", status: OrderPaid, items: []OrderStatus{"", ""}, action: OrderFulfill, role: OrderBuyer, sellerId: "seller", wantErr: ErrOrderActionForbidden},
+		{name: "seller without items", status: OrderPaid, items: []OrderStatus{"", ""}, action: OrderFulfill, role: OrderSeller, sellerId: "stranger", wantErr: ErrOrderSellerRequired},
+		{name: "no seller chosen", status: OrderPaid, items: []OrderStatus{"", ""}, action: OrderFulfill, role: OrderAdmin, wantErr: ErrOrderSellerRequired},
+		{name: "pending order", status: OrderPending, items: []OrderStatus{"", ""}, action: OrderFulfill, role: OrderSeller, sellerId: "seller", wantErr: ErrInvalidOrderTransition},
+		{name: "cancelled order", status: OrderCancelled, items: []OrderStatus{OrderFulfilled, ""}, action: OrderShip, role: OrderSeller, sellerId: "seller", wantErr: ErrInvalidOrderTransition},
+		{name: "cancel is not an item action", status: OrderPaid, items: []OrderStatus{"", ""}, action: OrderCancel, role: OrderSeller, sellerId: "seller", wantErr: ErrUnknownOrderAction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &Order{Status: tt.status, SellerIds: []string{"seller", "other seller"}, Items: []*OrderItem{
+				{SellerId: "seller", Status: tt.items[0]},
+				{SellerId: "other seller", Status: tt.items[1]},
+			}}
+
+			got, err := order.TransitionItems(tt.action, tt.role, tt.sellerId)
+			if err != tt.wantErr {
+				t.Fatalf("TransitionItems error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("TransitionItems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderMoveItems(t *testing.T) {
+	order := &Order{Status: OrderPaid, SellerIds: []string{"seller", "other seller"}, Items: []*OrderItem{
+		{SellerId: "seller"},
+		{SellerId: "other seller"},
+		{SellerId: "seller"},
+	}}
+
+	order.MoveItems("seller", OrderShipped, "TRACK-1")
+	if order.Status != OrderPaid {
+		t.Errorf("Status = %q, want %q while other seller has not moved", order.Status, OrderPaid)
+	}
+	for _, item := range order.Items {
+		shipped := item.SellerId == "seller"
+		if (item.Status == OrderShipped) != shipped || (item.TrackingNumber == "TRACK-1") != shipped {
+			t.Errorf("item of %q = %q %q", item.SellerId, item.Status, item.TrackingNumber)
+		}
+	}
+	if _, err := order.Transition(OrderCancel, OrderBuyer); err != ErrInvalidOrderTransition {
+		t.Errorf("cancel with shipped items error = %v, want %v", err, ErrInvalidOrderTransition)
+	}
+
+	order.MoveItems("other seller", OrderFulfilled, "")
+	if order.Status != OrderFulfilled {
+		t.Errorf("Status = %q, want %q", order.Status, OrderFulfilled)
+	}
+	order.MoveItems("other seller", OrderDelivered, "")
+	order.MoveItems("seller", OrderDelivered, "")
+	if order.Status != OrderDelivered {
+		t.Errorf("Status = %q, want %q", order.Status, OrderDelivered)
+	}
+}
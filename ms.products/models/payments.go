@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	// PaymentRefunding is held while the provider refunds the payment, so
+	// that it is refunded once
+	PaymentRefunding PaymentStatus = "refunding"
+	PaymentRefunded  PaymentStatus = "refunded"
+	PaymentFailed    PaymentStatus = "failed"
+)
+
+// PaymentIntent is an attempt to pay an order through a provider.
+type PaymentIntent struct {
+	ID       primitive.ObjectID `bson:"id"`
+	IntentId string             `json:"intentId"`
+	// Key is "<orderId>:<idempotency key>", retrying a payment with the
+	// same idempotency key resumes the same intent
+	Key     string `json:"-"`
+	OrderId string `json:"orderId"`
+	BuyerId string `json:"buyerId"`
+	Amount  Money  `json:"amount"`
+	// Provider and Reference identify the payment at the provider
+	Provider      string        `json:"provider"`
+	Reference     string        `json:"reference,omitempty"`
+	Status        PaymentStatus `json:"status"`
+	FailureReason string        `json:"failureReason,omitempty"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+}
+
+// PaymentEvent records a webhook once it was handled, so that the copies
+// sent again by the provider are ignored.
+type PaymentEvent struct {
+	Provider   string    `json:"provider"`
+	EventId    string    `json:"eventId"`
+	Type       string    `json:"type"`
+	Reference  string    `json:"reference"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+type PayOrderRequest struct {
+	// PaymentMethod is the token of the payment method entered on the
+	// provider side
+	PaymentMethod string `json:"paymentMethod"`
+}
+
+func (p PayOrderRequest) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.PaymentMethod, validation.Required),
+	)
+}
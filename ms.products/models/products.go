@@ -4,6 +4,7 @@ import (
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"golang.org/x/text/language"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -12,24 +13,93 @@ type Product struct {
 	ID          primitive.ObjectID `bson:"id"`
 	Name        *string            `json:"name" validate:"required,min=3,max=255"`
 	Description *string            `json:"description" validate:"required,min=3,max=255"`
-	Price       *string            `json:"price" validate:"required"`
+	Price       *Money             `json:"price" validate:"required"`
 	Quantity    int                `json:"qty" validate:"required,min=1"`
 	OwnerID     string             `json:"ownerId"`
 	OwnerName   string             `json:"ownerName"`
 	CreatedAt   time.Time          `json:"createdAt"`
 	UpdatedAt   time.Time          `json:"updatedAt"`
 	ProductID   string             `json:"productId"`
+	// OrganizationID is the organization the owner was acting in when the
+	// product was created, it is empty for products listed by a single user.
+	OrganizationID string `json:"organizationId"`
+	// Options and Variants are set for a product sold in several versions,
+	// Quantity is then the sum of the quantities of the variants
+	Options  []ProductOption `json:"options"`
+	Variants []*Variant      `json:"variants"`
+	// Categories are the ids of the categories the product is listed in
+	Categories []string `json:"categories"`
+	// Images are managed with the image endpoints, never with the product
+	// body
+	Images []*ProductImage `json:"images"`
+	// PrimaryImageId is the image shown in product lists, the first
+	// uploaded image until the owner picks another one
+	PrimaryImageId string `json:"primaryImageId"`
+	// Reserved is the part of Quantity held by pending orders, it is taken
+	// off Quantity once an order is paid and released when the order is
+	// cancelled or its reservation expires
+	Reserved int `json:"reserved"`
+	// Available is the stock that can still be bought, Quantity less
+	// Reserved
+	Available int `json:"available" bson:"-"`
+	// Breadcrumbs has the path from the root to each category of the
+	// product
+	Breadcrumbs [][]Breadcrumb `json:"breadcrumbs,omitempty" bson:"-"`
+	// SearchGrams are the trigrams of the name and description, see
+	// search.Grams
+	SearchGrams []string `json:"-"`
+	// PriceDisplay is the price formatted for the locale of the request
+	PriceDisplay string `json:"priceDisplay,omitempty" bson:"-"`
+}
+
+// Present sets the fields computed for responses, the price formatted for
+// locale and the available stock.
+func (p *Product) Present(locale language.Tag) {
+	if p.Price != nil {
+		p.PriceDisplay = p.Price.Format(locale)
+	}
+	p.Available = p.Stock(nil)
+	for _, variant := range p.Variants {
+		variant.Available = p.Stock(variant)
+	}
 }
 
 type PurchaseProduct struct {
-	ProductId       string    `json:"product_id" validate:"required"`
-	ProductName     string    `json:"product_name"`
-	Quantity        int       `json:"qty" validate:"required"`
-	SellerId        string    `json:"seller_id"`
-	SellerName      string    `json:"seller_name"`
-	BuyerId         string    `json:"buyer_id"`
-	BuyerName       string    `json:"buyer_name"`
-	TransactionDate time.Time `json:"transaction_date"`
+	ID              primitive.ObjectID `bson:"id"`
+	PurchaseId      string             `json:"purchase_id"`
+	ProductId       string             `json:"product_id" validate:"required"`
+	ProductName     string             `json:"product_name"`
+	Quantity        int                `json:"qty" validate:"required"`
+	VariantId       string             `json:"variant_id,omitempty"`
+	SKU             string             `json:"sku,omitempty"`
+	Options         map[string]string  `json:"options,omitempty"`
+	UnitPrice       *Money             `json:"unit_price"`
+	Total           *Money             `json:"total"`
+	SellerId        string             `json:"seller_id"`
+	SellerName      string             `json:"seller_name"`
+	BuyerId         string             `json:"buyer_id"`
+	BuyerName       string             `json:"buyer_name"`
+	TransactionDate time.Time          `json:"transaction_date"`
+	// OrderId is the order the purchase is part of
+	OrderId string `json:"order_id,omitempty"`
+	// Cancelled is set once the order is cancelled, the purchase no longer
+	// counts as a sale
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Pending is set until the order is paid, the purchase does not count as
+	// a sale before
+	Pending bool `json:"pending,omitempty"`
+}
+
+type PurchaseRequest struct {
+	Quantity int `json:"qty"`
+	// VariantId is required for a product with variants
+	VariantId string `json:"variantId"`
+}
+
+func (p PurchaseRequest) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Quantity, validation.Required, validation.Min(1)),
+	)
 }
 
 func (p Product) Validate() error {
@@ -42,13 +112,62 @@ func (p Product) Validate() error {
 		return err
 	}
 
+	if err := ValidateVariants(p.Options, p.Variants, p.Price); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// UpdateProductRequest lists the fields of a product its owner may change,
+// fields left nil are not updated.
+type UpdateProductRequest struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Price       *Money    `json:"price"`
+	Quantity    *int      `json:"qty"`
+	Categories  *[]string `json:"categories"`
+	// Options and Variants replace all the options and variants, variants
+	// keep their id when their SKU does not change
+	Options  *[]ProductOption `json:"options"`
+	Variants *[]*Variant      `json:"variants"`
+	// Reserved is set with Variants, to the reservations of the variants
+	// that are kept
+	Reserved *int `json:"-"`
+	// Reservations are set with Variants, to the reservations the variants
+	// were prepared from. The update only applies while they are unchanged,
+	// so that no reservation made meanwhile is overwritten.
+	Reservations *StockReservations `json:"-"`
+	// SearchGrams is set when the name or description changes
+	SearchGrams []string `json:"-"`
+}
+
+func (p UpdateProductRequest) Validate() error {
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Name, validation.NilOrNotEmpty, validation.Length(3, 255)),
+		validation.Field(&p.Description, validation.NilOrNotEmpty, validation.Length(3, 255)),
+		validation.Field(&p.Price),
+		validation.Field(&p.Quantity, validation.Min(0)),
+	)
+}
+
+// Actor is the authenticated user making a request.
+type Actor struct {
+	UserId   string
+	UserType string
+	Name     string
+}
+
+func (a Actor) IsAdmin() bool {
+	return a.UserType == "ADMIN"
+}
+
 type ProductList struct {
 	Data   []*Product `json:"data"`
 	Count  int64      `json:"count"`
 	Source Source     `json:"source"`
+	// NextCursor is empty on the last page
+	NextCursor *string `json:"nextCursor"`
 }
 
 type Source string
@@ -57,7 +176,3 @@ const (
 	DBData    Source = "database"
 	CacheData Source = "cache_memory"
 )
-
-type ProductFilter struct {
-	Limit int64 `json:"limit"`
-}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+type PurchaseFilter struct {
+	// BuyerId and SellerId are set from the token, a buyer only sees their
+	// purchases and a seller only their sales
+	BuyerId  string `json:"-"`
+	SellerId string `json:"-"`
+	// Paid leaves out the purchases of the orders not paid yet, sellers only
+	// see their paid sales
+	Paid bool `json:"-"`
+	// Filter by product
+	ProductId *string `json:"productId"`
+	// From and To limit the purchases to a period, both are inclusive
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+	// NextCursorId is the nextCursorId of the previous page
+	NextCursorId *string `json:"nextCursorId"`
+	// Limit the number of records to be returned at once
+	Limit int64 `json:"limit"`
+}
+
+type PurchaseList struct {
+	Data  []*PurchaseProduct `json:"data"`
+	Count int64              `json:"count"`
+	// NextCursorId is empty on the last page
+	NextCursorId *string `json:"nextCursorId"`
+}
+
+type SalesSummaryFilter struct {
+	SellerId string     `json:"-"`
+	From     *time.Time `json:"from"`
+	To       *time.Time `json:"to"`
+	// TopProducts is the number of best selling products returned
+	TopProducts int `json:"topProducts"`
+}
+
+type ProductSales struct {
+	ProductId   string  `json:"productId"`
+	ProductName string  `json:"productName"`
+	Units       int64   `json:"units"`
+	Revenue     []Money `json:"revenue"`
+}
+
+// SalesSummary totals the sales of a seller over a period, revenue is
+// totalled per currency.
+type SalesSummary struct {
+	From        *time.Time      `json:"from"`
+	To          *time.Time      `json:"to"`
+	Sales       int64           `json:"sales"`
+	Units       int64           `json:"units"`
+	Revenue     []Money         `json:"revenue"`
+	TopProducts []*ProductSales `json:"topProducts"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var ErrSearchQueryTooShort = errors.New("search query must be at least 2 characters")
+
+type SearchQuery struct {
+	Q string `json:"q"`
+	// Currency of the price facets, it defaults to DefaultCurrency
+	Currency string `json:"currency"`
+	Page     int64  `json:"page"`
+	Limit    int64  `json:"limit"`
+}
+
+func (q SearchQuery) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Q, validation.Required, validation.RuneLength(2, 200).Error(ErrSearchQueryTooShort.Error())),
+		validation.Field(&q.Page, validation.Min(int64(0))),
+	)
+}
+
+// SearchMode tells how results were matched.
+type SearchMode string
+
+const (
+	// SearchText matched whole words of the query
+	SearchText SearchMode = "text"
+	// SearchFuzzy matched words similar to those of the query, it is used
+	// when no word matched
+	SearchFuzzy SearchMode = "fuzzy"
+)
+
+type SearchHit struct {
+	*Product
+	Score float64 `json:"score"`
+	// Highlights has a snippet of the name and description with the
+	// matching words wrapped in <em>
+	Highlights map[string]string `json:"highlights"`
+}
+
+type PriceBucket struct {
+	Min Money `json:"min"`
+	// Max is excluded, it is nil for the last bucket
+	Max   *Money `json:"max"`
+	Count int64  `json:"count"`
+}
+
+type CategoryFacet struct {
+	CategoryId string `json:"categoryId"`
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	Count      int64  `json:"count"`
+}
+
+type SearchFacets struct {
+	Price      []*PriceBucket   `json:"price"`
+	Categories []*CategoryFacet `json:"categories"`
+}
+
+type SearchResult struct {
+	Data   []*SearchHit  `json:"data"`
+	Count  int64         `json:"count"`
+	Mode   SearchMode    `json:"mode"`
+	Facets *SearchFacets `json:"facets"`
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrVariantRequired       = errors.New("this product has variants, choose one with variantId")
+	ErrVariantNotFound       = errors.New("variant not found")
+	ErrVariantQuantity       = errors.New("the quantity of a product with variants is the sum of the quantities of its variants, update the variants instead")
+	ErrVariantCurrency       = errors.New("the price of a variant must be in the currency of the product")
+	ErrOptionsWithoutVariant = errors.New("a product with options must have variants")
+	ErrQuantityRequired      = errors.New("the variants of a product can only be removed with its new qty")
+	ErrQuantityReserved      = errors.New("the quantity can not be lower than the stock reserved by pending orders")
+)
+
+// ProductOption is a way a product varies, such as size with values S, M
+// and L.
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// Variant is a combination of option values of a product, with its own
+// stock and, when it differs from the product, its own price.
+type Variant struct {
+	VariantId string `json:"variantId"`
+	SKU       string `json:"sku"`
+	// Options maps the name of every option of the product to a value
+	Options  map[string]string `json:"options"`
+	Price    *Money            `json:"price"`
+	Quantity int               `json:"qty"`
+	// Reserved and Available are the variant counterparts of the fields of
+	// Product
+	Reserved  int `json:"reserved"`
+	Available int `json:"available" bson:"-"`
+}
+
+// UnitPrice returns the price of the variant, or of product when the
+// variant has none.
+func (v *Variant) UnitPrice(product *Product) *Money {
+	if v.Price != nil {
+		return v.Price
+	}
+	return product.Price
+}
+
+// combination returns the option values of the variant in the order of
+// options, as a comparable key.
+func (v *Variant) combination(options []ProductOption) string {
+	values := make([]string, 0, len(options))
+	for _, option := range options {
+		values = append(values, strings.ToLower(v.Options[option.Name]))
+	}
+	return strings.Join(values, "\x00")
+}
+
+// ValidateVariants checks that every variant has one defined value for
+// each option, that no two variants have the same combination or SKU, and
+// that their prices are in the currency of price.
+func ValidateVariants(options []ProductOption, variants []*Variant, price *Money) error {
+	if len(options) > 0 && len(variants) == 0 {
+		return ErrOptionsWithoutVariant
+	}
+
+	values := make(map[string]map[string]bool, len(options))
+	for _, option := range options {
+		name := strings.TrimSpace(option.Name)
+		if name == "" || len(option.Values) == 0 {
+			return fmt.Errorf("option %q must have a name and values", option.Name)
+		}
+		if values[name] != nil {
+			return fmt.Errorf("option %q is defined twice", name)
+		}
+		values[name] = map[string]bool{}
+		for _, value := range option.Values {
+			key := strings.ToLower(strings.TrimSpace(value))
+			if key == "" || values[name][key] {
+				return fmt.Errorf("option %q has an empty or duplicate value", name)
+			}
+			values[name][key] = true
+		}
+	}
+
+	combinations := map[string]bool{}
+	skus := map[string]bool{}
+	for _, variant := range variants {
+		if strings.TrimSpace(variant.SKU) == "" {
+			return errors.New("every variant must have a sku")
+		}
+		sku := strings.ToUpper(variant.SKU)
+		if skus[sku] {
+			return fmt.Errorf("sku %q is used by two variants", variant.SKU)
+		}
+		skus[sku] = true
+
+		if len(variant.Options) != len(options) {
+			return fmt.Errorf("variant %q must have exactly one value for each option", variant.SKU)
+		}
+		for name, value := range variant.Options {
+			if !values[name][strings.ToLower(strings.TrimSpace(value))] {
+				return fmt.Errorf("variant %q has an unknown value %q for option %q", variant.SKU, value, name)
+			}
+		}
+
+		combination := variant.combination(options)
+		if combinations[combination] {
+			return fmt.Errorf("variant %q has the same options as another variant", variant.SKU)
+		}
+		combinations[combination] = true
+
+		if variant.Quantity < 0 {
+			return fmt.Errorf("variant %q can not have a negative quantity", variant.SKU)
+		}
+		if variant.Price != nil {
+			if err := variant.Price.Validate(); err != nil {
+				return fmt.Errorf("variant %q: %w", variant.SKU, err)
+			}
+			if price != nil && variant.Price.Currency != price.Currency {
+				return ErrVariantCurrency
+			}
+		}
+	}
+
+	return nil
+}
+
+// PrepareVariants gives an id to the new variants, keeping the ids and
+// reservations of those matching a variant of existing by SKU, and returns
+// the total quantity and reservations.
+func PrepareVariants(variants []*Variant, existing []*Variant) (quantity, reserved int) {
+	kept := map[string]*Variant{}
+	for _, variant := range existing {
+		kept[strings.ToUpper(variant.SKU)] = variant
+	}
+
+	for _, variant := range variants {
+		variant.SKU = strings.TrimSpace(variant.SKU)
+		if old, ok := kept[strings.ToUpper(variant.SKU)]; ok {
+			variant.VariantId = old.VariantId
+			variant.Reserved = old.Reserved
+		} else {
+			variant.VariantId = primitive.NewObjectID().Hex()
+			variant.Reserved = 0
+		}
+		quantity += variant.Quantity
+		reserved += variant.Reserved
+	}
+	return quantity, reserved
+}
+
+// CheckReservations fails with ErrQuantityReserved when variants, prepared
+// with PrepareVariants, drop a variant of existing that has reservations or
+// lower its quantity below them.
+func CheckReservations(variants []*Variant, existing []*Variant) error {
+	ids := map[string]*Variant{}
+	for _, variant := range variants {
+		ids[variant.VariantId] = variant
+	}
+
+	for _, old := range existing {
+		if old.Reserved == 0 {
+			continue
+		}
+		if variant, ok := ids[old.VariantId]; !ok || variant.Quantity < variant.Reserved {
+			return ErrQuantityReserved
+		}
+	}
+	return nil
+}
+
+// StockReservations are the reserved quantities of a product and of its
+// variants, in the order they are stored.
+type StockReservations struct {
+	Reserved   int
+	VariantIds []string
+	Variants   []int
+}
+
+// StockReservations returns the reservations of the product.
+func (p *Product) StockReservations() *StockReservations {
+	reservations := &StockReservations{Reserved: p.Reserved, VariantIds: []string{}, Variants: []int{}}
+	for _, variant := range p.Variants {
+		reservations.VariantIds = append(reservations.VariantIds, variant.VariantId)
+		reservations.Variants = append(reservations.Variants, variant.Reserved)
+	}
+	return reservations
+}
+
+// Variant returns the variant of the product with id.
+func (p *Product) Variant(id string) (*Variant, error) {
+	for _, variant := range p.Variants {
+		if variant.VariantId == id {
+			return variant, nil
+		}
+	}
+	return nil, ErrVariantNotFound
+}
+
+// PickVariant returns the variant variantId of the product. It returns nil
+// for a product without variants, variantId must then be empty.
+func (p *Product) PickVariant(variantId string) (*Variant, error) {
+	if len(p.Variants) == 0 {
+		if variantId != "" {
+			return nil, ErrVariantNotFound
+		}
+		return nil, nil
+	}
+	if variantId == "" {
+		return nil, ErrVariantRequired
+	}
+	return p.Variant(variantId)
+}
+
+// Stock returns the available quantity of variant, or of the product when
+// variant is nil. It is the quantity left less the reservations of pending
+// orders.
+func (p *Product) Stock(variant *Variant) int {
+	quantity, reserved := p.Quantity, p.Reserved
+	if variant != nil {
+		quantity, reserved = variant.Quantity, variant.Reserved
+	}
+	if quantity < reserved {
+		return 0
+	}
+	return quantity - reserved
+}
+
+// PriceOf returns the unit price of variant, or of the product when variant
+// is nil.
+func (p *Product) PriceOf(variant *Variant) *Money {
+	if variant != nil {
+		return variant.UnitPrice(p)
+	}
+	return p.Price
+}
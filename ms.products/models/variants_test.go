@@ -0,0 +1,202 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateVariants(t *testing.T) {
+	options := []ProductOption{
+		{Name: "size", Values: []string{"S", "M"}},
+		{Name: "color", Values: []string{"red", "blue"}},
+	}
+	usd, higher, eur := NewMoney(1000, "USD"), NewMoney(1200, "USD"), NewMoney(1000, "EUR")
+
+	variant := func(sku, size, color string) *Variant {
+		return &Variant{SKU: sku, Options: map[string]string{"size": size, "color": color}, Quantity: 1}
+	}
+
+	tests := []struct {
+		name     string
+		options  []ProductOption
+		variants []*Variant
+		price    *Money
+		wantErr  bool
+		// is is the error expected, when the test wants a specific one
+		is error
+	}{
+		{name: "no options nor variants"},
+		{
+			name:     "variants",
+			options:  options,
+			variants: []*Variant{variant("TEE-S-RED", "S", "red"), variant("TEE-M-BLUE", "m", "Blue")},
+			price:    &usd,
+		},
+		{name: "options without variants", options: options, wantErr: true, is: ErrOptionsWithoutVariant},
+		{
+			name:     "option without values",
+			options:  []ProductOption{{Name: "size"}},
+			variants: []*Variant{{SKU: "TEE", Options: map[string]string{"size": "S"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "option defined twice",
+			options:  []ProductOption{{Name: "size", Values: []string{"S"}}, {Name: " size ", Values: []string{"M"}}},
+			variants: []*Variant{variant("TEE", "S", "")},
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate option value",
+			options:  []ProductOption{{Name: "size", Values: []string{"S", "s "}}},
+			variants: []*Variant{{SKU: "TEE", Options: map[string]string{"size": "S"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "variant without sku",
+			options:  options,
+			variants: []*Variant{variant(" ", "S", "red")},
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate sku",
+			options:  options,
+			variants: []*Variant{variant("TEE", "S", "red"), variant("tee", "M", "red")},
+			wantErr:  true,
+		},
+		{
+			name:     "missing option value",
+			options:  options,
+			variants: []*Variant{{SKU: "TEE", Options: map[string]string{"size": "S"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown option value",
+			options:  options,
+			variants: []*Variant{variant("TEE", "XL", "red")},
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate combination",
+			options:  options,
+			variants: []*Variant{variant("TEE-1", "S", "red"), variant("TEE-2", "s", "RED")},
+			wantErr:  true,
+		},
+		{
+			name:     "negative quantity",
+			options:  options,
+			variants: []*Variant{{SKU: "TEE", Options: map[string]string{"size": "S", "color": "red"}, Quantity: -1}},
+			wantErr:  true,
+		},
+		{
+			name:     "variant price",
+			options:  options,
+			variants: []*Variant{{SKU: "TEE", Options: map[string]string{"size": "S", "color": "red"}, Price: &higher}},
+			price:    &usd,
+		},
+		{
+			name:     "variant price in another currency",
+			options:  options,
+			variants: []*Variant{{SKU: "TEE", Options: map[string]string{"size": "S", "color": "red"}, Price: &eur}},
+			price:    &usd,
+			wantErr:  true,
+			is:       ErrVariantCurrency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVariants(tt.options, tt.variants, tt.price)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateVariants() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("ValidateVariants() error = %v, want %v", err, tt.is)
+			}
+		})
+	}
+}
+
+func TestPrepareVariants(t *testing.T) {
+	existing := []*Variant{
+		{VariantId: "small", SKU: "TEE-S", Quantity: 3, Reserved: 2},
+		{VariantId: "medium", SKU: "TEE-M", Quantity: 4, Reserved: 1},
+	}
+
+	tests := []struct {
+		name         string
+		variants     []*Variant
+		wantQuantity int
+		wantReserved int
+		// wantIds are the ids expected for the variants, an empty one
+		// expects a new id
+		wantIds []string
+	}{
+		{
+			name:         "kept by sku",
+			variants:     []*Variant{{SKU: " tee-s ", Quantity: 5}, {SKU: "TEE-M", Quantity: 1, Reserved: 9}},
+			wantQuantity: 6,
+			wantReserved: 3,
+			wantIds:      []string{"small", "medium"},
+		},
+		{
+			name:         "new sku",
+			variants:     []*Variant{{SKU: "TEE-S", Quantity: 5}, {VariantId: "forged", SKU: "TEE-L", Quantity: 2, Reserved: 4}},
+			wantQuantity: 7,
+			wantReserved: 2,
+			wantIds:      []string{"small", ""},
+		},
+		{name: "no variants"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quantity, reserved := PrepareVariants(tt.variants, existing)
+			if quantity != tt.wantQuantity || reserved != tt.wantReserved {
+				t.Errorf("PrepareVariants() = %d, %d, want %d, %d", quantity, reserved, tt.wantQuantity, tt.wantReserved)
+			}
+
+			for i, variant := range tt.variants {
+				want := tt.wantIds[i]
+				if want == "" {
+					for _, old := range append(existing, &Variant{VariantId: "forged"}) {
+						if variant.VariantId == old.VariantId {
+							t.Errorf("new variant %s got the id %q", variant.SKU, variant.VariantId)
+						}
+					}
+					if variant.VariantId == "" {
+						t.Errorf("new variant %s got no id", variant.SKU)
+					}
+					continue
+				}
+				if variant.VariantId != want {
+					t.Errorf("variant %s id = %q, want %q", variant.SKU, variant.VariantId, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReservations(t *testing.T) {
+	existing := []*Variant{
+		{VariantId: "small", SKU: "TEE-S", Quantity: 3, Reserved: 2},
+		{VariantId: "medium", SKU: "TEE-M", Quantity: 4},
+	}
+
+	tests := []struct {
+		name     string
+		variants []*Variant
+		wantErr  error
+	}{
+		{name: "kept", variants: []*Variant{{VariantId: "small", Quantity: 2, Reserved: 2}}},
+		{name: "below reservations", variants: []*Variant{{VariantId: "small", Quantity: 1, Reserved: 2}}, wantErr: ErrQuantityReserved},
+		{name: "reserved variant removed", variants: []*Variant{{VariantId: "medium", Quantity: 4}}, wantErr: ErrQuantityReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckReservations(tt.variants, existing); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckReservations() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
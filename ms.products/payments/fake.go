@@ -0,0 +1,129 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+)
+
+// Payment methods understood by Fake, every other payment method is
+// approved.
+const (
+	FakeDeclinedCard          = "pm_card_declined"
+	FakeInsufficientFundsCard = "pm_card_insufficient_funds"
+)
+
+// FakeSignatureHeader carries the signature of the webhooks of Fake.
+const FakeSignatureHeader = "X-Fake-Signature"
+
+type fakePayment struct {
+	amount   models.Money
+	captured bool
+	refunded bool
+}
+
+// Fake is a deterministic provider for local runs and tests, no money moves.
+// References are derived from the idempotency keys, and the payment method
+// decides whether a payment is declined.
+type Fake struct {
+	secret []byte
+
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+}
+
+// NewFake returns a Fake whose webhooks are signed with secret.
+func NewFake(secret string) *Fake {
+	return &Fake{
+		secret:   []byte(secret),
+		payments: map[string]*fakePayment{},
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorize(ctx context.Context, request AuthorizeRequest) (*Authorization, error) {
+	sum := sha256.Sum256([]byte(request.IdempotencyKey))
+	reference := "fake_" + hex.EncodeToString(sum[:12])
+
+	switch request.PaymentMethod {
+	case FakeDeclinedCard:
+		return &Authorization{Reference: reference, DeclineReason: "card_declined"}, nil
+	case FakeInsufficientFundsCard:
+		return &Authorization{Reference: reference, DeclineReason: "insufficient_funds"}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if payment, ok := f.payments[reference]; ok && payment.amount != request.Amount {
+		return nil, ErrInvalidAmount
+	}
+	if _, ok := f.payments[reference]; !ok {
+		f.payments[reference] = &fakePayment{amount: request.Amount}
+	}
+
+	return &Authorization{Reference: reference, Approved: true}, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, reference string, amount models.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, ok := f.payments[reference]
+	if !ok || payment.refunded {
+		return ErrUnknownPayment
+	}
+	if payment.amount != amount {
+		return ErrInvalidAmount
+	}
+	payment.captured = true
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, reference string, amount models.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payment, ok := f.payments[reference]
+	if !ok {
+		return ErrUnknownPayment
+	}
+	if payment.amount != amount {
+		return ErrInvalidAmount
+	}
+	payment.refunded = true
+	return nil
+}
+
+func (f *Fake) VerifyWebhook(header http.Header, body []byte) (*WebhookEvent, error) {
+	signature, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, f.sign(body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.EventId == "" || event.Reference == "" {
+		return nil, ErrInvalidWebhook
+	}
+	return &event, nil
+}
+
+// SignWebhook returns the signature header value of body, it lets local
+// runs and tests send webhooks as Fake would.
+func (f *Fake) SignWebhook(body []byte) string {
+	return hex.EncodeToString(f.sign(body))
+}
+
+func (f *Fake) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,166 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+)
+
+func TestFakeAuthorize(t *testing.T) {
+	tests := []struct {
+		name          string
+		paymentMethod string
+		approved      bool
+		declineReason string
+	}{
+		{name: "approved", paymentMethod: "pm_card_visa", approved: true},
+		{name: "no payment method", approved: true},
+		{name: "declined", paymentMethod: FakeDeclinedCard, declineReason: "card_declined"},
+		{name: "insufficient funds", paymentMethod: FakeInsufficientFundsCard, declineReason: "insufficient_funds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFake("secret")
+			auth, err := fake.Authorize(context.Background(), AuthorizeRequest{
+				IdempotencyKey: "order:" + tt.name,
+				Amount:         models.NewMoney(1000, "USD"),
+				PaymentMethod:  tt.paymentMethod,
+			})
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+			if auth.Approved != tt.approved || auth.DeclineReason != tt.declineReason {
+				t.Errorf("Authorize() = approved %v, reason %q, want %v, %q", auth.Approved, auth.DeclineReason, tt.approved, tt.declineReason)
+			}
+			if auth.Reference == "" {
+				t.Error("Authorize() returned no reference")
+			}
+		})
+	}
+}
+
+func TestFakeAuthorizeIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake("secret")
+	request := AuthorizeRequest{IdempotencyKey: "order:key", Amount: models.NewMoney(1000, "USD")}
+
+	first, err := fake.Authorize(ctx, request)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	again, err := fake.Authorize(ctx, request)
+	if err != nil {
+		t.Fatalf("Authorize() again error = %v", err)
+	}
+	if *again != *first {
+		t.Errorf("Authorize() again = %+v, want %+v", again, first)
+	}
+
+	other, err := fake.Authorize(ctx, AuthorizeRequest{IdempotencyKey: "order:other", Amount: request.Amount})
+	if err != nil {
+		t.Fatalf("Authorize() other key error = %v", err)
+	}
+	if other.Reference == first.Reference {
+		t.Error("Authorize() returned the same reference for another idempotency key")
+	}
+
+	request.Amount = models.NewMoney(2000, "USD")
+	if _, err := fake.Authorize(ctx, request); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Authorize() with another amount error = %v, want %v", err, ErrInvalidAmount)
+	}
+}
+
+func TestFakeCaptureAndRefund(t *testing.T) {
+	ctx := context.Background()
+	amount := models.NewMoney(1000, "USD")
+
+	tests := []struct {
+		name    string
+		call    func(f *Fake, reference string) error
+		wantErr error
+	}{
+		{
+			name: "capture",
+			call: func(f *Fake, reference string) error { return f.Capture(ctx, reference, amount) },
+		},
+		{
+			name:    "capture another amount",
+			call:    func(f *Fake, reference string) error { return f.Capture(ctx, reference, models.NewMoney(1, "USD")) },
+			wantErr: ErrInvalidAmount,
+		},
+		{
+			name:    "capture unknown payment",
+			call:    func(f *Fake, reference string) error { return f.Capture(ctx, "fake_unknown", amount) },
+			wantErr: ErrUnknownPayment,
+		},
+		{
+			name: "capture refunded payment",
+			call: func(f *Fake, reference string) error {
+				if err := f.Refund(ctx, reference, amount); err != nil {
+					return err
+				}
+				return f.Capture(ctx, reference, amount)
+			},
+			wantErr: ErrUnknownPayment,
+		},
+		{
+			name: "refund",
+			call: func(f *Fake, reference string) error { return f.Refund(ctx, reference, amount) },
+		},
+		{
+			name:    "refund another amount",
+			call:    func(f *Fake, reference string) error { return f.Refund(ctx, reference, models.NewMoney(1, "USD")) },
+			wantErr: ErrInvalidAmount,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFake("secret")
+			auth, err := fake.Authorize(ctx, AuthorizeRequest{IdempotencyKey: "order:key", Amount: amount})
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+			if err := tt.call(fake, auth.Reference); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFakeVerifyWebhook(t *testing.T) {
+	fake := NewFake("secret")
+	body := []byte(`{"id":"evt_1","type":"payment.captured","reference":"fake_1"}`)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		wantErr   error
+	}{
+		{name: "signed", body: body, signature: fake.SignWebhook(body)},
+		{name: "no signature", body: body, wantErr: ErrInvalidSignature},
+		{name: "signed with another secret", body: body, signature: NewFake("other").SignWebhook(body), wantErr: ErrInvalidSignature},
+		{name: "tampered body", body: []byte(`{"id":"evt_1","type":"payment.captured","reference":"fake_2"}`), signature: fake.SignWebhook(body), wantErr: ErrInvalidSignature},
+		{name: "no event id", body: []byte(`{"type":"payment.captured","reference":"fake_1"}`), signature: fake.SignWebhook([]byte(`{"type":"payment.captured","reference":"fake_1"}`)), wantErr: ErrInvalidWebhook},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(FakeSignatureHeader, tt.signature)
+
+			event, err := fake.VerifyWebhook(header, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyWebhook() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (event.EventId != "evt_1" || event.Type != PaymentCaptured || event.Reference != "fake_1") {
+				t.Errorf("VerifyWebhook() = %+v", event)
+			}
+		})
+	}
+}
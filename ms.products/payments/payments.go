@@ -0,0 +1,71 @@
+// Package payments moves the money of orders through a payment provider.
+// Providers authorize a payment, capture it once the order is confirmed,
+// refund it, and notify the service of changes made on their side with
+// signed webhooks.
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidWebhook   = errors.New("invalid webhook payload")
+	ErrUnknownPayment   = errors.New("unknown payment")
+	ErrInvalidAmount    = errors.New("the amount does not match the payment")
+)
+
+type Provider interface {
+	// Name identifies the provider in the stored payments and in the URL
+	// of its webhooks.
+	Name() string
+	// Authorize holds the amount on the payment method of the buyer. Calls
+	// with the same IdempotencyKey return the same authorization, a
+	// declined payment is not an error.
+	Authorize(ctx context.Context, request AuthorizeRequest) (*Authorization, error)
+	// Capture collects an authorized payment, capturing it again does
+	// nothing.
+	Capture(ctx context.Context, reference string, amount models.Money) error
+	// Refund returns a captured payment to the buyer, or releases an
+	// authorization that was never captured.
+	Refund(ctx context.Context, reference string, amount models.Money) error
+	// VerifyWebhook checks the signature of a webhook and decodes it.
+	VerifyWebhook(header http.Header, body []byte) (*WebhookEvent, error)
+}
+
+type AuthorizeRequest struct {
+	IdempotencyKey string
+	Amount         models.Money
+	// PaymentMethod is the token of the payment method the buyer entered on
+	// the provider side
+	PaymentMethod string
+	Description   string
+}
+
+type Authorization struct {
+	// Reference is the id of the payment at the provider
+	Reference     string
+	Approved      bool
+	DeclineReason string
+}
+
+type WebhookEventType string
+
+const (
+	PaymentCaptured WebhookEventType = "payment.captured"
+	PaymentFailed   WebhookEventType = "payment.failed"
+	PaymentRefunded WebhookEventType = "payment.refunded"
+)
+
+type WebhookEvent struct {
+	// EventId is unique per event, providers send an event again until it
+	// is acknowledged
+	EventId   string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	Reference string           `json:"reference"`
+	Reason    string           `json:"reason,omitempty"`
+}
@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/gin-gonic/gin"
+)
+
+// cartIdHeader carries the token of the cart of an anonymous visitor, it is
+// returned with every anonymous cart.
+const cartIdHeader = "X-Cart-Id"
+
+func cartResponse(c *gin.Context, cart *models.Cart) {
+	if cart.CartId != "" {
+		c.Header(cartIdHeader, cart.CartId)
+	}
+	c.JSON(http.StatusOK, cart)
+}
+
+func (r RouteService) GetCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		cart, err := r.core.GetCart(ctx, actor(c), c.GetHeader(cartIdHeader))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		cartResponse(c, cart)
+	}
+}
+
+func (r RouteService) AddCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.AddCartItemRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cart, err := r.core.AddCartItem(ctx, actor(c), c.GetHeader(cartIdHeader), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		cartResponse(c, cart)
+	}
+}
+
+func (r RouteService) UpdateCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.UpdateCartItemRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cart, err := r.core.UpdateCartItem(ctx, actor(c), c.GetHeader(cartIdHeader), c.Param("item_id"), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		cartResponse(c, cart)
+	}
+}
+
+func (r RouteService) RemoveCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		cart, err := r.core.RemoveCartItem(ctx, actor(c), c.GetHeader(cartIdHeader), c.Param("item_id"))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		cartResponse(c, cart)
+	}
+}
+
+func (r RouteService) ClearCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := r.core.ClearCart(ctx, actor(c), c.GetHeader(cartIdHeader)); err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": "cart cleared"})
+	}
+}
+
+// MergeCart moves the anonymous cart sent in the X-Cart-Id header into the
+// cart of the user, clients call it right after signing in to ms.users,
+// see its Login route.
+func (r RouteService) MergeCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		cart, err := r.core.MergeCart(ctx, actor(c), c.GetHeader(cartIdHeader))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		cartResponse(c, cart)
+	}
+}
+
+func (r RouteService) Checkout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.CheckoutRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&payload); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		order, err := r.core.Checkout(ctx, actor(c), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
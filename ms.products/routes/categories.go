@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (r RouteService) CategoryTree() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		tree, err := r.core.CategoryTree(ctx)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": tree})
+	}
+}
+
+func (r RouteService) GetCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		category, err := r.core.GetCategory(ctx, c.Param("id"))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func (r RouteService) CreateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.CreateCategoryRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		category, err := r.core.CreateCategory(ctx, actor(c), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func (r RouteService) UpdateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.UpdateCategoryRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		category, err := r.core.UpdateCategory(ctx, actor(c), c.Param("id"), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func (r RouteService) DeleteCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := r.core.DeleteCategory(ctx, actor(c), c.Param("id")); err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": "category deleted"})
+	}
+}
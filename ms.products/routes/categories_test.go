@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/cache"
+	"github.com/fredele20/microservice-practice/ms.products/core"
+	"github.com/fredele20/microservice-practice/ms.products/database"
+	"github.com/fredele20/microservice-practice/ms.products/middlewares"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// categoryStore keeps the categories created through the service, the
+// other store methods are not used by these tests.
+type categoryStore struct {
+	database.DBInterface
+	created []*models.Category
+}
+
+func (s *categoryStore) CreateCategory(ctx context.Context, category *models.Category) (*models.Category, error) {
+	s.created = append(s.created, category)
+	return category, nil
+}
+
+func TestCreateCategoryAsAdmin(t *testing.T) {
+	middlewares.SECRET_KEY = "test-secret"
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		role   string
+		status int
+	}{
+		{name: "admin", role: "ADMIN", status: http.StatusOK},
+		{name: "user", role: "USER", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &categoryStore{}
+			service := core.NewProductService(store, logrus.New(), cache.RedisConnection{}, nil, store, nil, nil)
+			router := gin.New()
+			router.POST("/categories", middlewares.Authentication(), NewRouteService(service).CreateCategory())
+
+			token, err := jwt.Sign(session.TokenPayload{
+				UserId: "u1",
+				Role:   tt.role,
+				Payload: jwt.Payload{
+					ExpirationTime: jwt.NumericDate(time.Now().Add(time.Hour)),
+				},
+			}, jwt.NewHS256([]byte(middlewares.SECRET_KEY)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, "/categories", strings.NewReader(`{"name":"Garden tools"}`))
+			request.Header.Set("token", string(token))
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if created := len(store.created) == 1; created != (tt.status == http.StatusOK) {
+				t.Errorf("created %d categories", len(store.created))
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.users/libs/imaging"
+	"github.com/gin-gonic/gin"
+)
+
+func (r RouteService) UploadImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		// the image itself is limited by the core, this only stops
+		// oversized requests before they are buffered
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, imaging.DefaultLimits.MaxBytes+1<<20)
+
+		file, err := c.FormFile("image")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an image is required in the image field, of at most 5MB"})
+			return
+		}
+
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer opened.Close()
+
+		product, err := r.core.UploadImage(ctx, actor(c), c.Param("id"), opened)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		product.Present(locale(c))
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+func (r RouteService) ReorderImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.ReorderImagesRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, err := r.core.ReorderImages(ctx, actor(c), c.Param("id"), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		product.Present(locale(c))
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+func (r RouteService) SetPrimaryImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		product, err := r.core.SetPrimaryImage(ctx, actor(c), c.Param("id"), c.Param("image_id"))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		product.Present(locale(c))
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+func (r RouteService) DeleteImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		product, err := r.core.DeleteImage(ctx, actor(c), c.Param("id"), c.Param("image_id"))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		product.Present(locale(c))
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+// ImageFile serves the product images kept in the local blob store.
+func (r RouteService) ImageFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, contentType, err := r.core.OpenImageFile(c.Request.Context(), c.Param("key"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		// every upload is stored under a new key, so files never change
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.DataFromReader(http.StatusOK, -1, contentType, file, nil)
+	}
+}
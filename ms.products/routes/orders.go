@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/gin-gonic/gin"
+)
+
+func orderFilter(c *gin.Context) (models.OrderFilter, error) {
+	var filter models.OrderFilter
+	var err error
+
+	filter.Status = models.OrderStatus(c.Query("status"))
+	if cursor := c.Query("nextCursorId"); cursor != "" {
+		filter.NextCursorId = &cursor
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			return filter, fmt.Errorf("limit must be a number")
+		}
+	}
+
+	return filter, nil
+}
+
+func (r RouteService) ListOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		filter, err := orderFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		orders, err := r.core.ListOrders(ctx, c.GetString("userId"), filter)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, orders)
+	}
+}
+
+func (r RouteService) ListSellerOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		filter, err := orderFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		orders, err := r.core.ListSellerOrders(ctx, c.GetString("userId"), filter)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, orders)
+	}
+}
+
+func (r RouteService) GetOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		order, err := r.core.GetOrder(ctx, actor(c), c.Param("id"))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// TransitionOrder returns the handler taking action on an order, the body
+// is optional.
+func (r RouteService) TransitionOrder(action models.OrderAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.OrderTransitionRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&payload); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		order, err := r.core.TransitionOrder(ctx, actor(c), c.Param("id"), action, payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyKeyHeader lets clients retry a payment without charging the
+// buyer twice.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxWebhookSize bounds the body of payment webhooks.
+const maxWebhookSize = 1 << 20
+
+func (r RouteService) PayOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.PayOrderRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := r.core.PayOrder(ctx, actor(c), c.Param("id"), c.GetHeader(idempotencyKeyHeader), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+func (r RouteService) ListOrderPayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		intents, err := r.core.ListOrderPayments(ctx, actor(c), c.Param("id"))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": intents})
+	}
+}
+
+// PaymentWebhook receives the webhooks of the payment provider, they are
+// authenticated by their signature instead of a token.
+func (r RouteService) PaymentWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookSize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := r.core.HandlePaymentWebhook(ctx, c.Param("provider"), c.Request.Header, body); err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"received": true})
+	}
+}
@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/core"
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/fredele20/microservice-practice/ms.products/payments"
+	"github.com/fredele20/microservice-practice/ms.users/libs/imaging"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// actor returns the authenticated user of the request.
+func actor(c *gin.Context) models.Actor {
+	return models.Actor{
+		UserId:   c.GetString("userId"),
+		UserType: c.GetString("userType"),
+		Name:     c.GetString("firstName") + " " + c.GetString("lastName"),
+	}
+}
+
+// locale returns the preferred language of the request, prices are
+// formatted for it.
+func locale(c *gin.Context) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	if err != nil || len(tags) == 0 {
+		return language.English
+	}
+	return tags[0]
+}
+
+// productErrorStatus maps the errors of product changes to a status code.
+func productErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, core.ErrProductNotFound), errors.Is(err, core.ErrCategoryNotFound), errors.Is(err, models.ErrVariantNotFound),
+		errors.Is(err, core.ErrImageNotFound), errors.Is(err, core.ErrCartItemNotFound), errors.Is(err, core.ErrOrderNotFound),
+		errors.Is(err, core.ErrUnknownPaymentProvider):
+		return http.StatusNotFound
+	case errors.Is(err, core.ErrNotProductOwner), errors.Is(err, core.ErrOwnProductPurchase), errors.Is(err, core.ErrAdminOnly),
+		errors.Is(err, models.ErrOrderActionForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, core.ErrInsufficientStock), errors.Is(err, core.ErrProductNotPriced), errors.Is(err, core.ErrCategorySlugTaken), errors.Is(err, core.ErrCategoryHasChildren),
+		errors.Is(err, core.ErrTooManyImages), errors.Is(err, core.ErrImagesChanged),
+		errors.Is(err, core.ErrCartFull), errors.Is(err, core.ErrCartUnavailable), errors.Is(err, core.ErrCartChanged),
+		errors.Is(err, core.ErrCartConflict), errors.Is(err, core.ErrCheckoutRunning),
+		errors.Is(err, models.ErrInvalidOrderTransition), errors.Is(err, models.ErrOrderNotPaid), errors.Is(err, core.ErrOrderChanged),
+		errors.Is(err, core.ErrPaymentInProgress), errors.Is(err, core.ErrReservationExpired), errors.Is(err, models.ErrQuantityReserved),
+		errors.Is(err, core.ErrProductChanged):
+		return http.StatusConflict
+	case errors.Is(err, core.ErrUpdateProductFailed), errors.Is(err, core.ErrDeleteProductFailed), errors.Is(err, core.ErrGetProductFailed), errors.Is(err, core.ErrPurchaseFailed),
+		errors.Is(err, core.ErrListPurchasesFailed), errors.Is(err, core.ErrSalesSummaryFailed),
+		errors.Is(err, core.ErrSearchFailed), errors.Is(err, core.ErrListCategoriesFailed), errors.Is(err, core.ErrCreateCategoryFailed),
+		errors.Is(err, core.ErrUpdateCategoryFailed), errors.Is(err, core.ErrDeleteCategoryFailed),
+		errors.Is(err, core.ErrUploadImageFailed), errors.Is(err, core.ErrUpdateImagesFailed),
+		errors.Is(err, core.ErrGetCartFailed), errors.Is(err, core.ErrSaveCartFailed), errors.Is(err, core.ErrCheckoutFailed),
+		errors.Is(err, core.ErrGetOrderFailed), errors.Is(err, core.ErrListOrdersFailed), errors.Is(err, core.ErrUpdateOrderFailed),
+		errors.Is(err, core.ErrGetPaymentFailed), errors.Is(err, core.ErrUpdatePaymentFailed), errors.Is(err, core.ErrListPaymentsFailed),
+		errors.Is(err, core.ErrPaymentWebhookFailed):
+		return http.StatusInternalServerError
+	case errors.Is(err, core.ErrPaymentDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, core.ErrPaymentFailed), errors.Is(err, core.ErrRefundFailed):
+		return http.StatusBadGateway
+	case errors.Is(err, payments.ErrInvalidSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, imaging.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func (r RouteService) GetProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		product, err := r.core.GetProductById(ctx, c.Param("id"))
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		product.Present(locale(c))
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+func (r RouteService) UpdateProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.UpdateProductRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, err := r.core.UpdateProduct(ctx, actor(c), c.Param("id"), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		product.Present(locale(c))
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+func (r RouteService) DeleteProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := r.core.DeleteProduct(ctx, actor(c), c.Param("id")); err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": "product deleted"})
+	}
+}
+
+func (r RouteService) PurchaseProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.PurchaseRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		purchase, err := r.core.PurchaseProduct(ctx, actor(c), c.Param("id"), payload)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, purchase)
+	}
+}
+
+func (r RouteService) SearchProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		query := models.SearchQuery{
+			Q:        c.Query("q"),
+			Currency: c.Query("currency"),
+		}
+		var err error
+		if page := c.Query("page"); page != "" {
+			if query.Page, err = strconv.ParseInt(page, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a number"})
+				return
+			}
+		}
+		if limit := c.Query("limit"); limit != "" {
+			if query.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+				return
+			}
+		}
+
+		result, err := r.core.SearchProducts(ctx, query)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, hit := range result.Data {
+			hit.Present(locale(c))
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+	"github.com/gin-gonic/gin"
+)
+
+// queryTime reads a time query parameter written as RFC 3339 or as a date,
+// a date used as the end of a range includes the whole day.
+func queryTime(c *gin.Context, name string, endOfDay bool) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date such as 2023-01-31 or an RFC 3339 time", name)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+func queryDateRange(c *gin.Context) (from, to *time.Time, err error) {
+	if from, err = queryTime(c, "from", false); err != nil {
+		return nil, nil, err
+	}
+	if to, err = queryTime(c, "to", true); err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
+
+func purchaseFilter(c *gin.Context) (models.PurchaseFilter, error) {
+	var filter models.PurchaseFilter
+	var err error
+
+	if filter.From, filter.To, err = queryDateRange(c); err != nil {
+		return filter, err
+	}
+	if productId := c.Query("productId"); productId != "" {
+		filter.ProductId = &productId
+	}
+	if cursor := c.Query("nextCursorId"); cursor != "" {
+		filter.NextCursorId = &cursor
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			return filter, fmt.Errorf("limit must be a number")
+		}
+	}
+
+	return filter, nil
+}
+
+func (r RouteService) ListPurchases() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		filter, err := purchaseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		purchases, err := r.core.ListPurchases(ctx, c.GetString("userId"), filter)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, purchases)
+	}
+}
+
+func (r RouteService) ListSales() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		filter, err := purchaseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sales, err := r.core.ListSales(ctx, c.GetString("userId"), filter)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, sales)
+	}
+}
+
+func (r RouteService) SalesSummary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var filter models.SalesSummaryFilter
+		var err error
+		if filter.From, filter.To, err = queryDateRange(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if top := c.Query("topProducts"); top != "" {
+			if filter.TopProducts, err = strconv.Atoi(top); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "topProducts must be a number"})
+				return
+			}
+		}
+
+		summary, err := r.core.SalesSummary(ctx, c.GetString("userId"), filter)
+		if err != nil {
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, summary)
+	}
+}
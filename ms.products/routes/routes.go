@@ -2,7 +2,9 @@ package routes
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/fredele20/microservice-practice/ms.products/core"
@@ -27,20 +29,23 @@ func (r RouteService) CreateProduct() gin.HandlerFunc {
 
 		var product models.Product
 
-		product.OwnerID = c.GetString("userId")
-		product.OwnerName = c.GetString("firstName") + " " + c.GetString("lastName")
-
 		if err := c.BindJSON(&product); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		// Ownership comes from the token, never from the request body.
+		product.OwnerID = c.GetString("userId")
+		product.OwnerName = c.GetString("firstName") + " " + c.GetString("lastName")
+		product.OrganizationID = c.GetString("organizationId")
+
 		newProduct, err := r.core.CreateProduct(ctx, product)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		newProduct.Present(locale(c))
 		c.JSON(http.StatusOK, newProduct)
 	}
 }
@@ -50,18 +55,76 @@ func (r RouteService) GetProducts() gin.HandlerFunc {
 		var ctx, cancle = context.WithTimeout(context.Background(), time.Second*100)
 		defer cancle()
 
-		var filter models.ProductFilter
-		if err := c.BindJSON(&filter); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		filter, err := productFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
 		productList, err := r.core.GetProducts(ctx, filter)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
+		for _, product := range productList.Data {
+			product.Present(locale(c))
+		}
 		c.JSON(http.StatusOK, productList)
 	}
 }
+
+// productFilter reads the filters of a product list from the query string:
+// ownerId, category, minPrice and maxPrice in currency, inStock, createdFrom,
+// createdTo, sort, cursor and limit.
+func productFilter(c *gin.Context) (models.ProductFilter, error) {
+	var filter models.ProductFilter
+	var err error
+
+	if ownerId := c.Query("ownerId"); ownerId != "" {
+		filter.OwnerId = &ownerId
+	}
+	if category := c.Query("category"); category != "" {
+		filter.Category = &category
+	}
+
+	currency := c.DefaultQuery("currency", models.DefaultCurrency)
+	for name, target := range map[string]**models.Money{"minPrice": &filter.MinPrice, "maxPrice": &filter.MaxPrice} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		price, err := models.ParseMoney(value, currency)
+		if err != nil {
+			return filter, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := price.Validate(); err != nil {
+			return filter, fmt.Errorf("%s: %w", name, err)
+		}
+		*target = &price
+	}
+
+	if inStock := c.Query("inStock"); inStock != "" {
+		if filter.InStock, err = strconv.ParseBool(inStock); err != nil {
+			return filter, fmt.Errorf("inStock must be true or false")
+		}
+	}
+	if filter.CreatedFrom, err = queryTime(c, "createdFrom", false); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = queryTime(c, "createdTo", true); err != nil {
+		return filter, err
+	}
+
+	filter.Sort = models.ProductSort(c.Query("sort"))
+	if cursor := c.Query("cursor"); cursor != "" {
+		filter.Cursor = &cursor
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			return filter, fmt.Errorf("limit must be a number")
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,127 @@
+// Package search finds products from free text. Engine is implemented by
+// the MongoDB store with a text index, another engine can be plugged in
+// without changing the callers.
+package search
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/fredele20/microservice-practice/ms.products/models"
+)
+
+type Engine interface {
+	Search(ctx context.Context, query models.SearchQuery) (*models.SearchResult, error)
+}
+
+// Terms splits text into lower case words.
+func Terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Grams returns the trigrams of the words of texts, each word padded with a
+// space on both sides so that prefixes weigh more. Products store the
+// grams of their name and description, a search matching few words falls
+// back to them to tolerate typos and partial words.
+func Grams(texts ...string) []string {
+	seen := map[string]bool{}
+	var grams []string
+	for _, text := range texts {
+		for _, term := range Terms(text) {
+			padded := []rune(" " + term + " ")
+			for i := 0; i+3 <= len(padded); i++ {
+				gram := string(padded[i : i+3])
+				if !seen[gram] {
+					seen[gram] = true
+					grams = append(grams, gram)
+				}
+			}
+		}
+	}
+	sort.Strings(grams)
+	return grams
+}
+
+const snippetLength = 160
+
+// Highlight returns the part of text around the first word starting with
+// one of terms, with every such word wrapped in <em>. The text is HTML
+// escaped. It returns an empty string when no word matches.
+func Highlight(text string, terms []string) string {
+	type match struct{ start, end int }
+	var matches []match
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsNumber(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsNumber(runes[j])) {
+			j++
+		}
+		word := strings.ToLower(string(runes[i:j]))
+		for _, term := range terms {
+			if term != "" && strings.HasPrefix(word, term) {
+				matches = append(matches, match{i, j})
+				break
+			}
+		}
+		i = j
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+
+	// start a little before the first match, at a word boundary
+	start := matches[0].start - snippetLength/4
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	position := start
+	for _, m := range matches {
+		if m.start < start || m.end > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[position:m.start])))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(string(runes[m.start:m.end])))
+		b.WriteString("</em>")
+		position = m.end
+	}
+	b.WriteString(html.EscapeString(string(runes[position:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// PriceBuckets returns the lower bounds, in minor units of currency, of the
+// price ranges search results are counted in.
+func PriceBuckets(currency string) []int64 {
+	unit := models.NewMoney(1, currency).Scale()
+	bounds := []int64{0, 10, 25, 50, 100, 250, 500, 1000}
+	for i := range bounds {
+		bounds[i] *= unit
+	}
+	return bounds
+}
@@ -0,0 +1,213 @@
+// Package avatars processes uploaded user pictures and generates initials
+// avatars for users without one.
+package avatars
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fredele20/microservice-practice/ms.users/libs/blob"
+	"github.com/fredele20/microservice-practice/ms.users/libs/imaging"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+type Size struct {
+	Name   string
+	Pixels int
+}
+
+// Sizes are the square thumbnails produced from every upload, the first one
+// is used as the user's PictureURL.
+var Sizes = []Size{
+	{Name: "large", Pixels: 512},
+	{Name: "medium", Pixels: 256},
+	{Name: "small", Pixels: 128},
+	{Name: "thumb", Pixels: 48},
+}
+
+// palette holds the background colors of initials avatars, a user always
+// gets the same one since it is picked from a hash of the name.
+var palette = []string{
+	"#1abc9c", "#2ecc71", "#3498db", "#9b59b6", "#34495e",
+	"#16a085", "#27ae60", "#2980b9", "#8e44ad", "#2c3e50",
+	"#f39c12", "#e67e22", "#e74c3c", "#d35400", "#c0392b",
+}
+
+// initialsFont draws the initials of PNG avatars, it is embedded so that
+// rendering does not depend on the fonts installed on the server.
+var initialsFont = mustParseFont(gobold.TTF)
+
+func mustParseFont(ttf []byte) *opentype.Font {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+type Avatars struct {
+	store   blob.Store
+	baseURL string
+	limits  imaging.Limits
+}
+
+// NewAvatars returns an Avatars storing uploads in store. baseURL is the
+// public URL of the service, initials avatars are served from it.
+func NewAvatars(store blob.Store, baseURL string) *Avatars {
+	return &Avatars{
+		store:   store,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		limits:  imaging.DefaultLimits,
+	}
+}
+
+// Process validates the uploaded image, resizes it into every size and
+// stores them under a new prefix, so that caches of the previous avatar
+// never serve stale pictures.
+func (a *Avatars) Process(ctx context.Context, userId string, r io.Reader) (*models.Avatar, error) {
+	img, contentType, err := imaging.Decode(r, a.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	outputType := imaging.OutputType(contentType)
+	avatar := &models.Avatar{
+		Prefix:      fmt.Sprintf("avatars/%s/%s", userId, primitive.NewObjectID().Hex()),
+		Sizes:       map[string]string{},
+		ContentType: outputType,
+		UploadedAt:  time.Now(),
+	}
+
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		if _, err := imaging.Encode(&buf, imaging.Square(img, size.Pixels), outputType); err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s/%s%s", avatar.Prefix, size.Name, imaging.Extension(outputType))
+		if err := a.store.Put(ctx, key, outputType, &buf); err != nil {
+			a.store.DeletePrefix(ctx, avatar.Prefix)
+			return nil, err
+		}
+		avatar.Sizes[size.Name] = a.store.URL(key)
+	}
+
+	return avatar, nil
+}
+
+// Remove deletes every size of avatar.
+func (a *Avatars) Remove(ctx context.Context, avatar *models.Avatar) error {
+	if avatar == nil || avatar.Prefix == "" {
+		return nil
+	}
+	return a.store.DeletePrefix(ctx, avatar.Prefix)
+}
+
+// Open returns a stored avatar file and its content type.
+func (a *Avatars) Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	return a.store.Open(ctx, key)
+}
+
+// PictureURL returns the URL of the largest size of avatar.
+func (a *Avatars) PictureURL(avatar *models.Avatar) string {
+	return avatar.Sizes[Sizes[0].Name]
+}
+
+// InitialsURL returns the URL of the initials avatar of a user. It points
+// to the PNG rendering, which unlike SVG is displayed by email clients.
+func (a *Avatars) InitialsURL(firstName, lastName string) string {
+	name := strings.TrimSpace(firstName + " " + lastName)
+	return fmt.Sprintf("%s/avatars/initials.png?name=%s", a.baseURL, url.QueryEscape(name))
+}
+
+// Initials returns the uppercased first letters of the first two words of
+// name.
+func Initials(name string) string {
+	var initials []rune
+	for _, word := range strings.Fields(name) {
+		for _, r := range word {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				initials = append(initials, unicode.ToUpper(r))
+				break
+			}
+		}
+		if len(initials) == 2 {
+			break
+		}
+	}
+
+	if len(initials) == 0 {
+		return "?"
+	}
+	return string(initials)
+}
+
+// InitialsSVG renders a size x size pixels avatar with the initials of name
+// on a colored background.
+func InitialsSVG(name string, size int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, size, size, size, size)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, background(name))
+	fmt.Fprintf(&buf, `<text x="50%%" y="50%%" dy=".35em" fill="#ffffff" font-family="Helvetica, Arial, sans-serif" font-size="%d" text-anchor="middle">%s</text>`, size*2/5, html.EscapeString(Initials(name)))
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+// InitialsPNG renders the avatar of InitialsSVG as a PNG image.
+func InitialsPNG(name string, size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(hexColor(background(name))), image.Point{}, draw.Src)
+
+	face, err := opentype.NewFace(initialsFont, &opentype.FaceOptions{Size: float64(size * 2 / 5), DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	// the initials are centered on their cap height, like the SVG text
+	initials := Initials(name)
+	drawer := &font.Drawer{Dst: img, Src: image.White, Face: face}
+	drawer.Dot = fixed.Point26_6{
+		X: (fixed.I(size) - drawer.MeasureString(initials)) / 2,
+		Y: (fixed.I(size) + face.Metrics().CapHeight) / 2,
+	}
+	drawer.DrawString(initials)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// background picks the color of the avatar of name from palette.
+func background(name string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.ToLower(strings.TrimSpace(name))))
+	return palette[hash.Sum32()%uint32(len(palette))]
+}
+
+// hexColor parses a #rrggbb color of palette.
+func hexColor(hex string) color.RGBA {
+	var c color.RGBA
+	fmt.Sscanf(hex, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	c.A = 0xff
+	return c
+}
@@ -0,0 +1,72 @@
+package avatars
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestInitials(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Ada Lovelace", want: "AL"},
+		{name: "ada byron lovelace", want: "AB"},
+		{name: "  Grace  ", want: "G"},
+		{name: "émile zola", want: "ÉZ"},
+		{name: "(Ada) Lovelace", want: "AL"},
+		{name: "", want: "?"},
+		{name: "!! ??", want: "?"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Initials(tt.name); got != tt.want {
+				t.Errorf("Initials(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitialsPNG(t *testing.T) {
+	for _, size := range []int{16, 128, 1024} {
+		data, err := InitialsPNG("Ada Lovelace", size)
+		if err != nil {
+			t.Fatalf("InitialsPNG(%d) error = %v", size, err)
+		}
+
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("InitialsPNG(%d) is not a png: %v", size, err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+			t.Errorf("InitialsPNG(%d) is %dx%d", size, bounds.Dx(), bounds.Dy())
+		}
+
+		want := hexColor(background("Ada Lovelace"))
+		if got := img.At(0, 0); got != want {
+			t.Errorf("InitialsPNG(%d) background = %v, want %v", size, got, want)
+		}
+
+		var drawn int
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				if img.At(x, y) != want {
+					drawn++
+				}
+			}
+		}
+		if drawn == 0 {
+			t.Errorf("InitialsPNG(%d) has no initials drawn", size)
+		}
+	}
+}
+
+func TestInitialsURL(t *testing.T) {
+	a := NewAvatars(nil, "https://users.example.com/")
+	want := "https://users.example.com/avatars/initials.png?name=Ada+Lovelace"
+	if got := a.InitialsURL("Ada", "Lovelace"); got != want {
+		t.Errorf("InitialsURL() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/core"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+)
+
+// runCommand runs the command line subcommand named by args[0], it reports
+// false when args do not name one and the server should start instead.
+//
+//	ms.users import -file users.csv [-format csv|jsonl] [-dry-run] [-batch-size 500] [-report report.json]
+//	ms.users export [-file users.csv] [-format csv|jsonl] [-status activated] [-iso2 NG] [-user-type USER]
+func runCommand(service *core.UserService, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	switch args[0] {
+	case "import":
+		return true, importCommand(service, args[1:])
+	case "export":
+		return true, exportCommand(service, args[1:])
+	default:
+		return false, nil
+	}
+}
+
+func importCommand(service *core.UserService, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("file", "", "path of the csv or jsonl file to import, - for stdin")
+	format := flags.String("format", "csv", "format of the file, csv or jsonl")
+	dryRun := flags.Bool("dry-run", false, "validate the file without inserting any user")
+	batchSize := flags.Int("batch-size", 500, "number of users inserted per batch")
+	reportPath := flags.String("report", "", "path where the json report is written, defaults to stdout")
+	flags.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	var input io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	report, importErr := service.ImportUsers(context.Background(), input, models.ImportOptions{
+		Format:    models.FileFormat(*format),
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+	})
+
+	if report != nil {
+		var output io.Writer = os.Stdout
+		if *reportPath != "" {
+			f, err := os.Create(*reportPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			output = f
+		}
+
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "%d rows, %d imported, %d failed (dry run: %t)\n", report.Total, report.Imported, report.Failed, report.DryRun)
+	}
+
+	return importErr
+}
+
+func exportCommand(service *core.UserService, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	file := flags.String("file", "", "path of the export file, defaults to stdout")
+	format := flags.String("format", "csv", "format of the file, csv or jsonl")
+	status := flags.String("status", "", "only export users with this status")
+	iso2 := flags.String("iso2", "", "only export users of this country")
+	userType := flags.String("user-type", "", "only export users of this type")
+	createdFrom := flags.String("created-from", "", "only export users created at or after this RFC3339 date")
+	createdTo := flags.String("created-to", "", "only export users created before this RFC3339 date")
+	flags.Parse(args)
+
+	var filter models.ExportUserFilter
+	if *status != "" {
+		s := models.Status(*status)
+		filter.Status = &s
+	}
+	if *iso2 != "" {
+		filter.Iso2 = iso2
+	}
+	if *userType != "" {
+		filter.UserType = userType
+	}
+	if *createdFrom != "" {
+		date, err := time.Parse(time.RFC3339, *createdFrom)
+		if err != nil {
+			return fmt.Errorf("-created-from: %w", err)
+		}
+		filter.CreatedFrom = &date
+	}
+	if *createdTo != "" {
+		date, err := time.Parse(time.RFC3339, *createdTo)
+		if err != nil {
+			return fmt.Errorf("-created-to: %w", err)
+		}
+		filter.CreatedTo = &date
+	}
+
+	var output io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		output = f
+	}
+
+	return service.ExportUsers(context.Background(), models.FileFormat(*format), filter, output)
+}
@@ -3,7 +3,10 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/fredele20/microservice-practice/ms.users/libs/ratelimit"
 	"github.com/joho/godotenv"
 )
 
@@ -13,6 +16,38 @@ type Secrets struct {
 	Port         string
 	JWTSecret    string `json:"JWT_SECRET"`
 	RedisAddress string `json:"REDIS_URL"`
+	SMTPHost     string `json:"SMTP_HOST"`
+	SMTPPort     string `json:"SMTP_PORT"`
+	SMTPUsername string `json:"SMTP_USERNAME"`
+	SMTPPassword string `json:"SMTP_PASSWORD"`
+	MailFrom     string `json:"MAIL_FROM"`
+	// ServiceTokens maps the name of each internal service to the
+	// credential it must present on internal endpoints.
+	ServiceTokens map[string]string `json:"SERVICE_TOKENS"`
+	// EventBroker selects where user events are published, redis or memory
+	EventBroker string `json:"EVENT_BROKER"`
+	EventStream string `json:"EVENT_STREAM"`
+	// PublicURL is the URL clients reach the service at, it prefixes the
+	// URLs of avatars
+	PublicURL string `json:"PUBLIC_URL"`
+	// BlobDir is the directory of the local blob store
+	BlobDir string `json:"BLOB_DIR"`
+	// SignupMode is open or invite_only
+	SignupMode string `json:"SIGNUP_MODE"`
+	// SignupAllowedDomains and SignupDeniedDomains restrict signup to
+	// emails of some domains, both are comma separated lists.
+	SignupAllowedDomains []string `json:"SIGNUP_ALLOWED_DOMAINS"`
+	SignupDeniedDomains  []string `json:"SIGNUP_DENIED_DOMAINS"`
+	// GeoIPDatabase is the path of the CSV file used to locate logins
+	GeoIPDatabase string `json:"GEOIP_DATABASE"`
+	// LoginStepUp requires unusual logins to be confirmed with a code
+	LoginStepUp bool `json:"LOGIN_STEP_UP"`
+	// RateLimits overrides the default limit of routes, see
+	// ratelimit.ParseLimits for the format
+	RateLimits ratelimit.Limits `json:"RATE_LIMITS"`
+	// TrustedProxies are the comma separated IPs or CIDRs of the proxies
+	// allowed to forward the client IP, none by default
+	TrustedProxies []string `json:"TRUSTED_PROXIES"`
 }
 
 var ss Secrets
@@ -30,11 +65,80 @@ func init() {
 	ss.DatabaseName = os.Getenv("DATABASE_NAME")
 	ss.JWTSecret = os.Getenv("JWT_SECRET")
 	ss.RedisAddress = os.Getenv("REDIS_URL")
+	ss.SMTPHost = os.Getenv("SMTP_HOST")
+	ss.SMTPUsername = os.Getenv("SMTP_USERNAME")
+	ss.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+
+	if ss.SMTPPort = os.Getenv("SMTP_PORT"); ss.SMTPPort == "" {
+		ss.SMTPPort = "587"
+	}
+
+	if ss.MailFrom = os.Getenv("MAIL_FROM"); ss.MailFrom == "" {
+		ss.MailFrom = "no-reply@localhost"
+	}
+
+	ss.ServiceTokens = parseServiceTokens(os.Getenv("SERVICE_TOKENS"))
+
+	if ss.EventBroker = os.Getenv("EVENT_BROKER"); ss.EventBroker == "" {
+		ss.EventBroker = "redis"
+	}
+
+	if ss.EventStream = os.Getenv("EVENT_STREAM"); ss.EventStream == "" {
+		ss.EventStream = "users.events"
+	}
 
 	if ss.Port = os.Getenv("PORT"); ss.Port == "" {
 		ss.Port = "80"
 	}
 
+	if ss.PublicURL = os.Getenv("PUBLIC_URL"); ss.PublicURL == "" {
+		ss.PublicURL = "http://127.0.0.1:" + ss.Port
+	}
+
+	if ss.BlobDir = os.Getenv("BLOB_DIR"); ss.BlobDir == "" {
+		ss.BlobDir = "uploads"
+	}
+
+	if ss.SignupMode = os.Getenv("SIGNUP_MODE"); ss.SignupMode == "" {
+		ss.SignupMode = "open"
+	}
+
+	ss.SignupAllowedDomains = parseList(os.Getenv("SIGNUP_ALLOWED_DOMAINS"))
+	ss.SignupDeniedDomains = parseList(os.Getenv("SIGNUP_DENIED_DOMAINS"))
+
+	ss.GeoIPDatabase = os.Getenv("GEOIP_DATABASE")
+	ss.LoginStepUp, _ = strconv.ParseBool(os.Getenv("LOGIN_STEP_UP"))
+
+	if ss.RateLimits, err = ratelimit.ParseLimits(os.Getenv("RATE_LIMITS")); err != nil {
+		log.Fatal(err)
+	}
+
+	ss.TrustedProxies = parseList(os.Getenv("TRUSTED_PROXIES"))
+
+}
+
+// parseList reads a comma separated list, ignoring empty items.
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseServiceTokens reads a comma separated list of name:token pairs.
+func parseServiceTokens(value string) map[string]string {
+	tokens := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		name, token, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found || name == "" || token == "" {
+			continue
+		}
+		tokens[name] = token
+	}
+	return tokens
 }
 
 func GetSecrets() Secrets {
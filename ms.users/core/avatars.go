@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/fredele20/microservice-practice/ms.users/libs/blob"
+	"github.com/fredele20/microservice-practice/ms.users/libs/imaging"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrUploadAvatarFailed = errors.New("failed to upload avatar")
+	ErrRemoveAvatarFailed = errors.New("failed to remove avatar")
+	ErrAvatarNotFound     = errors.New("avatar not found")
+)
+
+// legacyPictureURL prefixes the pictures of the users created when initials
+// avatars were served by ui-avatars.com instead of this service.
+const legacyPictureURL = "https://ui-avatars.com/"
+
+const migratePictureBatch = 500
+
+// UploadAvatar replaces the picture of a user with the uploaded image, the
+// files of the previous avatar are deleted once the user points to the new
+// one.
+func (u *UserService) UploadAvatar(ctx context.Context, userId string, r io.Reader) (*models.User, error) {
+	user, err := u.db.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, ErrUserNotFoundById
+	}
+
+	avatar, err := u.avatars.Process(ctx, user.UserId, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrTooLarge), errors.Is(err, imaging.ErrUnsupportedType),
+			errors.Is(err, imaging.ErrTooManyPixels), errors.Is(err, imaging.ErrInvalidImage):
+			return nil, err
+		}
+		u.logger.WithError(err).Error(ErrUploadAvatarFailed.Error())
+		return nil, ErrUploadAvatarFailed
+	}
+
+	updated, err := u.saveWithEvent(ctx, models.EventUserUpdated, func(ctx context.Context) (*models.User, error) {
+		return u.db.SetUserAvatar(ctx, user.UserId, u.avatars.PictureURL(avatar), avatar)
+	})
+	if err != nil {
+		u.avatars.Remove(ctx, avatar)
+		u.logger.WithError(err).Error(ErrUploadAvatarFailed.Error())
+		return nil, ErrUploadAvatarFailed
+	}
+
+	if err := u.avatars.Remove(ctx, user.Avatar); err != nil {
+		u.logger.WithError(err).Error("failed to delete previous avatar files")
+	}
+
+	return updated, nil
+}
+
+// RemoveAvatar deletes the uploaded picture of a user, who gets back an
+// initials avatar.
+func (u *UserService) RemoveAvatar(ctx context.Context, userId string) (*models.User, error) {
+	user, err := u.db.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, ErrUserNotFoundById
+	}
+
+	if user.Avatar == nil {
+		return nil, ErrAvatarNotFound
+	}
+
+	updated, err := u.saveWithEvent(ctx, models.EventUserUpdated, func(ctx context.Context) (*models.User, error) {
+		return u.db.SetUserAvatar(ctx, user.UserId, u.avatars.InitialsURL(user.FirstName, user.LastName), nil)
+	})
+	if err != nil {
+		u.logger.WithError(err).Error(ErrRemoveAvatarFailed.Error())
+		return nil, ErrRemoveAvatarFailed
+	}
+
+	if err := u.avatars.Remove(ctx, user.Avatar); err != nil {
+		u.logger.WithError(err).Error("failed to delete avatar files")
+	}
+
+	return updated, nil
+}
+
+// OpenAvatarFile returns a stored avatar file, only keys under the avatars
+// prefix can be read.
+func (u *UserService) OpenAvatarFile(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	key, err := blob.CleanKey(key)
+	if err != nil || !strings.HasPrefix(key, "avatars/") {
+		return nil, "", ErrAvatarNotFound
+	}
+
+	file, contentType, err := u.avatars.Open(ctx, key)
+	if err != nil {
+		if !errors.Is(err, blob.ErrNotFound) {
+			u.logger.WithError(err).Error("failed to open avatar file")
+		}
+		return nil, "", ErrAvatarNotFound
+	}
+
+	return file, contentType, nil
+}
+
+// MigratePictureURLs points the users still using a ui-avatars.com picture
+// to their local initials avatar and returns how many were migrated. Every
+// change is published like a profile update, so that services caching
+// pictures refresh them.
+func (u *UserService) MigratePictureURLs(ctx context.Context) (int64, error) {
+	var migrated int64
+	for {
+		users, err := u.db.ListUsersByPictureURLPrefix(ctx, legacyPictureURL, migratePictureBatch)
+		if err != nil {
+			return migrated, err
+		}
+
+		for _, user := range users {
+			_, err := u.saveWithEvent(ctx, models.EventUserUpdated, func(ctx context.Context) (*models.User, error) {
+				return u.db.ReplacePictureURL(ctx, user.UserId, user.PictureURL, u.avatars.InitialsURL(user.FirstName, user.LastName))
+			})
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				// the user uploaded or removed a picture meanwhile
+				continue
+			}
+			if err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+
+		if len(users) < migratePictureBatch {
+			return migrated, nil
+		}
+	}
+}
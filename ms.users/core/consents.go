@@ -0,0 +1,211 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrTermsAcceptanceRequired    = errors.New("You must accept the latest terms of service and privacy policy to continue")
+	ErrTermsVersionOutdated       = errors.New("the accepted terms of service or privacy policy version is not the current one")
+	ErrPublishLegalDocumentFailed = errors.New("failed to publish legal document")
+	ErrGetLegalDocumentsFailed    = errors.New("failed to get current legal documents")
+	ErrRecordConsentFailed        = errors.New("failed to record consent")
+	ErrListConsentsFailed         = errors.New("failed to list consents")
+)
+
+// TermsAcceptanceRequiredCode is returned alongside ErrTermsAcceptanceRequired
+// so that clients can show the documents and call users/accept-terms.
+const TermsAcceptanceRequiredCode = "TERMS_ACCEPTANCE_REQUIRED"
+
+// PublishLegalDocument makes document the current version of its type,
+// every user has to accept it again at their next login.
+func (u *UserService) PublishLegalDocument(ctx context.Context, actorId string, document models.LegalDocument) (*models.LegalDocument, error) {
+	if err := document.Validate(); err != nil {
+		return nil, err
+	}
+
+	document.ID = primitive.NewObjectID()
+	document.PublishedBy = actorId
+	document.PublishedAt = time.Now()
+
+	published, err := u.db.CreateLegalDocument(ctx, &document)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrPublishLegalDocumentFailed.Error())
+		return nil, ErrPublishLegalDocumentFailed
+	}
+
+	return published, nil
+}
+
+// CurrentLegalDocuments returns the current terms and privacy policy, a
+// document that was never published is nil and does not need acceptance.
+func (u *UserService) CurrentLegalDocuments(ctx context.Context) (*models.CurrentLegalDocuments, error) {
+	var documents models.CurrentLegalDocuments
+	for documentType, target := range map[models.DocumentType]**models.LegalDocument{
+		models.DocumentTerms:   &documents.Terms,
+		models.DocumentPrivacy: &documents.Privacy,
+	} {
+		document, err := u.db.GetCurrentLegalDocument(ctx, documentType)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			u.logger.WithError(err).Error(ErrGetLegalDocumentsFailed.Error())
+			return nil, ErrGetLegalDocumentsFailed
+		}
+		*target = document
+	}
+
+	return &documents, nil
+}
+
+// requiresAcceptance reports whether the user has not accepted one of the
+// current documents.
+func requiresAcceptance(consents models.Consents, current *models.CurrentLegalDocuments) bool {
+	if current.Terms != nil && (consents.Terms == nil || consents.Terms.Version != current.Terms.Version) {
+		return true
+	}
+	if current.Privacy != nil && (consents.Privacy == nil || consents.Privacy.Version != current.Privacy.Version) {
+		return true
+	}
+	return false
+}
+
+// buildConsents turns the consents of payload into the records proving them
+// and the update of the user's current consents. Terms and privacy
+// versions must match the current documents.
+func buildConsents(userId string, payload models.ConsentRequest, source models.ConsentSource, current *models.CurrentLegalDocuments) (models.Consents, []*models.ConsentRecord, error) {
+	now := time.Now()
+	consents := models.Consents{Marketing: map[models.MarketingChannel]*models.MarketingConsent{}}
+	var records []*models.ConsentRecord
+
+	newRecord := func(kind models.ConsentKind) *models.ConsentRecord {
+		id := primitive.NewObjectID()
+		record := &models.ConsentRecord{
+			ID:         id,
+			ConsentId:  id.Hex(),
+			UserId:     userId,
+			Kind:       kind,
+			Granted:    true,
+			Source:     source,
+			IPAddress:  payload.IPAddress,
+			UserAgent:  payload.UserAgent,
+			RecordedAt: now,
+		}
+		records = append(records, record)
+		return record
+	}
+
+	if current != nil {
+		if current.Terms != nil {
+			if payload.TermsVersion != current.Terms.Version {
+				return consents, nil, ErrTermsVersionOutdated
+			}
+			newRecord(models.ConsentTerms).Version = payload.TermsVersion
+			consents.Terms = &models.AcceptedDocument{Version: payload.TermsVersion, AcceptedAt: now}
+		}
+		if current.Privacy != nil {
+			if payload.PrivacyVersion != current.Privacy.Version {
+				return consents, nil, ErrTermsVersionOutdated
+			}
+			newRecord(models.ConsentPrivacy).Version = payload.PrivacyVersion
+			consents.Privacy = &models.AcceptedDocument{Version: payload.PrivacyVersion, AcceptedAt: now}
+		}
+	}
+
+	for channel, granted := range payload.Marketing {
+		record := newRecord(models.ConsentMarketing)
+		record.Channel = channel
+		record.Granted = granted
+		consents.Marketing[channel] = &models.MarketingConsent{Granted: granted, UpdatedAt: now}
+	}
+
+	return consents, records, nil
+}
+
+// AcceptTerms records the acceptance of the current documents by a user
+// whose login was refused with ErrTermsAcceptanceRequired, and logs them in.
+func (u *UserService) AcceptTerms(ctx context.Context, payload models.AcceptTermsRequest) (*models.User, error) {
+	if err := payload.ConsentRequest.Validate(); err != nil {
+		return nil, err
+	}
+
+	user, err := u.authenticate(ctx, payload.Email, payload.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := u.CurrentLegalDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consents, records, err := buildConsents(user.UserId, payload.ConsentRequest, models.ConsentSourceLogin, current)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := u.saveConsents(ctx, user.UserId, consents, records)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.completeLogin(ctx, updated, models.ClientInfo{
+		IPAddress: payload.IPAddress,
+		UserAgent: payload.UserAgent,
+	})
+}
+
+// UpdateMarketingConsents grants or withdraws marketing consent per channel.
+func (u *UserService) UpdateMarketingConsents(ctx context.Context, userId string, payload models.ConsentRequest) (*models.User, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := u.db.GetUserById(ctx, userId); err != nil {
+		return nil, ErrUserNotFoundById
+	}
+
+	consents, records, err := buildConsents(userId, models.ConsentRequest{
+		Marketing: payload.Marketing,
+		IPAddress: payload.IPAddress,
+		UserAgent: payload.UserAgent,
+	}, models.ConsentSourceSettings, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.saveConsents(ctx, userId, consents, records)
+}
+
+func (u *UserService) saveConsents(ctx context.Context, userId string, consents models.Consents, records []*models.ConsentRecord) (*models.User, error) {
+	user, err := u.saveWithEvent(ctx, models.EventUserUpdated, func(ctx context.Context) (*models.User, error) {
+		if err := u.db.InsertConsentRecords(ctx, records...); err != nil {
+			return nil, err
+		}
+		return u.db.SetUserConsents(ctx, userId, consents)
+	})
+	if err != nil {
+		u.logger.WithError(err).Error(ErrRecordConsentFailed.Error())
+		return nil, ErrRecordConsentFailed
+	}
+
+	return user, nil
+}
+
+// ListConsents returns the consent history of a user, newest first.
+func (u *UserService) ListConsents(ctx context.Context, userId string) (*models.ConsentRecordList, error) {
+	records, err := u.db.ListConsentRecords(ctx, userId)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListConsentsFailed.Error())
+		return nil, ErrListConsentsFailed
+	}
+
+	return records, nil
+}
@@ -5,14 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/fredele20/microservice-practice/ms.users/avatars"
 	"github.com/fredele20/microservice-practice/ms.users/cache"
 	"github.com/fredele20/microservice-practice/ms.users/db"
 	"github.com/fredele20/microservice-practice/ms.users/db/mongod"
+	"github.com/fredele20/microservice-practice/ms.users/geoip"
 	"github.com/fredele20/microservice-practice/ms.users/libs/session"
 	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/fredele20/microservice-practice/ms.users/notifier"
 	"github.com/fredele20/microservice-practice/ms.users/utils"
 	"github.com/go-redis/redis/v8"
 	"github.com/nyaruka/phonenumbers"
@@ -43,40 +45,32 @@ var (
 )
 
 type UserService struct {
-	session session.SessionManager
-	db      db.UserStore
-	logger *logrus.Logger
-	redis cache.RedisStore
+	session  session.SessionManager
+	db       db.UserStore
+	logger   *logrus.Logger
+	redis    cache.RedisStore
+	notifier notifier.Notifier
+	avatars  *avatars.Avatars
+	signup   models.SignupPolicy
+	locator  geoip.Locator
+	// stepUp makes unusual logins wait for a code sent to the user
+	stepUp bool
 }
 
-func NewUserService(redis cache.RedisStore, db db.UserStore, session session.SessionManager, logger *logrus.Logger) *UserService {
+func NewUserService(redis cache.RedisStore, db db.UserStore, session session.SessionManager, logger *logrus.Logger, notifier notifier.Notifier, avatars *avatars.Avatars, signup models.SignupPolicy, locator geoip.Locator, stepUp bool) *UserService {
 	return &UserService{
-		session: session,
-		redis:   redis,
-		db:      db,
-		logger: logger,
+		session:  session,
+		redis:    redis,
+		db:       db,
+		logger:   logger,
+		notifier: notifier,
+		avatars:  avatars,
+		signup:   signup,
+		locator:  locator,
+		stepUp:   stepUp,
 	}
 }
 
-type RequestMonitor struct {
-	Count int64
-	Error Error
-	Time  time.Duration
-}
-
-type Error string
-
-const (
-	ErrorMaximumRequest Error = "Too many load on server, please try again later"
-	ErrorMaximumTrial   Error = "Maximum number of trial reached"
-)
-
-// func (e *RequestMonitor) MaximumRequest(count int64, time time.Duration) error {
-
-// 	e.Count = 100
-
-// }
-
 func parsePhone(phone, iso2 string) (string, error) {
 	num, err := phonenumbers.Parse(phone, iso2)
 	if err != nil {
@@ -91,47 +85,97 @@ func parsePhone(phone, iso2 string) (string, error) {
 	return phonenumbers.Format(num, phonenumbers.E164), nil
 }
 
-func buildPictureURLFromName(name string) string {
-	return fmt.Sprintf("https://ui-avatars.com/api/?name=%s", strings.ReplaceAll(name, " ", "+"))
-}
-
-func (u *UserService) CreateUser(ctx context.Context, payload models.User) (*models.User, error) {
+// normalizeUser validates a new user and normalises its phone number and
+// type, every way of creating users goes through it.
+func normalizeUser(payload *models.User) error {
 	if err := payload.Validate(); err != nil {
 		logrus.WithError(err).Error(ErrUserValidationFailed.Error())
-		return nil, err
+		return err
 	}
 
 	phone, err := parsePhone(payload.Phone, payload.Iso2)
 	if err != nil {
 		logrus.WithError(err).Error("failed to validate phone number or country code")
-		return nil, err
+		return err
 	}
 
 	payload.Phone = phone
-	password := utils.HashPassword(payload.Password)
-	payload.Password = password
 
 	if payload.UserType == "" {
 		payload.UserType = "USER"
 	}
 
-	payload.PictureURL = buildPictureURLFromName(fmt.Sprintf("%s+%s", payload.FirstName, payload.LastName))
+	return nil
+}
+
+// stampNewUser sets the identifiers, status and defaults of a user that is
+// about to be persisted for the first time.
+func (u *UserService) stampNewUser(payload *models.User) {
+	payload.PictureURL = u.avatars.InitialsURL(payload.FirstName, payload.LastName)
 	payload.Status = models.StatusActivated
 	payload.CreatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	payload.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	payload.ID = primitive.NewObjectID()
 	payload.UserId = payload.ID.Hex()
+	payload.Consents.Marketing = map[models.MarketingChannel]*models.MarketingConsent{}
+}
+
+func (u *UserService) CreateUser(ctx context.Context, payload models.User) (*models.User, error) {
+	if err := normalizeUser(&payload); err != nil {
+		return nil, err
+	}
+
+	if err := u.checkSignupPolicy(&payload); err != nil {
+		return nil, err
+	}
+
+	password := utils.HashPassword(payload.Password)
+	payload.Password = password
+
+	u.stampNewUser(&payload)
+
+	current, err := u.CurrentLegalDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var consent models.ConsentRequest
+	if payload.Consent != nil {
+		consent = *payload.Consent
+	}
+	if err := consent.Validate(); err != nil {
+		return nil, err
+	}
+
+	consents, records, err := buildConsents(payload.UserId, consent, models.ConsentSourceSignup, current)
+	if err != nil {
+		return nil, ErrTermsAcceptanceRequired
+	}
+	payload.Consents = consents
 
-	user, err := u.db.CreateUser(ctx, &payload)
+	user, err := u.saveWithEvent(ctx, models.EventUserCreated, func(ctx context.Context) (*models.User, error) {
+		if err := u.redeemSignupInvite(ctx, &payload); err != nil {
+			return nil, err
+		}
+		if err := u.db.InsertConsentRecords(ctx, records...); err != nil {
+			return nil, err
+		}
+		return u.db.CreateUser(ctx, &payload)
+	})
 	if err != nil {
 		fmt.Println(err.Error())
-		if err == mongod.ErrDuplicate {
+		if errors.Is(err, ErrSignupInviteInvalid) {
+			return nil, err
+		}
+		if errors.Is(err, mongod.ErrDuplicate) {
 			logrus.WithError(err).Error("create user failed, duplicate record attempted")
 			return nil, ErrCreateUserDuplicate
 		}
 		logrus.WithError(err).Error(err.Error())
 		return nil, ErrCreateUserFailed
 	}
+	user.InviteCode = ""
+	user.Consent = nil
 
 	// token, err := session.CreateSession(session.Session{
 	// 	AccountId: user.UserId,
@@ -150,7 +194,26 @@ func (u *UserService) CreateUser(ctx context.Context, payload models.User) (*mod
 	return user, nil
 }
 
-func (u *UserService) Login(ctx context.Context, email, password string) (*models.User, error) {
+func (u *UserService) Login(ctx context.Context, email, password string, client models.ClientInfo) (*models.User, error) {
+	user, err := u.authenticate(ctx, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := u.CurrentLegalDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if requiresAcceptance(user.Consents, current) {
+		return nil, ErrTermsAcceptanceRequired
+	}
+
+	return u.completeLogin(ctx, user, client)
+}
+
+// authenticate returns the user with email when password is theirs.
+func (u *UserService) authenticate(ctx context.Context, email, password string) (*models.User, error) {
 	user, err := u.db.GetUserByEmail(ctx, email)
 	if err != nil {
 		logrus.WithError(err).Error("failed to get user by email")
@@ -163,14 +226,24 @@ func (u *UserService) Login(ctx context.Context, email, password string) (*model
 		return nil, ErrAuthenticationFailed
 	}
 
-	session, err := u.session.CreateSession(ctx, "token", time.Hour * 1, session.Session{
-		UserId:         user.UserId,
-		Email:          user.Email,
-		FirstName:      user.FirstName,
-		LastName:       user.LastName,
-		Role:           user.UserType,
-		Validity:       1,
-		UnitOfValidity: session.UnitOfValidityHour,
+	return user, nil
+}
+
+// startSession creates the session of an authenticated user and returns
+// the user with its token.
+func (u *UserService) startSession(ctx context.Context, user *models.User) (*models.User, error) {
+	organizationId, organizationRole := u.activeOrganization(ctx, user)
+
+	session, err := u.session.CreateSession(ctx, "", time.Hour * 1, session.Session{
+		UserId:           user.UserId,
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Role:             user.UserType,
+		OrganizationId:   organizationId,
+		OrganizationRole: organizationRole,
+		Validity:         1,
+		UnitOfValidity:   session.UnitOfValidityHour,
 	})
 
 	if err != nil {
@@ -183,10 +256,8 @@ func (u *UserService) Login(ctx context.Context, email, password string) (*model
 	return user, nil
 }
 
-func (u *UserService) Logout(token string) error {
-	var ctx context.Context
-	err := u.redis.Del(ctx, token)
-	// err := session.DestroySession(token)
+func (u *UserService) Logout(ctx context.Context, token string) error {
+	err := u.session.DestroySession(ctx, token)
 	if err != nil {
 		logrus.WithError(err).Error("failed to destroy user logged in token")
 		return err
@@ -201,7 +272,9 @@ func (u *UserService) ForgotPassword(ctx context.Context, email string) (*models
 		return nil, ErrFailedToGetUserByEmail
 	}
 
-	token, err := u.session.CreateSession(ctx, "token", time.Hour * 1, session.Session{
+	// the token only resets the password, it is sent to the email of the
+	// user and never returned to the caller, who may not own the account
+	token, err := u.session.CreateSession(ctx, "", time.Hour * 1, session.Session{
 		UserId:         user.UserId,
 		Email:          user.Email,
 		FirstName:      user.FirstName,
@@ -209,6 +282,7 @@ func (u *UserService) ForgotPassword(ctx context.Context, email string) (*models
 		Role:           user.UserType,
 		Validity:       1,
 		UnitOfValidity: session.UnitOfValidityHour,
+		Purpose:        session.PurposeResetPassword,
 	})
 
 	if err != nil {
@@ -216,7 +290,14 @@ func (u *UserService) ForgotPassword(ctx context.Context, email string) (*models
 		return nil, err
 	}
 
-	user.ResetPasswordToken = &token
+	if err := u.notifier.Notify(ctx, notifier.Notification{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nUse this token to reset your password: %s\nIt expires in 1 hour.\n\nIf you did not ask to reset your password, you can ignore this email.", user.FirstName, token),
+	}); err != nil {
+		logrus.WithError(err).Error("failed to send password reset token")
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -259,28 +340,29 @@ func (u UserService) ListUsers(ctx context.Context, filters models.ListUserFilte
 
 }
 
-func (u UserService) ResetPassword(ctx context.Context, password, confirmPassword string) (*models.User, error) {
-	result, err := u.redis.Get(ctx, "token")
-	if err != nil {
-		return nil, err
-	}
-	var token string
-
-	fmt.Println(string(result))
+// ResetPassword changes the password of the user a reset token was sent
+// to, the token can only be used once.
+func (u UserService) ResetPassword(ctx context.Context, token, password, confirmPassword string) (*models.User, error) {
 	if password != confirmPassword {
 		logrus.WithError(ErrPasswordDoesNotMatch).Error(ErrPasswordDoesNotMatch)
 		return nil, ErrPasswordDoesNotMatch
 	}
-	
-	_ = json.Unmarshal(result, &token)
-	fmt.Println("token: ",token)
 
-	userSession, err := u.session.GetSessionByToken(token)
+	claims, err := u.session.VerifyToken(token)
+	if err != nil || claims.Purpose != session.PurposeResetPassword {
+		return nil, ErrFailedToResetPasswordBadToken
+	}
+
+	userSession, err := u.session.GetSession(ctx, token)
 	if err != nil {
 		logrus.WithError(err).Error("failed to valid session")
 		return nil, ErrFailedToResetPasswordBadToken
 	}
 
+	if userSession.IsImpersonation() {
+		return nil, session.ErrSessionIsImpersonated
+	}
+
 	user, err := u.db.GetUserById(ctx, userSession.UserId)
 	if err != nil {
 		logrus.WithError(err).Error("failed to get user from database after validating user session")
@@ -292,16 +374,20 @@ func (u UserService) ResetPassword(ctx context.Context, password, confirmPasswor
 		return nil, ErrPasswordIsSame
 	}
 
-	updatedUser, err := u.db.UpdateUser(ctx, &models.User{
-		UserId:   user.UserId,
-		Password: utils.HashPassword(password),
+	updatedUser, err := u.saveWithEvent(ctx, models.EventUserPasswordReset, func(ctx context.Context) (*models.User, error) {
+		return u.db.UpdateUser(ctx, &models.User{
+			UserId:   user.UserId,
+			Password: utils.HashPassword(password),
+		})
 	})
 	if err != nil {
 		logrus.WithError(err).Error("failed to update user password in database")
 		return nil, ErrFailedToResetPassword
 	}
 
-	// _ = u.session.DestroySession(token) // Destroy token once the password is reset
+	if err := u.session.DestroySession(ctx, token); err != nil {
+		logrus.WithError(err).Error("failed to destroy password reset token")
+	}
 
 	return updatedUser, nil
 }
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/geoip"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/fredele20/microservice-practice/ms.users/notifier"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrStepUpRequired        = errors.New("This sign-in looks unusual, enter the code we sent to your email to continue")
+	ErrLoginChallengeInvalid = errors.New("Sorry, this verification has expired, please sign in again")
+	ErrLoginCodeInvalid      = errors.New("Sorry, this code is incorrect, please try again")
+	ErrDeviceNotFound        = errors.New("device not found")
+	ErrListDevicesFailed     = errors.New("failed to list devices")
+	ErrCreateChallengeFailed = errors.New("failed to start login verification")
+)
+
+// StepUpRequiredCode is returned alongside ErrStepUpRequired so that
+// clients can ask for the code and call users/login/verify.
+const StepUpRequiredCode = "STEP_UP_REQUIRED"
+
+const (
+	// impossibleTravelSpeed is the speed in km/h above which two logins
+	// cannot come from the same person
+	impossibleTravelSpeed = 900
+	// impossibleTravelDistance ignores jumps below this many kilometers,
+	// coarse GeoIP locations are often that far off
+	impossibleTravelDistance = 500
+
+	loginChallengeValidity    = time.Minute * 10
+	loginChallengeMaxAttempts = 5
+)
+
+// StepUpError is returned by Login when the login must be confirmed with
+// the code sent to the user, it matches ErrStepUpRequired.
+type StepUpError struct {
+	Challenge *models.LoginChallenge
+}
+
+func (e *StepUpError) Error() string {
+	return ErrStepUpRequired.Error()
+}
+
+func (e *StepUpError) Is(target error) bool {
+	return target == ErrStepUpRequired
+}
+
+// deviceFingerprint identifies a device by its user agent and the network
+// it connects from, so that a browser on the same network is recognised
+// across IP changes within its provider's range.
+func deviceFingerprint(client models.ClientInfo) string {
+	network := client.IPAddress
+	if ip := net.ParseIP(client.IPAddress); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			network = ip4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			network = ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+	}
+
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(client.UserAgent)) + "|" + network))
+	return hex.EncodeToString(sum[:])
+}
+
+// assessLogin returns the device of the login and what is unusual about it.
+// A user's very first login is never unusual.
+func (u *UserService) assessLogin(ctx context.Context, user *models.User, client models.ClientInfo) (*models.Device, []models.LoginAnomaly) {
+	now := time.Now()
+	id := primitive.NewObjectID()
+	device := &models.Device{
+		ID:          id,
+		DeviceId:    id.Hex(),
+		UserId:      user.UserId,
+		Fingerprint: deviceFingerprint(client),
+		UserAgent:   client.UserAgent,
+		IPAddress:   client.IPAddress,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	if ip := net.ParseIP(client.IPAddress); ip != nil {
+		device.Location, _ = u.locator.Locate(ip)
+	}
+
+	var anomalies []models.LoginAnomaly
+
+	known, err := u.db.ListDevices(ctx, user.UserId)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListDevicesFailed.Error())
+		return device, nil
+	}
+	if known.Count == 0 {
+		return device, nil
+	}
+
+	if _, err := u.db.GetDevice(ctx, user.UserId, device.Fingerprint); errors.Is(err, mongo.ErrNoDocuments) {
+		anomalies = append(anomalies, models.AnomalyNewDevice)
+	}
+
+	if device.Location != nil {
+		if last, err := u.db.GetLastLocatedDevice(ctx, user.UserId); err == nil && last.Location != nil {
+			distance := geoip.Distance(last.Location, device.Location)
+			hours := now.Sub(last.LastSeenAt).Hours()
+			if distance > impossibleTravelDistance && (hours <= 0 || distance/hours > impossibleTravelSpeed) {
+				anomalies = append(anomalies, models.AnomalyImpossibleTravel)
+			}
+		}
+	}
+
+	return device, anomalies
+}
+
+// completeLogin checks the device of an authenticated user before creating
+// their session. Unusual logins are notified to the user, and must be
+// confirmed with a code first when step-up verification is enabled.
+func (u *UserService) completeLogin(ctx context.Context, user *models.User, client models.ClientInfo) (*models.User, error) {
+	device, anomalies := u.assessLogin(ctx, user, client)
+
+	if len(anomalies) > 0 {
+		u.logger.WithField("userId", user.UserId).
+			WithField("anomalies", anomalies).
+			WithField("ipAddress", client.IPAddress).
+			Warn("unusual login detected")
+
+		if u.stepUp {
+			return nil, u.startLoginChallenge(ctx, user, device, client, anomalies)
+		}
+
+		u.notifyUnusualLogin(ctx, user, device, anomalies, "")
+	}
+
+	if _, err := u.db.SaveDevice(ctx, device); err != nil {
+		u.logger.WithError(err).Error("failed to save login device")
+	}
+
+	return u.startSession(ctx, user)
+}
+
+func (u *UserService) startLoginChallenge(ctx context.Context, user *models.User, device *models.Device, client models.ClientInfo, anomalies []models.LoginAnomaly) error {
+	code, err := randomCode(6)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrCreateChallengeFailed.Error())
+		return ErrCreateChallengeFailed
+	}
+
+	now := time.Now()
+	id := primitive.NewObjectID()
+	challenge := &models.LoginChallenge{
+		ID:          id,
+		ChallengeId: id.Hex(),
+		UserId:      user.UserId,
+		CodeHash:    hashCode(code),
+		Client:      client,
+		Anomalies:   anomalies,
+		ExpiresAt:   now.Add(loginChallengeValidity),
+		CreatedAt:   now,
+	}
+
+	if err := u.db.CreateLoginChallenge(ctx, challenge); err != nil {
+		u.logger.WithError(err).Error(ErrCreateChallengeFailed.Error())
+		return ErrCreateChallengeFailed
+	}
+
+	u.notifyUnusualLogin(ctx, user, device, anomalies, code)
+
+	return &StepUpError{Challenge: challenge}
+}
+
+// VerifyLogin confirms a login refused with ErrStepUpRequired with the code
+// sent to the user, and logs them in.
+func (u *UserService) VerifyLogin(ctx context.Context, payload models.VerifyLoginRequest) (*models.User, error) {
+	challenge, err := u.db.GetLoginChallenge(ctx, payload.ChallengeId)
+	if err != nil {
+		return nil, ErrLoginChallengeInvalid
+	}
+
+	if time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= loginChallengeMaxAttempts {
+		u.db.DeleteLoginChallenge(ctx, challenge.ChallengeId)
+		return nil, ErrLoginChallengeInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashCode(strings.TrimSpace(payload.Code))), []byte(challenge.CodeHash)) != 1 {
+		updated, err := u.db.IncrementLoginChallengeAttempts(ctx, challenge.ChallengeId)
+		if err == nil && updated.Attempts >= loginChallengeMaxAttempts {
+			u.db.DeleteLoginChallenge(ctx, challenge.ChallengeId)
+			return nil, ErrLoginChallengeInvalid
+		}
+		return nil, ErrLoginCodeInvalid
+	}
+
+	if err := u.db.DeleteLoginChallenge(ctx, challenge.ChallengeId); err != nil {
+		u.logger.WithError(err).Error("failed to delete login challenge")
+		return nil, ErrLoginChallengeInvalid
+	}
+
+	user, err := u.db.GetUserById(ctx, challenge.UserId)
+	if err != nil {
+		return nil, ErrUserNotFoundById
+	}
+
+	device, _ := u.assessLogin(ctx, user, challenge.Client)
+	if _, err := u.db.SaveDevice(ctx, device); err != nil {
+		u.logger.WithError(err).Error("failed to save login device")
+	}
+
+	return u.startSession(ctx, user)
+}
+
+func (u *UserService) notifyUnusualLogin(ctx context.Context, user *models.User, device *models.Device, anomalies []models.LoginAnomaly, code string) {
+	if user.Email == "" {
+		return
+	}
+
+	where := "an unknown location"
+	if device.Location != nil {
+		where = strings.Trim(fmt.Sprintf("%s, %s", device.Location.City, device.Location.Iso2), ", ")
+	}
+
+	reason := "a new device"
+	for _, anomaly := range anomalies {
+		if anomaly == models.AnomalyImpossibleTravel {
+			reason = "a location far from your previous sign-in"
+		}
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nWe noticed a sign-in to your account from %s.\n\nDevice: %s\nIP address: %s\nLocation: %s\nTime: %s\n\n",
+		user.FirstName, reason, device.UserAgent, device.IPAddress, where, device.LastSeenAt.UTC().Format(time.RFC1123))
+	if code != "" {
+		body += fmt.Sprintf("To confirm it is you, enter this code: %s\nIt expires in %d minutes.\n\n", code, int(loginChallengeValidity.Minutes()))
+	}
+	body += "If this was not you, reset your password right away."
+
+	if err := u.notifier.Notify(ctx, notifier.Notification{
+		To:      user.Email,
+		Subject: "New sign-in to your account",
+		Body:    body,
+	}); err != nil {
+		u.logger.WithError(err).Error("failed to send unusual login notification")
+	}
+}
+
+func (u *UserService) ListDevices(ctx context.Context, userId string) (*models.DeviceList, error) {
+	devices, err := u.db.ListDevices(ctx, userId)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListDevicesFailed.Error())
+		return nil, ErrListDevicesFailed
+	}
+
+	return devices, nil
+}
+
+// ForgetDevice removes a known device, the next login from it is treated as
+// coming from a new device.
+func (u *UserService) ForgetDevice(ctx context.Context, userId, deviceId string) error {
+	if err := u.db.DeleteDevice(ctx, userId, deviceId); err != nil {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+func randomCode(digits int) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < digits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
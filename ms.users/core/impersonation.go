@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrImpersonationNotAllowed    = errors.New("only an admin can impersonate another user")
+	ErrImpersonationTargetInvalid = errors.New("sorry, this user can not be impersonated")
+	ErrImpersonationNotFound      = errors.New("impersonation session not found or already ended")
+	ErrStartImpersonationFailed   = errors.New("failed to start impersonation session")
+	ErrEndImpersonationFailed     = errors.New("failed to end impersonation session")
+)
+
+const (
+	defaultImpersonationValidity int64 = 30
+	maxImpersonationValidity     int64 = 60
+)
+
+// StartImpersonation creates a time limited session for userId on behalf of
+// the admin actorId. The session token carries the admin id as its actor.
+func (u *UserService) StartImpersonation(ctx context.Context, actorId, userId string, payload models.ImpersonationRequest) (*models.Impersonation, error) {
+	actor, err := u.db.GetUserById(ctx, actorId)
+	if err != nil {
+		u.logger.WithError(err).Error("failed to get impersonation actor by id")
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	if actor.UserType != "ADMIN" {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	user, err := u.db.GetUserById(ctx, userId)
+	if err != nil {
+		u.logger.WithError(err).Error("failed to get user to impersonate by id")
+		return nil, ErrUserNotFoundById
+	}
+
+	// Admins can not impersonate themselves or other admins, otherwise an
+	// impersonation session could be used to act with someone else's privileges.
+	if user.UserId == actor.UserId || user.UserType == "ADMIN" {
+		return nil, ErrImpersonationTargetInvalid
+	}
+
+	validity := payload.Validity
+	if validity <= 0 {
+		validity = defaultImpersonationValidity
+	}
+	if validity > maxImpersonationValidity {
+		validity = maxImpersonationValidity
+	}
+
+	organizationId, organizationRole := u.activeOrganization(ctx, user)
+
+	duration := time.Minute * time.Duration(validity)
+	token, err := u.session.CreateSession(ctx, "", duration, session.Session{
+		UserId:           user.UserId,
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Role:             user.UserType,
+		Actor:            actor.UserId,
+		OrganizationId:   organizationId,
+		OrganizationRole: organizationRole,
+		Validity:         time.Duration(validity),
+		UnitOfValidity:   session.UnitOfValidityMinute,
+	})
+	if err != nil {
+		u.logger.WithError(err).Error("failed to create impersonation session")
+		return nil, ErrStartImpersonationFailed
+	}
+
+	u.audit(ctx, models.AuditImpersonationStarted, actor.UserId, user.UserId, payload.Reason)
+
+	return &models.Impersonation{
+		Token:     token,
+		ActorId:   actor.UserId,
+		UserId:    user.UserId,
+		ExpiresAt: time.Now().Add(duration),
+	}, nil
+}
+
+// EndImpersonation destroys an impersonation session. Only the admin that
+// started the session can end it.
+func (u *UserService) EndImpersonation(ctx context.Context, actorId, token string) error {
+	payload, err := u.session.VerifyToken(token)
+	if err != nil || !payload.IsImpersonation() {
+		return ErrImpersonationNotFound
+	}
+
+	if payload.Actor != actorId {
+		return ErrImpersonationNotAllowed
+	}
+
+	if _, err := u.session.GetSession(ctx, token); err != nil {
+		return ErrImpersonationNotFound
+	}
+
+	if err := u.session.DestroySession(ctx, token); err != nil {
+		u.logger.WithError(err).Error("failed to destroy impersonation session")
+		return ErrEndImpersonationFailed
+	}
+
+	u.audit(ctx, models.AuditImpersonationEnded, payload.Actor, payload.UserId, "")
+
+	return nil
+}
+
+// audit records an action in the audit trail. Failing to persist the record
+// does not fail the action, but it is always written to the logs.
+func (u *UserService) audit(ctx context.Context, action models.AuditAction, actorId, userId, details string) {
+	u.logger.WithFields(logrus.Fields{
+		"audit":   action.String(),
+		"actor":   actorId,
+		"userId":  userId,
+		"details": details,
+	}).Warn("audit event")
+
+	if err := u.db.CreateAuditLog(ctx, &models.AuditLog{
+		ID:        primitive.NewObjectID(),
+		Action:    action,
+		ActorId:   actorId,
+		UserId:    userId,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		u.logger.WithError(err).Error("failed to persist audit log")
+	}
+}
@@ -0,0 +1,366 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/fredele20/microservice-practice/ms.users/utils"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrImportFormatInvalid  = errors.New("invalid file format, you must provide csv or jsonl")
+	ErrImportFileInvalid    = errors.New("failed to read import file")
+	ErrImportUsersFailed    = errors.New("failed to import users")
+	ErrExportUsersFailed    = errors.New("failed to export users")
+	ErrImportPasswordNeeded = errors.New("a password or a bcrypt passwordHash is required")
+	ErrImportPasswordHash   = errors.New("passwordHash is not a valid bcrypt hash")
+	ErrImportDuplicateFile  = errors.New("a user with this email or phone appears earlier in the file")
+	ErrImportDuplicateUser  = errors.New("a user with this email or phone already exists")
+	ErrUserStatusInvalid    = errors.New("invalid status, you must provide activated or deactivated")
+)
+
+const defaultImportBatchSize = 500
+
+// importRow is a record that passed validation and waits for its batch to
+// be checked against existing users and inserted.
+type importRow struct {
+	row  int
+	user *models.User
+}
+
+// ImportUsers reads users from r and inserts them in batches, each batch in
+// a transaction with its user.created events. Invalid rows are skipped and
+// reported, they never fail the whole import. In dry run mode every row is
+// validated and checked against existing users but nothing is written.
+func (u *UserService) ImportUsers(ctx context.Context, r io.Reader, options models.ImportOptions) (*models.ImportReport, error) {
+	if !options.Format.IsValid() {
+		return nil, ErrImportFormatInvalid
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = defaultImportBatchSize
+	}
+
+	report := &models.ImportReport{
+		DryRun: options.DryRun,
+		Errors: []models.ImportRowError{},
+	}
+
+	// emails and phones already seen in the file, to reject duplicates
+	// before they reach the unique indexes on email and phone. The indexes
+	// still refuse the users created by others meanwhile, which fails the
+	// batch
+	seen := map[string]int{}
+	batch := make([]importRow, 0, options.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := u.importBatch(ctx, batch, report, options.DryRun)
+		batch = batch[:0]
+		return err
+	}
+
+	err := readImportRecords(r, options.Format, func(row int, record models.ImportUserRecord, err error) error {
+		report.Total++
+		if err != nil {
+			report.Fail(row, record.Email, err)
+			return nil
+		}
+
+		user, err := u.importUser(record)
+		if err != nil {
+			report.Fail(row, record.Email, err)
+			return nil
+		}
+
+		for _, key := range []string{"email:" + user.Email, "phone:" + user.Phone} {
+			if _, ok := seen[key]; ok {
+				report.Fail(row, record.Email, ErrImportDuplicateFile)
+				return nil
+			}
+		}
+		seen["email:"+user.Email] = row
+		seen["phone:"+user.Phone] = row
+
+		batch = append(batch, importRow{row: row, user: user})
+		if len(batch) >= options.BatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if errors.Is(err, ErrImportFileInvalid) {
+			return report, err
+		}
+		u.logger.WithError(err).Error(ErrImportUsersFailed.Error())
+		return report, ErrImportUsersFailed
+	}
+
+	u.logger.WithField("total", report.Total).
+		WithField("imported", report.Imported).
+		WithField("failed", report.Failed).
+		WithField("dryRun", report.DryRun).
+		Info("users import finished")
+
+	return report, nil
+}
+
+// importBatch drops the rows of batch that collide with existing users and
+// inserts the remaining ones.
+func (u *UserService) importBatch(ctx context.Context, batch []importRow, report *models.ImportReport, dryRun bool) error {
+	emails := make([]string, 0, len(batch))
+	phones := make([]string, 0, len(batch))
+	for _, row := range batch {
+		emails = append(emails, row.user.Email)
+		phones = append(phones, row.user.Phone)
+	}
+
+	existing, err := u.db.FindExistingUsers(ctx, emails, phones)
+	if err != nil {
+		return err
+	}
+
+	taken := map[string]bool{}
+	for _, user := range existing {
+		taken["email:"+user.Email] = true
+		taken["phone:"+user.Phone] = true
+	}
+
+	users := make([]*models.User, 0, len(batch))
+	events := make([]models.Event, 0, len(batch))
+	for _, row := range batch {
+		if taken["email:"+row.user.Email] || taken["phone:"+row.user.Phone] {
+			report.Fail(row.row, row.user.Email, ErrImportDuplicateUser)
+			continue
+		}
+		users = append(users, row.user)
+		events = append(events, models.NewUserEvent(models.EventUserCreated, row.user))
+	}
+
+	if !dryRun && len(users) > 0 {
+		err := u.db.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := u.db.CreateUsers(ctx, users); err != nil {
+				return err
+			}
+			return u.db.InsertOutboxMessages(ctx, events...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	report.Imported += len(users)
+	return nil
+}
+
+// importUser turns record into a user ready to be inserted, applying the
+// same validation and normalisation as CreateUser.
+func (u *UserService) importUser(record models.ImportUserRecord) (*models.User, error) {
+	user := models.User{
+		FirstName: strings.TrimSpace(record.FirstName),
+		LastName:  strings.TrimSpace(record.LastName),
+		Email:     strings.ToLower(strings.TrimSpace(record.Email)),
+		Phone:     strings.TrimSpace(record.Phone),
+		Iso2:      strings.ToUpper(strings.TrimSpace(record.Iso2)),
+		Country:   strings.TrimSpace(record.Country),
+		UserType:  strings.ToUpper(strings.TrimSpace(record.UserType)),
+	}
+
+	if err := validation.Validate(user.Email, validation.Required, is.Email); err != nil {
+		return nil, fmt.Errorf("email: %w", err)
+	}
+	if err := validation.Validate(user.UserType, validation.In("", "USER", "ADMIN")); err != nil {
+		return nil, fmt.Errorf("userType: %w", err)
+	}
+	if record.Status != "" && !record.Status.IsValid() {
+		return nil, ErrUserStatusInvalid
+	}
+
+	if err := normalizeUser(&user); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case record.PasswordHash != "":
+		if _, err := bcrypt.Cost([]byte(record.PasswordHash)); err != nil {
+			return nil, ErrImportPasswordHash
+		}
+		user.Password = record.PasswordHash
+	case record.Password != "":
+		user.Password = utils.HashPassword(record.Password)
+	default:
+		return nil, ErrImportPasswordNeeded
+	}
+
+	u.stampNewUser(&user)
+	if record.Status != "" {
+		user.Status = record.Status
+	}
+
+	return &user, nil
+}
+
+// readImportRecords calls fn with every record of r. Errors of a single
+// record are passed to fn, an error reading the file itself stops the import.
+func readImportRecords(r io.Reader, format models.FileFormat, fn func(row int, record models.ImportUserRecord, err error) error) error {
+	switch format {
+	case models.FormatCSV:
+		return readCSVRecords(r, fn)
+	case models.FormatJSONL:
+		return readJSONLRecords(r, fn)
+	default:
+		return ErrImportFormatInvalid
+	}
+}
+
+func readCSVRecords(r io.Reader, fn func(row int, record models.ImportUserRecord, err error) error) error {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrImportFileInvalid, err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return fmt.Errorf("%w: %v", ErrImportFileInvalid, err)
+			}
+			if err := fn(row, models.ImportUserRecord{}, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := columns[strings.ToLower(name)]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return fields[i]
+		}
+
+		record := models.ImportUserRecord{
+			FirstName:    field("firstName"),
+			LastName:     field("lastName"),
+			Email:        field("email"),
+			Phone:        field("phone"),
+			Iso2:         field("iso2"),
+			Country:      field("country"),
+			UserType:     field("userType"),
+			Password:     field("password"),
+			PasswordHash: field("passwordHash"),
+			Status:       models.Status(strings.ToLower(field("status"))),
+		}
+
+		if err := fn(row, record, nil); err != nil {
+			return err
+		}
+	}
+}
+
+func readJSONLRecords(r io.Reader, fn func(row int, record models.ImportUserRecord, err error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	row := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row++
+
+		var record models.ImportUserRecord
+		err := json.Unmarshal([]byte(line), &record)
+		if err := fn(row, record, err); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrImportFileInvalid, err)
+	}
+	return nil
+}
+
+// ExportUsers writes every user matching filter to w as they are read from
+// the database, so that exports of any size use constant memory.
+func (u *UserService) ExportUsers(ctx context.Context, format models.FileFormat, filter models.ExportUserFilter, w io.Writer) error {
+	if filter.Status != nil && !filter.Status.IsValid() {
+		return ErrUserStatusInvalid
+	}
+
+	var (
+		write func(user *models.ExportUser) error
+		flush func() error
+	)
+
+	switch format {
+	case models.FormatCSV:
+		writer := csv.NewWriter(w)
+		header := []string{"userId", "firstName", "lastName", "email", "phone", "iso2", "country", "userType", "status", "createdAt"}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		write = func(user *models.ExportUser) error {
+			return writer.Write([]string{
+				user.UserId, user.FirstName, user.LastName, user.Email, user.Phone,
+				user.Iso2, user.Country, user.UserType, user.Status.String(),
+				user.CreatedAt.Format(time.RFC3339),
+			})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case models.FormatJSONL:
+		encoder := json.NewEncoder(w)
+		write = func(user *models.ExportUser) error {
+			return encoder.Encode(user)
+		}
+		flush = func() error { return nil }
+	default:
+		return ErrImportFormatInvalid
+	}
+
+	err := u.db.StreamUsers(ctx, filter, func(user *models.User) error {
+		return write(user.Export())
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		u.logger.WithError(err).Error(ErrExportUsersFailed.Error())
+		return ErrExportUsersFailed
+	}
+
+	return nil
+}
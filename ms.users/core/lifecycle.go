@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"strings"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// saveWithEvent runs fn in a transaction together with writing an event of
+// eventType for the user it returns to the outbox, so that an event is
+// published if and only if the change is persisted.
+func (u *UserService) saveWithEvent(ctx context.Context, eventType models.EventType, fn func(ctx context.Context) (*models.User, error)) (*models.User, error) {
+	var user *models.User
+	err := u.db.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = fn(ctx)
+		if err != nil {
+			return err
+		}
+
+		return u.db.InsertOutboxMessages(ctx, models.NewUserEvent(eventType, user))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (u *UserService) UpdateUser(ctx context.Context, id string, payload models.UpdateUserRequest) (*models.User, error) {
+	if err := validation.ValidateStruct(&payload,
+		validation.Field(&payload.FirstName, validation.NilOrNotEmpty, validation.Length(2, 100)),
+		validation.Field(&payload.LastName, validation.NilOrNotEmpty, validation.Length(2, 100)),
+		validation.Field(&payload.Iso2, validation.NilOrNotEmpty, is.CountryCode2),
+		validation.Field(&payload.Country, validation.NilOrNotEmpty),
+	); err != nil {
+		return nil, err
+	}
+
+	user, err := u.db.GetUserById(ctx, id)
+	if err != nil {
+		return nil, ErrUserNotFoundById
+	}
+
+	update := &models.User{UserId: user.UserId}
+	if payload.FirstName != nil {
+		update.FirstName = strings.TrimSpace(*payload.FirstName)
+	}
+	if payload.LastName != nil {
+		update.LastName = strings.TrimSpace(*payload.LastName)
+	}
+	if payload.Country != nil {
+		update.Country = *payload.Country
+	}
+	if payload.Iso2 != nil {
+		update.Iso2 = *payload.Iso2
+	}
+
+	if payload.Phone != nil {
+		iso2 := user.Iso2
+		if update.Iso2 != "" {
+			iso2 = update.Iso2
+		}
+
+		phone, err := parsePhone(*payload.Phone, iso2)
+		if err != nil {
+			u.logger.WithError(err).Error("failed to validate phone number or country code")
+			return nil, err
+		}
+		update.Phone = phone
+	}
+
+	updated, err := u.saveWithEvent(ctx, models.EventUserUpdated, func(ctx context.Context) (*models.User, error) {
+		return u.db.UpdateUser(ctx, update)
+	})
+	if err != nil {
+		u.logger.WithError(err).Error(ErrUpdateUserFailed.Error())
+		return nil, ErrUpdateUserFailed
+	}
+
+	return updated, nil
+}
+
+func (u *UserService) DeactivateUser(ctx context.Context, id string) (*models.User, error) {
+	user, err := u.saveWithEvent(ctx, models.EventUserDeactivated, func(ctx context.Context) (*models.User, error) {
+		return u.db.DeactivateUser(ctx, id)
+	})
+	if err != nil {
+		u.logger.WithError(err).Error(ErrUserDeactivationFailed.Error())
+		return nil, ErrUserDeactivationFailed
+	}
+
+	return user, nil
+}
+
+func (u *UserService) ActivateUser(ctx context.Context, id string) (*models.User, error) {
+	user, err := u.saveWithEvent(ctx, models.EventUserUpdated, func(ctx context.Context) (*models.User, error) {
+		return u.db.ActivateUser(ctx, id)
+	})
+	if err != nil {
+		u.logger.WithError(err).Error(ErrUserActivationFailed.Error())
+		return nil, ErrUserActivationFailed
+	}
+
+	return user, nil
+}
+
+func (u *UserService) DeleteUser(ctx context.Context, id string) error {
+	user, err := u.db.GetUserById(ctx, id)
+	if err != nil {
+		return ErrUserNotFoundById
+	}
+
+	if _, err := u.saveWithEvent(ctx, models.EventUserDeleted, func(ctx context.Context) (*models.User, error) {
+		return user, u.db.DeleteUser(ctx, id)
+	}); err != nil {
+		u.logger.WithError(err).Error(ErrDeleteUserFailed.Error())
+		return ErrDeleteUserFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+)
+
+var (
+	ErrLookupUsersFailed   = errors.New("failed to lookup users")
+	ErrLookupTooManyIds    = errors.New("too many ids, you can lookup at most 100 users at once")
+	ErrLookupNoIdsProvided = errors.New("at least one user id must be provided")
+)
+
+const maxLookupIds = 100
+
+// LookupUsers returns the public profile of every user in ids, ids that do
+// not match any user are returned as missing.
+func (u *UserService) LookupUsers(ctx context.Context, ids []string) (*models.UserLookupResponse, error) {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	if len(unique) == 0 {
+		return nil, ErrLookupNoIdsProvided
+	}
+
+	if len(unique) > maxLookupIds {
+		return nil, ErrLookupTooManyIds
+	}
+
+	users, err := u.db.GetUsersByIds(ctx, unique)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrLookupUsersFailed.Error())
+		return nil, ErrLookupUsersFailed
+	}
+
+	response := &models.UserLookupResponse{
+		Data:    make([]*models.PublicUser, 0, len(users)),
+		Missing: []string{},
+	}
+
+	found := map[string]bool{}
+	for _, user := range users {
+		found[user.UserId] = true
+		response.Data = append(response.Data, user.Public())
+	}
+
+	for _, id := range unique {
+		if !found[id] {
+			response.Missing = append(response.Missing, id)
+		}
+	}
+
+	return response, nil
+}
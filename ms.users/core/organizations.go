@@ -0,0 +1,480 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/db/mongod"
+	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/fredele20/microservice-practice/ms.users/notifier"
+	"github.com/fredele20/microservice-practice/ms.users/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrCreateOrganizationFailed = errors.New("failed to create organization")
+	ErrOrganizationNotFound     = errors.New("organization not found")
+	ErrListOrganizationsFailed  = errors.New("failed to list organizations")
+	ErrNotOrganizationMember    = errors.New("you are not a member of this organization")
+	ErrOrganizationActionDenied = errors.New("you are not allowed to perform this action in this organization")
+	ErrMemberNotFound           = errors.New("member not found in this organization")
+	ErrMemberAlreadyExists      = errors.New("user is already a member of this organization")
+	ErrUpdateMemberFailed       = errors.New("failed to update organization member")
+	ErrRemoveMemberFailed       = errors.New("failed to remove organization member")
+	ErrOwnerCannotLeave         = errors.New("the organization owner must transfer ownership before leaving")
+	ErrInvalidOrganizationRole  = errors.New("invalid organization role, you must provide admin or member")
+	ErrCreateInvitationFailed   = errors.New("failed to create invitation")
+	ErrInvitationNotFound       = errors.New("invitation not found or already responded to")
+	ErrInvitationExpired        = errors.New("sorry, this invitation has expired")
+	ErrInvitationEmailMismatch  = errors.New("this invitation was sent to a different email address")
+	ErrTransferOwnershipFailed  = errors.New("failed to transfer organization ownership")
+	ErrSwitchOrganizationFailed = errors.New("failed to switch active organization")
+	ErrListInvitationsFailed    = errors.New("failed to list invitations")
+	ErrListMembersFailed        = errors.New("failed to list organization members")
+)
+
+const invitationValidity = time.Hour * 24 * 7
+
+func (u *UserService) CreateOrganization(ctx context.Context, userId string, payload models.Organization) (*models.Organization, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	payload.ID = primitive.NewObjectID()
+	payload.OrganizationId = payload.ID.Hex()
+	payload.OwnerId = userId
+	payload.CreatedAt = now
+	payload.UpdatedAt = now
+
+	organization, err := u.db.CreateOrganization(ctx, &payload)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrCreateOrganizationFailed.Error())
+		return nil, ErrCreateOrganizationFailed
+	}
+
+	if _, err := u.db.CreateMembership(ctx, &models.Membership{
+		ID:             primitive.NewObjectID(),
+		OrganizationId: organization.OrganizationId,
+		UserId:         userId,
+		Role:           models.OrganizationRoleOwner,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}); err != nil {
+		u.logger.WithError(err).Error("failed to create owner membership for organization")
+		return nil, ErrCreateOrganizationFailed
+	}
+
+	user, err := u.db.GetUserById(ctx, userId)
+	if err == nil && user.ActiveOrganizationId == "" {
+		if err := u.db.SetActiveOrganization(ctx, userId, organization.OrganizationId); err != nil {
+			u.logger.WithError(err).Error("failed to set first organization as active")
+		}
+	}
+
+	return organization, nil
+}
+
+func (u *UserService) ListOrganizations(ctx context.Context, userId string) (*models.OrganizationList, error) {
+	memberships, err := u.db.ListMembershipsByUser(ctx, userId)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListOrganizationsFailed.Error())
+		return nil, ErrListOrganizationsFailed
+	}
+
+	ids := make([]string, 0, len(memberships.Data))
+	for _, membership := range memberships.Data {
+		ids = append(ids, membership.OrganizationId)
+	}
+
+	organizations, err := u.db.ListOrganizationsByIds(ctx, ids)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListOrganizationsFailed.Error())
+		return nil, ErrListOrganizationsFailed
+	}
+
+	return organizations, nil
+}
+
+func (u *UserService) GetOrganization(ctx context.Context, userId, organizationId string) (*models.Organization, error) {
+	if _, err := u.membership(ctx, organizationId, userId); err != nil {
+		return nil, err
+	}
+
+	organization, err := u.db.GetOrganizationById(ctx, organizationId)
+	if err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+
+	return organization, nil
+}
+
+func (u *UserService) ListMembers(ctx context.Context, userId, organizationId string) (*models.MembershipList, error) {
+	if _, err := u.membership(ctx, organizationId, userId); err != nil {
+		return nil, err
+	}
+
+	members, err := u.db.ListMemberships(ctx, organizationId)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListMembersFailed.Error())
+		return nil, ErrListMembersFailed
+	}
+
+	return members, nil
+}
+
+func (u *UserService) InviteMember(ctx context.Context, userId, organizationId string, payload models.InviteMemberRequest) (*models.Invitation, error) {
+	payload.Email = strings.ToLower(strings.TrimSpace(payload.Email))
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	inviter, err := u.membership(ctx, organizationId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inviter.Role.CanManageMembers() {
+		return nil, ErrOrganizationActionDenied
+	}
+
+	organization, err := u.db.GetOrganizationById(ctx, organizationId)
+	if err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+
+	if invitee, err := u.db.GetUserByEmail(ctx, payload.Email); err == nil {
+		if _, err := u.db.GetMembership(ctx, organizationId, invitee.UserId); err == nil {
+			return nil, ErrMemberAlreadyExists
+		}
+	}
+
+	now := time.Now()
+	invitation := &models.Invitation{
+		ID:             primitive.NewObjectID(),
+		OrganizationId: organizationId,
+		Email:          payload.Email,
+		Role:           payload.Role,
+		Token:          utils.RandomToken(32),
+		InvitedBy:      userId,
+		Status:         models.InvitationPending,
+		ExpiresAt:      now.Add(invitationValidity),
+		CreatedAt:      now,
+	}
+	invitation.InvitationId = invitation.ID.Hex()
+
+	invitation, err = u.db.CreateInvitation(ctx, invitation)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrCreateInvitationFailed.Error())
+		return nil, ErrCreateInvitationFailed
+	}
+
+	if err := u.notifier.Notify(ctx, notifier.Notification{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", organization.Name),
+		Body: fmt.Sprintf(
+			"You have been invited to join %s as %s. Use this code to accept or decline the invitation: %s. The invitation expires on %s.",
+			organization.Name, invitation.Role, invitation.Token, invitation.ExpiresAt.Format(time.RFC1123),
+		),
+	}); err != nil {
+		u.logger.WithError(err).Error("failed to send organization invitation")
+	}
+
+	return invitation, nil
+}
+
+func (u *UserService) ListInvitations(ctx context.Context, userId, organizationId string) (*models.InvitationList, error) {
+	member, err := u.membership(ctx, organizationId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !member.Role.CanManageMembers() {
+		return nil, ErrOrganizationActionDenied
+	}
+
+	invitations, err := u.db.ListInvitations(ctx, organizationId)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListInvitationsFailed.Error())
+		return nil, ErrListInvitationsFailed
+	}
+
+	return invitations, nil
+}
+
+func (u *UserService) ListMyInvitations(ctx context.Context, email string) (*models.InvitationList, error) {
+	invitations, err := u.db.ListPendingInvitationsByEmail(ctx, strings.ToLower(email))
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListInvitationsFailed.Error())
+		return nil, ErrListInvitationsFailed
+	}
+
+	return invitations, nil
+}
+
+// pendingInvitation returns the invitation for token if it is still pending
+// and was sent to email.
+func (u *UserService) pendingInvitation(ctx context.Context, email, token string) (*models.Invitation, error) {
+	invitation, err := u.db.GetInvitationByToken(ctx, token)
+	if err != nil || invitation.Status != models.InvitationPending {
+		return nil, ErrInvitationNotFound
+	}
+
+	if !strings.EqualFold(invitation.Email, email) {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	if invitation.IsExpired() {
+		return nil, ErrInvitationExpired
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation adds the user to the organization of the invitation.
+// The membership is created before the invitation is marked accepted, so
+// that a failure leaves the invitation pending, and is removed again when
+// the invitation was answered meanwhile.
+func (u *UserService) AcceptInvitation(ctx context.Context, userId, email, token string) (*models.Membership, error) {
+	invitation, err := u.pendingInvitation(ctx, email, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var membership *models.Membership
+	err = u.db.WithTransaction(ctx, func(ctx context.Context) error {
+		now := time.Now()
+		created, err := u.db.CreateMembership(ctx, &models.Membership{
+			ID:             primitive.NewObjectID(),
+			OrganizationId: invitation.OrganizationId,
+			UserId:         userId,
+			Role:           invitation.Role,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := u.db.RespondToInvitation(ctx, token, models.InvitationAccepted); err != nil {
+			// on a standalone server the membership is not rolled back
+			if err := u.db.DeleteMembership(ctx, invitation.OrganizationId, userId); err != nil {
+				u.logger.WithError(err).Error("failed to remove membership of an invitation answered meanwhile")
+			}
+			return ErrInvitationNotFound
+		}
+
+		membership = created
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, mongod.ErrDuplicate):
+			return nil, ErrMemberAlreadyExists
+		case errors.Is(err, ErrInvitationNotFound):
+			return nil, ErrInvitationNotFound
+		}
+		u.logger.WithError(err).Error("failed to create membership from invitation")
+		return nil, ErrUpdateMemberFailed
+	}
+
+	return membership, nil
+}
+
+func (u *UserService) DeclineInvitation(ctx context.Context, email, token string) (*models.Invitation, error) {
+	if _, err := u.pendingInvitation(ctx, email, token); err != nil {
+		return nil, err
+	}
+
+	invitation, err := u.db.RespondToInvitation(ctx, token, models.InvitationDeclined)
+	if err != nil {
+		return nil, ErrInvitationNotFound
+	}
+
+	return invitation, nil
+}
+
+func (u *UserService) UpdateMemberRole(ctx context.Context, userId, organizationId, memberId string, role models.OrganizationRole) (*models.Membership, error) {
+	if role != models.OrganizationRoleAdmin && role != models.OrganizationRoleMember {
+		return nil, ErrInvalidOrganizationRole
+	}
+
+	actor, err := u.membership(ctx, organizationId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := u.db.GetMembership(ctx, organizationId, memberId)
+	if err != nil {
+		return nil, ErrMemberNotFound
+	}
+
+	if !u.canManage(actor, member) {
+		return nil, ErrOrganizationActionDenied
+	}
+
+	updated, err := u.db.UpdateMembershipRole(ctx, organizationId, memberId, role)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrUpdateMemberFailed.Error())
+		return nil, ErrUpdateMemberFailed
+	}
+
+	return updated, nil
+}
+
+// RemoveMember removes memberId from the organization, members can also
+// remove themselves to leave an organization.
+func (u *UserService) RemoveMember(ctx context.Context, userId, organizationId, memberId string) error {
+	actor, err := u.membership(ctx, organizationId, userId)
+	if err != nil {
+		return err
+	}
+
+	member, err := u.db.GetMembership(ctx, organizationId, memberId)
+	if err != nil {
+		return ErrMemberNotFound
+	}
+
+	if member.Role == models.OrganizationRoleOwner {
+		return ErrOwnerCannotLeave
+	}
+
+	if userId != memberId && !u.canManage(actor, member) {
+		return ErrOrganizationActionDenied
+	}
+
+	if err := u.db.DeleteMembership(ctx, organizationId, memberId); err != nil {
+		u.logger.WithError(err).Error(ErrRemoveMemberFailed.Error())
+		return ErrRemoveMemberFailed
+	}
+
+	if user, err := u.db.GetUserById(ctx, memberId); err == nil && user.ActiveOrganizationId == organizationId {
+		if err := u.db.SetActiveOrganization(ctx, memberId, ""); err != nil {
+			u.logger.WithError(err).Error("failed to reset active organization of removed member")
+		}
+	}
+
+	return nil
+}
+
+// TransferOwnership makes an existing member the owner of the organization,
+// the previous owner stays in the organization as an admin.
+func (u *UserService) TransferOwnership(ctx context.Context, userId, organizationId string, payload models.TransferOwnershipRequest) (*models.Organization, error) {
+	actor, err := u.membership(ctx, organizationId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.Role != models.OrganizationRoleOwner {
+		return nil, ErrOrganizationActionDenied
+	}
+
+	if payload.UserId == userId {
+		return nil, ErrTransferOwnershipFailed
+	}
+
+	if _, err := u.db.GetMembership(ctx, organizationId, payload.UserId); err != nil {
+		return nil, ErrMemberNotFound
+	}
+
+	// the organization and both memberships change together. Without
+	// transactions the previous owner is demoted last, so that a failure
+	// never leaves the organization without an owner
+	var organization *models.Organization
+	err = u.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := u.db.UpdateMembershipRole(ctx, organizationId, payload.UserId, models.OrganizationRoleOwner); err != nil {
+			return err
+		}
+
+		var err error
+		if organization, err = u.db.SetOrganizationOwner(ctx, organizationId, payload.UserId); err != nil {
+			return err
+		}
+
+		_, err = u.db.UpdateMembershipRole(ctx, organizationId, userId, models.OrganizationRoleAdmin)
+		return err
+	})
+	if err != nil {
+		u.logger.WithError(err).Error(ErrTransferOwnershipFailed.Error())
+		return nil, ErrTransferOwnershipFailed
+	}
+
+	return organization, nil
+}
+
+// SwitchOrganization makes organizationId the active organization of the
+// user and returns the user with a token carrying it.
+func (u *UserService) SwitchOrganization(ctx context.Context, userId, organizationId string) (*models.User, error) {
+	member, err := u.membership(ctx, organizationId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.db.SetActiveOrganization(ctx, userId, organizationId); err != nil {
+		u.logger.WithError(err).Error(ErrSwitchOrganizationFailed.Error())
+		return nil, ErrSwitchOrganizationFailed
+	}
+
+	user, err := u.db.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, ErrUserNotFoundById
+	}
+
+	token, err := u.session.CreateSession(ctx, "", time.Hour*1, session.Session{
+		UserId:           user.UserId,
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Role:             user.UserType,
+		OrganizationId:   member.OrganizationId,
+		OrganizationRole: member.Role.String(),
+		Validity:         1,
+		UnitOfValidity:   session.UnitOfValidityHour,
+	})
+	if err != nil {
+		u.logger.WithError(err).Error("failed to create token for switched organization")
+		return nil, ErrSwitchOrganizationFailed
+	}
+
+	user.Token = &token
+	return user, nil
+}
+
+func (u *UserService) membership(ctx context.Context, organizationId, userId string) (*models.Membership, error) {
+	member, err := u.db.GetMembership(ctx, organizationId, userId)
+	if err != nil {
+		return nil, ErrNotOrganizationMember
+	}
+	return member, nil
+}
+
+// canManage reports whether actor can change or remove member. Owners can
+// manage everyone, admins can only manage plain members.
+func (u *UserService) canManage(actor, member *models.Membership) bool {
+	switch actor.Role {
+	case models.OrganizationRoleOwner:
+		return member.Role != models.OrganizationRoleOwner
+	case models.OrganizationRoleAdmin:
+		return member.Role == models.OrganizationRoleMember
+	}
+	return false
+}
+
+// activeOrganization returns the active organization of the user and the
+// user's role in it, it is empty when the user is no longer a member.
+func (u *UserService) activeOrganization(ctx context.Context, user *models.User) (string, string) {
+	if user.ActiveOrganizationId == "" {
+		return "", ""
+	}
+
+	member, err := u.db.GetMembership(ctx, user.ActiveOrganizationId, user.UserId)
+	if err != nil {
+		return "", ""
+	}
+
+	return member.OrganizationId, member.Role.String()
+}
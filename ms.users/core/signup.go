@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/fredele20/microservice-practice/ms.users/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrSignupEmailRequired      = errors.New("an email address is required to sign up")
+	ErrSignupDomainNotAllowed   = errors.New("Sorry, signup is not open to this email domain")
+	ErrSignupInviteRequired     = errors.New("Sorry, signup is by invitation only, an invite code is required")
+	ErrSignupInviteInvalid      = errors.New("Sorry, this invite code is invalid, expired or already used")
+	ErrCreateSignupInviteFailed = errors.New("failed to create signup invite")
+	ErrListSignupInvitesFailed  = errors.New("failed to list signup invites")
+	ErrSignupInviteNotFound     = errors.New("signup invite not found or already revoked")
+)
+
+// checkSignupPolicy rejects signups the policy does not allow before any
+// work is done, the invite code itself is redeemed with the user creation.
+func (u *UserService) checkSignupPolicy(payload *models.User) error {
+	payload.Email = strings.ToLower(strings.TrimSpace(payload.Email))
+
+	if u.signup.RequiresEmail() && payload.Email == "" {
+		return ErrSignupEmailRequired
+	}
+	if !u.signup.AllowsEmail(payload.Email) {
+		return ErrSignupDomainNotAllowed
+	}
+	if u.signup.Mode == models.SignupModeInviteOnly && strings.TrimSpace(payload.InviteCode) == "" {
+		return ErrSignupInviteRequired
+	}
+
+	return nil
+}
+
+// redeemSignupInvite uses the invite code of payload when signup is invite
+// only. It must run in the transaction creating the user so that a failed
+// signup does not consume the invite.
+func (u *UserService) redeemSignupInvite(ctx context.Context, payload *models.User) error {
+	if u.signup.Mode != models.SignupModeInviteOnly {
+		return nil
+	}
+
+	if _, err := u.db.RedeemSignupInvite(ctx, strings.TrimSpace(payload.InviteCode), payload.Email, time.Now()); err != nil {
+		return ErrSignupInviteInvalid
+	}
+
+	return nil
+}
+
+func (u *UserService) CreateSignupInvite(ctx context.Context, actorId string, payload models.CreateSignupInviteRequest) (*models.SignupInvite, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	id := primitive.NewObjectID()
+	invite := &models.SignupInvite{
+		ID:        id,
+		InviteId:  id.Hex(),
+		Code:      strings.ToUpper(utils.RandomToken(6)),
+		Email:     strings.ToLower(strings.TrimSpace(payload.Email)),
+		MaxUses:   payload.MaxUses,
+		ExpiresAt: payload.ExpiresAt,
+		Note:      payload.Note,
+		CreatedBy: actorId,
+		CreatedAt: time.Now(),
+	}
+
+	invite, err := u.db.CreateSignupInvite(ctx, invite)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrCreateSignupInviteFailed.Error())
+		return nil, ErrCreateSignupInviteFailed
+	}
+
+	return invite, nil
+}
+
+func (u *UserService) ListSignupInvites(ctx context.Context) (*models.SignupInviteList, error) {
+	invites, err := u.db.ListSignupInvites(ctx)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListSignupInvitesFailed.Error())
+		return nil, ErrListSignupInvitesFailed
+	}
+
+	return invites, nil
+}
+
+func (u *UserService) RevokeSignupInvite(ctx context.Context, id string) (*models.SignupInvite, error) {
+	invite, err := u.db.RevokeSignupInvite(ctx, id, time.Now())
+	if err != nil {
+		return nil, ErrSignupInviteNotFound
+	}
+
+	return invite, nil
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/fredele20/microservice-practice/ms.users/utils"
+	"github.com/fredele20/microservice-practice/ms.users/webhooks"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrCreateWebhookFailed   = errors.New("failed to create webhook")
+	ErrWebhookNotFound       = errors.New("webhook not found")
+	ErrListWebhooksFailed    = errors.New("failed to list webhooks")
+	ErrUpdateWebhookFailed   = errors.New("failed to update webhook")
+	ErrDeleteWebhookFailed   = errors.New("failed to delete webhook")
+	ErrDeliveryNotFound      = errors.New("webhook delivery not found")
+	ErrListDeliveriesFailed  = errors.New("failed to list webhook deliveries")
+	ErrReplayDeliveryFailed  = errors.New("failed to replay webhook delivery")
+	ErrDeliveryStatusInvalid = errors.New("invalid delivery status, you must provide pending, succeeded or dead")
+)
+
+// CreateWebhook registers a webhook endpoint. The signing secret is only
+// returned in this response.
+func (u *UserService) CreateWebhook(ctx context.Context, actorId string, payload models.Webhook) (*models.Webhook, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	payload.ID = primitive.NewObjectID()
+	payload.WebhookId = payload.ID.Hex()
+	payload.Secret = "whsec_" + utils.RandomToken(24)
+	payload.Active = true
+	payload.CreatedBy = actorId
+	payload.CreatedAt = now
+	payload.UpdatedAt = now
+
+	webhook, err := u.db.CreateWebhook(ctx, &payload)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrCreateWebhookFailed.Error())
+		return nil, ErrCreateWebhookFailed
+	}
+
+	return webhook, nil
+}
+
+func (u *UserService) ListWebhooks(ctx context.Context) (*models.WebhookList, error) {
+	webhooks, err := u.db.ListWebhooks(ctx)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListWebhooksFailed.Error())
+		return nil, ErrListWebhooksFailed
+	}
+
+	for _, webhook := range webhooks.Data {
+		webhook.Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+func (u *UserService) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	webhook, err := u.db.GetWebhookById(ctx, id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (u *UserService) UpdateWebhook(ctx context.Context, id string, payload models.UpdateWebhookRequest) (*models.Webhook, error) {
+	current, err := u.db.GetWebhookById(ctx, id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	if payload.URL != nil {
+		current.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		current.Events = *payload.Events
+	}
+	if err := current.Validate(); err != nil {
+		return nil, err
+	}
+
+	webhook, err := u.db.UpdateWebhook(ctx, id, payload)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrUpdateWebhookFailed.Error())
+		return nil, ErrUpdateWebhookFailed
+	}
+
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (u *UserService) DeleteWebhook(ctx context.Context, id string) error {
+	if err := u.db.DeleteWebhook(ctx, id); err != nil {
+		u.logger.WithError(err).Error(ErrDeleteWebhookFailed.Error())
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (u *UserService) ListWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (*models.WebhookDeliveryList, error) {
+	if filter.Status != nil && !filter.Status.IsValid() {
+		return nil, ErrDeliveryStatusInvalid
+	}
+
+	deliveries, err := u.db.ListWebhookDeliveries(ctx, filter)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListDeliveriesFailed.Error())
+		return nil, ErrListDeliveriesFailed
+	}
+
+	return deliveries, nil
+}
+
+func (u *UserService) ListDeadLetters(ctx context.Context, limit int64) (*models.WebhookDeliveryList, error) {
+	deliveries, err := u.db.ListDeadLetters(ctx, limit)
+	if err != nil {
+		u.logger.WithError(err).Error(ErrListDeliveriesFailed.Error())
+		return nil, ErrListDeliveriesFailed
+	}
+
+	return deliveries, nil
+}
+
+// ReplayDelivery sends the event of a past delivery again as a new delivery,
+// whatever the status of the original one.
+func (u *UserService) ReplayDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	original, err := u.db.GetWebhookDeliveryById(ctx, id)
+	if err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	if _, err := u.db.GetWebhookById(ctx, original.WebhookId); err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	delivery := webhooks.NewDelivery(original.WebhookId, original.Event)
+	delivery.ReplayOf = original.DeliveryId
+
+	if err := u.db.CreateWebhookDeliveries(ctx, delivery); err != nil {
+		u.logger.WithError(err).Error(ErrReplayDeliveryFailed.Error())
+		return nil, ErrReplayDeliveryFailed
+	}
+
+	return delivery, nil
+}
@@ -2,8 +2,10 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -12,13 +14,126 @@ type UserStore interface {
 	GetUserByPhone(ctx context.Context, phone string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	GetUserById(ctx context.Context, id string) (*models.User, error)
+	GetUsersByIds(ctx context.Context, ids []string) ([]*models.User, error)
 	ListUsers(ctx context.Context, filters models.ListUserFilter) (*models.UserList, error)
 	CreateUser(ctx context.Context, payload *models.User) (*models.User, error)
+	CreateUsers(ctx context.Context, payload []*models.User) error
+	// FindExistingUsers returns the users already registered with one of
+	// the emails or phones.
+	FindExistingUsers(ctx context.Context, emails, phones []string) ([]*models.User, error)
+	// StreamUsers calls fn for every user matching filter without loading
+	// them all in memory.
+	StreamUsers(ctx context.Context, filter models.ExportUserFilter, fn func(user *models.User) error) error
 	UpdateUser(ctx context.Context, payload *models.User) (*models.User, error)
 	DeactivateUser(ctx context.Context, id string) (*models.User, error)
 	ActivateUser(ctx context.Context, id string) (*models.User, error)
 	DeleteUser(ctx context.Context, id string) error
+	CreateAuditLog(ctx context.Context, payload *models.AuditLog) error
+	SetActiveOrganization(ctx context.Context, userId, organizationId string) error
+	SetUserAvatar(ctx context.Context, userId, pictureURL string, avatar *models.Avatar) (*models.User, error)
+	// ListUsersByPictureURLPrefix returns at most limit users without an
+	// uploaded avatar whose PictureURL starts with prefix.
+	ListUsersByPictureURLPrefix(ctx context.Context, prefix string, limit int64) ([]*models.User, error)
+	// ReplacePictureURL changes the PictureURL of a user without an
+	// uploaded avatar, if it is still from.
+	ReplacePictureURL(ctx context.Context, userId, from, to string) (*models.User, error)
 	SessionCollection() *mongo.Collection
+	// WithTransaction runs fn in a transaction, every store call made with
+	// the context passed to fn is committed or aborted together. On a
+	// standalone server, which has no transactions, fn runs without one.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	OrganizationStore
+	OutboxStore
+	WebhookStore
+	SignupInviteStore
+	ConsentStore
+	DeviceStore
+}
+
+type DeviceStore interface {
+	GetDevice(ctx context.Context, userId, fingerprint string) (*models.Device, error)
+	// GetLastLocatedDevice returns the device of the user's most recent
+	// login that could be located.
+	GetLastLocatedDevice(ctx context.Context, userId string) (*models.Device, error)
+	// SaveDevice creates the device or updates the last time it was seen.
+	SaveDevice(ctx context.Context, payload *models.Device) (*models.Device, error)
+	ListDevices(ctx context.Context, userId string) (*models.DeviceList, error)
+	DeleteDevice(ctx context.Context, userId, deviceId string) error
+	CreateLoginChallenge(ctx context.Context, payload *models.LoginChallenge) error
+	GetLoginChallenge(ctx context.Context, id string) (*models.LoginChallenge, error)
+	// IncrementLoginChallengeAttempts counts a wrong code and returns the
+	// challenge as updated.
+	IncrementLoginChallengeAttempts(ctx context.Context, id string) (*models.LoginChallenge, error)
+	DeleteLoginChallenge(ctx context.Context, id string) error
+}
+
+type ConsentStore interface {
+	CreateLegalDocument(ctx context.Context, payload *models.LegalDocument) (*models.LegalDocument, error)
+	// GetCurrentLegalDocument returns the latest published document of
+	// documentType.
+	GetCurrentLegalDocument(ctx context.Context, documentType models.DocumentType) (*models.LegalDocument, error)
+	InsertConsentRecords(ctx context.Context, records ...*models.ConsentRecord) error
+	ListConsentRecords(ctx context.Context, userId string) (*models.ConsentRecordList, error)
+	// SetUserConsents updates the current consents of a user, nil documents
+	// and missing channels are left unchanged.
+	SetUserConsents(ctx context.Context, userId string, consents models.Consents) (*models.User, error)
+}
+
+type SignupInviteStore interface {
+	CreateSignupInvite(ctx context.Context, payload *models.SignupInvite) (*models.SignupInvite, error)
+	ListSignupInvites(ctx context.Context) (*models.SignupInviteList, error)
+	RevokeSignupInvite(ctx context.Context, id string, revokedAt time.Time) (*models.SignupInvite, error)
+	// RedeemSignupInvite uses the invite with code once for email, it fails
+	// when the invite is revoked, expired, used up or meant for another
+	// email. The check and the increment are atomic.
+	RedeemSignupInvite(ctx context.Context, code, email string, now time.Time) (*models.SignupInvite, error)
+}
+
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, payload *models.Webhook) (*models.Webhook, error)
+	GetWebhookById(ctx context.Context, id string) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context) (*models.WebhookList, error)
+	ListActiveWebhooks(ctx context.Context) ([]*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, id string, payload models.UpdateWebhookRequest) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	// CreateWebhookDeliveries is idempotent, a delivery of the same event to
+	// the same webhook is only created once.
+	CreateWebhookDeliveries(ctx context.Context, deliveries ...*models.WebhookDelivery) error
+	GetWebhookDeliveryById(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, filter models.WebhookDeliveryFilter) (*models.WebhookDeliveryList, error)
+	// ClaimDueDeliveries pushes back the next attempt of up to limit due
+	// deliveries by lockFor, so that concurrent workers skip them.
+	ClaimDueDeliveries(ctx context.Context, limit int64, lockFor time.Duration) ([]*models.WebhookDelivery, error)
+	RecordDeliveryAttempt(ctx context.Context, id string, attempt models.DeliveryAttempt, status models.DeliveryStatus, nextAttemptAt time.Time) (*models.WebhookDelivery, error)
+	CreateDeadLetter(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListDeadLetters(ctx context.Context, limit int64) (*models.WebhookDeliveryList, error)
+}
+
+type OutboxStore interface {
+	InsertOutboxMessages(ctx context.Context, events ...models.Event) error
+	// ClaimOutboxMessages locks up to limit pending messages, oldest first, so
+	// that concurrent relays do not deliver the same message.
+	ClaimOutboxMessages(ctx context.Context, limit int64, lockFor time.Duration) ([]*models.OutboxMessage, error)
+	MarkOutboxMessageDelivered(ctx context.Context, id primitive.ObjectID) error
+	MarkOutboxMessageFailed(ctx context.Context, id primitive.ObjectID, reason string) error
+}
+
+type OrganizationStore interface {
+	CreateOrganization(ctx context.Context, payload *models.Organization) (*models.Organization, error)
+	GetOrganizationById(ctx context.Context, id string) (*models.Organization, error)
+	ListOrganizationsByIds(ctx context.Context, ids []string) (*models.OrganizationList, error)
+	SetOrganizationOwner(ctx context.Context, id, ownerId string) (*models.Organization, error)
+	CreateMembership(ctx context.Context, payload *models.Membership) (*models.Membership, error)
+	GetMembership(ctx context.Context, organizationId, userId string) (*models.Membership, error)
+	ListMemberships(ctx context.Context, organizationId string) (*models.MembershipList, error)
+	ListMembershipsByUser(ctx context.Context, userId string) (*models.MembershipList, error)
+	UpdateMembershipRole(ctx context.Context, organizationId, userId string, role models.OrganizationRole) (*models.Membership, error)
+	DeleteMembership(ctx context.Context, organizationId, userId string) error
+	CreateInvitation(ctx context.Context, payload *models.Invitation) (*models.Invitation, error)
+	GetInvitationByToken(ctx context.Context, token string) (*models.Invitation, error)
+	ListInvitations(ctx context.Context, organizationId string) (*models.InvitationList, error)
+	ListPendingInvitationsByEmail(ctx context.Context, email string) (*models.InvitationList, error)
+	RespondToInvitation(ctx context.Context, token string, status models.InvitationStatus) (*models.Invitation, error)
 }
 
 // func DBInstance() *mongo.Client {
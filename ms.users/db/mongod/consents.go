@@ -0,0 +1,95 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (u dbStore) legalDocumentCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("legal_documents")
+}
+
+func (u dbStore) consentCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("consents")
+}
+
+func (u dbStore) CreateLegalDocument(ctx context.Context, payload *models.LegalDocument) (*models.LegalDocument, error) {
+	if _, err := u.legalDocumentCollection().InsertOne(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (u dbStore) GetCurrentLegalDocument(ctx context.Context, documentType models.DocumentType) (*models.LegalDocument, error) {
+	opts := options.FindOne().SetSort(bson.M{"publishedat": -1})
+
+	var document models.LegalDocument
+	if err := u.legalDocumentCollection().FindOne(ctx, bson.M{"type": documentType}, opts).Decode(&document); err != nil {
+		return nil, err
+	}
+
+	return &document, nil
+}
+
+func (u dbStore) InsertConsentRecords(ctx context.Context, records ...*models.ConsentRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		documents = append(documents, record)
+	}
+
+	if _, err := u.consentCollection().InsertMany(ctx, documents); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u dbStore) ListConsentRecords(ctx context.Context, userId string) (*models.ConsentRecordList, error) {
+	cursor, err := u.consentCollection().Find(ctx, bson.M{"userid": userId}, options.Find().SetSort(bson.M{"recordedat": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*models.ConsentRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	return &models.ConsentRecordList{
+		Count: int64(len(records)),
+		Data:  records,
+	}, nil
+}
+
+func (u dbStore) SetUserConsents(ctx context.Context, userId string, consents models.Consents) (*models.User, error) {
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set := bson.M{"updatedat": updatedAt}
+	if consents.Terms != nil {
+		set["consents.terms"] = consents.Terms
+	}
+	if consents.Privacy != nil {
+		set["consents.privacy"] = consents.Privacy
+	}
+	for channel, consent := range consents.Marketing {
+		set["consents.marketing."+string(channel)] = consent
+	}
+
+	var user models.User
+	if err := u.userCollection().FindOneAndUpdate(ctx, bson.M{"userid": userId}, bson.M{
+		"$set": set,
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,128 @@
+package mongod
+
+import (
+	"context"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (u dbStore) deviceCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("devices")
+}
+
+func (u dbStore) loginChallengeCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("login_challenges")
+}
+
+func (u dbStore) GetDevice(ctx context.Context, userId, fingerprint string) (*models.Device, error) {
+	var device models.Device
+	if err := u.deviceCollection().FindOne(ctx, bson.M{"userid": userId, "fingerprint": fingerprint}).Decode(&device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (u dbStore) GetLastLocatedDevice(ctx context.Context, userId string) (*models.Device, error) {
+	opts := options.FindOne().SetSort(bson.M{"lastseenat": -1})
+
+	var device models.Device
+	if err := u.deviceCollection().FindOne(ctx, bson.M{"userid": userId, "location": bson.M{"$ne": nil}}, opts).Decode(&device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (u dbStore) SaveDevice(ctx context.Context, payload *models.Device) (*models.Device, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var device models.Device
+	if err := u.deviceCollection().FindOneAndUpdate(ctx, bson.M{"userid": payload.UserId, "fingerprint": payload.Fingerprint}, bson.M{
+		"$set": bson.M{
+			"useragent":  payload.UserAgent,
+			"ipaddress":  payload.IPAddress,
+			"location":   payload.Location,
+			"lastseenat": payload.LastSeenAt,
+		},
+		"$setOnInsert": bson.M{
+			"id":          payload.ID,
+			"deviceid":    payload.DeviceId,
+			"firstseenat": payload.FirstSeenAt,
+		},
+	}, opts).Decode(&device); err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+func (u dbStore) ListDevices(ctx context.Context, userId string) (*models.DeviceList, error) {
+	cursor, err := u.deviceCollection().Find(ctx, bson.M{"userid": userId}, options.Find().SetSort(bson.M{"lastseenat": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []*models.Device{}
+	if err := cursor.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+
+	return &models.DeviceList{
+		Count: int64(len(devices)),
+		Data:  devices,
+	}, nil
+}
+
+func (u dbStore) DeleteDevice(ctx context.Context, userId, deviceId string) error {
+	result, err := u.deviceCollection().DeleteOne(ctx, bson.M{"userid": userId, "deviceid": deviceId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (u dbStore) CreateLoginChallenge(ctx context.Context, payload *models.LoginChallenge) error {
+	if _, err := u.loginChallengeCollection().InsertOne(ctx, payload); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u dbStore) GetLoginChallenge(ctx context.Context, id string) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	if err := u.loginChallengeCollection().FindOne(ctx, bson.M{"challengeid": id}).Decode(&challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (u dbStore) IncrementLoginChallengeAttempts(ctx context.Context, id string) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	if err := u.loginChallengeCollection().FindOneAndUpdate(ctx, bson.M{"challengeid": id}, bson.M{
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// DeleteLoginChallenge fails when the challenge was already deleted, so
+// that a code can only be used once.
+func (u dbStore) DeleteLoginChallenge(ctx context.Context, id string) error {
+	result, err := u.loginChallengeCollection().DeleteOne(ctx, bson.M{"challengeid": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
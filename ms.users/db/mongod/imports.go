@@ -0,0 +1,98 @@
+package mongod
+
+import (
+	"context"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (u dbStore) CreateUsers(ctx context.Context, payload []*models.User) error {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(payload))
+	for _, user := range payload {
+		documents = append(documents, user)
+	}
+
+	if _, err := u.userCollection().InsertMany(ctx, documents); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (u dbStore) FindExistingUsers(ctx context.Context, emails, phones []string) ([]*models.User, error) {
+	opts := options.Find().SetProjection(bson.M{"userid": true, "email": true, "phone": true})
+
+	cursor, err := u.userCollection().Find(ctx, bson.M{
+		"$or": []bson.M{
+			{"email": bson.M{"$in": emails}},
+			{"phone": bson.M{"$in": phones}},
+		},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (u dbStore) StreamUsers(ctx context.Context, filters models.ExportUserFilter, fn func(user *models.User) error) error {
+	opts := options.Find().
+		SetProjection(bson.M{"password": false, "token": false}).
+		SetSort(bson.M{"createdat": 1}).
+		SetBatchSize(500)
+
+	filter := bson.M{}
+	if filters.Status != nil && filters.Status.IsValid() {
+		filter["status"] = filters.Status.String()
+	}
+	if filters.Iso2 != nil {
+		filter["iso2"] = *filters.Iso2
+	}
+	if filters.UserType != nil {
+		filter["usertype"] = *filters.UserType
+	}
+
+	createdAt := bson.M{}
+	if filters.CreatedFrom != nil {
+		createdAt["$gte"] = *filters.CreatedFrom
+	}
+	if filters.CreatedTo != nil {
+		createdAt["$lt"] = *filters.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		filter["createdat"] = createdAt
+	}
+
+	cursor, err := u.userCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/fredele20/microservice-practice/ms.users/db"
@@ -15,8 +18,10 @@ import (
 )
 
 type dbStore struct {
-	client         *mongo.Client
-	dbName         string
+	client *mongo.Client
+	dbName string
+	// transactions is false on a standalone server, which rejects them
+	transactions bool
 }
 
 func MongoConnection(connectionUri, databaseName string) (db.UserStore, error) {
@@ -32,17 +37,65 @@ func MongoConnection(connectionUri, databaseName string) (db.UserStore, error) {
 
 	fmt.Println("connected to mongodb successfully....")
 
-	return &dbStore{client: client, dbName: databaseName}, nil
+	transactions := supportsTransactions(ctx, client)
+	if !transactions {
+		log.Println("mongodb is a standalone server, writes spanning several documents run without transactions. Run a replica set in production, see DATABASE_URL in .env")
+	}
+
+	store := &dbStore{client: client, dbName: databaseName, transactions: transactions}
+	if err := store.ensureUserIndexes(ctx); err != nil {
+		log.Println("failed to create user indexes: ", err)
+	}
+	if err := store.ensureOrganizationIndexes(ctx); err != nil {
+		log.Println("failed to create organization indexes: ", err)
+	}
+
+	return store, nil
+}
+
+// supportsTransactions reports whether the server is a replica set member
+// or a mongos, standalone servers reject transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello); err != nil {
+		// the transactions report the error themselves
+		return true
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
 }
 
 func (u dbStore) userCollection() *mongo.Collection {
 	return u.client.Database(u.dbName).Collection("users")
 }
 
+// ensureUserIndexes makes emails and phones unique, the users without a
+// phone are left out of its index.
+func (u dbStore) ensureUserIndexes(ctx context.Context) error {
+	_, err := u.userCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName("user_email").SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "phone", Value: 1}},
+			Options: options.Index().SetName("user_phone").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"phone": bson.M{"$gt": ""}}),
+		},
+	})
+	return err
+}
+
 func (u dbStore) SessionCollection() *mongo.Collection {
 	return u.client.Database(u.dbName).Collection("session")
 }
 
+func (u dbStore) auditCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("audit_logs")
+}
+
 func (u dbStore) GetUserByField(ctx context.Context, field, value string) (*models.User, error) {
 	var user models.User
 	if err := u.userCollection().FindOne(ctx, bson.M{field: value}).Decode(&user); err != nil {
@@ -63,6 +116,26 @@ func (u dbStore) GetUserById(ctx context.Context, id string) (*models.User, erro
 	return u.GetUserByField(ctx, "userid", id)
 }
 
+func (u dbStore) GetUsersByIds(ctx context.Context, ids []string) ([]*models.User, error) {
+	opts := options.Find()
+	opts.SetProjection(bson.M{
+		"password": false,
+		"token":    false,
+	})
+
+	cursor, err := u.userCollection().Find(ctx, bson.M{"userid": bson.M{"$in": ids}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 func (u dbStore) ListUsers(ctx context.Context, filters models.ListUserFilter) (*models.UserList, error) {
 	opts := options.Find()
 	opts.SetProjection(bson.M{
@@ -111,7 +184,7 @@ func (u dbStore) UpdateUser(ctx context.Context, payload *models.User) (*models.
 	payload.UpdatedAt = updatedAt
 	var user models.User
 	if err := u.userCollection().FindOneAndUpdate(ctx, bson.M{"userid": payload.UserId}, bson.M{
-		"$set": payload,
+		"$set": nonZeroFields(payload),
 	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user); err != nil {
 		return nil, err
 	}
@@ -132,7 +205,7 @@ func (u dbStore) ResetPassword(ctx context.Context, id, password string) (*model
 }
 
 func (u dbStore) DeleteUser(ctx context.Context, id string) error {
-	if _, err := u.userCollection().DeleteOne(ctx, bson.M{"userId": id}); err != nil {
+	if _, err := u.userCollection().DeleteOne(ctx, bson.M{"userid": id}); err != nil {
 		return err
 	}
 
@@ -157,11 +230,103 @@ func (u dbStore) CreateUser(ctx context.Context, payload *models.User) (*models.
 		return nil, ErrDuplicate
 	}
 
+	// the unique indexes catch the users created since the check
 	if _, err := u.userCollection().InsertOne(ctx, payload); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrDuplicate
+		}
 		return nil, err
 	}
 
 	return payload, nil
 }
 
+func (u dbStore) SetActiveOrganization(ctx context.Context, userId, organizationId string) error {
+	if _, err := u.userCollection().UpdateOne(ctx, bson.M{"userid": userId}, bson.M{
+		"$set": bson.M{"activeorganizationid": organizationId},
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetUserAvatar replaces the avatar of a user, a nil avatar removes it.
+func (u dbStore) SetUserAvatar(ctx context.Context, userId, pictureURL string, avatar *models.Avatar) (*models.User, error) {
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	var user models.User
+	if err := u.userCollection().FindOneAndUpdate(ctx, bson.M{"userid": userId}, bson.M{
+		"$set": bson.M{"pictureurl": pictureURL, "avatar": avatar, "updatedat": updatedAt},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// ListUsersByPictureURLPrefix returns at most limit users without an
+// uploaded avatar whose PictureURL starts with prefix.
+func (u dbStore) ListUsersByPictureURLPrefix(ctx context.Context, prefix string, limit int64) ([]*models.User, error) {
+	cursor, err := u.userCollection().Find(ctx, bson.M{
+		"avatar":     nil,
+		"pictureurl": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)},
+	}, options.Find().SetProjection(bson.M{"password": false, "token": false}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// ReplacePictureURL sets the PictureURL of a user without an uploaded
+// avatar from one URL to another. It returns mongo.ErrNoDocuments when the
+// user changed their picture in the meantime.
+func (u dbStore) ReplacePictureURL(ctx context.Context, userId, from, to string) (*models.User, error) {
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	var user models.User
+	if err := u.userCollection().FindOneAndUpdate(ctx, bson.M{"userid": userId, "pictureurl": from, "avatar": nil}, bson.M{
+		"$set": bson.M{"pictureurl": to, "updatedat": updatedAt},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (u dbStore) CreateAuditLog(ctx context.Context, payload *models.AuditLog) error {
+	if _, err := u.auditCollection().InsertOne(ctx, payload); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// nonZeroFields returns the fields of payload that are set, keyed by their
+// bson name, so that updates only overwrite the fields they carry.
+func nonZeroFields(payload interface{}) bson.M {
+	fields := bson.M{}
+	value := reflect.Indirect(reflect.ValueOf(payload))
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() || value.Field(i).IsZero() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("bson"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = value.Field(i).Interface()
+	}
+	return fields
+}
+
 var ErrDuplicate = errors.New("duplicate record")
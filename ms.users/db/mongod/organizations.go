@@ -0,0 +1,220 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (u dbStore) organizationCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("organizations")
+}
+
+func (u dbStore) membershipCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("memberships")
+}
+
+func (u dbStore) invitationCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("invitations")
+}
+
+// ensureOrganizationIndexes makes a user a member of an organization once.
+func (u dbStore) ensureOrganizationIndexes(ctx context.Context) error {
+	_, err := u.membershipCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "organizationid", Value: 1}, {Key: "userid", Value: 1}},
+		Options: options.Index().SetName("membership_user").SetUnique(true),
+	})
+	return err
+}
+
+func (u dbStore) CreateOrganization(ctx context.Context, payload *models.Organization) (*models.Organization, error) {
+	if _, err := u.organizationCollection().InsertOne(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (u dbStore) GetOrganizationById(ctx context.Context, id string) (*models.Organization, error) {
+	var organization models.Organization
+	if err := u.organizationCollection().FindOne(ctx, bson.M{"organizationid": id}).Decode(&organization); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (u dbStore) ListOrganizationsByIds(ctx context.Context, ids []string) (*models.OrganizationList, error) {
+	filter := bson.M{"organizationid": bson.M{"$in": ids}}
+
+	cursor, err := u.organizationCollection().Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	organizations := []*models.Organization{}
+	if err := cursor.All(ctx, &organizations); err != nil {
+		return nil, err
+	}
+
+	return &models.OrganizationList{
+		Count: int64(len(organizations)),
+		Data:  organizations,
+	}, nil
+}
+
+func (u dbStore) SetOrganizationOwner(ctx context.Context, id, ownerId string) (*models.Organization, error) {
+	var organization models.Organization
+	if err := u.organizationCollection().FindOneAndUpdate(ctx, bson.M{"organizationid": id}, bson.M{
+		"$set": bson.M{"ownerid": ownerId, "updatedat": time.Now()},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&organization); err != nil {
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
+func (u dbStore) CreateMembership(ctx context.Context, payload *models.Membership) (*models.Membership, error) {
+	var membership models.Membership
+	if err := u.membershipCollection().FindOne(ctx, bson.M{
+		"organizationid": payload.OrganizationId,
+		"userid":         payload.UserId,
+	}).Decode(&membership); err == nil {
+		return nil, ErrDuplicate
+	}
+
+	// the unique index catches the memberships created since the check
+	if _, err := u.membershipCollection().InsertOne(ctx, payload); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrDuplicate
+		}
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (u dbStore) GetMembership(ctx context.Context, organizationId, userId string) (*models.Membership, error) {
+	var membership models.Membership
+	if err := u.membershipCollection().FindOne(ctx, bson.M{
+		"organizationid": organizationId,
+		"userid":         userId,
+	}).Decode(&membership); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (u dbStore) listMemberships(ctx context.Context, filter bson.M) (*models.MembershipList, error) {
+	cursor, err := u.membershipCollection().Find(ctx, filter, options.Find().SetSort(bson.M{"createdat": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := []*models.Membership{}
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+
+	return &models.MembershipList{
+		Count: int64(len(memberships)),
+		Data:  memberships,
+	}, nil
+}
+
+func (u dbStore) ListMemberships(ctx context.Context, organizationId string) (*models.MembershipList, error) {
+	return u.listMemberships(ctx, bson.M{"organizationid": organizationId})
+}
+
+func (u dbStore) ListMembershipsByUser(ctx context.Context, userId string) (*models.MembershipList, error) {
+	return u.listMemberships(ctx, bson.M{"userid": userId})
+}
+
+func (u dbStore) UpdateMembershipRole(ctx context.Context, organizationId, userId string, role models.OrganizationRole) (*models.Membership, error) {
+	var membership models.Membership
+	if err := u.membershipCollection().FindOneAndUpdate(ctx, bson.M{
+		"organizationid": organizationId,
+		"userid":         userId,
+	}, bson.M{
+		"$set": bson.M{"role": role, "updatedat": time.Now()},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&membership); err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+func (u dbStore) DeleteMembership(ctx context.Context, organizationId, userId string) error {
+	if _, err := u.membershipCollection().DeleteOne(ctx, bson.M{
+		"organizationid": organizationId,
+		"userid":         userId,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u dbStore) CreateInvitation(ctx context.Context, payload *models.Invitation) (*models.Invitation, error) {
+	if _, err := u.invitationCollection().InsertOne(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (u dbStore) GetInvitationByToken(ctx context.Context, token string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := u.invitationCollection().FindOne(ctx, bson.M{"token": token}).Decode(&invitation); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (u dbStore) listInvitations(ctx context.Context, filter bson.M) (*models.InvitationList, error) {
+	cursor, err := u.invitationCollection().Find(ctx, filter, options.Find().SetSort(bson.M{"createdat": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := []*models.Invitation{}
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+
+	return &models.InvitationList{
+		Count: int64(len(invitations)),
+		Data:  invitations,
+	}, nil
+}
+
+func (u dbStore) ListInvitations(ctx context.Context, organizationId string) (*models.InvitationList, error) {
+	return u.listInvitations(ctx, bson.M{"organizationid": organizationId})
+}
+
+func (u dbStore) ListPendingInvitationsByEmail(ctx context.Context, email string) (*models.InvitationList, error) {
+	return u.listInvitations(ctx, bson.M{
+		"email":     email,
+		"status":    models.InvitationPending,
+		"expiresat": bson.M{"$gt": time.Now()},
+	})
+}
+
+// RespondToInvitation moves a pending invitation to status, it fails with
+// mongo.ErrNoDocuments when the invitation was already responded to.
+func (u dbStore) RespondToInvitation(ctx context.Context, token string, status models.InvitationStatus) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := u.invitationCollection().FindOneAndUpdate(ctx, bson.M{
+		"token":  token,
+		"status": models.InvitationPending,
+	}, bson.M{
+		"$set": bson.M{"status": status, "respondedat": time.Now()},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&invitation); err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
@@ -0,0 +1,111 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (u dbStore) outboxCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("outbox")
+}
+
+// WithTransaction runs fn in a transaction. On a standalone server fn runs
+// without one, its writes are then not atomic.
+func (u dbStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !u.transactions {
+		return fn(ctx)
+	}
+
+	session, err := u.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
+func (u dbStore) InsertOutboxMessages(ctx context.Context, events ...models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		messages = append(messages, models.OutboxMessage{
+			ID:        primitive.NewObjectID(),
+			Event:     event,
+			Status:    models.OutboxPending,
+			CreatedAt: now,
+		})
+	}
+
+	if _, err := u.outboxCollection().InsertMany(ctx, messages); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u dbStore) ClaimOutboxMessages(ctx context.Context, limit int64, lockFor time.Duration) ([]*models.OutboxMessage, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var messages []*models.OutboxMessage
+	for i := int64(0); i < limit; i++ {
+		now := time.Now()
+
+		var message models.OutboxMessage
+		err := u.outboxCollection().FindOneAndUpdate(ctx, bson.M{
+			"status":      models.OutboxPending,
+			"lockeduntil": bson.M{"$lt": now},
+		}, bson.M{
+			"$set": bson.M{"lockeduntil": now.Add(lockFor)},
+		}, opts).Decode(&message)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return messages, err
+		}
+
+		messages = append(messages, &message)
+	}
+
+	return messages, nil
+}
+
+func (u dbStore) MarkOutboxMessageDelivered(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := u.outboxCollection().UpdateOne(ctx, bson.M{"id": id}, bson.M{
+		"$set": bson.M{"status": models.OutboxDelivered, "deliveredat": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkOutboxMessageFailed records the failure, the message stays pending and
+// is retried once its lock expires.
+func (u dbStore) MarkOutboxMessageFailed(ctx context.Context, id primitive.ObjectID, reason string) error {
+	if _, err := u.outboxCollection().UpdateOne(ctx, bson.M{"id": id}, bson.M{
+		"$set": bson.M{"lasterror": reason},
+		"$inc": bson.M{"attempts": 1},
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (u dbStore) signupInviteCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("signup_invites")
+}
+
+func (u dbStore) CreateSignupInvite(ctx context.Context, payload *models.SignupInvite) (*models.SignupInvite, error) {
+	if _, err := u.signupInviteCollection().InsertOne(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (u dbStore) ListSignupInvites(ctx context.Context) (*models.SignupInviteList, error) {
+	cursor, err := u.signupInviteCollection().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdat": -1}))
+	if err != nil {
+		return nil, err
+	}
+
+	invites := []*models.SignupInvite{}
+	if err := cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+
+	return &models.SignupInviteList{
+		Count: int64(len(invites)),
+		Data:  invites,
+	}, nil
+}
+
+func (u dbStore) RevokeSignupInvite(ctx context.Context, id string, revokedAt time.Time) (*models.SignupInvite, error) {
+	var invite models.SignupInvite
+	if err := u.signupInviteCollection().FindOneAndUpdate(ctx, bson.M{"inviteid": id, "revokedat": nil}, bson.M{
+		"$set": bson.M{"revokedat": revokedAt},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&invite); err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+func (u dbStore) RedeemSignupInvite(ctx context.Context, code, email string, now time.Time) (*models.SignupInvite, error) {
+	filter := bson.M{
+		"code":      code,
+		"revokedat": nil,
+		"$and": []bson.M{
+			{"$or": []bson.M{{"expiresat": nil}, {"expiresat": bson.M{"$gt": now}}}},
+			{"$or": []bson.M{{"maxuses": 0}, {"$expr": bson.M{"$lt": []string{"$uses", "$maxuses"}}}}},
+			{"$or": []bson.M{{"email": ""}, {"email": email}}},
+		},
+	}
+
+	var invite models.SignupInvite
+	if err := u.signupInviteCollection().FindOneAndUpdate(ctx, filter, bson.M{
+		"$inc": bson.M{"uses": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&invite); err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
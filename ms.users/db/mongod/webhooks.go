@@ -0,0 +1,241 @@
+package mongod
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxDeliveryAttemptsKept bounds the attempt history stored on a delivery
+const maxDeliveryAttemptsKept = 20
+
+func (u dbStore) webhookCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("webhooks")
+}
+
+func (u dbStore) webhookDeliveryCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("webhook_deliveries")
+}
+
+func (u dbStore) webhookDeadLetterCollection() *mongo.Collection {
+	return u.client.Database(u.dbName).Collection("webhook_dead_letters")
+}
+
+func (u dbStore) CreateWebhook(ctx context.Context, payload *models.Webhook) (*models.Webhook, error) {
+	if _, err := u.webhookCollection().InsertOne(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (u dbStore) GetWebhookById(ctx context.Context, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := u.webhookCollection().FindOne(ctx, bson.M{"webhookid": id}).Decode(&webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (u dbStore) findWebhooks(ctx context.Context, filter bson.M) ([]*models.Webhook, error) {
+	cursor, err := u.webhookCollection().Find(ctx, filter, options.Find().SetSort(bson.M{"createdat": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []*models.Webhook{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (u dbStore) ListWebhooks(ctx context.Context) (*models.WebhookList, error) {
+	webhooks, err := u.findWebhooks(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookList{
+		Count: int64(len(webhooks)),
+		Data:  webhooks,
+	}, nil
+}
+
+func (u dbStore) ListActiveWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	return u.findWebhooks(ctx, bson.M{"active": true})
+}
+
+func (u dbStore) UpdateWebhook(ctx context.Context, id string, payload models.UpdateWebhookRequest) (*models.Webhook, error) {
+	fields := bson.M{"updatedat": time.Now()}
+	if payload.URL != nil {
+		fields["url"] = *payload.URL
+	}
+	if payload.Description != nil {
+		fields["description"] = *payload.Description
+	}
+	if payload.Events != nil {
+		fields["events"] = *payload.Events
+	}
+	if payload.Active != nil {
+		fields["active"] = *payload.Active
+	}
+
+	var webhook models.Webhook
+	if err := u.webhookCollection().FindOneAndUpdate(ctx, bson.M{"webhookid": id}, bson.M{
+		"$set": fields,
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&webhook); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func (u dbStore) DeleteWebhook(ctx context.Context, id string) error {
+	result, err := u.webhookCollection().DeleteOne(ctx, bson.M{"webhookid": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (u dbStore) CreateWebhookDeliveries(ctx context.Context, deliveries ...*models.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		filter := bson.M{
+			"webhookid":     delivery.WebhookId,
+			"event.eventid": delivery.Event.EventId,
+			"replayof":      "",
+		}
+		// Replays are explicit requests, each of them is a new delivery.
+		if delivery.ReplayOf != "" {
+			filter = bson.M{"deliveryid": delivery.DeliveryId}
+		}
+
+		if _, err := u.webhookDeliveryCollection().UpdateOne(ctx, filter, bson.M{
+			"$setOnInsert": delivery,
+		}, options.Update().SetUpsert(true)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u dbStore) GetWebhookDeliveryById(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := u.webhookDeliveryCollection().FindOne(ctx, bson.M{"deliveryid": id}).Decode(&delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (u dbStore) findDeliveries(ctx context.Context, collection *mongo.Collection, filter bson.M, limit int64) (*models.WebhookDeliveryList, error) {
+	opts := options.Find().SetSort(bson.M{"createdat": -1})
+	if limit != 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookDeliveryList{
+		Count: count,
+		Data:  deliveries,
+	}, nil
+}
+
+func (u dbStore) ListWebhookDeliveries(ctx context.Context, filters models.WebhookDeliveryFilter) (*models.WebhookDeliveryList, error) {
+	filter := bson.M{}
+	if filters.WebhookId != "" {
+		filter["webhookid"] = filters.WebhookId
+	}
+	if filters.Status != nil && filters.Status.IsValid() {
+		filter["status"] = *filters.Status
+	}
+
+	return u.findDeliveries(ctx, u.webhookDeliveryCollection(), filter, filters.Limit)
+}
+
+func (u dbStore) ClaimDueDeliveries(ctx context.Context, limit int64, lockFor time.Duration) ([]*models.WebhookDelivery, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"nextattemptat": 1}).
+		SetReturnDocument(options.After)
+
+	var deliveries []*models.WebhookDelivery
+	for i := int64(0); i < limit; i++ {
+		now := time.Now()
+
+		var delivery models.WebhookDelivery
+		err := u.webhookDeliveryCollection().FindOneAndUpdate(ctx, bson.M{
+			"status":        models.DeliveryPending,
+			"nextattemptat": bson.M{"$lte": now},
+		}, bson.M{
+			"$set": bson.M{"nextattemptat": now.Add(lockFor)},
+		}, opts).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return deliveries, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (u dbStore) RecordDeliveryAttempt(ctx context.Context, id string, attempt models.DeliveryAttempt, status models.DeliveryStatus, nextAttemptAt time.Time) (*models.WebhookDelivery, error) {
+	fields := bson.M{"status": status, "nextattemptat": nextAttemptAt}
+	if status == models.DeliverySucceeded {
+		fields["deliveredat"] = attempt.AttemptedAt
+	}
+
+	var delivery models.WebhookDelivery
+	if err := u.webhookDeliveryCollection().FindOneAndUpdate(ctx, bson.M{"deliveryid": id}, bson.M{
+		"$set": fields,
+		"$inc": bson.M{"attemptcount": 1},
+		"$push": bson.M{"attempts": bson.M{
+			"$each":  []models.DeliveryAttempt{attempt},
+			"$slice": -maxDeliveryAttemptsKept,
+		}},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&delivery); err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (u dbStore) CreateDeadLetter(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if _, err := u.webhookDeadLetterCollection().InsertOne(ctx, delivery); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u dbStore) ListDeadLetters(ctx context.Context, limit int64) (*models.WebhookDeliveryList, error) {
+	return u.findDeliveries(ctx, u.webhookDeadLetterCollection(), bson.M{}, limit)
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/go-redis/redis/v8"
+)
+
+// Broker delivers user lifecycle events to other services.
+type Broker interface {
+	Publish(ctx context.Context, event models.Event) error
+}
+
+// RedisStreamBroker appends every event to a Redis stream, consumers read
+// it with consumer groups.
+type RedisStreamBroker struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamBroker(address, stream string) *RedisStreamBroker {
+	client := redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: "",
+		DB:       0,
+	})
+
+	return &RedisStreamBroker{
+		client: client,
+		stream: stream,
+		maxLen: 100000,
+	}
+}
+
+func (r *RedisStreamBroker) Publish(ctx context.Context, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.stream,
+		MaxLen: r.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"eventId": event.EventId,
+			"type":    event.Type.String(),
+			"userId":  event.UserId,
+			"payload": payload,
+		},
+	}).Err()
+}
+
+// MemoryBroker keeps published events in memory, it is meant for tests and
+// local runs without Redis.
+type MemoryBroker struct {
+	mu     sync.RWMutex
+	events []models.Event
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (m *MemoryBroker) Publish(ctx context.Context, event models.Event) error {
+	m.mu.Lock()
+	m.events = append(m.events, event)
+	m.mu.Unlock()
+	return nil
+}
+
+// Events returns a copy of every event published so far.
+func (m *MemoryBroker) Events() []models.Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make([]models.Event, len(m.events))
+	copy(events, m.events)
+	return events
+}
+
+func (m *MemoryBroker) Reset() {
+	m.mu.Lock()
+	m.events = nil
+	m.mu.Unlock()
+}
+
+// MultiBroker publishes every event to each of its brokers. An event only
+// counts as published once every broker accepted it, and it is published
+// again to all of them otherwise, so brokers must tolerate duplicates.
+type MultiBroker []Broker
+
+func (m MultiBroker) Publish(ctx context.Context, event models.Event) error {
+	for _, broker := range m {
+		if err := broker.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
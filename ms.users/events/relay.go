@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/db"
+	"github.com/sirupsen/logrus"
+)
+
+// Relay moves events from the outbox collection to the broker. Several
+// relays can run at once, messages are locked while they are delivered.
+// Delivery is at least once, consumers should dedupe on the event id.
+type Relay struct {
+	store     db.OutboxStore
+	broker    Broker
+	logger    *logrus.Logger
+	interval  time.Duration
+	batchSize int64
+	lockFor   time.Duration
+}
+
+func NewRelay(store db.OutboxStore, broker Broker, logger *logrus.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		broker:    broker,
+		logger:    logger,
+		interval:  time.Second,
+		batchSize: 100,
+		lockFor:   time.Second * 30,
+	}
+}
+
+// Run relays events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep draining without waiting while the outbox is backed up.
+		if r.RelayBatch(ctx) == r.batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch delivers one batch of pending events and returns how many
+// messages were claimed.
+func (r *Relay) RelayBatch(ctx context.Context) int64 {
+	messages, err := r.store.ClaimOutboxMessages(ctx, r.batchSize, r.lockFor)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to claim outbox messages")
+	}
+
+	for _, message := range messages {
+		if err := r.broker.Publish(ctx, message.Event); err != nil {
+			r.logger.WithError(err).WithField("eventId", message.Event.EventId).Error("failed to publish event")
+			if err := r.store.MarkOutboxMessageFailed(ctx, message.ID, err.Error()); err != nil {
+				r.logger.WithError(err).Error("failed to record outbox delivery failure")
+			}
+			continue
+		}
+
+		if err := r.store.MarkOutboxMessageDelivered(ctx, message.ID); err != nil {
+			r.logger.WithError(err).Error("failed to mark outbox message as delivered")
+		}
+	}
+
+	return int64(len(messages))
+}
@@ -0,0 +1,208 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryOutbox is an OutboxStore keeping its messages in memory, with the
+// locking rules of the mongo store.
+type memoryOutbox struct {
+	mu       sync.Mutex
+	messages []*models.OutboxMessage
+}
+
+func (m *memoryOutbox) InsertOutboxMessages(ctx context.Context, events ...models.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, event := range events {
+		m.messages = append(m.messages, &models.OutboxMessage{
+			ID:        primitive.NewObjectID(),
+			Event:     event,
+			Status:    models.OutboxPending,
+			CreatedAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+func (m *memoryOutbox) ClaimOutboxMessages(ctx context.Context, limit int64, lockFor time.Duration) ([]*models.OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var claimed []*models.OutboxMessage
+	for _, message := range m.messages {
+		if int64(len(claimed)) == limit {
+			break
+		}
+		if message.Status == models.OutboxPending && message.LockedUntil.Before(now) {
+			message.LockedUntil = now.Add(lockFor)
+			copied := *message
+			claimed = append(claimed, &copied)
+		}
+	}
+	return claimed, nil
+}
+
+func (m *memoryOutbox) MarkOutboxMessageDelivered(ctx context.Context, id primitive.ObjectID) error {
+	return m.update(id, func(message *models.OutboxMessage) {
+		now := time.Now()
+		message.Status = models.OutboxDelivered
+		message.DeliveredAt = &now
+	})
+}
+
+func (m *memoryOutbox) MarkOutboxMessageFailed(ctx context.Context, id primitive.ObjectID, reason string) error {
+	return m.update(id, func(message *models.OutboxMessage) {
+		message.Attempts++
+		message.LastError = reason
+	})
+}
+
+func (m *memoryOutbox) update(id primitive.ObjectID, fn func(message *models.OutboxMessage)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, message := range m.messages {
+		if message.ID == id {
+			fn(message)
+			return nil
+		}
+	}
+	return errors.New("unknown outbox message")
+}
+
+func (m *memoryOutbox) statuses() []models.OutboxStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]models.OutboxStatus, 0, len(m.messages))
+	for _, message := range m.messages {
+		statuses = append(statuses, message.Status)
+	}
+	return statuses
+}
+
+// failingBroker fails to publish the events of userId.
+type failingBroker struct {
+	userId string
+}
+
+func (f failingBroker) Publish(ctx context.Context, event models.Event) error {
+	if event.UserId == f.userId {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func newTestRelay(store *memoryOutbox, broker Broker) *Relay {
+	relay := NewRelay(store, broker, logrus.New())
+	relay.batchSize = 2
+	return relay
+}
+
+func events(userIds ...string) []models.Event {
+	events := make([]models.Event, 0, len(userIds))
+	for _, userId := range userIds {
+		events = append(events, models.Event{EventId: primitive.NewObjectID().Hex(), Type: models.EventUserCreated, UserId: userId})
+	}
+	return events
+}
+
+func TestRelayBatch(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryOutbox{}
+	broker := NewMemoryBroker()
+	if err := store.InsertOutboxMessages(ctx, events("u1", "u2", "u3")...); err != nil {
+		t.Fatal(err)
+	}
+	relay := newTestRelay(store, broker)
+
+	tests := []struct {
+		claimed   int64
+		published int
+	}{
+		{claimed: 2, published: 2},
+		{claimed: 1, published: 3},
+		{claimed: 0, published: 3},
+	}
+	for i, tt := range tests {
+		if claimed := relay.RelayBatch(ctx); claimed != tt.claimed {
+			t.Errorf("batch %d: claimed %d messages, want %d", i, claimed, tt.claimed)
+		}
+		if published := len(broker.Events()); published != tt.published {
+			t.Errorf("batch %d: published %d events, want %d", i, published, tt.published)
+		}
+	}
+
+	for i, event := range broker.Events() {
+		if want := []string{"u1", "u2", "u3"}[i]; event.UserId != want {
+			t.Errorf("event %d is for %s, want %s", i, event.UserId, want)
+		}
+	}
+	for _, status := range store.statuses() {
+		if status != models.OutboxDelivered {
+			t.Errorf("message status = %s, want %s", status, models.OutboxDelivered)
+		}
+	}
+}
+
+func TestRelayBatchRetriesFailedEvents(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryOutbox{}
+	if err := store.InsertOutboxMessages(ctx, events("u1", "u2")...); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed event stays locked for lockFor before it is retried
+	relay := newTestRelay(store, failingBroker{userId: "u2"})
+	relay.lockFor = 0
+	relay.RelayBatch(ctx)
+	if statuses := store.statuses(); statuses[0] != models.OutboxDelivered || statuses[1] != models.OutboxPending {
+		t.Fatalf("statuses = %v, want the failed event left pending", statuses)
+	}
+
+	broker := NewMemoryBroker()
+	newTestRelay(store, broker).RelayBatch(ctx)
+	if published := broker.Events(); len(published) != 1 || published[0].UserId != "u2" {
+		t.Errorf("published %v, want the failed event only", published)
+	}
+	if store.messages[1].Attempts != 1 || store.messages[1].LastError == "" {
+		t.Errorf("the failed attempt was not recorded: %+v", store.messages[1])
+	}
+}
+
+func TestMultiBroker(t *testing.T) {
+	ctx := context.Background()
+	first, last := NewMemoryBroker(), NewMemoryBroker()
+
+	tests := []struct {
+		name    string
+		brokers MultiBroker
+		wantErr bool
+		last    int
+	}{
+		{name: "all accept", brokers: MultiBroker{first, last}, last: 1},
+		{name: "one fails", brokers: MultiBroker{first, failingBroker{userId: "u1"}, last}, wantErr: true, last: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first.Reset()
+			last.Reset()
+
+			err := tt.brokers.Publish(ctx, events("u1")[0])
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Publish error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(first.Events()) != 1 || len(last.Events()) != tt.last {
+				t.Errorf("first got %d events, last got %d, want 1 and %d", len(first.Events()), len(last.Events()), tt.last)
+			}
+		})
+	}
+}
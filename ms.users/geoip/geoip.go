@@ -0,0 +1,162 @@
+// Package geoip resolves IP addresses to coarse locations from an offline
+// database file, so that logins can be located without calling an external
+// service.
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+)
+
+// Locator resolves an IP address to a location, ok is false when the
+// address is unknown.
+type Locator interface {
+	Locate(ip net.IP) (location *models.Location, ok bool)
+}
+
+// NoopLocator never resolves any address, it is used when no database file
+// is configured.
+type NoopLocator struct{}
+
+func (NoopLocator) Locate(ip net.IP) (*models.Location, bool) {
+	return nil, false
+}
+
+type network struct {
+	start    []byte
+	end      []byte
+	location *models.Location
+}
+
+// Database is a Locator reading a CSV file with one network per line:
+//
+//	network,iso2,city,latitude,longitude
+//	41.58.0.0/16,NG,Lagos,6.4541,3.3947
+//
+// The header line is optional. Networks must not overlap.
+type Database struct {
+	networks []network
+}
+
+func Open(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+func Load(r io.Reader) (*Database, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 5
+	reader.ReuseRecord = true
+
+	var networks []network
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				// header
+				continue
+			}
+			return nil, fmt.Errorf("geoip line %d: %w", line, err)
+		}
+
+		latitude, errLat := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		longitude, errLon := strconv.ParseFloat(strings.TrimSpace(record[4]), 64)
+		if errLat != nil || errLon != nil {
+			return nil, fmt.Errorf("geoip line %d: invalid coordinates", line)
+		}
+
+		start := normalize(ipNet.IP)
+		mask := ipNet.Mask
+		if ones, bits := mask.Size(); bits == 32 {
+			// IPv4 addresses are compared in their IPv6 mapped form
+			mask = net.CIDRMask(96+ones, 128)
+		}
+		end := make([]byte, net.IPv6len)
+		for i := range start {
+			end[i] = start[i] | ^mask[i]
+		}
+
+		networks = append(networks, network{
+			start: start,
+			end:   end,
+			location: &models.Location{
+				Iso2:      strings.ToUpper(strings.TrimSpace(record[1])),
+				City:      strings.TrimSpace(record[2]),
+				Latitude:  latitude,
+				Longitude: longitude,
+			},
+		})
+	}
+
+	if len(networks) == 0 {
+		return nil, errors.New("geoip database is empty")
+	}
+
+	sort.Slice(networks, func(i, j int) bool {
+		return bytes.Compare(networks[i].start, networks[j].start) < 0
+	})
+
+	return &Database{networks: networks}, nil
+}
+
+func (d *Database) Locate(ip net.IP) (*models.Location, bool) {
+	key := normalize(ip)
+	if key == nil {
+		return nil, false
+	}
+
+	// the last network starting at or before ip is the only candidate
+	i := sort.Search(len(d.networks), func(i int) bool {
+		return bytes.Compare(d.networks[i].start, key) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(key, d.networks[i].end) > 0 {
+		return nil, false
+	}
+
+	location := *d.networks[i].location
+	return &location, true
+}
+
+func normalize(ip net.IP) []byte {
+	if ip16 := ip.To16(); ip16 != nil {
+		return ip16
+	}
+	return nil
+}
+
+// Distance returns the great circle distance between two locations in
+// kilometers.
+func Distance(a, b *models.Location) float64 {
+	const earthRadius = 6371.0
+
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
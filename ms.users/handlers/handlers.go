@@ -1,31 +1,106 @@
 package handlers
 
 import (
+	"github.com/fredele20/microservice-practice/ms.users/libs/ratelimit"
+	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/fredele20/microservice-practice/ms.users/middlewares"
 	"github.com/fredele20/microservice-practice/ms.users/routes"
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler struct {
-	routes *routes.UserRoutes
+	routes        *routes.UserRoutes
+	session       *session.SessionManager
+	serviceTokens map[string]string
+	limiter       *ratelimit.Limiter
 }
 
-func NewUserHandler(routes *routes.UserRoutes) *UserHandler {
+func NewUserHandler(routes *routes.UserRoutes, session *session.SessionManager, serviceTokens map[string]string, limiter *ratelimit.Limiter) *UserHandler {
 	return &UserHandler{
-		routes: routes,
+		routes:        routes,
+		session:       session,
+		serviceTokens: serviceTokens,
+		limiter:       limiter,
 	}
 }
 
 func UserRoutes(incomingRoutes *gin.Engine, u UserHandler) {
 	// incomingRoutes.Use(middleware.Authenticate())
 	incomingRoutes.GET("/users", u.routes.ListUsers())
+	incomingRoutes.PATCH("/users/:user_id", middlewares.Authentication(u.session), u.routes.UpdateUser())
+	incomingRoutes.POST("/users/:user_id/avatar", middlewares.Authentication(u.session), u.routes.UploadAvatar())
+	incomingRoutes.DELETE("/users/:user_id/avatar", middlewares.Authentication(u.session), u.routes.RemoveAvatar())
+	incomingRoutes.GET("/users/:user_id/consents", middlewares.Authentication(u.session), u.routes.ListConsents())
+	incomingRoutes.PUT("/users/:user_id/consents/marketing", middlewares.Authentication(u.session), middlewares.DenyImpersonation(u.session), u.routes.UpdateMarketingConsents())
+	incomingRoutes.GET("/users/:user_id/devices", middlewares.Authentication(u.session), u.routes.ListDevices())
+	incomingRoutes.DELETE("/users/:user_id/devices/:device_id", middlewares.Authentication(u.session), u.routes.ForgetDevice())
+	incomingRoutes.GET("/legal-documents", u.routes.CurrentLegalDocuments())
 	// incomingRoutes.GET("/users")
 	// incomingRoutes.GET("/users/:user_id", routes.GetUserById())
 }
 
+// AvatarRoutes are public, avatars are embedded in pages without credentials.
+func AvatarRoutes(incomingRoutes *gin.Engine, u UserHandler) {
+	incomingRoutes.GET("/avatars/initials.svg", u.routes.InitialsAvatar())
+	incomingRoutes.GET("/avatars/initials.png", u.routes.InitialsAvatarPNG())
+	incomingRoutes.GET("/files/*key", u.routes.AvatarFile())
+}
+
 func AuthRoutes(incomingRoutes *gin.Engine, u UserHandler) {
 	incomingRoutes.POST("users/signup", u.routes.Signup())
-	incomingRoutes.POST("users/login", u.routes.Login())
+	incomingRoutes.POST("users/login", u.limiter.Route("users.login", ratelimit.ByIP), u.routes.Login())
+	incomingRoutes.POST("users/login/verify", u.limiter.Route("users.login-verify", ratelimit.ByIP), u.routes.VerifyLogin())
+	incomingRoutes.POST("users/accept-terms", u.limiter.Route("users.accept-terms", ratelimit.ByIP), u.routes.AcceptTerms())
 	incomingRoutes.DELETE("users/logout", u.routes.Logout())
-	incomingRoutes.POST("users/forgot-password", u.routes.ForgotPassword())
-	incomingRoutes.POST("users/reset-password", u.routes.ResetPassword())
+	incomingRoutes.POST("users/forgot-password", u.limiter.Route("users.forgot-password", ratelimit.ByIP), u.routes.ForgotPassword())
+	incomingRoutes.POST("users/reset-password", middlewares.DenyImpersonation(u.session), u.routes.ResetPassword())
+}
+
+func OrganizationRoutes(incomingRoutes *gin.Engine, u UserHandler) {
+	organizations := incomingRoutes.Group("organizations", middlewares.Authentication(u.session))
+	organizations.POST("", u.routes.CreateOrganization())
+	organizations.GET("", u.routes.ListOrganizations())
+	organizations.GET("/:org_id", u.routes.GetOrganization())
+	organizations.GET("/:org_id/members", u.routes.ListOrganizationMembers())
+	organizations.PATCH("/:org_id/members/:user_id", u.routes.UpdateOrganizationMember())
+	organizations.DELETE("/:org_id/members/:user_id", u.routes.RemoveOrganizationMember())
+	organizations.POST("/:org_id/invitations", u.routes.InviteOrganizationMember())
+	organizations.GET("/:org_id/invitations", u.routes.ListOrganizationInvitations())
+	organizations.POST("/:org_id/transfer-ownership", u.routes.TransferOrganizationOwnership())
+	organizations.POST("/:org_id/switch", u.routes.SwitchOrganization())
+
+	invitations := incomingRoutes.Group("invitations", middlewares.Authentication(u.session))
+	invitations.GET("", u.routes.ListMyInvitations())
+	invitations.POST("/:token/accept", u.routes.AcceptInvitation())
+	invitations.POST("/:token/decline", u.routes.DeclineInvitation())
+}
+
+func AdminRoutes(incomingRoutes *gin.Engine, u UserHandler) {
+	admin := incomingRoutes.Group("admin", middlewares.Authentication(u.session))
+	admin.POST("/impersonate/:user_id", u.routes.StartImpersonation())
+	admin.DELETE("/impersonate", u.routes.EndImpersonation())
+	admin.POST("/users/import", u.routes.ImportUsers())
+	admin.GET("/users/export", u.routes.ExportUsers())
+	admin.POST("/users/:user_id/deactivate", u.routes.DeactivateUser())
+	admin.POST("/users/:user_id/activate", u.routes.ActivateUser())
+	admin.DELETE("/users/:user_id", u.routes.DeleteUser())
+	admin.POST("/legal-documents", u.routes.PublishLegalDocument())
+	admin.POST("/invites", u.routes.CreateSignupInvite())
+	admin.GET("/invites", u.routes.ListSignupInvites())
+	admin.DELETE("/invites/:invite_id", u.routes.RevokeSignupInvite())
+	admin.POST("/webhooks", u.routes.CreateWebhook())
+	admin.GET("/webhooks", u.routes.ListWebhooks())
+	admin.GET("/webhooks/:webhook_id", u.routes.GetWebhook())
+	admin.PATCH("/webhooks/:webhook_id", u.routes.UpdateWebhook())
+	admin.DELETE("/webhooks/:webhook_id", u.routes.DeleteWebhook())
+	admin.GET("/webhooks/:webhook_id/deliveries", u.routes.ListWebhookDeliveries())
+	admin.GET("/webhook-deliveries", u.routes.ListWebhookDeliveries())
+	admin.GET("/webhook-deliveries/dead-letters", u.routes.ListWebhookDeadLetters())
+	admin.POST("/webhook-deliveries/:delivery_id/replay", u.routes.ReplayWebhookDelivery())
+}
+
+// InternalRoutes are only reachable by other services of the platform.
+func InternalRoutes(incomingRoutes *gin.Engine, u UserHandler) {
+	internal := incomingRoutes.Group("internal", middlewares.ServiceAuthentication(u.serviceTokens))
+	internal.POST("/users/lookup", u.routes.LookupUsers())
 }
@@ -0,0 +1,151 @@
+// Package blob stores binary objects such as uploaded images behind a small
+// interface, so that the local filesystem store used in development can be
+// swapped for an object storage without touching the services.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store keeps objects under slash separated keys such as
+// "avatars/<userId>/<version>/small.jpg".
+type Store interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader) error
+	// Open returns the content of key and its content type, the caller
+	// must close it.
+	Open(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes every object whose key starts with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+	// URL returns the public URL of key.
+	URL(key string) string
+}
+
+// LocalStore keeps objects as files under a root directory. It is served
+// back by the application itself, baseURL is the URL of that handler.
+type LocalStore struct {
+	root    string
+	baseURL string
+}
+
+func NewLocalStore(root, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+// CleanKey normalises key and rejects keys escaping the store, such as
+// "../config" or absolute paths.
+func CleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	cleaned := path.Clean(key)
+	if key == "" || cleaned == "." || cleaned != key || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
+
+func (l *LocalStore) path(key string) (string, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes body to a temporary file first, so that readers never see a
+// partially written object.
+func (l *LocalStore) Put(ctx context.Context, key, contentType string, body io.Reader) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (l *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", ErrNotFound
+		}
+		return nil, "", err
+	}
+
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		file.Close()
+		return nil, "", ErrNotFound
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return file, contentType, nil
+}
+
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalStore) DeletePrefix(ctx context.Context, prefix string) error {
+	name, err := l.path(strings.TrimSuffix(prefix, "/"))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(name)
+}
+
+func (l *LocalStore) URL(key string) string {
+	return l.baseURL + "/" + strings.TrimPrefix(key, "/")
+}
@@ -0,0 +1,169 @@
+// Package imaging validates uploaded images and produces resized copies of
+// them. Uploads are identified by sniffing their content, never by the
+// content type or file name sent by the client.
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrTooLarge        = errors.New("image is too large")
+	ErrUnsupportedType = errors.New("unsupported image type, you must provide a jpeg, png, gif or webp image")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+	ErrInvalidImage    = errors.New("failed to decode image")
+)
+
+// SupportedTypes are the sniffed content types accepted by Decode.
+var SupportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type Limits struct {
+	// MaxBytes is the maximum size of the upload
+	MaxBytes int64
+	// MaxPixels bounds width*height, it protects the server from small
+	// files that decode into huge images
+	MaxPixels int
+}
+
+var DefaultLimits = Limits{
+	MaxBytes:  5 << 20,
+	MaxPixels: 40_000_000,
+}
+
+// Decode reads at most limits.MaxBytes from r, checks the sniffed content
+// type and the image dimensions, and decodes it. It returns the image and
+// its sniffed content type.
+func Decode(r io.Reader, limits Limits) (image.Image, string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !SupportedTypes[contentType] {
+		return nil, "", ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > limits.MaxPixels {
+		return nil, "", ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+
+	return img, contentType, nil
+}
+
+// Fit scales img down so that it fits in a width x height box, keeping its
+// aspect ratio. Images already smaller than the box are returned as is.
+func Fit(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width && bounds.Dy() <= height {
+		return img
+	}
+
+	w, h := width, bounds.Dy()*width/bounds.Dx()
+	if h > height {
+		w, h = bounds.Dx()*height/bounds.Dy(), height
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// Square crops the center of img into a square and scales it to size x
+// size pixels.
+func Square(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+
+	crop := image.Rect(0, 0, side, side).Add(image.Point{
+		X: bounds.Min.X + (bounds.Dx()-side)/2,
+		Y: bounds.Min.Y + (bounds.Dy()-side)/2,
+	})
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// Encode writes img as contentType. Only jpeg and png are produced, other
+// types are converted to png since they may carry transparency.
+func Encode(w io.Writer, img image.Image, contentType string) (string, error) {
+	buffered := bufio.NewWriter(w)
+
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(buffered, img, &jpeg.Options{Quality: 85})
+	default:
+		contentType = "image/png"
+		err = png.Encode(buffered, img)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return contentType, buffered.Flush()
+}
+
+// Extension returns the file extension of the content types produced by
+// Encode.
+func Extension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ""
+	}
+}
+
+// OutputType returns the content type Encode produces for an image sniffed
+// as contentType.
+func OutputType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
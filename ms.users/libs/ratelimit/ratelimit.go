@@ -0,0 +1,299 @@
+// Package ratelimit limits how often clients can call routes, with the
+// counters kept in Redis so that every instance of a service shares them.
+// It is used by ms.users and ms.products.
+//
+// Limiters fail open: while Redis can not be reached every request is let
+// through and logged at error level, so an outage of Redis removes the
+// limits, including the ones on login and password resets, instead of
+// taking the services down. Alert on those logs.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrTooManyRequests = errors.New("Too many requests, please try again later")
+
+type Algorithm string
+
+const (
+	// SlidingWindow allows Requests per Period over any window of Period,
+	// it is exact and suits low limits such as login attempts.
+	SlidingWindow Algorithm = "sliding"
+	// TokenBucket refills Requests tokens per Period and allows bursts of
+	// up to Requests, it suits higher limits.
+	TokenBucket Algorithm = "bucket"
+)
+
+type Limit struct {
+	Requests  int
+	Period    time.Duration
+	Algorithm Algorithm
+}
+
+// Limits maps route names to their limit.
+type Limits map[string]Limit
+
+// ParseLimits reads limits written as a comma separated list of
+// name=requests/period[:algorithm], for example
+// "users.login=5/1m,products.create=30/1m:bucket". The algorithm defaults
+// to sliding.
+func ParseLimits(value string) (Limits, error) {
+	limits := Limits{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, spec, found := strings.Cut(item, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid rate limit %q", item)
+		}
+
+		spec, algorithm, found := strings.Cut(spec, ":")
+		if !found {
+			algorithm = string(SlidingWindow)
+		}
+
+		requests, period, found := strings.Cut(spec, "/")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit %q", item)
+		}
+
+		limit := Limit{Algorithm: Algorithm(algorithm)}
+		var err error
+		if limit.Requests, err = strconv.Atoi(requests); err != nil || limit.Requests < 1 {
+			return nil, fmt.Errorf("invalid rate limit %q: requests must be a positive number", item)
+		}
+		if limit.Period, err = time.ParseDuration(period); err != nil || limit.Period <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q: period must be a duration such as 1m", item)
+		}
+		if limit.Algorithm != SlidingWindow && limit.Algorithm != TokenBucket {
+			return nil, fmt.Errorf("invalid rate limit %q: algorithm must be sliding or bucket", item)
+		}
+
+		limits[strings.TrimSpace(name)] = limit
+	}
+
+	return limits, nil
+}
+
+// Merge returns defaults overridden by the limits of overrides.
+func (l Limits) Merge(overrides Limits) Limits {
+	merged := Limits{}
+	for name, limit := range l {
+		merged[name] = limit
+	}
+	for name, limit := range overrides {
+		merged[name] = limit
+	}
+	return merged
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit allows a request again, or until
+	// it is fully restored when the request was allowed
+	Reset time.Duration
+}
+
+// slidingWindowScript keeps the timestamp of every allowed request of the
+// window in a sorted set.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+
+local reset = window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+return {allowed, limit - count, reset}
+`)
+
+// tokenBucketScript stores the tokens left and the time they were counted,
+// tokens are refilled lazily on every call.
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', key, math.ceil((capacity - tokens) / rate) + 1000)
+
+local reset
+if allowed == 1 then
+	reset = math.ceil((capacity - tokens) / rate)
+else
+	reset = math.ceil((1 - tokens) / rate)
+end
+
+return {allowed, math.floor(tokens), reset}
+`)
+
+type Limiter struct {
+	client redis.UniversalClient
+	limits Limits
+	prefix string
+	logger *logrus.Logger
+}
+
+// NewLimiter returns a Limiter applying limits, with its counters stored in
+// the Redis server at address under keys starting with prefix.
+func NewLimiter(address, prefix string, limits Limits, logger *logrus.Logger) *Limiter {
+	client := redis.NewClient(&redis.Options{
+		Addr:     address,
+		Password: "",
+		DB:       0,
+	})
+
+	return &Limiter{
+		client: client,
+		limits: limits,
+		prefix: prefix,
+		logger: logger,
+	}
+}
+
+// Allow counts one request of key against limit.
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	now := time.Now().UnixMilli()
+	period := limit.Period.Milliseconds()
+	redisKey := fmt.Sprintf("%s:ratelimit:%s", l.prefix, key)
+
+	var values []interface{}
+	var err error
+	switch limit.Algorithm {
+	case TokenBucket:
+		rate := float64(limit.Requests) / float64(period)
+		values, err = tokenBucketScript.Run(ctx, l.client, []string{redisKey}, limit.Requests, strconv.FormatFloat(rate, 'f', -1, 64), now).Slice()
+	default:
+		member := fmt.Sprintf("%d-%d", now, rand.Int63())
+		values, err = slidingWindowScript.Run(ctx, l.client, []string{redisKey}, now, period, limit.Requests, member).Slice()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	reset, _ := values[2].(int64)
+
+	return &Result{
+		Allowed:   allowed == 1,
+		Limit:     limit.Requests,
+		Remaining: int(remaining),
+		Reset:     time.Duration(reset) * time.Millisecond,
+	}, nil
+}
+
+// KeyFunc returns the identity a request is counted against.
+type KeyFunc func(c *gin.Context) string
+
+// ByIP counts requests per client IP. The IP is only read from forwarding
+// headers set by trusted proxies, see TrustProxies.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// TrustProxies makes router read the client IP from the X-Forwarded-For and
+// X-Real-IP headers only on requests coming from proxies, a list of IPs or
+// CIDRs. Gin trusts every peer by default, which would let a client pick its
+// own IP and so its rate limit key. Without proxies the peer address is
+// used.
+func TrustProxies(router *gin.Engine, proxies []string) error {
+	if len(proxies) == 0 {
+		proxies = nil
+	}
+	return router.SetTrustedProxies(proxies)
+}
+
+// ByContextValue counts requests per value of key set on the context by the
+// authentication middleware, such as the user id, and per IP for requests
+// without it.
+func ByContextValue(key string) KeyFunc {
+	return func(c *gin.Context) string {
+		if value := c.GetString(key); value != "" {
+			return key + ":" + value
+		}
+		return ByIP(c)
+	}
+}
+
+// Route limits the requests to the route named name, it does nothing when
+// no limit is configured for name. Redis errors let requests through, see
+// the package documentation.
+func (l *Limiter) Route(name string, key KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := l.limits[name]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		result, err := l.Allow(c.Request.Context(), name+":"+key(c), limit)
+		if err != nil {
+			l.logger.WithError(err).WithField("route", name).Error("failed to apply rate limit, the request is let through without a limit")
+			c.Next()
+			return
+		}
+
+		reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", reset)
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Period.Seconds())))
+
+		if !result.Allowed {
+			c.Header("Retry-After", reset)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": ErrTooManyRequests.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
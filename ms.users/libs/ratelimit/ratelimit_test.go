@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Limits
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: Limits{}},
+		{
+			name:  "sliding by default",
+			value: "users.login=5/1m",
+			want:  Limits{"users.login": {Requests: 5, Period: time.Minute, Algorithm: SlidingWindow}},
+		},
+		{
+			name:  "several limits",
+			value: " users.login=5/1m , products.create=30/1m:bucket,",
+			want: Limits{
+				"users.login":     {Requests: 5, Period: time.Minute, Algorithm: SlidingWindow},
+				"products.create": {Requests: 30, Period: time.Minute, Algorithm: TokenBucket},
+			},
+		},
+		{name: "no name", value: "=5/1m", wantErr: true},
+		{name: "no period", value: "users.login=5", wantErr: true},
+		{name: "no requests", value: "users.login=0/1m", wantErr: true},
+		{name: "invalid period", value: "users.login=5/minute", wantErr: true},
+		{name: "unknown algorithm", value: "users.login=5/1m:fixed", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimits(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimits(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLimits(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteFailsOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, hook := test.NewNullLogger()
+
+	// nothing listens on the address, so every call to Redis fails
+	limiter := NewLimiter("127.0.0.1:1", "test", Limits{
+		"users.login": {Requests: 1, Period: time.Minute, Algorithm: SlidingWindow},
+	}, logger)
+
+	router := gin.New()
+	router.POST("/login", limiter.Route("users.login", ByIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, http.StatusOK)
+		}
+	}
+
+	if len(hook.Entries) != 3 {
+		t.Fatalf("logged %d entries, want 3", len(hook.Entries))
+	}
+	for _, entry := range hook.Entries {
+		if entry.Level != logrus.ErrorLevel {
+			t.Errorf("logged at %s, want %s", entry.Level, logrus.ErrorLevel)
+		}
+	}
+}
+
+func TestByIPTrustProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "no proxy", remoteAddr: "203.0.113.7:4000", want: "ip:203.0.113.7"},
+		{
+			name:       "spoofed forwarded for",
+			remoteAddr: "203.0.113.7:4000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "ip:203.0.113.7",
+		},
+		{
+			name:       "spoofed real ip",
+			remoteAddr: "203.0.113.7:4000",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.1"},
+			want:       "ip:203.0.113.7",
+		},
+		{
+			name:       "spoofed through an untrusted peer",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "203.0.113.7:4000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "ip:203.0.113.7",
+		},
+		{
+			name:       "forwarded by a trusted proxy",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.2:4000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			want:       "ip:198.51.100.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := TrustProxies(router, tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			var key string
+			router.GET("/", func(c *gin.Context) {
+				key = ByIP(c)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				request.Header.Set(name, value)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), request)
+
+			if key != tt.want {
+				t.Errorf("ByIP() = %q, want %q", key, tt.want)
+			}
+		})
+	}
+}
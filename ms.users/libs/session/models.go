@@ -20,6 +20,15 @@ type Session struct {
 	Validity       time.Duration  `json:"validity"`
 	UnitOfValidity UnitOfValidity `json:"unitOfValidity"`
 	LastUsage      time.Time      `json:"lastUsage"`
+	// Actor is the id of the admin acting on behalf of UserId, it is only
+	// set on impersonation sessions.
+	Actor string `json:"actor,omitempty"`
+	// OrganizationId is the organization the user is currently acting in.
+	OrganizationId   string `json:"organizationId,omitempty"`
+	OrganizationRole string `json:"organizationRole,omitempty"`
+	// Purpose restricts the token to a single use such as resetting a
+	// password, it is empty for sign-in sessions.
+	Purpose string `json:"purpose,omitempty"`
 }
 
 type TokenPayload struct {
@@ -28,9 +37,18 @@ type TokenPayload struct {
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
 	Role      string `json:"client"`
+	Actor     string `json:"actor,omitempty"`
+	// OrganizationId is the active organization of the user
+	OrganizationId   string `json:"organizationId,omitempty"`
+	OrganizationRole string `json:"organizationRole,omitempty"`
+	// Purpose is set on tokens that do not authenticate requests
+	Purpose string `json:"purpose,omitempty"`
 	jwt.Payload
 }
 
+// PurposeResetPassword marks the tokens sent to reset a password.
+const PurposeResetPassword = "reset-password"
+
 const (
 	UnitOfValidityMinute UnitOfValidity = "MINUTE"
 	UnitOfValidityHour   UnitOfValidity = "HOUR"
@@ -46,15 +64,7 @@ func (u UnitOfValidity) IsValid() bool {
 
 func (sm *Session) AssertValidity() error {
 	now := time.Now().Unix()
-	lastUsage := sm.LastUsage
-	uV := sm.UnitOfValidity
-	var validity int64 = 0
-	switch uV {
-	case UnitOfValidityHour:
-		validity = lastUsage.Add(time.Hour * sm.Validity).Unix()
-	case UnitOfValidityMinute:
-		validity = lastUsage.Add(time.Minute * sm.Validity).Unix()
-	}
+	validity := sm.LastUsage.Add(sm.ValidityDuration()).Unix()
 
 	if now > validity {
 		return ErrTokenExpired
@@ -62,6 +72,28 @@ func (sm *Session) AssertValidity() error {
 	return nil
 }
 
+// ValidityDuration converts Validity and UnitOfValidity into a time.Duration.
+func (sm *Session) ValidityDuration() time.Duration {
+	switch sm.UnitOfValidity {
+	case UnitOfValidityHour:
+		return time.Hour * sm.Validity
+	case UnitOfValidityMinute:
+		return time.Minute * sm.Validity
+	}
+	return 0
+}
+
+// IsImpersonation reports whether the session was started by an admin on
+// behalf of another user.
+func (sm *Session) IsImpersonation() bool {
+	return sm != nil && sm.Actor != ""
+}
+
+// IsImpersonation reports whether the token was issued for an impersonation session.
+func (p *TokenPayload) IsImpersonation() bool {
+	return p != nil && p.Actor != ""
+}
+
 func (u UnitOfValidity) String() string {
 	return string(u)
 }
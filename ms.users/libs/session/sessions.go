@@ -14,6 +14,7 @@ import (
 	"github.com/gbrlsnchs/jwt/v3"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var (
@@ -21,6 +22,8 @@ var (
 	ErrTokenExpired          = errors.New("sorry, session has expired. Please login again to continue")
 	ErrTokenSessionNotFound  = errors.New("session not found or destroyed")
 	ErrInvalidUnitOfValidity = errors.New("invalid unit of validity, you must provide HOUR or MINUTE")
+	ErrSessionIsImpersonated = errors.New("this action is not allowed during an impersonation session")
+	ErrTokenPurpose          = errors.New("this token can not be used to sign in")
 )
 
 type SessionManager struct {
@@ -36,19 +39,26 @@ func NewSessionManager(cache cache.RedisStore, db db.UserStore) *SessionManager
 	}
 }
 
-func generateToken(userId, role, email, firstName, lastName string) string {
+func generateToken(s *Session, expiresAt time.Time) string {
 	payload := &TokenPayload{
-		Role:      role,
-		UserId:    userId,
-		Email:     email,
-		FirstName: firstName,
-		LastName:  lastName,
+		Role:             s.Role,
+		UserId:           s.UserId,
+		Email:            s.Email,
+		FirstName:        s.FirstName,
+		LastName:         s.LastName,
+		Actor:            s.Actor,
+		OrganizationId:   s.OrganizationId,
+		OrganizationRole: s.OrganizationRole,
+		Purpose:          s.Purpose,
 		Payload: jwt.Payload{
-			Issuer:   "Golang",
-			Subject:  "Golang JWT",
-			Audience: jwt.Audience{""},
-			IssuedAt: jwt.NumericDate(time.Now()),
-			JWTID:    "Golang JWT Auth",
+			Issuer:         "Golang",
+			Subject:        "Golang JWT",
+			Audience:       jwt.Audience{""},
+			IssuedAt:       jwt.NumericDate(time.Now()),
+			ExpirationTime: jwt.NumericDate(expiresAt),
+			// every token is unique, so that ending a session never ends
+			// another one issued in the same second
+			JWTID: primitive.NewObjectID().Hex(),
 		},
 	}
 
@@ -109,25 +119,80 @@ func verifyAuthToken(token string) (*TokenPayload, error) {
 	return &payloadBody, nil
 }
 
-func newSession(userId, role, email, firstName, lastName string, validity time.Duration, unitOfValidity UnitOfValidity) *Session {
-	token := generateToken(userId, role, email, firstName, lastName)
-	return &Session{
-		Token:          token,
-		Role:           role,
-		UserId:         userId,
-		Validity:       validity,
-		LastUsage:      time.Now(),
-		UnitOfValidity: unitOfValidity,
-		TimeCreated:    time.Now(),
+// VerifyToken checks the signature of a token and that it has not expired
+// yet, tokens without an expiry are rejected.
+func (sm SessionManager) VerifyToken(token string) (*TokenPayload, error) {
+	if strings.TrimSpace(token) == "" {
+		return nil, ErrTokenInvalid
+	}
+
+	payload, err := verifyAuthToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.ExpirationTime == nil || time.Now().After(payload.ExpirationTime.Time) {
+		return nil, ErrTokenExpired
+	}
+
+	return payload, nil
+}
+
+// GetSession returns the session stored in the cache under the token itself.
+func (sm SessionManager) GetSession(ctx context.Context, token string) (*Session, error) {
+	result, err := sm.cache.Get(ctx, token)
+	if err != nil {
+		return nil, ErrTokenSessionNotFound
+	}
+
+	var session Session
+	if err := json.Unmarshal(result, &session); err != nil {
+		return nil, ErrTokenSessionNotFound
+	}
+
+	if err := session.AssertValidity(); err != nil {
+		return nil, err
 	}
+
+	return &session, nil
 }
 
+func newSession(payload Session) *Session {
+	now := time.Now()
+	s := &Session{
+		Role:             payload.Role,
+		UserId:           payload.UserId,
+		Email:            payload.Email,
+		FirstName:        payload.FirstName,
+		LastName:         payload.LastName,
+		Validity:         payload.Validity,
+		LastUsage:        now,
+		UnitOfValidity:   payload.UnitOfValidity,
+		TimeCreated:      now,
+		Actor:            payload.Actor,
+		OrganizationId:   payload.OrganizationId,
+		OrganizationRole: payload.OrganizationRole,
+		Purpose:          payload.Purpose,
+	}
+
+	// Tokens are hard limited, a token stops being valid once the session
+	// validity is over even if it is still cached.
+	s.Token = generateToken(s, now.Add(s.ValidityDuration()))
+	return s
+}
+
+// CreateSession generates a token for the payload and caches the session
+// under key. When key is empty, the session is cached under the token itself.
 func (sm *SessionManager) CreateSession(ctx context.Context, key string, duration time.Duration, payload Session) (string, error) {
 
 	if !payload.UnitOfValidity.IsValid() {
 		return "", ErrInvalidUnitOfValidity
 	}
-	s := newSession(payload.UserId, payload.Role, payload.Email, payload.FirstName, payload.LastName, payload.Validity, payload.UnitOfValidity)
+	s := newSession(payload)
+
+	if key == "" {
+		key = s.Token
+	}
 
 	_, err := sm.cache.Set(ctx, key, s.Byte(), duration)
 	if err != nil {
@@ -138,10 +203,9 @@ func (sm *SessionManager) CreateSession(ctx context.Context, key string, duratio
 	return s.Token, nil
 }
 
-func (sm *SessionManager) DestroySession(token string) error {
+func (sm *SessionManager) DestroySession(ctx context.Context, token string) error {
 
-	// Delete session from the DB
-	var ctx context.Context
+	// Delete session from the cache
 	err := sm.cache.Del(ctx, token)
 	if err != nil {
 		logrus.WithError(err).Error("session with the token not found")
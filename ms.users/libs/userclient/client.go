@@ -0,0 +1,279 @@
+// Package userclient is the client other services use to resolve users
+// through the internal API of ms.users. It is part of the ms.users module,
+// so importers require that module, but the package only depends on the
+// standard library and does not link the rest of ms.users into them.
+package userclient
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLookupFailed = errors.New("failed to lookup users from ms.users")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+const (
+	StatusActivated   = "activated"
+	StatusDeactivated = "deactivated"
+
+	// maxBatchSize matches the limit enforced by the lookup endpoint
+	maxBatchSize = 100
+	// defaultCacheSize is the number of users and unknown ids cached by
+	// default
+	defaultCacheSize = 10000
+)
+
+type User struct {
+	UserId     string `json:"userId"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	PictureURL string `json:"pictureURL"`
+	Status     string `json:"status"`
+}
+
+func (u User) FullName() string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+func (u User) IsActive() bool {
+	return u.Status == StatusActivated
+}
+
+type lookupRequest struct {
+	Ids []string `json:"ids"`
+}
+
+type lookupResponse struct {
+	Data    []*User  `json:"data"`
+	Missing []string `json:"missing"`
+}
+
+type cacheEntry struct {
+	id        string
+	user      *User
+	expiresAt time.Time
+}
+
+type Client struct {
+	baseURL      string
+	serviceToken string
+	httpClient   *http.Client
+	ttl          time.Duration
+	missingTTL   time.Duration
+
+	// the cache keeps up to cacheSize entries, the least recently used
+	// are dropped first
+	mu        sync.Mutex
+	cacheSize int
+	recent    *list.List
+	cache     map[string]*list.Element
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http client, which times out after 5 seconds.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCacheTTL sets how long found users and unknown ids are cached.
+func WithCacheTTL(ttl, missingTTL time.Duration) Option {
+	return func(c *Client) {
+		c.ttl = ttl
+		c.missingTTL = missingTTL
+	}
+}
+
+// WithCacheSize sets how many users and unknown ids are cached, 10000 by
+// default. A size of 0 disables the cache.
+func WithCacheSize(size int) Option {
+	return func(c *Client) {
+		c.cacheSize = size
+	}
+}
+
+func New(baseURL, serviceToken string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		serviceToken: serviceToken,
+		httpClient:   &http.Client{Timeout: time.Second * 5},
+		ttl:          time.Minute,
+		missingTTL:   time.Second * 10,
+		cacheSize:    defaultCacheSize,
+		recent:       list.New(),
+		cache:        map[string]*list.Element{},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// GetUser returns a single user, ErrUserNotFound is returned for unknown ids.
+func (c *Client) GetUser(ctx context.Context, id string) (*User, error) {
+	users, err := c.LookupUsers(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+// LookupUsers resolves ids to users, keyed by user id. Cached users are
+// served from memory and the rest are fetched in batches. Unknown ids are
+// left out of the result.
+func (c *Client) LookupUsers(ctx context.Context, ids []string) (map[string]*User, error) {
+	result := map[string]*User{}
+	missing := []string{}
+
+	now := time.Now()
+	c.mu.Lock()
+	for _, id := range ids {
+		if _, done := result[id]; done {
+			continue
+		}
+		entry, ok := c.cached(id)
+		if !ok || now.After(entry.expiresAt) {
+			missing = append(missing, id)
+			continue
+		}
+		if entry.user != nil {
+			result[id] = entry.user
+		}
+	}
+	c.mu.Unlock()
+
+	missing = unique(missing)
+	for start := 0; start < len(missing); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		users, err := c.fetch(ctx, missing[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		for id, user := range users {
+			result[id] = user
+		}
+	}
+
+	return result, nil
+}
+
+// Invalidate drops a user from the cache, for example after receiving an
+// event telling that the user changed.
+func (c *Client) Invalidate(id string) {
+	c.mu.Lock()
+	if element, ok := c.cache[id]; ok {
+		c.recent.Remove(element)
+		delete(c.cache, id)
+	}
+	c.mu.Unlock()
+}
+
+// cached returns the entry of id and marks it as recently used, c.mu must
+// be held.
+func (c *Client) cached(id string) (*cacheEntry, bool) {
+	element, ok := c.cache[id]
+	if !ok {
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return element.Value.(*cacheEntry), true
+}
+
+// store caches entry and drops the least recently used entries past the
+// size of the cache, c.mu must be held.
+func (c *Client) store(entry *cacheEntry) {
+	if element, ok := c.cache[entry.id]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+	} else {
+		c.cache[entry.id] = c.recent.PushFront(entry)
+	}
+
+	for c.recent.Len() > c.cacheSize {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.cache, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+func (c *Client) fetch(ctx context.Context, ids []string) (map[string]*User, error) {
+	body, err := json.Marshal(lookupRequest{Ids: ids})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/internal/users/lookup", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Service-Token", c.serviceToken)
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLookupFailed, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %d", ErrLookupFailed, response.StatusCode)
+	}
+
+	var payload lookupResponse
+	if err := json.NewDecoder(response.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLookupFailed, err)
+	}
+
+	users := map[string]*User{}
+	now := time.Now()
+
+	c.mu.Lock()
+	for _, user := range payload.Data {
+		users[user.UserId] = user
+		c.store(&cacheEntry{id: user.UserId, user: user, expiresAt: now.Add(c.ttl)})
+	}
+	for _, id := range payload.Missing {
+		c.store(&cacheEntry{id: id, expiresAt: now.Add(c.missingTTL)})
+	}
+	c.mu.Unlock()
+
+	return users, nil
+}
+
+func unique(ids []string) []string {
+	seen := map[string]bool{}
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
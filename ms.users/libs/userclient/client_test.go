@@ -0,0 +1,105 @@
+package userclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newTestServer serves the lookup endpoint for the users in known and
+// records the ids of every lookup.
+func newTestServer(t *testing.T, known ...string) (*httptest.Server, *[][]string) {
+	t.Helper()
+	var lookups [][]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request lookupRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decoding lookup: %v", err)
+		}
+		lookups = append(lookups, request.Ids)
+
+		var response lookupResponse
+		for _, id := range request.Ids {
+			found := false
+			for _, user := range known {
+				if user == id {
+					found = true
+				}
+			}
+			if found {
+				response.Data = append(response.Data, &User{UserId: id, Status: StatusActivated})
+			} else {
+				response.Missing = append(response.Missing, id)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &lookups
+}
+
+func TestLookupUsersCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheSize int
+		calls     [][]string
+		// want is the ids looked up from ms.users
+		want [][]string
+	}{
+		{
+			name:      "cached",
+			cacheSize: 10,
+			calls:     [][]string{{"a", "b"}, {"b", "a"}},
+			want:      [][]string{{"a", "b"}},
+		},
+		{
+			name:      "unknown ids cached",
+			cacheSize: 10,
+			calls:     [][]string{{"a", "x"}, {"x"}},
+			want:      [][]string{{"a", "x"}},
+		},
+		{
+			name:      "least recently used dropped",
+			cacheSize: 2,
+			calls:     [][]string{{"a", "b"}, {"a"}, {"c"}, {"a"}, {"b"}},
+			want:      [][]string{{"a", "b"}, {"c"}, {"b"}},
+		},
+		{
+			name:      "cache disabled",
+			cacheSize: 0,
+			calls:     [][]string{{"a"}, {"a"}},
+			want:      [][]string{{"a"}, {"a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, lookups := newTestServer(t, "a", "b", "c")
+			client := New(server.URL, "token", WithCacheSize(tt.cacheSize))
+
+			for _, ids := range tt.calls {
+				users, err := client.LookupUsers(context.Background(), ids)
+				if err != nil {
+					t.Fatalf("LookupUsers(%v) error = %v", ids, err)
+				}
+				for _, id := range ids {
+					if _, ok := users[id]; ok == (id == "x") {
+						t.Errorf("LookupUsers(%v) found %s = %v", ids, id, ok)
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(*lookups, tt.want) {
+				t.Errorf("lookups = %v, want %v", *lookups, tt.want)
+			}
+			if client.recent.Len() > tt.cacheSize || len(client.cache) > tt.cacheSize {
+				t.Errorf("cache holds %d entries, want at most %d", client.recent.Len(), tt.cacheSize)
+			}
+		})
+	}
+}
@@ -1,17 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/fredele20/microservice-practice/ms.users/avatars"
 	"github.com/fredele20/microservice-practice/ms.users/cache"
 	"github.com/fredele20/microservice-practice/ms.users/config"
 	"github.com/fredele20/microservice-practice/ms.users/core"
 	"github.com/fredele20/microservice-practice/ms.users/db/mongod"
+	"github.com/fredele20/microservice-practice/ms.users/events"
+	"github.com/fredele20/microservice-practice/ms.users/geoip"
 	"github.com/fredele20/microservice-practice/ms.users/handlers"
+	"github.com/fredele20/microservice-practice/ms.users/libs/blob"
+	"github.com/fredele20/microservice-practice/ms.users/libs/ratelimit"
 	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/fredele20/microservice-practice/ms.users/notifier"
 	"github.com/fredele20/microservice-practice/ms.users/routes"
+	"github.com/fredele20/microservice-practice/ms.users/webhooks"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -26,6 +36,52 @@ func main() {
 	}
 	address := fmt.Sprintf("127.0.0.1:%s", secrets.Port)
 
+	var mailer notifier.Notifier = notifier.NewLogNotifier(logger)
+	if secrets.SMTPHost != "" {
+		mailer = notifier.NewSMTPNotifier(secrets.SMTPHost, secrets.SMTPPort, secrets.SMTPUsername, secrets.SMTPPassword, secrets.MailFrom)
+	}
+
+	blobs, err := blob.NewLocalStore(secrets.BlobDir, secrets.PublicURL+"/files")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signup := models.SignupPolicy{
+		Mode:           models.SignupMode(secrets.SignupMode),
+		AllowedDomains: secrets.SignupAllowedDomains,
+		DeniedDomains:  secrets.SignupDeniedDomains,
+	}
+	if !signup.Mode.IsValid() {
+		log.Fatalf("invalid SIGNUP_MODE %q, you must provide open or invite_only", secrets.SignupMode)
+	}
+
+	var locator geoip.Locator = geoip.NoopLocator{}
+	if secrets.GeoIPDatabase != "" {
+		database, err := geoip.Open(secrets.GeoIPDatabase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		locator = database
+	}
+
+	session := session.NewSessionManager(redis, db)
+	core := core.NewUserService(redis, db, *session, logger, mailer, avatars.NewAvatars(blobs, secrets.PublicURL), signup, locator, secrets.LoginStepUp)
+
+	if ok, err := runCommand(core, os.Args[1:]); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	migrateCtx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	if migrated, err := core.MigratePictureURLs(migrateCtx); err != nil {
+		logger.WithError(err).Error("failed to migrate picture urls")
+	} else if migrated > 0 {
+		logger.WithField("records", migrated).Info("migrated picture urls")
+	}
+	cancel()
+
 	fileLogger := "logs.log"
 
 	logFile, err := os.OpenFile(fileLogger, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
@@ -41,16 +97,38 @@ func main() {
 
 	log.Println("log file created")
 
+	var broker events.Broker = events.NewRedisStreamBroker(secrets.RedisAddress, secrets.EventStream)
+	if secrets.EventBroker == "memory" {
+		broker = events.NewMemoryBroker()
+	}
+
+	relay := events.NewRelay(db, events.MultiBroker{broker, webhooks.NewDispatcher(db)}, logger)
+	go relay.Run(context.Background())
+	go webhooks.NewWorker(db, logger).Run(context.Background())
+
 	router := gin.New()
 	router.Use(gin.Logger())
+	if err := ratelimit.TrustProxies(router, secrets.TrustedProxies); err != nil {
+		log.Fatal(err)
+	}
 
-	session := session.NewSessionManager(redis, db)
-	core := core.NewUserService(redis, db, *session, logger)
 	routes := routes.NewUserRoute(core)
-	handler := handlers.NewUserHandler(routes)
+	limits := ratelimit.Limits{
+		"users.login":           {Requests: 10, Period: time.Minute, Algorithm: ratelimit.SlidingWindow},
+		"users.login-verify":    {Requests: 10, Period: time.Minute, Algorithm: ratelimit.SlidingWindow},
+		"users.accept-terms":    {Requests: 10, Period: time.Minute, Algorithm: ratelimit.SlidingWindow},
+		"users.forgot-password": {Requests: 5, Period: time.Minute * 15, Algorithm: ratelimit.SlidingWindow},
+	}.Merge(secrets.RateLimits)
+	limiter := ratelimit.NewLimiter(secrets.RedisAddress, "ms.users", limits, logger)
+
+	handler := handlers.NewUserHandler(routes, session, secrets.ServiceTokens, limiter)
 
 	handlers.UserRoutes(router, *handler)
 	handlers.AuthRoutes(router, *handler)
+	handlers.AvatarRoutes(router, *handler)
+	handlers.OrganizationRoutes(router, *handler)
+	handlers.AdminRoutes(router, *handler)
+	handlers.InternalRoutes(router, *handler)
 
 	router.GET("/api-1", func(ctx *gin.Context) {
 		ctx.JSON(200, gin.H{"success": "Access granted for api-1"})
@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func Authentication(sm *session.SessionManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientToken := ctx.Request.Header.Get("token")
+		if clientToken == "" {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "No Authorization header provided"})
+			ctx.Abort()
+			return
+		}
+
+		claims, err := sm.VerifyToken(clientToken)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			ctx.Abort()
+			return
+		}
+
+		// tokens issued for another purpose, such as resetting a password,
+		// never authenticate a request
+		if claims.Purpose != "" {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": session.ErrTokenPurpose.Error()})
+			ctx.Abort()
+			return
+		}
+
+		// Sessions can be ended at any time by logging out or ending an
+		// impersonation, so the cached session must still exist for the
+		// token to be accepted.
+		if _, err := sm.GetSession(ctx, clientToken); err != nil {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			ctx.Abort()
+			return
+		}
+		if claims.IsImpersonation() {
+			ctx.Set("actor", claims.Actor)
+		}
+
+		ctx.Set("email", claims.Email)
+		ctx.Set("firstName", claims.FirstName)
+		ctx.Set("lastName", claims.LastName)
+		ctx.Set("uid", claims.UserId)
+		ctx.Set("user_type", claims.Role)
+		ctx.Set("organizationId", claims.OrganizationId)
+		ctx.Set("organizationRole", claims.OrganizationRole)
+		ctx.Next()
+
+		if claims.IsImpersonation() {
+			logrus.WithFields(logrus.Fields{
+				"impersonation": true,
+				"actor":         claims.Actor,
+				"userId":        claims.UserId,
+				"method":        ctx.Request.Method,
+				"path":          ctx.FullPath(),
+				"status":        ctx.Writer.Status(),
+			}).Warn("request made during impersonation session")
+		}
+	}
+}
+
+// DenyImpersonation rejects requests made with an impersonation token, it
+// guards actions such as password or 2FA changes that must only be taken by
+// the account owner.
+func DenyImpersonation(sm *session.SessionManager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clientToken := ctx.Request.Header.Get("token")
+		if clientToken == "" {
+			ctx.Next()
+			return
+		}
+
+		claims, err := sm.VerifyToken(clientToken)
+		if err == nil && claims.IsImpersonation() {
+			logrus.WithFields(logrus.Fields{
+				"impersonation": true,
+				"actor":         claims.Actor,
+				"userId":        claims.UserId,
+				"method":        ctx.Request.Method,
+				"path":          ctx.FullPath(),
+			}).Warn("restricted action attempted during impersonation session")
+
+			ctx.JSON(http.StatusForbidden, gin.H{"error": session.ErrSessionIsImpersonated.Error()})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/libs/session"
+	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/gin-gonic/gin"
+)
+
+// memoryCache keeps sessions in memory instead of redis.
+type memoryCache map[string][]byte
+
+func (m memoryCache) Set(ctx context.Context, key string, value interface{}, duration time.Duration) ([]byte, error) {
+	m[key] = value.([]byte)
+	return m[key], nil
+}
+
+func (m memoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, ok := m[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func (m memoryCache) Del(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	sessions := session.NewSessionManager(memoryCache{}, nil)
+	newToken := func(payload session.Session) string {
+		payload.Validity, payload.UnitOfValidity = 1, session.UnitOfValidityHour
+		token, err := sessions.CreateSession(ctx, "", time.Hour, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	loggedOut := newToken(session.Session{UserId: "u1", Role: "ADMIN"})
+	if err := sessions.DestroySession(ctx, loggedOut); err != nil {
+		t.Fatal(err)
+	}
+
+	// a token signed with the secret but without a session nor an expiry
+	unexpiring, err := jwt.Sign(session.TokenPayload{UserId: "u1", Role: "ADMIN"}, jwt.NewHS256([]byte("test-secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "signed in", token: newToken(session.Session{UserId: "u1", Role: "ADMIN"}), want: http.StatusOK},
+		{name: "impersonating", token: newToken(session.Session{UserId: "u1", Actor: "admin"}), want: http.StatusOK},
+		{name: "logged out", token: loggedOut, want: http.StatusUnauthorized},
+		{name: "password reset token", token: newToken(session.Session{UserId: "u1", Role: "ADMIN", Purpose: session.PurposeResetPassword}), want: http.StatusUnauthorized},
+		{name: "no expiry", token: string(unexpiring), want: http.StatusUnauthorized},
+		{name: "not a token", token: "token", want: http.StatusUnauthorized},
+		{name: "no token", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", Authentication(sessions), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("token", tt.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
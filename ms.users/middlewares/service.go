@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ServiceAuthentication guards internal endpoints, callers must present one
+// of the configured service credentials in the X-Service-Token header.
+func ServiceAuthentication(tokens map[string]string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		serviceToken := ctx.Request.Header.Get("X-Service-Token")
+		if serviceToken == "" {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "No service credential provided"})
+			ctx.Abort()
+			return
+		}
+
+		for service, token := range tokens {
+			if subtle.ConstantTimeCompare([]byte(serviceToken), []byte(token)) == 1 {
+				ctx.Set("service", service)
+				ctx.Next()
+				return
+			}
+		}
+
+		logrus.WithField("path", ctx.FullPath()).Warn("internal request with invalid service credential")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid service credential"})
+		ctx.Abort()
+	}
+}
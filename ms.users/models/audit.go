@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuditAction string
+
+const (
+	AuditImpersonationStarted AuditAction = "impersonation.started"
+	AuditImpersonationEnded   AuditAction = "impersonation.ended"
+)
+
+func (a AuditAction) String() string {
+	return string(a)
+}
+
+type AuditLog struct {
+	ID        primitive.ObjectID `bson:"id"`
+	Action    AuditAction        `json:"action"`
+	ActorId   string             `json:"actorId"`
+	UserId    string             `json:"userId"`
+	Details   string             `json:"details"`
+	CreatedAt time.Time          `json:"createdAt"`
+}
+
+type ImpersonationRequest struct {
+	// Validity of the impersonation session in minutes
+	Validity int64 `json:"validity"`
+	// Reason is recorded in the audit log
+	Reason string `json:"reason"`
+}
+
+type Impersonation struct {
+	Token     string    `json:"token"`
+	ActorId   string    `json:"actorId"`
+	UserId    string    `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type EndImpersonationRequest struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DocumentType string
+
+const (
+	DocumentTerms   DocumentType = "terms"
+	DocumentPrivacy DocumentType = "privacy"
+)
+
+func (d DocumentType) IsValid() bool {
+	switch d {
+	case DocumentTerms, DocumentPrivacy:
+		return true
+	default:
+		return false
+	}
+}
+
+// LegalDocument is a published version of the terms of service or of the
+// privacy policy, the latest published version of each type is current.
+type LegalDocument struct {
+	ID          primitive.ObjectID `bson:"id"`
+	Type        DocumentType       `json:"type"`
+	Version     string             `json:"version"`
+	URL         string             `json:"url"`
+	PublishedBy string             `json:"publishedBy"`
+	PublishedAt time.Time          `json:"publishedAt"`
+}
+
+func (d LegalDocument) Validate() error {
+	return validation.ValidateStruct(&d,
+		validation.Field(&d.Type, validation.Required, validation.In(DocumentTerms, DocumentPrivacy)),
+		validation.Field(&d.Version, validation.Required, validation.Length(1, 50)),
+		validation.Field(&d.URL, validation.Required, is.URL),
+	)
+}
+
+type MarketingChannel string
+
+const (
+	MarketingEmail MarketingChannel = "email"
+	MarketingSMS   MarketingChannel = "sms"
+	MarketingPush  MarketingChannel = "push"
+)
+
+func (m MarketingChannel) IsValid() bool {
+	switch m {
+	case MarketingEmail, MarketingSMS, MarketingPush:
+		return true
+	default:
+		return false
+	}
+}
+
+// AcceptedDocument is the version of a legal document a user last accepted.
+type AcceptedDocument struct {
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+type MarketingConsent struct {
+	Granted   bool      `json:"granted"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Consents is the current consent state of a user, every change is also
+// kept as a ConsentRecord.
+type Consents struct {
+	Terms     *AcceptedDocument                      `json:"terms"`
+	Privacy   *AcceptedDocument                      `json:"privacy"`
+	Marketing map[MarketingChannel]*MarketingConsent `json:"marketing"`
+}
+
+type ConsentKind string
+
+const (
+	ConsentTerms     ConsentKind = "terms"
+	ConsentPrivacy   ConsentKind = "privacy"
+	ConsentMarketing ConsentKind = "marketing"
+)
+
+type ConsentSource string
+
+const (
+	ConsentSourceSignup   ConsentSource = "signup"
+	ConsentSourceLogin    ConsentSource = "login"
+	ConsentSourceSettings ConsentSource = "settings"
+)
+
+// ConsentRecord is an append only proof that a user gave or withdrew a
+// consent, with where the request came from.
+type ConsentRecord struct {
+	ID        primitive.ObjectID `bson:"id"`
+	ConsentId string             `json:"consentId"`
+	UserId    string             `json:"userId"`
+	Kind      ConsentKind        `json:"kind"`
+	// Version is set for terms and privacy consents
+	Version string `json:"version,omitempty"`
+	// Channel is set for marketing consents
+	Channel    MarketingChannel `json:"channel,omitempty"`
+	Granted    bool             `json:"granted"`
+	Source     ConsentSource    `json:"source"`
+	IPAddress  string           `json:"ipAddress"`
+	UserAgent  string           `json:"userAgent"`
+	RecordedAt time.Time        `json:"recordedAt"`
+}
+
+type ConsentRecordList struct {
+	Data  []*ConsentRecord `json:"data"`
+	Count int64            `json:"count"`
+}
+
+// ConsentRequest carries the consents given in a request, the client
+// metadata is filled by the routes and kept with the records.
+type ConsentRequest struct {
+	TermsVersion   string                    `json:"termsVersion"`
+	PrivacyVersion string                    `json:"privacyVersion"`
+	Marketing      map[MarketingChannel]bool `json:"marketing"`
+	IPAddress      string                    `json:"-"`
+	UserAgent      string                    `json:"-"`
+}
+
+func (r ConsentRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Marketing, validation.By(func(value interface{}) error {
+			for channel := range r.Marketing {
+				if !channel.IsValid() {
+					return validation.NewError("validation_marketing_channel", "channel must be email, sms or push")
+				}
+			}
+			return nil
+		})),
+	)
+}
+
+type AcceptTermsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	ConsentRequest
+}
+
+type CurrentLegalDocuments struct {
+	Terms   *LegalDocument `json:"terms"`
+	Privacy *LegalDocument `json:"privacy"`
+}
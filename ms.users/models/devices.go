@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Location struct {
+	Iso2      string  `json:"iso2"`
+	City      string  `json:"city"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// ClientInfo describes where a request comes from.
+type ClientInfo struct {
+	IPAddress string `json:"ipAddress"`
+	UserAgent string `json:"userAgent"`
+}
+
+// Device is a browser or app a user logged in from, identified by a
+// fingerprint of its user agent and network.
+type Device struct {
+	ID          primitive.ObjectID `bson:"id"`
+	DeviceId    string             `json:"deviceId"`
+	UserId      string             `json:"userId"`
+	Fingerprint string             `json:"-"`
+	UserAgent   string             `json:"userAgent"`
+	IPAddress   string             `json:"ipAddress"`
+	Location    *Location          `json:"location"`
+	FirstSeenAt time.Time          `json:"firstSeenAt"`
+	LastSeenAt  time.Time          `json:"lastSeenAt"`
+}
+
+type DeviceList struct {
+	Data  []*Device `json:"data"`
+	Count int64     `json:"count"`
+}
+
+type LoginAnomaly string
+
+const (
+	AnomalyNewDevice        LoginAnomaly = "new_device"
+	AnomalyImpossibleTravel LoginAnomaly = "impossible_travel"
+)
+
+// LoginChallenge is a pending login that must be confirmed with a code sent
+// to the user before a session is created.
+type LoginChallenge struct {
+	ID          primitive.ObjectID `bson:"id"`
+	ChallengeId string             `json:"challengeId"`
+	UserId      string             `json:"userId"`
+	// CodeHash is the sha256 of the code sent to the user
+	CodeHash  string         `json:"-"`
+	Client    ClientInfo     `json:"-"`
+	Anomalies []LoginAnomaly `json:"anomalies"`
+	Attempts  int            `json:"-"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+type VerifyLoginRequest struct {
+	ChallengeId string `json:"challengeId"`
+	Code        string `json:"code"`
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventType string
+
+const (
+	EventUserCreated       EventType = "user.created"
+	EventUserUpdated       EventType = "user.updated"
+	EventUserDeactivated   EventType = "user.deactivated"
+	EventUserDeleted       EventType = "user.deleted"
+	EventUserPasswordReset EventType = "user.password_reset"
+)
+
+func (e EventType) String() string {
+	return string(e)
+}
+
+// EventUser is the snapshot of a user carried by events, it never contains
+// credentials.
+type EventUser struct {
+	UserId     string `json:"userId"`
+	Email      string `json:"email"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	Phone      string `json:"phone"`
+	Country    string `json:"country"`
+	UserType   string `json:"userType"`
+	PictureURL string `json:"pictureURL"`
+	Status     Status `json:"status"`
+}
+
+type Event struct {
+	EventId    string     `json:"eventId"`
+	Type       EventType  `json:"type"`
+	UserId     string     `json:"userId"`
+	User       *EventUser `json:"user"`
+	OccurredAt time.Time  `json:"occurredAt"`
+}
+
+func NewUserEvent(eventType EventType, user *User) Event {
+	event := Event{
+		EventId:    primitive.NewObjectID().Hex(),
+		Type:       eventType,
+		UserId:     user.UserId,
+		OccurredAt: time.Now(),
+	}
+
+	if eventType != EventUserDeleted {
+		event.User = &EventUser{
+			UserId:     user.UserId,
+			Email:      user.Email,
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			Phone:      user.Phone,
+			Country:    user.Country,
+			UserType:   user.UserType,
+			PictureURL: user.PictureURL,
+			Status:     user.Status,
+		}
+	}
+
+	return event
+}
+
+type OutboxStatus string
+
+const (
+	OutboxPending   OutboxStatus = "pending"
+	OutboxDelivered OutboxStatus = "delivered"
+)
+
+// OutboxMessage is an event waiting in the outbox collection to be relayed
+// to the broker.
+type OutboxMessage struct {
+	ID          primitive.ObjectID `bson:"id"`
+	Event       Event              `json:"event"`
+	Status      OutboxStatus       `json:"status"`
+	Attempts    int                `json:"attempts"`
+	LastError   string             `json:"lastError"`
+	LockedUntil time.Time          `json:"lockedUntil"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	DeliveredAt *time.Time         `json:"deliveredAt"`
+}
+
+type UpdateUserRequest struct {
+	FirstName *string `json:"firstName"`
+	LastName  *string `json:"lastName"`
+	Phone     *string `json:"phone"`
+	Iso2      *string `json:"iso2"`
+	Country   *string `json:"country"`
+}
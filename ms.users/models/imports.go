@@ -0,0 +1,103 @@
+package models
+
+import "time"
+
+type FileFormat string
+
+const (
+	FormatCSV   FileFormat = "csv"
+	FormatJSONL FileFormat = "jsonl"
+)
+
+func (f FileFormat) IsValid() bool {
+	switch f {
+	case FormatCSV, FormatJSONL:
+		return true
+	default:
+		return false
+	}
+}
+
+// ImportUserRecord is one row of a bulk import file. Rows carry either a
+// plain Password or a bcrypt PasswordHash migrated from the legacy system.
+type ImportUserRecord struct {
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	Iso2         string `json:"iso2"`
+	Country      string `json:"country"`
+	UserType     string `json:"userType"`
+	Password     string `json:"password"`
+	PasswordHash string `json:"passwordHash"`
+	Status       Status `json:"status"`
+}
+
+type ImportOptions struct {
+	Format FileFormat
+	// DryRun validates every row without inserting any user
+	DryRun    bool
+	BatchSize int
+}
+
+type ImportRowError struct {
+	// Row is the 1-based position of the record in the file, headers excluded
+	Row   int    `json:"row"`
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+type ImportReport struct {
+	DryRun   bool             `json:"dryRun"`
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// Fail records that row was rejected because of err.
+func (r *ImportReport) Fail(row int, email string, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, ImportRowError{
+		Row:   row,
+		Email: email,
+		Error: err.Error(),
+	})
+}
+
+type ExportUserFilter struct {
+	Status      *Status
+	Iso2        *string
+	UserType    *string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// ExportUser is the shape of an exported user, it never contains credentials.
+type ExportUser struct {
+	UserId    string    `json:"userId"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Iso2      string    `json:"iso2"`
+	Country   string    `json:"country"`
+	UserType  string    `json:"userType"`
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (u User) Export() *ExportUser {
+	return &ExportUser{
+		UserId:    u.UserId,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		Phone:     u.Phone,
+		Iso2:      u.Iso2,
+		Country:   u.Country,
+		UserType:  u.UserType,
+		Status:    u.Status,
+		CreatedAt: u.CreatedAt,
+	}
+}
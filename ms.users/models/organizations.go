@@ -0,0 +1,125 @@
+package models
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Organization struct {
+	ID             primitive.ObjectID `bson:"id"`
+	OrganizationId string             `json:"organizationId"`
+	Name           string             `json:"name"`
+	OwnerId        string             `json:"ownerId"`
+	CreatedAt      time.Time          `json:"createdAt"`
+	UpdatedAt      time.Time          `json:"updatedAt"`
+}
+
+func (o Organization) Validate() error {
+	return validation.ValidateStruct(&o,
+		validation.Field(&o.Name, validation.Required, validation.Length(2, 100)),
+	)
+}
+
+type OrganizationRole string
+
+const (
+	OrganizationRoleOwner  OrganizationRole = "owner"
+	OrganizationRoleAdmin  OrganizationRole = "admin"
+	OrganizationRoleMember OrganizationRole = "member"
+)
+
+func (r OrganizationRole) IsValid() bool {
+	switch r {
+	case OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanManageMembers reports whether the role can invite, remove and change
+// the role of other members.
+func (r OrganizationRole) CanManageMembers() bool {
+	return r == OrganizationRoleOwner || r == OrganizationRoleAdmin
+}
+
+func (r OrganizationRole) String() string {
+	return string(r)
+}
+
+type Membership struct {
+	ID             primitive.ObjectID `bson:"id"`
+	OrganizationId string             `json:"organizationId"`
+	UserId         string             `json:"userId"`
+	Role           OrganizationRole   `json:"role"`
+	CreatedAt      time.Time          `json:"createdAt"`
+	UpdatedAt      time.Time          `json:"updatedAt"`
+}
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationDeclined InvitationStatus = "declined"
+)
+
+func (s InvitationStatus) String() string {
+	return string(s)
+}
+
+type Invitation struct {
+	ID             primitive.ObjectID `bson:"id"`
+	InvitationId   string             `json:"invitationId"`
+	OrganizationId string             `json:"organizationId"`
+	Email          string             `json:"email"`
+	Role           OrganizationRole   `json:"role"`
+	Token          string             `json:"-"`
+	InvitedBy      string             `json:"invitedBy"`
+	Status         InvitationStatus   `json:"status"`
+	ExpiresAt      time.Time          `json:"expiresAt"`
+	RespondedAt    *time.Time         `json:"respondedAt"`
+	CreatedAt      time.Time          `json:"createdAt"`
+}
+
+func (i Invitation) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
+
+type OrganizationList struct {
+	Data  []*Organization `json:"data"`
+	Count int64           `json:"count"`
+}
+
+type MembershipList struct {
+	Data  []*Membership `json:"data"`
+	Count int64         `json:"count"`
+}
+
+type InvitationList struct {
+	Data  []*Invitation `json:"data"`
+	Count int64         `json:"count"`
+}
+
+type InviteMemberRequest struct {
+	Email string           `json:"email"`
+	Role  OrganizationRole `json:"role"`
+}
+
+func (i InviteMemberRequest) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.Email, validation.Required, is.Email),
+		validation.Field(&i.Role, validation.Required, validation.In(OrganizationRoleAdmin, OrganizationRoleMember)),
+	)
+}
+
+type UpdateMemberRoleRequest struct {
+	Role OrganizationRole `json:"role"`
+}
+
+type TransferOwnershipRequest struct {
+	UserId string `json:"userId"`
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SignupMode string
+
+const (
+	SignupModeOpen       SignupMode = "open"
+	SignupModeInviteOnly SignupMode = "invite_only"
+)
+
+func (m SignupMode) IsValid() bool {
+	switch m {
+	case SignupModeOpen, SignupModeInviteOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// SignupPolicy decides who can create an account through users/signup.
+// Domains match the domain of the email and its subdomains, the deny list
+// wins over the allow list, and an empty allow list allows every domain.
+type SignupPolicy struct {
+	Mode           SignupMode
+	AllowedDomains []string
+	DeniedDomains  []string
+}
+
+// RequiresEmail reports whether users must give an email so that its domain
+// can be checked.
+func (p SignupPolicy) RequiresEmail() bool {
+	return len(p.AllowedDomains) > 0 || len(p.DeniedDomains) > 0
+}
+
+func (p SignupPolicy) AllowsEmail(email string) bool {
+	_, domain, found := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if !found {
+		return !p.RequiresEmail()
+	}
+
+	for _, denied := range p.DeniedDomains {
+		if matchDomain(domain, denied) {
+			return false
+		}
+	}
+
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+
+	for _, allowed := range p.AllowedDomains {
+		if matchDomain(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchDomain(domain, pattern string) bool {
+	pattern = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(pattern)), "@")
+	return domain == pattern || strings.HasSuffix(domain, "."+pattern)
+}
+
+// SignupInvite is a code that lets people sign up while signup is invite
+// only. It is distinct from organization invitations.
+type SignupInvite struct {
+	ID       primitive.ObjectID `bson:"id"`
+	InviteId string             `json:"inviteId"`
+	Code     string             `json:"code"`
+	// Email restricts the invite to one address when set
+	Email string `json:"email"`
+	// MaxUses is the number of signups the invite allows, 0 means unlimited
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	Note      string     `json:"note"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type CreateSignupInviteRequest struct {
+	Email     string     `json:"email"`
+	MaxUses   int        `json:"maxUses"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Note      string     `json:"note"`
+}
+
+func (r CreateSignupInviteRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Email, is.Email),
+		validation.Field(&r.MaxUses, validation.Min(0)),
+		validation.Field(&r.ExpiresAt, validation.By(func(value interface{}) error {
+			if expiresAt, _ := value.(*time.Time); expiresAt != nil && !expiresAt.After(time.Now()) {
+				return validation.NewError("validation_expires_at_past", "must be in the future")
+			}
+			return nil
+		})),
+		validation.Field(&r.Note, validation.Length(0, 200)),
+	)
+}
+
+type SignupInviteList struct {
+	Data  []*SignupInvite `json:"data"`
+	Count int64           `json:"count"`
+}
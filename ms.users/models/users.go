@@ -26,6 +26,26 @@ type User struct {
 	UpdatedAt          time.Time          `json:"updatedAt"`
 	UserId             string             `json:"userId"`
 	Status             Status             `json:"status"`
+	// ActiveOrganizationId is the organization carried by the user's tokens
+	ActiveOrganizationId string `json:"activeOrganizationId"`
+	// Avatar is the uploaded picture, PictureURL points to a generated
+	// initials avatar when it is nil
+	Avatar *Avatar `json:"avatar"`
+	// InviteCode is only read on signup when signup is invite only
+	InviteCode string `json:"inviteCode,omitempty" bson:"-"`
+	Consents   Consents `json:"consents"`
+	// Consent is only read on signup, it holds the consents given with it
+	Consent *ConsentRequest `json:"consent,omitempty" bson:"-"`
+}
+
+// Avatar is an uploaded picture stored in every size of avatars.Sizes.
+type Avatar struct {
+	// Prefix is the blob key under which every size is stored
+	Prefix string `json:"-"`
+	// Sizes maps each size name to its public URL
+	Sizes       map[string]string `json:"sizes"`
+	ContentType string            `json:"contentType"`
+	UploadedAt  time.Time         `json:"uploadedAt"`
 }
 
 type Status string
@@ -97,3 +117,33 @@ type ConfirmPasswordRequest struct {
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirmPassword"`
 }
+
+// PublicUser holds the profile fields of a user that can be shared with
+// other services.
+type PublicUser struct {
+	UserId     string `json:"userId"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	PictureURL string `json:"pictureURL"`
+	Status     Status `json:"status"`
+}
+
+func (u User) Public() *PublicUser {
+	return &PublicUser{
+		UserId:     u.UserId,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		PictureURL: u.PictureURL,
+		Status:     u.Status,
+	}
+}
+
+type UserLookupRequest struct {
+	Ids []string `json:"ids"`
+}
+
+type UserLookupResponse struct {
+	Data []*PublicUser `json:"data"`
+	// Missing lists the requested ids that do not match any user
+	Missing []string `json:"missing"`
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Webhook struct {
+	ID          primitive.ObjectID `bson:"id"`
+	WebhookId   string             `json:"webhookId"`
+	URL         string             `json:"url"`
+	Description string             `json:"description"`
+	// Events the endpoint is subscribed to, every event is sent when empty
+	Events    []EventType `json:"events"`
+	Secret    string      `json:"secret,omitempty"`
+	Active    bool        `json:"active"`
+	CreatedBy string      `json:"createdBy"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+func (w Webhook) Validate() error {
+	return validation.ValidateStruct(&w,
+		validation.Field(&w.URL, validation.Required, is.URL),
+		validation.Field(&w.Events, validation.Each(validation.In(
+			EventUserCreated, EventUserUpdated, EventUserDeactivated, EventUserDeleted, EventUserPasswordReset,
+		))),
+	)
+}
+
+// Subscribed reports whether the webhook should receive events of eventType.
+func (w Webhook) Subscribed(eventType EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type UpdateWebhookRequest struct {
+	URL         *string      `json:"url"`
+	Description *string      `json:"description"`
+	Events      *[]EventType `json:"events"`
+	Active      *bool        `json:"active"`
+}
+
+type WebhookList struct {
+	Data  []*Webhook `json:"data"`
+	Count int64      `json:"count"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryDead deliveries exhausted their retries and were moved to the
+	// dead letter store
+	DeliveryDead DeliveryStatus = "dead"
+	// DeliveryCancelled deliveries were dropped because their webhook was
+	// deleted
+	DeliveryCancelled DeliveryStatus = "cancelled"
+)
+
+func (s DeliveryStatus) IsValid() bool {
+	switch s {
+	case DeliveryPending, DeliverySucceeded, DeliveryDead, DeliveryCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+type DeliveryAttempt struct {
+	AttemptedAt time.Time     `json:"attemptedAt"`
+	StatusCode  int           `json:"statusCode"`
+	Error       string        `json:"error"`
+	Duration    time.Duration `json:"duration"`
+}
+
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `bson:"id"`
+	DeliveryId    string             `json:"deliveryId"`
+	WebhookId     string             `json:"webhookId"`
+	Event         Event              `json:"event"`
+	Status        DeliveryStatus     `json:"status"`
+	AttemptCount  int                `json:"attemptCount"`
+	Attempts      []DeliveryAttempt  `json:"attempts"`
+	NextAttemptAt time.Time          `json:"nextAttemptAt"`
+	// ReplayOf is the id of the delivery this one replays
+	ReplayOf    string     `json:"replayOf,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	DeliveredAt *time.Time `json:"deliveredAt"`
+}
+
+type WebhookDeliveryList struct {
+	Data  []*WebhookDelivery `json:"data"`
+	Count int64              `json:"count"`
+}
+
+type WebhookDeliveryFilter struct {
+	WebhookId string
+	Status    *DeliveryStatus
+	Limit     int64
+}
@@ -0,0 +1,71 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Notification struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// LogNotifier writes notifications to the logs instead of delivering them,
+// it is used when no mail server is configured.
+type LogNotifier struct {
+	logger *logrus.Logger
+}
+
+func NewLogNotifier(logger *logrus.Logger) *LogNotifier {
+	return &LogNotifier{
+		logger: logger,
+	}
+}
+
+func (l *LogNotifier) Notify(ctx context.Context, notification Notification) error {
+	l.logger.WithFields(logrus.Fields{
+		"to":      notification.To,
+		"subject": notification.Subject,
+	}).Info(notification.Body)
+	return nil
+}
+
+type SMTPNotifier struct {
+	address string
+	from    string
+	auth    smtp.Auth
+}
+
+func NewSMTPNotifier(host, port, username, password, from string) *SMTPNotifier {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPNotifier{
+		address: fmt.Sprintf("%s:%s", host, port),
+		from:    from,
+		auth:    auth,
+	}
+}
+
+func (s *SMTPNotifier) Notify(ctx context.Context, notification Notification) error {
+	message := strings.Join([]string{
+		fmt.Sprintf("From: %s", s.from),
+		fmt.Sprintf("To: %s", notification.To),
+		fmt.Sprintf("Subject: %s", notification.Subject),
+		"",
+		notification.Body,
+	}, "\r\n")
+
+	return smtp.SendMail(s.address, s.auth, s.from, []string{notification.To}, []byte(message))
+}
@@ -0,0 +1,150 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/core"
+	"github.com/fredele20/microservice-practice/ms.users/helpers"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/gin-gonic/gin"
+)
+
+// termsAcceptanceRequired answers a login or signup that needs the current
+// legal documents to be accepted first, with the documents to show.
+func (u UserRoutes) termsAcceptanceRequired(c *gin.Context, ctx context.Context, err error) {
+	documents, docErr := u.core.CurrentLegalDocuments(ctx)
+	if docErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": docErr.Error()})
+		return
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":     err.Error(),
+		"code":      core.TermsAcceptanceRequiredCode,
+		"documents": documents,
+	})
+}
+
+// AcceptTerms completes a login held until the terms are accepted, the
+// client then merges its anonymous cart as after Login.
+func (u UserRoutes) AcceptTerms() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.AcceptTermsRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		payload.IPAddress = c.ClientIP()
+		payload.UserAgent = c.Request.UserAgent()
+
+		user, err := u.core.AcceptTerms(ctx, payload)
+		if err != nil {
+			var stepUp *core.StepUpError
+			if errors.As(err, &stepUp) {
+				stepUpRequired(c, stepUp)
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func (u UserRoutes) CurrentLegalDocuments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		documents, err := u.core.CurrentLegalDocuments(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, documents)
+	}
+}
+
+func (u UserRoutes) PublishLegalDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		var document models.LegalDocument
+		if err := c.BindJSON(&document); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		published, err := u.core.PublishLegalDocument(ctx, c.GetString("uid"), document)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, published)
+	}
+}
+
+func (u UserRoutes) ListConsents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		records, err := u.core.ListConsents(ctx, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, records)
+	}
+}
+
+func (u UserRoutes) UpdateMarketingConsents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if c.GetString("uid") != userId {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "consents can only be changed by the user themselves"})
+			return
+		}
+
+		var payload models.ConsentRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		payload.IPAddress = c.ClientIP()
+		payload.UserAgent = c.Request.UserAgent()
+
+		user, err := u.core.UpdateMarketingConsents(ctx, userId, payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/core"
+	"github.com/fredele20/microservice-practice/ms.users/helpers"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/gin-gonic/gin"
+)
+
+// stepUpRequired answers a login that must be confirmed with the code sent
+// to the user.
+func stepUpRequired(c *gin.Context, err *core.StepUpError) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":       err.Error(),
+		"code":        core.StepUpRequiredCode,
+		"challengeId": err.Challenge.ChallengeId,
+		"anomalies":   err.Challenge.Anomalies,
+		"expiresAt":   err.Challenge.ExpiresAt,
+	})
+}
+
+// VerifyLogin completes a login held for confirmation, the client then
+// merges its anonymous cart as after Login.
+func (u UserRoutes) VerifyLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.VerifyLoginRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := u.core.VerifyLogin(ctx, payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func (u UserRoutes) ListDevices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		devices, err := u.core.ListDevices(ctx, userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, devices)
+	}
+}
+
+func (u UserRoutes) ForgetDevice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := u.core.ForgetDevice(ctx, userId, c.Param("device_id")); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": "device removed"})
+	}
+}
@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/helpers"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ImportUsers accepts the file either as the "file" field of a multipart
+// form or as the raw request body.
+func (u UserRoutes) ImportUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Minute*30)
+		defer cancel()
+
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+		batchSize, _ := strconv.Atoi(c.Query("batchSize"))
+		options := models.ImportOptions{
+			Format:    models.FileFormat(c.DefaultQuery("format", string(models.FormatCSV))),
+			DryRun:    dryRun,
+			BatchSize: batchSize,
+		}
+
+		var body io.Reader = c.Request.Body
+		if file, err := c.FormFile("file"); err == nil {
+			opened, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			defer opened.Close()
+			body = opened
+		}
+
+		report, err := u.core.ImportUsers(ctx, body, options)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "report": report})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// ExportUsers streams the users matching the query filters, the response
+// is written as users are read so it has no size limit.
+func (u UserRoutes) ExportUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		format := models.FileFormat(c.DefaultQuery("format", string(models.FormatCSV)))
+		if !format.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file format, you must provide csv or jsonl"})
+			return
+		}
+
+		var filter models.ExportUserFilter
+		if status := c.Query("status"); status != "" {
+			s := models.Status(status)
+			if !s.IsValid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status, you must provide activated or deactivated"})
+				return
+			}
+			filter.Status = &s
+		}
+		if iso2 := c.Query("iso2"); iso2 != "" {
+			filter.Iso2 = &iso2
+		}
+		if userType := c.Query("userType"); userType != "" {
+			filter.UserType = &userType
+		}
+		for name, target := range map[string]**time.Time{"createdFrom": &filter.CreatedFrom, "createdTo": &filter.CreatedTo} {
+			value := c.Query(name)
+			if value == "" {
+				continue
+			}
+			date, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC3339 date", name)})
+				return
+			}
+			*target = &date
+		}
+
+		contentType := "text/csv"
+		if format == models.FormatJSONL {
+			contentType = "application/x-ndjson"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=users-%s.%s", time.Now().Format("20060102-150405"), format))
+		c.Status(http.StatusOK)
+
+		// headers are already sent once the first user is written, a failure
+		// can only be reported by cutting the stream short
+		if err := u.core.ExportUsers(ctx, format, filter, c.Writer); err != nil {
+			c.Error(err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (u UserRoutes) CreateOrganization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var organization models.Organization
+		if err := c.BindJSON(&organization); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		newOrganization, err := u.core.CreateOrganization(ctx, c.GetString("uid"), organization)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, newOrganization)
+	}
+}
+
+func (u UserRoutes) ListOrganizations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		organizations, err := u.core.ListOrganizations(ctx, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, organizations)
+	}
+}
+
+func (u UserRoutes) GetOrganization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		organization, err := u.core.GetOrganization(ctx, c.GetString("uid"), c.Param("org_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, organization)
+	}
+}
+
+func (u UserRoutes) ListOrganizationMembers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		members, err := u.core.ListMembers(ctx, c.GetString("uid"), c.Param("org_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, members)
+	}
+}
+
+func (u UserRoutes) UpdateOrganizationMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.UpdateMemberRoleRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		member, err := u.core.UpdateMemberRole(ctx, c.GetString("uid"), c.Param("org_id"), c.Param("user_id"), payload.Role)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, member)
+	}
+}
+
+func (u UserRoutes) RemoveOrganizationMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := u.core.RemoveMember(ctx, c.GetString("uid"), c.Param("org_id"), c.Param("user_id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": "member removed from organization"})
+	}
+}
+
+func (u UserRoutes) InviteOrganizationMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.InviteMemberRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		invitation, err := u.core.InviteMember(ctx, c.GetString("uid"), c.Param("org_id"), payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, invitation)
+	}
+}
+
+func (u UserRoutes) ListOrganizationInvitations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		invitations, err := u.core.ListInvitations(ctx, c.GetString("uid"), c.Param("org_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+func (u UserRoutes) TransferOrganizationOwnership() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.TransferOwnershipRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		organization, err := u.core.TransferOwnership(ctx, c.GetString("uid"), c.Param("org_id"), payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, organization)
+	}
+}
+
+func (u UserRoutes) SwitchOrganization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		user, err := u.core.SwitchOrganization(ctx, c.GetString("uid"), c.Param("org_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func (u UserRoutes) ListMyInvitations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		invitations, err := u.core.ListMyInvitations(ctx, c.GetString("email"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+func (u UserRoutes) AcceptInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		membership, err := u.core.AcceptInvitation(ctx, c.GetString("uid"), c.GetString("email"), c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, membership)
+	}
+}
+
+func (u UserRoutes) DeclineInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		invitation, err := u.core.DeclineInvitation(ctx, c.GetString("email"), c.Param("token"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, invitation)
+	}
+}
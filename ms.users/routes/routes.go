@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/fredele20/microservice-practice/ms.users/avatars"
 	"github.com/fredele20/microservice-practice/ms.users/core"
+	"github.com/fredele20/microservice-practice/ms.users/helpers"
+	"github.com/fredele20/microservice-practice/ms.users/libs/imaging"
 	"github.com/fredele20/microservice-practice/ms.users/models"
 	"github.com/gin-gonic/gin"
 	"github.com/nyaruka/phonenumbers"
@@ -64,8 +69,17 @@ func (u *UserRoutes) Signup() gin.HandlerFunc {
 			return
 		}
 
+		if user.Consent != nil {
+			user.Consent.IPAddress = c.ClientIP()
+			user.Consent.UserAgent = c.Request.UserAgent()
+		}
+
 		newUser, err := u.core.CreateUser(ctx, user)
 		if err != nil {
+			if errors.Is(err, core.ErrTermsAcceptanceRequired) {
+				u.termsAcceptanceRequired(c, ctx, err)
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -75,6 +89,12 @@ func (u *UserRoutes) Signup() gin.HandlerFunc {
 	}
 }
 
+// Login returns the signed in user with their token. Visitors can fill a
+// cart in ms.products before signing in, ms.users does not know about it:
+// a client holding an anonymous cart, the X-Cart-Id header of ms.products,
+// must send it to POST /cart/merge of ms.products with the new token once
+// signed in, whether here, through users/login/verify or through
+// users/accept-terms. Sending the merge again does nothing.
 func (u *UserRoutes) Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -87,8 +107,20 @@ func (u *UserRoutes) Login() gin.HandlerFunc {
 			return
 		}
 
-		foundUser, err := u.core.Login(ctx, user.Email, user.Password)
+		foundUser, err := u.core.Login(ctx, user.Email, user.Password, models.ClientInfo{
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
 		if err != nil {
+			if errors.Is(err, core.ErrTermsAcceptanceRequired) {
+				u.termsAcceptanceRequired(c, ctx, err)
+				return
+			}
+			var stepUp *core.StepUpError
+			if errors.As(err, &stepUp) {
+				stepUpRequired(c, stepUp)
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
@@ -102,9 +134,7 @@ func (u *UserRoutes) Logout() gin.HandlerFunc {
 		var context, cancel = context.WithTimeout(context.Background(), time.Second * 30)
 		fmt.Println(context)
 		defer cancel()
-		// Get the token from the request header
-		// token := ctx.GetHeader("token")
-		err := u.core.Logout("token")
+		err := u.core.Logout(context, ctx.GetHeader("token"))
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -146,9 +176,8 @@ func (u UserRoutes) ResetPassword() gin.HandlerFunc {
 			return
 		}
 
-		// token := c.GetHeader("token")
-
-		reset, err := u.core.ResetPassword(ctx, user.Password, user.ConfirmPassword)
+		// the reset token is the one sent by email by ForgotPassword
+		reset, err := u.core.ResetPassword(ctx, c.GetHeader("token"), user.Password, user.ConfirmPassword)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -180,6 +209,171 @@ func (u UserRoutes) ListUsers() gin.HandlerFunc {
 	}
 }
 
+func (u UserRoutes) UpdateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		var payload models.UpdateUserRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := u.core.UpdateUser(ctx, userId, payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func (u UserRoutes) DeactivateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := u.core.DeactivateUser(ctx, c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func (u UserRoutes) ActivateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := u.core.ActivateUser(ctx, c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func (u UserRoutes) DeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := u.core.DeleteUser(ctx, c.Param("user_id")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": "user deleted"})
+	}
+}
+
+func (u UserRoutes) LookupUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		var payload models.UserLookupRequest
+		if err := c.BindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		users, err := u.core.LookupUsers(ctx, payload.Ids)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, users)
+	}
+}
+
+func (u UserRoutes) StartImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// An impersonation session can not be used to start another one.
+		if c.GetString("actor") != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": core.ErrImpersonationNotAllowed.Error()})
+			return
+		}
+
+		var payload models.ImpersonationRequest
+		if err := c.ShouldBindJSON(&payload); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		impersonation, err := u.core.StartImpersonation(ctx, c.GetString("uid"), c.Param("user_id"), payload)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, impersonation)
+	}
+}
+
+func (u UserRoutes) EndImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		// The session can be ended with the impersonation token itself, or
+		// by the admin passing the impersonation token in the body.
+		actorId, token := c.GetString("actor"), c.GetHeader("token")
+		if actorId == "" {
+			var payload models.EndImpersonationRequest
+			if err := c.BindJSON(&payload); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			actorId, token = c.GetString("uid"), payload.Token
+		}
+
+		if err := u.core.EndImpersonation(ctx, actorId, token); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": "impersonation session ended"})
+	}
+}
+
 // func GetUsers() gin.HandlerFunc {
 // 	return func(c *gin.Context) {
 // 		if err := helpers.CheckUserType(c, "ADMIN"); err != nil {
@@ -283,3 +477,111 @@ func (u UserRoutes) ListUsers() gin.HandlerFunc {
 // 		c.JSON(http.StatusOK, user)
 // 	}
 // }
+
+func (u UserRoutes) UploadAvatar() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the image itself is limited by the core, this only stops
+		// oversized requests before they are buffered
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, imaging.DefaultLimits.MaxBytes+1<<20)
+
+		file, err := c.FormFile("avatar")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an image is required in the avatar field, of at most 5MB"})
+			return
+		}
+
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer opened.Close()
+
+		user, err := u.core.UploadAvatar(ctx, userId, opened)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func (u UserRoutes) RemoveAvatar() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		userId := c.Param("user_id")
+		if err := helpers.MatchUserTypeToUid(c, userId); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := u.core.RemoveAvatar(ctx, userId)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// AvatarFile serves the uploaded avatars kept in the local blob store.
+func (u UserRoutes) AvatarFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, contentType, err := u.core.OpenAvatarFile(c.Request.Context(), c.Param("key"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		defer file.Close()
+
+		// every upload is stored under a new key, so files never change
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.DataFromReader(http.StatusOK, -1, contentType, file, nil)
+	}
+}
+
+func (u UserRoutes) InitialsAvatar() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(http.StatusOK, "image/svg+xml", avatars.InitialsSVG(c.Query("name"), initialsSize(c)))
+	}
+}
+
+func (u UserRoutes) InitialsAvatarPNG() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := avatars.InitialsPNG(c.Query("name"), initialsSize(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(http.StatusOK, "image/png", data)
+	}
+}
+
+// initialsSize returns the size query parameter of an initials avatar,
+// defaulting to 128 pixels.
+func initialsSize(c *gin.Context) int {
+	size, err := strconv.Atoi(c.DefaultQuery("size", "128"))
+	if err != nil || size < 16 || size > 1024 {
+		return 128
+	}
+	return size
+}
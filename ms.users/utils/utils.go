@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 
@@ -26,3 +28,12 @@ func VerifyPassword(hashedPassword, providedPassword string) (bool, string) {
 
 	return check, msg
 }
+
+// RandomToken returns a hex encoded random string built from n random bytes.
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,236 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/db"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+
+	// MaxAttempts is the number of attempts after which a delivery is moved
+	// to the dead letter store
+	MaxAttempts = 8
+)
+
+// Sign computes the signature sent in the X-Webhook-Signature header. The
+// receiver recomputes it with its copy of the secret over the timestamp
+// header and the raw body, and rejects stale timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the delay before the next attempt, doubling from 30
+// seconds after each failed attempt up to 6 hours.
+func Backoff(attempts int) time.Duration {
+	delay := time.Second * 30
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= time.Hour*6 {
+			return time.Hour * 6
+		}
+	}
+	return delay
+}
+
+// NewDelivery creates a pending delivery of event to webhook.
+func NewDelivery(webhookId string, event models.Event) *models.WebhookDelivery {
+	now := time.Now()
+	id := primitive.NewObjectID()
+	return &models.WebhookDelivery{
+		ID:            id,
+		DeliveryId:    id.Hex(),
+		WebhookId:     webhookId,
+		Event:         event,
+		Status:        models.DeliveryPending,
+		Attempts:      []models.DeliveryAttempt{},
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+// Dispatcher is an events.Broker that fans events out into one delivery per
+// subscribed webhook, the deliveries are then sent by the Worker.
+type Dispatcher struct {
+	store db.WebhookStore
+}
+
+func NewDispatcher(store db.WebhookStore) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+	}
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event models.Event) error {
+	webhooks, err := d.store.ListActiveWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []*models.WebhookDelivery
+	for _, webhook := range webhooks {
+		if webhook.Subscribed(event.Type) {
+			deliveries = append(deliveries, NewDelivery(webhook.WebhookId, event))
+		}
+	}
+
+	return d.store.CreateWebhookDeliveries(ctx, deliveries...)
+}
+
+// Worker sends due deliveries, retries failures with exponential backoff
+// and moves deliveries that keep failing to the dead letter store.
+type Worker struct {
+	store      db.WebhookStore
+	httpClient *http.Client
+	logger     *logrus.Logger
+	interval   time.Duration
+	batchSize  int64
+}
+
+func NewWorker(store db.WebhookStore, logger *logrus.Logger) *Worker {
+	return &Worker{
+		store:      store,
+		httpClient: &http.Client{Timeout: time.Second * 10},
+		logger:     logger,
+		interval:   time.Second * 5,
+		batchSize:  50,
+	}
+}
+
+// Run sends deliveries until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		deliveries, err := w.store.ClaimDueDeliveries(ctx, w.batchSize, time.Minute)
+		if err != nil {
+			w.logger.WithError(err).Error("failed to claim webhook deliveries")
+		}
+
+		for _, delivery := range deliveries {
+			w.Deliver(ctx, delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver makes one attempt at sending delivery and records its outcome.
+func (w *Worker) Deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	logger := w.logger.WithFields(logrus.Fields{
+		"webhookId":  delivery.WebhookId,
+		"deliveryId": delivery.DeliveryId,
+		"event":      delivery.Event.Type.String(),
+	})
+
+	webhook, err := w.store.GetWebhookById(ctx, delivery.WebhookId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// the webhook was deleted, the delivery would be claimed forever
+		attempt := models.DeliveryAttempt{AttemptedAt: time.Now(), Error: "webhook was deleted"}
+		if _, err := w.store.RecordDeliveryAttempt(ctx, delivery.DeliveryId, attempt, models.DeliveryCancelled, attempt.AttemptedAt); err != nil {
+			logger.WithError(err).Error("failed to cancel webhook delivery")
+		}
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Error("failed to get webhook for delivery")
+		return
+	}
+
+	attempt := w.send(ctx, webhook, delivery)
+
+	status := models.DeliveryPending
+	nextAttemptAt := attempt.AttemptedAt.Add(Backoff(delivery.AttemptCount + 1))
+	switch {
+	case attempt.Error == "":
+		status = models.DeliverySucceeded
+	case delivery.AttemptCount+1 >= MaxAttempts:
+		status = models.DeliveryDead
+	}
+
+	updated, err := w.store.RecordDeliveryAttempt(ctx, delivery.DeliveryId, attempt, status, nextAttemptAt)
+	if err != nil {
+		logger.WithError(err).Error("failed to record webhook delivery attempt")
+		return
+	}
+
+	if status == models.DeliveryDead {
+		logger.WithField("error", attempt.Error).Error("webhook delivery moved to dead letter store")
+		if err := w.store.CreateDeadLetter(ctx, updated); err != nil {
+			logger.WithError(err).Error("failed to store dead webhook delivery")
+		}
+	}
+}
+
+func (w *Worker) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) models.DeliveryAttempt {
+	attempt := models.DeliveryAttempt{AttemptedAt: time.Now()}
+
+	if !webhook.Active {
+		attempt.Error = "webhook is disabled"
+		return attempt
+	}
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := attempt.AttemptedAt.Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "ms.users-webhooks/1.0")
+	request.Header.Set(HeaderEvent, delivery.Event.Type.String())
+	request.Header.Set(HeaderDelivery, delivery.DeliveryId)
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	response, err := w.httpClient.Do(request)
+	attempt.Duration = time.Since(attempt.AttemptedAt)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status code %d", response.StatusCode)
+	}
+
+	return attempt
+}
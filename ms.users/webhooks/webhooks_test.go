@@ -0,0 +1,42 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fredele20/microservice-practice/ms.users/db"
+	"github.com/fredele20/microservice-practice/ms.users/models"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// deletedWebhookStore has no webhooks and records the attempts of the
+// deliveries, the other store methods are not used by these tests.
+type deletedWebhookStore struct {
+	db.WebhookStore
+	statuses map[string]models.DeliveryStatus
+}
+
+func (s *deletedWebhookStore) GetWebhookById(ctx context.Context, id string) (*models.Webhook, error) {
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *deletedWebhookStore) RecordDeliveryAttempt(ctx context.Context, id string, attempt models.DeliveryAttempt, status models.DeliveryStatus, nextAttemptAt time.Time) (*models.WebhookDelivery, error) {
+	s.statuses[id] = status
+	return &models.WebhookDelivery{DeliveryId: id, Status: status}, nil
+}
+
+func TestDeliverToDeletedWebhook(t *testing.T) {
+	store := &deletedWebhookStore{statuses: map[string]models.DeliveryStatus{}}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	delivery := NewDelivery("deleted", models.Event{})
+	NewWorker(store, logger).Deliver(context.Background(), delivery)
+
+	if got := store.statuses[delivery.DeliveryId]; got != models.DeliveryCancelled {
+		t.Errorf("delivery status = %q, want %q", got, models.DeliveryCancelled)
+	}
+}